@@ -73,17 +73,19 @@ type backend struct {
 	// of tidyCooldownPeriod.
 	nextTidyTime time.Time
 
-	// Map to hold the EC2 client objects indexed by region, account ID, and STS role.
+	// Cache of the EC2 client objects indexed by region, account ID, and STS role.
 	// This avoids the overhead of creating a client object for every login request.
 	// When the credentials are modified or deleted, all the cached client objects
-	// will be flushed. The empty STS role signifies the master account
-	EC2ClientsMap map[string]map[string]map[string]*ec2.EC2
+	// will be flushed. When the STS configuration of an account is modified or
+	// deleted, the cached client objects of the account will be flushed.
+	EC2Clients *clientCache[*ec2.EC2]
 
-	// Map to hold the IAM client objects indexed by region, account ID, and STS role.
+	// Cache of the IAM client objects indexed by region, account ID, and STS role.
 	// This avoids the overhead of creating a client object for every login request.
 	// When the credentials are modified or deleted, all the cached client objects
-	// will be flushed. The empty STS role signifies the master account
-	IAMClientsMap map[string]map[string]map[string]*iam.IAM
+	// will be flushed. When the STS configuration of an account is modified or
+	// deleted, the cached client objects of the account will be flushed.
+	IAMClients *clientCache[*iam.IAM]
 
 	// Map to associate a partition to a random region in that partition. Users of
 	// this don't care what region in the partition they use, but there is some client
@@ -95,6 +97,12 @@ type backend struct {
 	// using the IAM auth method when bound_iam_principal_arn contains a wildcard
 	iamUserIdToArnCache *cache.Cache
 
+	// Set of the AWS account IDs recently found to have no STS configuration,
+	// so that repeated requests for them fail without reading the storage.
+	// Entries expire after sts_negative_cache_ttl and are removed when the
+	// STS configuration of the account is written.
+	stsMissCache *cache.Cache
+
 	// AWS Account ID of the "default" AWS credentials
 	// This cache avoids the need to call GetCallerIdentity repeatedly to learn it
 	// We can't store this because, in certain pathological cases, it could change
@@ -107,6 +115,10 @@ type backend struct {
 
 	resolveArnToUniqueIDFunc func(context.Context, logical.Storage, string) (string, error)
 
+	// imdsEndpoint overrides the endpoint of the instance metadata service
+	// used with require_imdsv2. Only set by tests.
+	imdsEndpoint string
+
 	// upgradeCancelFunc is used to cancel the context used in the upgrade
 	// function
 	upgradeCancelFunc context.CancelFunc
@@ -122,9 +134,10 @@ func Backend(_ *logical.BackendConfig) (*backend, error) {
 		// Setting the periodic func to be run once in an hour.
 		// If there is a real need, this can be made configurable.
 		tidyCooldownPeriod:     time.Hour,
-		EC2ClientsMap:          make(map[string]map[string]map[string]*ec2.EC2),
-		IAMClientsMap:          make(map[string]map[string]map[string]*iam.IAM),
+		EC2Clients:             newClientCache[*ec2.EC2](clientCacheSize, clientCacheTTL),
+		IAMClients:             newClientCache[*iam.IAM](clientCacheSize, clientCacheTTL),
 		iamUserIdToArnCache:    cache.New(7*24*time.Hour, 24*time.Hour),
+		stsMissCache:           cache.New(defaultSTSNegativeCacheTTL, time.Minute),
 		tidyDenyListCASGuard:   new(uint32),
 		tidyAccessListCASGuard: new(uint32),
 		roleCache:              cache.New(cache.NoExpiration, cache.NoExpiration),
@@ -285,6 +298,14 @@ func (b *backend) invalidate(ctx context.Context, key string) {
 		b.flushCachedEC2Clients()
 		b.flushCachedIAMClients()
 		b.defaultAWSAccountID = ""
+	case strings.HasPrefix(key, "config/sts/"):
+		// The STS configuration of the account was written or deleted on
+		// another node
+		accountID := strings.TrimPrefix(key, "config/sts/")
+		b.configMutex.Lock()
+		defer b.configMutex.Unlock()
+		b.flushCachedAccountClients(accountID)
+		b.stsMissCache.Delete(accountID)
 	case strings.HasPrefix(key, "role"):
 		// TODO: We could make this better
 		b.roleCache.Flush()
@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -1458,7 +1459,7 @@ func TestBackend_pathStsConfig(t *testing.T) {
 		t.Fatalf("failed to list config/sts")
 	}
 	keys := resp.Data["keys"].([]string)
-	if len(keys) != 2 {
+	if !reflect.DeepEqual(keys, []string{"account1", "account2"}) {
 		t.Fatalf("invalid keys listed: %#v\n", keys)
 	}
 
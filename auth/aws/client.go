@@ -6,9 +6,19 @@ package aws
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
@@ -25,6 +35,8 @@ import (
 // * Static credentials from 'config/client'
 // * Environment variables
 // * Instance metadata role
+//
+// With require_imdsv2, the instance metadata role is only fetched with IMDSv2.
 func (b *backend) getRawClientConfig(ctx context.Context, s logical.Storage, region, clientType string) (*aws.Config, error) {
 	credsConfig := &awsutil.CredentialsConfig{
 		Region: region,
@@ -39,6 +51,7 @@ func (b *backend) getRawClientConfig(ctx context.Context, s logical.Storage, reg
 
 	endpoint := aws.String("")
 	var maxRetries int = aws.UseServiceDefaultRetries
+	useFIPSEndpoint := endpoints.FIPSEndpointStateUnset
 	if config != nil {
 		// Override the defaults with configured values.
 		switch {
@@ -58,11 +71,19 @@ func (b *backend) getRawClientConfig(ctx context.Context, s logical.Storage, reg
 		credsConfig.AccessKey = config.AccessKey
 		credsConfig.SecretKey = config.SecretKey
 		maxRetries = config.MaxRetries
+		if config.UseFIPSEndpoint {
+			useFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+		}
 	}
 
 	credsConfig.HTTPClient = cleanhttp.DefaultClient()
 
-	creds, err := credsConfig.GenerateCredentialChain()
+	var creds *credentials.Credentials
+	if config != nil && config.RequireIMDSv2 {
+		creds, err = b.imdsv2CredentialChain(credsConfig, config.IMDSTimeout)
+	} else {
+		creds, err = credsConfig.GenerateCredentialChain()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -72,19 +93,236 @@ func (b *backend) getRawClientConfig(ctx context.Context, s logical.Storage, reg
 
 	// Create a config that can be used to make the API calls.
 	return &aws.Config{
-		Credentials: creds,
-		Region:      aws.String(region),
-		HTTPClient:  cleanhttp.DefaultClient(),
-		Endpoint:    endpoint,
-		MaxRetries:  aws.Int(maxRetries),
+		Credentials:     creds,
+		Region:          aws.String(region),
+		HTTPClient:      cleanhttp.DefaultClient(),
+		Endpoint:        endpoint,
+		MaxRetries:      aws.Int(maxRetries),
+		UseFIPSEndpoint: useFIPSEndpoint,
 	}, nil
 }
 
+// imdsv2CredentialChain builds a credential chain from static credentials,
+// environment variables, the shared credentials file and the instance profile,
+// like GenerateCredentialChain, except that instance profile credentials are
+// only fetched with IMDSv2 and the metadata requests time out after timeout.
+func (b *backend) imdsv2CredentialChain(credsConfig *awsutil.CredentialsConfig, timeout time.Duration) (*credentials.Credentials, error) {
+	if (credsConfig.AccessKey != "") != (credsConfig.SecretKey != "") {
+		return nil, fmt.Errorf("static AWS client credentials haven't been properly configured (the access key or secret key were provided but not both)")
+	}
+	if timeout <= 0 {
+		timeout = defaultIMDSTimeout
+	}
+
+	var providers []credentials.Provider
+	if credsConfig.AccessKey != "" {
+		providers = append(providers, &credentials.StaticProvider{
+			Value: credentials.Value{
+				AccessKeyID:     credsConfig.AccessKey,
+				SecretAccessKey: credsConfig.SecretKey,
+			},
+		})
+	}
+	providers = append(providers,
+		&credentials.EnvProvider{},
+		&credentials.SharedCredentialsProvider{},
+		&imdsv2RoleProvider{
+			EC2RoleProvider: ec2rolecreds.EC2RoleProvider{
+				Client:       b.imdsv2Client(timeout),
+				ExpiryWindow: 5 * time.Minute,
+			},
+		},
+	)
+
+	// Verbose errors keep the reason the instance profile credentials could
+	// not be fetched
+	return credentials.NewCredentials(&credentials.ChainProvider{
+		Providers:     providers,
+		VerboseErrors: true,
+	}), nil
+}
+
+// imdsv2Client returns a client of the instance metadata service that does
+// not fall back to IMDSv1 when no session token can be obtained
+func (b *backend) imdsv2Client(timeout time.Duration) *ec2metadata.EC2Metadata {
+	endpoint := b.imdsEndpoint
+	if endpoint == "" {
+		e, _ := endpoints.DefaultResolver().EndpointFor(endpoints.Ec2metadataServiceID, "")
+		endpoint = e.URL
+	}
+
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = timeout
+	cfg := aws.Config{
+		HTTPClient:                        httpClient,
+		MaxRetries:                        aws.Int(1),
+		EC2MetadataDisableTimeoutOverride: aws.Bool(true),
+		EC2MetadataEnableFallback:         aws.Bool(false),
+	}
+	return ec2metadata.NewClient(cfg, defaults.Handlers(), endpoint, "")
+}
+
+// imdsv2RoleProvider fetches the credentials of the instance profile with
+// IMDSv2 only, explaining why they could not be fetched
+type imdsv2RoleProvider struct {
+	ec2rolecreds.EC2RoleProvider
+}
+
+func (p *imdsv2RoleProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithContext(aws.BackgroundContext())
+}
+
+func (p *imdsv2RoleProvider) RetrieveWithContext(ctx credentials.Context) (credentials.Value, error) {
+	value, err := p.EC2RoleProvider.RetrieveWithContext(ctx)
+	if err != nil {
+		return value, fmt.Errorf("require_imdsv2 is set but instance profile credentials could not be fetched with IMDSv2; "+
+			"the instance may only offer IMDSv1, or the hop limit of its metadata responses may be too low: %w", err)
+	}
+	return value, nil
+}
+
+// getStsClientConfig returns an aws-sdk-go config for the STS client used to
+// assume the STS role of an account. The region and endpoint configured for
+// the account take precedence over those of config/client.
+func (b *backend) getStsClientConfig(ctx context.Context, s logical.Storage, region string, stsEntry *awsStsEntry) (*aws.Config, error) {
+	stsConfig, err := b.getRawClientConfig(ctx, s, region, "sts")
+	if err != nil {
+		return nil, err
+	}
+	if stsConfig == nil {
+		return nil, fmt.Errorf("could not configure STS client")
+	}
+
+	if stsEntry.StsEndpoint != "" {
+		stsConfig.Endpoint = aws.String(stsEntry.StsEndpoint)
+	}
+	if stsEntry.StsRegion != "" {
+		stsConfig.Region = aws.String(stsEntry.StsRegion)
+		// Without this, the SDK uses the global endpoint for most regions
+		stsConfig.STSRegionalEndpoint = endpoints.RegionalSTSEndpoint
+	}
+
+	if stsEntry.StsRole != "" {
+		for _, role := range stsEntry.roleChain() {
+			if err := checkStsPartition(role, aws.StringValue(stsConfig.Region), aws.StringValue(stsConfig.Endpoint)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return stsConfig, nil
+}
+
+// checkStsPartition returns an error if the STS role is in another partition
+// than the STS region or endpoint used to assume it, such as a GovCloud role
+// assumed through a commercial endpoint. Roles that are not ARNs, and
+// endpoints whose partition cannot be told from the host, are not checked.
+func checkStsPartition(roleARN, region, endpoint string) error {
+	parsed, err := arn.Parse(roleARN)
+	if err != nil {
+		return nil
+	}
+
+	if region != "" {
+		if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok && partition.ID() != parsed.Partition {
+			return fmt.Errorf("STS role %q is in partition %q, but STS region %q is in partition %q", roleARN, parsed.Partition, region, partition.ID())
+		}
+	}
+	if partition := endpointPartition(endpoint); partition != "" && partition != parsed.Partition {
+		return fmt.Errorf("STS role %q is in partition %q, but STS endpoint %q is in partition %q", roleARN, parsed.Partition, endpoint, partition)
+	}
+	return nil
+}
+
+// endpointPartition returns the partition of an AWS endpoint from its host,
+// or an empty string for hosts outside of the AWS domains, such as proxies
+func endpointPartition(endpoint string) string {
+	if endpoint == "" {
+		return ""
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case strings.HasSuffix(host, ".amazonaws.com.cn"):
+		return endpoints.AwsCnPartitionID
+	case strings.HasSuffix(host, ".amazonaws.com") && strings.Contains(host, "us-gov-"):
+		return endpoints.AwsUsGovPartitionID
+	case strings.HasSuffix(host, ".amazonaws.com"):
+		return endpoints.AwsPartitionID
+	default:
+		return ""
+	}
+}
+
+// newAssumeRoleProvider returns a credentials provider assuming the STS role
+// of stsEntry, passing its external ID, session tags and duration if set
+func newAssumeRoleProvider(client stscreds.AssumeRoler, stsEntry *awsStsEntry) *stscreds.AssumeRoleProvider {
+	provider := &stscreds.AssumeRoleProvider{
+		Client:   client,
+		RoleARN:  stsEntry.StsRole,
+		Duration: stscreds.DefaultDuration,
+	}
+	if stsEntry.ExternalID != "" {
+		provider.ExternalID = aws.String(stsEntry.ExternalID)
+	}
+	if stsEntry.Duration != 0 {
+		provider.Duration = stsEntry.Duration
+	}
+
+	keys := make([]string, 0, len(stsEntry.SessionTags))
+	for key := range stsEntry.SessionTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		provider.Tags = append(provider.Tags, &sts.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(stsEntry.SessionTags[key]),
+		})
+	}
+	return provider
+}
+
+// assumeRoleChain returns the credentials of the STS role of stsEntry. The
+// roles of its role chain are assumed first, in order, each with a client
+// using the credentials of the previous one, and newClient is called with nil
+// credentials for the client assuming the first role. Only the STS role is
+// assumed with the external ID, session tags and duration of stsEntry.
+func assumeRoleChain(newClient func(*credentials.Credentials) stscreds.AssumeRoler, stsEntry *awsStsEntry) *credentials.Credentials {
+	var creds *credentials.Credentials
+	for _, role := range stsEntry.StsRoleChain {
+		creds = credentials.NewCredentials(&stscreds.AssumeRoleProvider{
+			Client:   newClient(creds),
+			RoleARN:  role,
+			Duration: stscreds.DefaultDuration,
+		})
+	}
+	return credentials.NewCredentials(newAssumeRoleProvider(newClient(creds), stsEntry))
+}
+
+// validateAssumedCredentials checks that the credentials of the assumed STS
+// role of an account can be used, so that clients are only cached once they
+// work rather than failing on first use
+func validateAssumedCredentials(ctx context.Context, client *sts.STS, stsEntry *awsStsEntry, accountID string) error {
+	if _, err := client.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+		return fmt.Errorf("credentials of STS role %q configured for account ID %q cannot be used: %w", stsEntry.StsRole, accountID, err)
+	}
+	return nil
+}
+
 // getClientConfig returns an aws-sdk-go config, with optionally assumed credentials
 // It uses getRawClientConfig to obtain config for the runtime environment, and if
-// stsRole is a non-empty string, it will use AssumeRole to obtain a set of assumed
-// credentials. The credentials will expire after 15 minutes but will auto-refresh.
-func (b *backend) getClientConfig(ctx context.Context, s logical.Storage, region, stsRole, accountID, clientType string) (*aws.Config, error) {
+// the STS role of stsEntry is a non-empty string, it will use AssumeRole to obtain
+// a set of assumed credentials. The credentials will expire after the duration
+// of stsEntry, 15 minutes by default, but will auto-refresh.
+func (b *backend) getClientConfig(ctx context.Context, s logical.Storage, region string, stsEntry *awsStsEntry, accountID, clientType string) (*aws.Config, error) {
 	config, err := b.getRawClientConfig(ctx, s, region, clientType)
 	if err != nil {
 		return nil, err
@@ -93,23 +331,34 @@ func (b *backend) getClientConfig(ctx context.Context, s logical.Storage, region
 		return nil, fmt.Errorf("could not compile valid credentials through the default provider chain")
 	}
 
-	stsConfig, err := b.getRawClientConfig(ctx, s, region, "sts")
-	if stsConfig == nil {
-		return nil, fmt.Errorf("could not configure STS client")
-	}
+	stsConfig, err := b.getStsClientConfig(ctx, s, region, stsEntry)
 	if err != nil {
 		return nil, err
 	}
-	if stsRole != "" {
+	if stsEntry.StsRole != "" {
 		sess, err := session.NewSession(stsConfig)
 		if err != nil {
 			return nil, err
 		}
-		assumedCredentials := stscreds.NewCredentials(sess, stsRole)
+		assumedCredentials := assumeRoleChain(func(creds *credentials.Credentials) stscreds.AssumeRoler {
+			if creds == nil {
+				return sts.New(sess)
+			}
+			return sts.New(sess, &aws.Config{Credentials: creds})
+		}, stsEntry)
 		// Test that we actually have permissions to assume the role
 		if _, err = assumedCredentials.Get(); err != nil {
+			return nil, fmt.Errorf("unable to assume STS role %q configured for account ID %q: %w", stsEntry.StsRole, accountID, err)
+		}
+		clientConfig, err := b.nonLockedClientConfigEntry(ctx, s)
+		if err != nil {
 			return nil, err
 		}
+		if clientConfig == nil || !clientConfig.SkipSTSRoleValidation {
+			if err := validateAssumedCredentials(ctx, sts.New(sess, &aws.Config{Credentials: assumedCredentials}), stsEntry, accountID); err != nil {
+				return nil, err
+			}
+		}
 		config.Credentials = assumedCredentials
 	} else {
 		if b.defaultAWSAccountID == "" {
@@ -144,10 +393,7 @@ func (b *backend) getClientConfig(ctx context.Context, s logical.Storage, region
 // the cached EC2 client objects will be flushed. Config mutex lock should be
 // acquired for write operation before calling this method.
 func (b *backend) flushCachedEC2Clients() {
-	// deleting items in map during iteration is safe
-	for region := range b.EC2ClientsMap {
-		delete(b.EC2ClientsMap, region)
-	}
+	b.EC2Clients.flush()
 }
 
 // flushCachedIAMClients deletes all the cached iam client objects from the
@@ -155,10 +401,17 @@ func (b *backend) flushCachedEC2Clients() {
 // the backend, all the cached IAM client objects will be flushed. Config mutex
 // lock should be acquired for write operation before calling this method.
 func (b *backend) flushCachedIAMClients() {
-	// deleting items in map during iteration is safe
-	for region := range b.IAMClientsMap {
-		delete(b.IAMClientsMap, region)
-	}
+	b.IAMClients.flush()
+}
+
+// flushCachedAccountClients deletes the cached ec2 and iam client objects of
+// an account from the backend. If the STS configuration of the account is
+// deleted or updated in the backend, its cached client objects will be
+// flushed. Config mutex lock should be acquired for write operation before
+// calling this method.
+func (b *backend) flushCachedAccountClients(accountID string) {
+	b.EC2Clients.flushAccount(accountID)
+	b.IAMClients.flushAccount(accountID)
 }
 
 // Gets an entry out of the user ID cache
@@ -180,39 +433,71 @@ func (b *backend) setCachedUserId(userId, arn string) {
 	}
 }
 
-func (b *backend) stsRoleForAccount(ctx context.Context, s logical.Storage, accountID string) (string, error) {
+// stsEntryForAccount returns the STS configuration of the account. An entry
+// with an empty STS role is returned for the default account.
+func (b *backend) stsEntryForAccount(ctx context.Context, s logical.Storage, accountID string) (*awsStsEntry, error) {
+	// Accounts recently found to have no STS configuration fail without
+	// reading the storage again
+	if _, ok := b.stsMissCache.Get(accountID); ok {
+		return nil, fmt.Errorf("no STS configuration found for account ID %q", accountID)
+	}
+
+	// The lock is held until the account is cached, so that an STS
+	// configuration written in between is not hidden by the cache
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
 	// Check if an STS configuration exists for the AWS account
-	sts, err := b.lockedAwsStsEntry(ctx, s, accountID)
+	sts, err := b.nonLockedAwsStsEntry(ctx, s, accountID)
 	if err != nil {
-		return "", fmt.Errorf("error fetching STS config for account ID %q: %w", accountID, err)
+		return nil, fmt.Errorf("error fetching STS config for account ID %q: %w", accountID, err)
 	}
 	// An empty STS role signifies the master account
 	if sts != nil {
-		return sts.StsRole, nil
+		return sts, nil
 	}
 
 	// Return an error if there's no STS config for an account which is not the default one
 	if b.defaultAWSAccountID != "" && b.defaultAWSAccountID != accountID {
-		return "", fmt.Errorf("no STS configuration found for account ID %q", accountID)
+		b.cacheSTSMiss(ctx, s, accountID)
+		return nil, fmt.Errorf("no STS configuration found for account ID %q", accountID)
 	}
 
-	return "", nil
+	return &awsStsEntry{}, nil
+}
+
+// cacheSTSMiss remembers that the account has no STS configuration for
+// sts_negative_cache_ttl. Config mutex lock should be acquired for reading
+// before calling this method.
+func (b *backend) cacheSTSMiss(ctx context.Context, s logical.Storage, accountID string) {
+	ttl := defaultSTSNegativeCacheTTL
+	config, err := b.nonLockedClientConfigEntry(ctx, s)
+	if err != nil {
+		b.Logger().Debug("not caching missing STS configuration", "account_id", accountID, "error", err)
+		return
+	}
+	if config != nil {
+		ttl = config.STSNegativeCacheTTL
+	}
+	if ttl > 0 {
+		b.stsMissCache.Set(accountID, struct{}{}, ttl)
+	}
 }
 
 // clientEC2 creates a client to interact with AWS EC2 API
 func (b *backend) clientEC2(ctx context.Context, s logical.Storage, region, accountID string) (*ec2.EC2, error) {
-	stsRole, err := b.stsRoleForAccount(ctx, s, accountID)
+	stsEntry, err := b.stsEntryForAccount(ctx, s, accountID)
 	if err != nil {
 		return nil, err
 	}
+	stsRole := stsEntry.StsRole
+	key := clientCacheKey{region: region, accountID: accountID, stsRole: stsRole, roleChain: strings.Join(stsEntry.StsRoleChain, ","), session: stsEntry.sessionKey()}
 	b.configMutex.RLock()
-	if b.EC2ClientsMap[region] != nil &&
-		b.EC2ClientsMap[region][accountID] != nil &&
-		b.EC2ClientsMap[region][accountID][stsRole] != nil {
+	if client, ok := b.EC2Clients.get(key); ok {
 		defer b.configMutex.RUnlock()
 		// If the client object was already created, return it
 		b.Logger().Debug(fmt.Sprintf("returning cached client for region %s, account %s and stsRole %s", region, accountID, stsRole))
-		return b.EC2ClientsMap[region][accountID][stsRole], nil
+		return client, nil
 	}
 	b.Logger().Debug(fmt.Sprintf("no cached client for region %s, account %s and stsRole %s", region, accountID, stsRole))
 
@@ -222,15 +507,13 @@ func (b *backend) clientEC2(ctx context.Context, s logical.Storage, region, acco
 	defer b.configMutex.Unlock()
 
 	// If the client gets created while switching the locks, return it
-	if b.EC2ClientsMap[region] != nil &&
-		b.EC2ClientsMap[region][accountID] != nil &&
-		b.EC2ClientsMap[region][accountID][stsRole] != nil {
-		return b.EC2ClientsMap[region][accountID][stsRole], nil
+	if client, ok := b.EC2Clients.get(key); ok {
+		return client, nil
 	}
 
 	// Create an AWS config object using a chain of providers
 	var awsConfig *aws.Config
-	awsConfig, err = b.getClientConfig(ctx, s, region, stsRole, accountID, "ec2")
+	awsConfig, err = b.getClientConfig(ctx, s, region, stsEntry, accountID, "ec2")
 
 	if err != nil {
 		return nil, err
@@ -250,36 +533,30 @@ func (b *backend) clientEC2(ctx context.Context, s logical.Storage, region, acco
 		return nil, fmt.Errorf("could not obtain ec2 client")
 	}
 
-	if _, ok := b.EC2ClientsMap[region]; !ok {
-		b.EC2ClientsMap[region] = make(map[string]map[string]*ec2.EC2)
-	}
-	if _, ok := b.EC2ClientsMap[region][accountID]; !ok {
-		b.EC2ClientsMap[region][accountID] = make(map[string]*ec2.EC2)
-	}
-	b.EC2ClientsMap[region][accountID][stsRole] = client
+	b.EC2Clients.add(key, client)
 
-	return b.EC2ClientsMap[region][accountID][stsRole], nil
+	return client, nil
 }
 
 // clientIAM creates a client to interact with AWS IAM API
 func (b *backend) clientIAM(ctx context.Context, s logical.Storage, region, accountID string) (*iam.IAM, error) {
-	stsRole, err := b.stsRoleForAccount(ctx, s, accountID)
+	stsEntry, err := b.stsEntryForAccount(ctx, s, accountID)
 	if err != nil {
 		return nil, err
 	}
+	stsRole := stsEntry.StsRole
 	if stsRole == "" {
 		b.Logger().Debug(fmt.Sprintf("no stsRole found for %s", accountID))
 	} else {
 		b.Logger().Debug(fmt.Sprintf("found stsRole %s for account %s", stsRole, accountID))
 	}
+	key := clientCacheKey{region: region, accountID: accountID, stsRole: stsRole, roleChain: strings.Join(stsEntry.StsRoleChain, ","), session: stsEntry.sessionKey()}
 	b.configMutex.RLock()
-	if b.IAMClientsMap[region] != nil &&
-		b.IAMClientsMap[region][accountID] != nil &&
-		b.IAMClientsMap[region][accountID][stsRole] != nil {
+	if client, ok := b.IAMClients.get(key); ok {
 		defer b.configMutex.RUnlock()
 		// If the client object was already created, return it
 		b.Logger().Debug(fmt.Sprintf("returning cached client for region %s, account %s and stsRole %s", region, accountID, stsRole))
-		return b.IAMClientsMap[region][accountID][stsRole], nil
+		return client, nil
 	}
 	b.Logger().Debug(fmt.Sprintf("no cached client for region %s, account %s and stsRole %s", region, accountID, stsRole))
 
@@ -289,15 +566,13 @@ func (b *backend) clientIAM(ctx context.Context, s logical.Storage, region, acco
 	defer b.configMutex.Unlock()
 
 	// If the client gets created while switching the locks, return it
-	if b.IAMClientsMap[region] != nil &&
-		b.IAMClientsMap[region][accountID] != nil &&
-		b.IAMClientsMap[region][accountID][stsRole] != nil {
-		return b.IAMClientsMap[region][accountID][stsRole], nil
+	if client, ok := b.IAMClients.get(key); ok {
+		return client, nil
 	}
 
 	// Create an AWS config object using a chain of providers
 	var awsConfig *aws.Config
-	awsConfig, err = b.getClientConfig(ctx, s, region, stsRole, accountID, "iam")
+	awsConfig, err = b.getClientConfig(ctx, s, region, stsEntry, accountID, "iam")
 
 	if err != nil {
 		return nil, err
@@ -317,13 +592,7 @@ func (b *backend) clientIAM(ctx context.Context, s logical.Storage, region, acco
 		return nil, fmt.Errorf("could not obtain iam client")
 	}
 
-	if _, ok := b.IAMClientsMap[region]; !ok {
-		b.IAMClientsMap[region] = make(map[string]map[string]*iam.IAM)
-	}
-	if _, ok := b.IAMClientsMap[region][accountID]; !ok {
-		b.IAMClientsMap[region][accountID] = make(map[string]*iam.IAM)
-	}
-	b.IAMClientsMap[region][accountID][stsRole] = client
+	b.IAMClients.add(key, client)
 
-	return b.IAMClientsMap[region][accountID][stsRole], nil
+	return client, nil
 }
@@ -0,0 +1,94 @@
+// Copyright (c) 2025 OpenBao a Series of LF Projects, LLC
+// SPDX-License-Identifier: MPL-2.0
+
+package aws
+
+import (
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+const (
+	// clientCacheSize is the maximum number of cached clients of each type.
+	// The least recently used clients are evicted first.
+	clientCacheSize = 512
+
+	// clientCacheTTL is how long a client is cached before it is created
+	// again. It is shorter than the 15 minutes assumed role credentials are
+	// valid for.
+	clientCacheTTL = 10 * time.Minute
+)
+
+// clientCacheKey identifies a cached client. The empty STS role signifies the
+// master account. The role chain lists the intermediary roles assumed before
+// the STS role, so that chains ending with the same role are cached
+// separately. The session identifies the session tags and duration the STS
+// role is assumed with.
+type clientCacheKey struct {
+	region    string
+	accountID string
+	stsRole   string
+	roleChain string
+	session   string
+}
+
+type clientCacheEntry[T any] struct {
+	client  T
+	expires time.Time
+}
+
+// clientCache is a size bounded LRU cache of AWS clients, which expire after
+// a TTL
+type clientCache[T any] struct {
+	lru *lru.Cache[clientCacheKey, clientCacheEntry[T]]
+	ttl time.Duration
+}
+
+func newClientCache[T any](size int, ttl time.Duration) *clientCache[T] {
+	c, err := lru.New[clientCacheKey, clientCacheEntry[T]](size)
+	if err != nil {
+		// Only returned for a non-positive size
+		panic(err)
+	}
+	return &clientCache[T]{
+		lru: c,
+		ttl: ttl,
+	}
+}
+
+// get returns the cached client for the key, unless it has expired
+func (c *clientCache[T]) get(key clientCacheKey) (T, bool) {
+	entry, ok := c.lru.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(key)
+		var zero T
+		return zero, false
+	}
+	return entry.client, true
+}
+
+func (c *clientCache[T]) add(key clientCacheKey, client T) {
+	c.lru.Add(key, clientCacheEntry[T]{
+		client:  client,
+		expires: time.Now().Add(c.ttl),
+	})
+}
+
+// flush removes all cached clients
+func (c *clientCache[T]) flush() {
+	c.lru.Purge()
+}
+
+// flushAccount removes the cached clients of an account
+func (c *clientCache[T]) flushAccount(accountID string) {
+	for _, key := range c.lru.Keys() {
+		if key.accountID == accountID {
+			c.lru.Remove(key)
+		}
+	}
+}
@@ -6,8 +6,21 @@ package aws
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/openbao/openbao/sdk/v2/logical"
 )
 
@@ -34,16 +47,16 @@ func TestClientCache(t *testing.T) {
 	b.defaultAWSAccountID = account1
 
 	// This should work - same account as default
-	stsRole, err := b.stsRoleForAccount(ctx, storage, account1)
+	sts, err := b.stsEntryForAccount(ctx, storage, account1)
 	if err != nil {
 		t.Fatalf("Expected success for default account, got error: %v", err)
 	}
-	if stsRole != "" {
-		t.Fatalf("Expected empty STS role for default account, got: %v", stsRole)
+	if sts.StsRole != "" {
+		t.Fatalf("Expected empty STS role for default account, got: %v", sts.StsRole)
 	}
 
 	// This should fail - different account without STS config
-	_, err = b.stsRoleForAccount(ctx, storage, account2)
+	_, err = b.stsEntryForAccount(ctx, storage, account2)
 	if err == nil {
 		t.Fatal("Expected error for cross-account access without STS config")
 	}
@@ -55,18 +68,848 @@ func TestClientCache(t *testing.T) {
 	}
 
 	stsEntry := &awsStsEntry{
-		StsRole: "arn:aws:iam::222222222222:role/cross-account-role",
+		StsRole:    "arn:aws:iam::222222222222:role/cross-account-role",
+		ExternalID: "external-id-222222222222",
 	}
 	err = b.lockedSetAwsStsEntry(ctx, storage, account2, stsEntry)
 	if err != nil {
 		t.Fatalf("Failed to set STS entry: %v", err)
 	}
 
-	stsRole, err = b.stsRoleForAccount(ctx, storage, account2)
+	sts, err = b.stsEntryForAccount(ctx, storage, account2)
 	if err != nil {
 		t.Fatalf("Expected success for account with STS config, got error: %v", err)
 	}
-	if stsRole != stsEntry.StsRole {
-		t.Fatalf("Expected STS role %v, got: %v", stsEntry.StsRole, stsRole)
+	if sts.StsRole != stsEntry.StsRole {
+		t.Fatalf("Expected STS role %v, got: %v", stsEntry.StsRole, sts.StsRole)
+	}
+	if sts.ExternalID != stsEntry.ExternalID {
+		t.Fatalf("Expected external ID %v, got: %v", stsEntry.ExternalID, sts.ExternalID)
+	}
+
+	// The external ID is passed when assuming the role
+	assumeRoler := &mockAssumeRoler{}
+	if _, err := newAssumeRoleProvider(assumeRoler, sts).Retrieve(); err != nil {
+		t.Fatalf("Failed to assume role: %v", err)
+	}
+	if assumeRoler.input == nil || aws.StringValue(assumeRoler.input.ExternalId) != stsEntry.ExternalID {
+		t.Fatalf("Expected AssumeRole with external ID %v, got: %v", stsEntry.ExternalID, assumeRoler.input)
+	}
+	if aws.StringValue(assumeRoler.input.RoleArn) != stsEntry.StsRole {
+		t.Fatalf("Expected AssumeRole of role %v, got: %v", stsEntry.StsRole, aws.StringValue(assumeRoler.input.RoleArn))
+	}
+}
+
+// TestClientCache_StsNegativeCache verifies that accounts without an STS
+// configuration are remembered, and that writing the STS configuration of an
+// account takes effect without waiting for the cached lookup to expire
+func TestClientCache_StsNegativeCache(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	b.defaultAWSAccountID = "111111111111"
+	account := "222222222222"
+
+	if _, err := b.stsEntryForAccount(ctx, storage, account); err == nil {
+		t.Fatal("Expected error for cross-account access without STS config")
+	}
+	if _, ok := b.stsMissCache.Get(account); !ok {
+		t.Fatal("Expected the missing STS config to be cached")
+	}
+
+	// An entry written to the storage directly is not seen while the lookup
+	// is cached
+	entry, err := logical.StorageEntryJSON("config/sts/"+account, &awsStsEntry{StsRole: "arn:aws:iam::222222222222:role/stale"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.stsEntryForAccount(ctx, storage, account); err == nil {
+		t.Fatal("Expected the cached lookup to be used")
+	}
+
+	// Invalidating the entry, as when it is written on another node, drops
+	// the cached lookup
+	b.invalidate(ctx, "config/sts/"+account)
+	if _, err := b.stsEntryForAccount(ctx, storage, account); err != nil {
+		t.Fatalf("Expected the invalidated lookup to read the storage, got error: %v", err)
+	}
+	if err := storage.Delete(ctx, "config/sts/"+account); err != nil {
+		t.Fatal(err)
+	}
+	b.invalidate(ctx, "config/sts/"+account)
+	if _, err := b.stsEntryForAccount(ctx, storage, account); err == nil {
+		t.Fatal("Expected error for cross-account access without STS config")
+	}
+
+	// Writing the STS config invalidates the cached lookup immediately
+	stsEntry := &awsStsEntry{StsRole: "arn:aws:iam::222222222222:role/cross-account-role"}
+	if err := b.lockedSetAwsStsEntry(ctx, storage, account, stsEntry); err != nil {
+		t.Fatalf("Failed to set STS entry: %v", err)
+	}
+	sts, err := b.stsEntryForAccount(ctx, storage, account)
+	if err != nil {
+		t.Fatalf("Expected success for account with STS config, got error: %v", err)
+	}
+	if sts.StsRole != stsEntry.StsRole {
+		t.Fatalf("Expected STS role %v, got: %v", stsEntry.StsRole, sts.StsRole)
+	}
+
+	// Lookups are not cached when sts_negative_cache_ttl is 0
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/client",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"sts_negative_cache_ttl": 0,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write client config: resp:%#v err:%v", resp, err)
+	}
+	b.defaultAWSAccountID = "111111111111"
+	if _, err := b.stsEntryForAccount(ctx, storage, "333333333333"); err == nil {
+		t.Fatal("Expected error for cross-account access without STS config")
+	}
+	if _, ok := b.stsMissCache.Get("333333333333"); ok {
+		t.Fatal("Expected the missing STS config not to be cached")
+	}
+}
+
+// mockAssumeRoler records the input of AssumeRole
+type mockAssumeRoler struct {
+	input *sts.AssumeRoleInput
+}
+
+func (m *mockAssumeRoler) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	m.input = input
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("AKIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+// TestClientCache_StsRegion verifies that the STS clients of accounts use the
+// region and endpoint configured for the account
+func TestClientCache_StsRegion(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Static credentials keep the credential chain from reaching out to the
+	// instance metadata service
+	entry, err := logical.StorageEntryJSON("config/client", &clientConfig{
+		AccessKey:  "AKIAEXAMPLE",
+		SecretKey:  "secret",
+		STSRegion:  "us-east-1",
+		MaxRetries: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := map[string]*awsStsEntry{
+		"222222222222": {
+			StsRole:   "arn:aws:iam::222222222222:role/cross-account-role",
+			StsRegion: "eu-west-1",
+		},
+		"333333333333": {
+			StsRole:     "arn:aws:iam::333333333333:role/cross-account-role",
+			StsRegion:   "us-west-2",
+			StsEndpoint: "https://vpce-0123456789abcdef0.sts.us-west-2.vpce.amazonaws.com",
+		},
+	}
+	for accountID, stsEntry := range accounts {
+		if err := b.lockedSetAwsStsEntry(ctx, storage, accountID, stsEntry); err != nil {
+			t.Fatalf("Failed to set STS entry: %v", err)
+		}
+	}
+
+	for accountID, want := range accounts {
+		sts, err := b.stsEntryForAccount(ctx, storage, accountID)
+		if err != nil {
+			t.Fatalf("Expected success for account with STS config, got error: %v", err)
+		}
+
+		stsConfig, err := b.getStsClientConfig(ctx, storage, "ap-southeast-2", sts)
+		if err != nil {
+			t.Fatalf("Failed to get STS client config: %v", err)
+		}
+		if *stsConfig.Region != want.StsRegion {
+			t.Fatalf("Expected STS region %q for account %s, got: %q", want.StsRegion, accountID, *stsConfig.Region)
+		}
+		if *stsConfig.Endpoint != want.StsEndpoint {
+			t.Fatalf("Expected STS endpoint %q for account %s, got: %q", want.StsEndpoint, accountID, *stsConfig.Endpoint)
+		}
+		if stsConfig.STSRegionalEndpoint != endpoints.RegionalSTSEndpoint {
+			t.Fatalf("Expected regional STS endpoint for account %s", accountID)
+		}
+	}
+
+	// Accounts without a configured region use the one of config/client
+	stsConfig, err := b.getStsClientConfig(ctx, storage, "ap-southeast-2", &awsStsEntry{})
+	if err != nil {
+		t.Fatalf("Failed to get STS client config: %v", err)
+	}
+	if *stsConfig.Region != "us-east-1" {
+		t.Fatalf("Expected STS region of config/client, got: %q", *stsConfig.Region)
+	}
+}
+
+// TestClientCache_StsSessionTags verifies that the session tags and duration
+// of an account are passed when assuming its role, that clients assuming the
+// role with other session tags are cached separately, and that durations
+// outside of the bounds of AWS are rejected
+func TestClientCache_StsSessionTags(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/sts/222222222222",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"sts_role":         "arn:aws:iam::222222222222:role/cross-account-role",
+			"session_tags":     []string{"team=payments", "env=prod"},
+			"duration_seconds": "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("Failed to write STS config: resp:%#v err:%v", resp, err)
+	}
+
+	stsEntry, err := b.stsEntryForAccount(ctx, storage, "222222222222")
+	if err != nil {
+		t.Fatalf("Expected success for account with STS config, got error: %v", err)
+	}
+	if stsEntry.Duration != time.Hour {
+		t.Fatalf("Expected duration of 1h, got: %v", stsEntry.Duration)
+	}
+
+	assumeRoler := &mockAssumeRoler{}
+	if _, err := newAssumeRoleProvider(assumeRoler, stsEntry).Retrieve(); err != nil {
+		t.Fatalf("Failed to assume role: %v", err)
+	}
+	if aws.Int64Value(assumeRoler.input.DurationSeconds) != 3600 {
+		t.Fatalf("Expected AssumeRole with a duration of 3600 seconds, got: %v", assumeRoler.input.DurationSeconds)
+	}
+	var tags []string
+	for _, tag := range assumeRoler.input.Tags {
+		tags = append(tags, aws.StringValue(tag.Key)+"="+aws.StringValue(tag.Value))
+	}
+	if strings.Join(tags, ",") != "env=prod,team=payments" {
+		t.Fatalf("Expected AssumeRole with the session tags, got: %v", tags)
+	}
+
+	// The same role assumed with other session tags gets a client of its own
+	key := clientCacheKey{region: "us-east-1", accountID: "222222222222", stsRole: stsEntry.StsRole, session: stsEntry.sessionKey()}
+	b.IAMClients.add(key, &iam.IAM{})
+
+	otherEntry := *stsEntry
+	otherEntry.SessionTags = map[string]string{"team": "payments", "env": "staging"}
+	otherKey := key
+	otherKey.session = otherEntry.sessionKey()
+	if otherKey == key {
+		t.Fatal("Expected distinct cache keys for distinct session tags")
+	}
+	if _, ok := b.IAMClients.get(otherKey); ok {
+		t.Fatal("Expected no cached client for other session tags")
+	}
+	if _, ok := b.IAMClients.get(key); !ok {
+		t.Fatal("Expected cached client for the configured session tags")
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/sts/222222222222",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("Failed to read STS config: resp:%#v err:%v", resp, err)
+	}
+	if resp.Data["duration_seconds"] != int64(3600) {
+		t.Fatalf("Expected duration_seconds of 3600, got: %v", resp.Data["duration_seconds"])
+	}
+
+	for _, duration := range []string{"899", "43201"} {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config/sts/222222222222",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"duration_seconds": duration,
+			},
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("Expected duration_seconds of %s to be rejected: resp:%#v err:%v", duration, resp, err)
+		}
+	}
+}
+
+// TestClientCache_StsRoleChain verifies that the roles of the role chain of
+// an account are assumed in order before its STS role, each with the
+// credentials of the previous one, that chains ending with the same role are
+// cached separately, and that sessions longer than AWS allows for chained
+// roles are rejected
+func TestClientCache_StsRoleChain(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	hubRole := "arn:aws:iam::111111111111:role/hub"
+	spokeRole := "arn:aws:iam::222222222222:role/spoke"
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/sts/222222222222",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"sts_role":       spokeRole,
+			"sts_role_chain": hubRole,
+			"external_id":    "spoke-external-id",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("Failed to write STS config: resp:%#v err:%v", resp, err)
+	}
+
+	stsEntry, err := b.stsEntryForAccount(ctx, storage, "222222222222")
+	if err != nil {
+		t.Fatalf("Expected success for account with STS config, got error: %v", err)
+	}
+	if chain := strings.Join(stsEntry.roleChain(), ","); chain != hubRole+","+spokeRole {
+		t.Fatalf("Expected role chain of the hub and spoke roles, got: %v", chain)
+	}
+
+	var assumeRolers []*mockAssumeRoler
+	var clientCredentials []*credentials.Credentials
+	creds := assumeRoleChain(func(creds *credentials.Credentials) stscreds.AssumeRoler {
+		assumeRoler := &mockAssumeRoler{}
+		assumeRolers = append(assumeRolers, assumeRoler)
+		clientCredentials = append(clientCredentials, creds)
+		return assumeRoler
+	}, stsEntry)
+	if _, err := creds.Get(); err != nil {
+		t.Fatalf("Failed to assume role: %v", err)
+	}
+	if len(assumeRolers) != 2 || clientCredentials[0] != nil || clientCredentials[1] == nil {
+		t.Fatalf("Expected the hub role to be assumed with the default credentials, got: %v", clientCredentials)
+	}
+	if aws.StringValue(assumeRolers[1].input.RoleArn) != spokeRole || aws.StringValue(assumeRolers[1].input.ExternalId) != "spoke-external-id" {
+		t.Fatalf("Expected AssumeRole of the spoke role with its external ID, got: %v", assumeRolers[1].input)
+	}
+
+	// The spoke role is assumed with the credentials of the hub role
+	if _, err := clientCredentials[1].Get(); err != nil {
+		t.Fatalf("Failed to assume role: %v", err)
+	}
+	if aws.StringValue(assumeRolers[0].input.RoleArn) != hubRole || assumeRolers[0].input.ExternalId != nil {
+		t.Fatalf("Expected AssumeRole of the hub role without external ID, got: %v", assumeRolers[0].input)
+	}
+
+	// The same role assumed through another hub gets a client of its own
+	key := clientCacheKey{region: "us-east-1", accountID: "222222222222", stsRole: spokeRole, roleChain: hubRole}
+	b.IAMClients.add(key, &iam.IAM{})
+	otherKey := key
+	otherKey.roleChain = "arn:aws:iam::333333333333:role/hub"
+	if _, ok := b.IAMClients.get(otherKey); ok {
+		t.Fatal("Expected no cached client for another role chain")
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/sts/222222222222",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"duration_seconds": "2h",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("Expected duration_seconds above 1h to be rejected with a role chain: resp:%#v err:%v", resp, err)
+	}
+}
+
+// TestClientCache_Eviction verifies that cached clients expire after the TTL,
+// that the least recently used clients are evicted, and that clients of an
+// account are flushed when its STS configuration changes
+// TestClientCache_StsRoleValidation verifies that clients are only cached once
+// the STS role of their account is assumed and its credentials can be used,
+// with errors naming the account and role, unless skip_sts_role_validation is
+// set
+func TestClientCache_StsRoleValidation(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	deniedRole := "arn:aws:iam::222222222222:role/denied"
+	unusableRole := "arn:aws:iam::333333333333:role/unusable"
+	var callerIdentityCalls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		switch {
+		case r.Form.Get("Action") == "AssumeRole" && r.Form.Get("RoleArn") == deniedRole:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not authorized to perform sts:AssumeRole</Message></Error><RequestId>1</RequestId></ErrorResponse>`)
+		case r.Form.Get("Action") == "AssumeRole":
+			fmt.Fprint(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials><AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult><ResponseMetadata><RequestId>2</RequestId></ResponseMetadata></AssumeRoleResponse>`)
+		case r.Form.Get("Action") == "GetCallerIdentity":
+			callerIdentityCalls++
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidClientTokenId</Code><Message>The security token included in the request is invalid</Message></Error><RequestId>3</RequestId></ErrorResponse>`)
+		default:
+			t.Errorf("unexpected request: %v", r.Form)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	// Static credentials keep the credential chain from reaching out to the
+	// instance metadata service
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/client",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"access_key":   "AKIAEXAMPLE",
+			"secret_key":   "secret",
+			"sts_endpoint": ts.URL,
+			"sts_region":   "us-east-1",
+			"max_retries":  0,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("Failed to write client config: resp:%#v err:%v", resp, err)
+	}
+	for accountID, role := range map[string]string{"222222222222": deniedRole, "333333333333": unusableRole} {
+		if err := b.lockedSetAwsStsEntry(ctx, storage, accountID, &awsStsEntry{StsRole: role}); err != nil {
+			t.Fatalf("Failed to set STS entry: %v", err)
+		}
+	}
+
+	_, err = b.clientIAM(ctx, storage, "us-east-1", "222222222222")
+	if err == nil || !strings.Contains(err.Error(), "unable to assume STS role") ||
+		!strings.Contains(err.Error(), deniedRole) || !strings.Contains(err.Error(), "222222222222") {
+		t.Fatalf("Expected an error naming the account and role, got: %v", err)
+	}
+
+	_, err = b.clientIAM(ctx, storage, "us-east-1", "333333333333")
+	if err == nil || !strings.Contains(err.Error(), "cannot be used") ||
+		!strings.Contains(err.Error(), unusableRole) || !strings.Contains(err.Error(), "333333333333") {
+		t.Fatalf("Expected an error naming the account and role, got: %v", err)
+	}
+	if callerIdentityCalls != 1 {
+		t.Fatalf("Expected 1 GetCallerIdentity call, got %d", callerIdentityCalls)
+	}
+	for _, key := range []clientCacheKey{
+		{region: "us-east-1", accountID: "222222222222", stsRole: deniedRole},
+		{region: "us-east-1", accountID: "333333333333", stsRole: unusableRole},
+	} {
+		if _, ok := b.IAMClients.get(key); ok {
+			t.Fatalf("Expected no cached client for account %s", key.accountID)
+		}
+	}
+
+	// Without validation, the client is cached once the role is assumed
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/client",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"skip_sts_role_validation": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("Failed to write client config: resp:%#v err:%v", resp, err)
+	}
+	if _, err := b.clientIAM(ctx, storage, "us-east-1", "333333333333"); err != nil {
+		t.Fatalf("Expected the client without validation, got: %v", err)
+	}
+	if callerIdentityCalls != 1 {
+		t.Fatalf("Expected no further GetCallerIdentity call, got %d", callerIdentityCalls)
+	}
+	if _, ok := b.IAMClients.get(clientCacheKey{region: "us-east-1", accountID: "333333333333", stsRole: unusableRole}); !ok {
+		t.Fatal("Expected a cached client for account 333333333333")
+	}
+}
+
+func TestClientCache_Eviction(t *testing.T) {
+	key1 := clientCacheKey{region: "us-east-1", accountID: "111111111111"}
+	key2 := clientCacheKey{region: "us-east-1", accountID: "222222222222", stsRole: "role"}
+	key3 := clientCacheKey{region: "us-west-2", accountID: "222222222222", stsRole: "role"}
+
+	c := newClientCache[*iam.IAM](2, time.Hour)
+	c.add(key1, &iam.IAM{})
+	c.add(key2, &iam.IAM{})
+	if _, ok := c.get(key1); !ok {
+		t.Fatal("Expected client of account 1 to be cached")
+	}
+
+	// Account 2 is the least recently used
+	c.add(key3, &iam.IAM{})
+	if _, ok := c.get(key2); ok {
+		t.Fatal("Expected least recently used client to be evicted")
+	}
+	if _, ok := c.get(key1); !ok {
+		t.Fatal("Expected client of account 1 to be cached")
+	}
+
+	c.flushAccount("222222222222")
+	if _, ok := c.get(key3); ok {
+		t.Fatal("Expected clients of account 2 to be flushed")
+	}
+	if _, ok := c.get(key1); !ok {
+		t.Fatal("Expected client of account 1 to be cached")
+	}
+
+	c = newClientCache[*iam.IAM](2, time.Millisecond)
+	c.add(key1, &iam.IAM{})
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.get(key1); ok {
+		t.Fatal("Expected client to expire")
+	}
+
+	// Writing and deleting the STS configuration flushes the clients of the account
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []logical.Operation{logical.CreateOperation, logical.DeleteOperation} {
+		b.IAMClients.add(key1, &iam.IAM{})
+		b.EC2Clients.add(key2, &ec2.EC2{})
+
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: op,
+			Path:      "config/sts/222222222222",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"sts_role": "arn:aws:iam::222222222222:role/cross-account-role",
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("Failed to %s STS config: resp:%#v err:%v", op, resp, err)
+		}
+
+		if _, ok := b.EC2Clients.get(key2); ok {
+			t.Fatalf("Expected clients of account 2 to be flushed on %s", op)
+		}
+		if _, ok := b.IAMClients.get(key1); !ok {
+			t.Fatalf("Expected client of account 1 to be cached on %s", op)
+		}
+	}
+}
+
+// TestClientConfig_RequireIMDSv2 verifies that instance profile credentials
+// are fetched with IMDSv2 when required, and that an instance metadata service
+// only offering IMDSv1 fails instead of being used without a session token
+func TestClientConfig_RequireIMDSv2(t *testing.T) {
+	// Keep the credential chain from finding credentials of the environment
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	const token = "imdsv2-token"
+	imdsv1Only := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			if imdsv1Only {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			fmt.Fprint(w, token)
+		case r.Header.Get("X-Aws-Ec2-Metadata-Token") != token:
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "instance-role")
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/instance-role":
+			fmt.Fprintf(w, `{
+  "Code": "Success",
+  "AccessKeyId": "ASIAEXAMPLE",
+  "SecretAccessKey": "secret",
+  "Token": "session",
+  "Expiration": %q
+}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.imdsEndpoint = ts.URL
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/client",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"require_imdsv2": true,
+			"imds_timeout":   "2s",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write client config: resp:%#v err:%v", resp, err)
+	}
+
+	clientConfig, err := b.getRawClientConfig(ctx, storage, "us-east-1", "ec2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := clientConfig.Credentials.Get()
+	if err != nil {
+		t.Fatalf("expected instance profile credentials, got error: %v", err)
+	}
+	if creds.AccessKeyID != "ASIAEXAMPLE" {
+		t.Fatalf("expected instance profile credentials, got access key %q", creds.AccessKeyID)
+	}
+
+	imdsv1Only = true
+	clientConfig, err = b.getRawClientConfig(ctx, storage, "us-east-1", "ec2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = clientConfig.Credentials.Get()
+	if err == nil {
+		t.Fatal("expected error fetching credentials without IMDSv2")
+	}
+	if !strings.Contains(err.Error(), "require_imdsv2") {
+		t.Fatalf("expected error to explain that IMDSv2 is required, got: %v", err)
+	}
+}
+
+// TestCheckStsPartition verifies that STS roles in another partition than
+// their STS region or endpoint are rejected, both when the STS configuration
+// of an account is written and when its role is assumed
+func TestCheckStsPartition(t *testing.T) {
+	const govRole = "arn:aws-us-gov:iam::222222222222:role/cross-account-role"
+
+	tests := map[string]struct {
+		role, region, endpoint string
+		wantErr                bool
+	}{
+		"commercial defaults":               {"arn:aws:iam::222222222222:role/r", "", "", false},
+		"commercial region":                 {"arn:aws:iam::222222222222:role/r", "us-east-1", "", false},
+		"govcloud region":                   {govRole, "us-gov-west-1", "", false},
+		"govcloud fips endpoint":            {govRole, "us-gov-west-1", "https://sts.us-gov-west-1.amazonaws.com", false},
+		"govcloud privatelink":              {govRole, "", "vpce-0123.sts.us-gov-east-1.vpce.amazonaws.com", false},
+		"govcloud with commercial region":   {govRole, "us-east-1", "", true},
+		"govcloud with commercial endpoint": {govRole, "", "https://sts.amazonaws.com", true},
+		"commercial with govcloud endpoint": {"arn:aws:iam::222222222222:role/r", "", "https://sts.us-gov-west-1.amazonaws.com", true},
+		"china with commercial endpoint":    {"arn:aws-cn:iam::222222222222:role/r", "", "https://sts.cn-north-1.amazonaws.com.cn", false},
+		"govcloud with proxy endpoint":      {govRole, "", "https://sts-proxy.example.com", false},
+		"role name":                         {"cross-account-role", "us-east-1", "", false},
+	}
+	for name, tt := range tests {
+		err := checkStsPartition(tt.role, tt.region, tt.endpoint)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: expected error %t, got: %v", name, tt.wantErr, err)
+		}
+	}
+
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/sts/222222222222",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"sts_role":     govRole,
+			"sts_endpoint": "https://sts.us-east-1.amazonaws.com",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "aws-us-gov") {
+		t.Fatalf("expected GovCloud role with commercial endpoint to be rejected, got: %#v", resp)
+	}
+
+	// The sts_region of config/client is only known when the role is assumed
+	entry, err := logical.StorageEntryJSON("config/client", &clientConfig{
+		AccessKey:  "AKIAEXAMPLE",
+		SecretKey:  "secret",
+		STSRegion:  "us-east-1",
+		MaxRetries: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.getStsClientConfig(ctx, storage, "us-gov-west-1", &awsStsEntry{StsRole: govRole}); err == nil {
+		t.Fatal("expected GovCloud role with the commercial sts_region of config/client to be rejected")
+	}
+	if _, err := b.getStsClientConfig(ctx, storage, "us-gov-west-1", &awsStsEntry{StsRole: govRole, StsRegion: "us-gov-west-1"}); err != nil {
+		t.Fatalf("expected GovCloud role with GovCloud sts_region to be accepted, got: %v", err)
+	}
+}
+
+// TestClientConfig_UseFIPSEndpoint verifies that use_fips_endpoint resolves
+// the FIPS endpoints of the clients, and that clients are otherwise unchanged
+func TestClientConfig_UseFIPSEndpoint(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig := func(data map[string]interface{}) {
+		t.Helper()
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config/client",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to write client config: resp:%#v err:%v", resp, err)
+		}
+	}
+	resolve := func(region string) string {
+		t.Helper()
+		clientConfig, err := b.getRawClientConfig(ctx, storage, region, "sts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess, err := session.NewSession(clientConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sts.New(sess).Endpoint
+	}
+
+	writeConfig(map[string]interface{}{
+		"access_key":  "AKIAEXAMPLE",
+		"secret_key":  "secret",
+		"max_retries": -1,
+	})
+	if endpoint := resolve("us-east-1"); endpoint != "https://sts.amazonaws.com" {
+		t.Fatalf("expected the commercial STS endpoint by default, got: %q", endpoint)
+	}
+
+	writeConfig(map[string]interface{}{"use_fips_endpoint": true})
+	if endpoint := resolve("us-east-1"); endpoint != "https://sts-fips.us-east-1.amazonaws.com" {
+		t.Fatalf("expected the FIPS STS endpoint, got: %q", endpoint)
+	}
+	if endpoint := resolve("us-gov-west-1"); endpoint != "https://sts.us-gov-west-1.amazonaws.com" {
+		t.Fatalf("expected the GovCloud FIPS STS endpoint, got: %q", endpoint)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/client",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to read client config: resp:%#v err:%v", resp, err)
+	}
+	if resp.Data["use_fips_endpoint"] != true {
+		t.Fatalf("expected use_fips_endpoint to be read back, got: %v", resp.Data["use_fips_endpoint"])
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/textproto"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/hashicorp/go-secure-stdlib/strutil"
@@ -17,6 +18,14 @@ import (
 	"github.com/openbao/openbao/sdk/v2/logical"
 )
 
+// defaultIMDSTimeout is how long requests to the instance metadata service
+// may take with require_imdsv2, unless imds_timeout is configured
+const defaultIMDSTimeout = time.Second
+
+// defaultSTSNegativeCacheTTL is how long accounts without an STS
+// configuration are remembered, unless sts_negative_cache_ttl is configured
+const defaultSTSNegativeCacheTTL = 5 * time.Second
+
 func (b *backend) pathConfigClient() *framework.Path {
 	return &framework.Path{
 		Pattern: "config/client$",
@@ -85,6 +94,36 @@ func (b *backend) pathConfigClient() *framework.Path {
 				Default:     aws.UseServiceDefaultRetries,
 				Description: "Maximum number of retries for recoverable exceptions of AWS APIs",
 			},
+
+			"require_imdsv2": {
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: "Only fetch instance profile credentials with IMDSv2, failing instead of falling back to IMDSv1.",
+			},
+
+			"use_fips_endpoint": {
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: "Resolve the FIPS endpoints of EC2, IAM and STS for the region of each client. Endpoints set explicitly are used as is.",
+			},
+
+			"skip_sts_role_validation": {
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: "Skip checking with GetCallerIdentity that the credentials of the STS role of an account can be used before caching its clients, saving a call to STS.",
+			},
+
+			"imds_timeout": {
+				Type:        framework.TypeDurationSecond,
+				Default:     int(defaultIMDSTimeout.Seconds()),
+				Description: "Timeout of requests to the instance metadata service when require_imdsv2 is set.",
+			},
+
+			"sts_negative_cache_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Default:     int(defaultSTSNegativeCacheTTL.Seconds()),
+				Description: "How long accounts without an STS configuration are remembered, so that repeated requests for them do not read the storage. Set to 0 to disable.",
+			},
 		},
 
 		ExistenceCheck: b.pathConfigClientExistenceCheck,
@@ -151,7 +190,9 @@ func (b *backend) nonLockedClientConfigEntry(ctx context.Context, s logical.Stor
 		return nil, nil
 	}
 
-	var result clientConfig
+	// Configurations stored before sts_negative_cache_ttl was added keep
+	// its default
+	result := clientConfig{STSNegativeCacheTTL: defaultSTSNegativeCacheTTL}
 	if err := entry.DecodeJSON(&result); err != nil {
 		return nil, err
 	}
@@ -179,6 +220,11 @@ func (b *backend) pathConfigClientRead(ctx context.Context, req *logical.Request
 			"iam_server_id_header_value": clientConfig.IAMServerIdHeaderValue,
 			"max_retries":                clientConfig.MaxRetries,
 			"allowed_sts_header_values":  clientConfig.AllowedSTSHeaderValues,
+			"require_imdsv2":             clientConfig.RequireIMDSv2,
+			"use_fips_endpoint":          clientConfig.UseFIPSEndpoint,
+			"skip_sts_role_validation":   clientConfig.SkipSTSRoleValidation,
+			"imds_timeout":               int64(clientConfig.IMDSTimeout.Seconds()),
+			"sts_negative_cache_ttl":     int64(clientConfig.STSNegativeCacheTTL.Seconds()),
 		},
 	}, nil
 }
@@ -199,6 +245,7 @@ func (b *backend) pathConfigClientDelete(ctx context.Context, req *logical.Reque
 
 	// unset the cached default AWS account ID
 	b.defaultAWSAccountID = ""
+	b.stsMissCache.Flush()
 
 	return nil, nil
 }
@@ -334,6 +381,59 @@ func (b *backend) pathConfigClientCreateUpdate(ctx context.Context, req *logical
 		configEntry.MaxRetries = data.Get("max_retries").(int)
 	}
 
+	requireIMDSv2Raw, ok := data.GetOk("require_imdsv2")
+	if ok {
+		if configEntry.RequireIMDSv2 != requireIMDSv2Raw.(bool) {
+			// The credential chain of the cached clients changes
+			changedCreds = true
+			configEntry.RequireIMDSv2 = requireIMDSv2Raw.(bool)
+		}
+	}
+
+	useFIPSEndpointRaw, ok := data.GetOk("use_fips_endpoint")
+	if ok {
+		if configEntry.UseFIPSEndpoint != useFIPSEndpointRaw.(bool) {
+			// The endpoints of the cached clients change
+			changedCreds = true
+			configEntry.UseFIPSEndpoint = useFIPSEndpointRaw.(bool)
+		}
+	}
+
+	skipSTSRoleValidationRaw, ok := data.GetOk("skip_sts_role_validation")
+	if ok {
+		configEntry.SkipSTSRoleValidation = skipSTSRoleValidationRaw.(bool)
+		changedOtherConfig = true
+	}
+
+	imdsTimeoutRaw, ok := data.GetOk("imds_timeout")
+	if ok {
+		imdsTimeout := time.Duration(imdsTimeoutRaw.(int)) * time.Second
+		if imdsTimeout <= 0 {
+			return logical.ErrorResponse("imds_timeout must be positive"), nil
+		}
+		if configEntry.IMDSTimeout != imdsTimeout {
+			changedCreds = true
+			configEntry.IMDSTimeout = imdsTimeout
+		}
+	} else if req.Operation == logical.CreateOperation {
+		configEntry.IMDSTimeout = defaultIMDSTimeout
+	}
+
+	stsNegativeCacheTTLRaw, ok := data.GetOk("sts_negative_cache_ttl")
+	if ok {
+		stsNegativeCacheTTL := time.Duration(stsNegativeCacheTTLRaw.(int)) * time.Second
+		if stsNegativeCacheTTL < 0 {
+			return logical.ErrorResponse("sts_negative_cache_ttl cannot be negative"), nil
+		}
+		if configEntry.STSNegativeCacheTTL != stsNegativeCacheTTL {
+			changedOtherConfig = true
+			configEntry.STSNegativeCacheTTL = stsNegativeCacheTTL
+			b.stsMissCache.Flush()
+		}
+	} else if req.Operation == logical.CreateOperation {
+		configEntry.STSNegativeCacheTTL = defaultSTSNegativeCacheTTL
+	}
+
 	// Since this endpoint supports both create operation and update operation,
 	// the error checks for access_key and secret_key not being set are not present.
 	// This allows calling this endpoint multiple times to provide the values.
@@ -354,6 +454,7 @@ func (b *backend) pathConfigClientCreateUpdate(ctx context.Context, req *logical
 		b.flushCachedEC2Clients()
 		b.flushCachedIAMClients()
 		b.defaultAWSAccountID = ""
+		b.stsMissCache.Flush()
 	}
 
 	return nil, nil
@@ -373,16 +474,21 @@ func (b *backend) configClientToEntry(conf *clientConfig) (*logical.StorageEntry
 // Struct to hold 'aws_access_key' and 'aws_secret_key' that are required to
 // interact with the AWS EC2 API.
 type clientConfig struct {
-	AccessKey              string   `json:"access_key"`
-	SecretKey              string   `json:"secret_key"`
-	Endpoint               string   `json:"endpoint"`
-	IAMEndpoint            string   `json:"iam_endpoint"`
-	STSEndpoint            string   `json:"sts_endpoint"`
-	STSRegion              string   `json:"sts_region"`
-	UseSTSRegionFromClient bool     `json:"use_sts_region_from_client"`
-	IAMServerIdHeaderValue string   `json:"iam_server_id_header_value"`
-	AllowedSTSHeaderValues []string `json:"allowed_sts_header_values"`
-	MaxRetries             int      `json:"max_retries"`
+	AccessKey              string        `json:"access_key"`
+	SecretKey              string        `json:"secret_key"`
+	Endpoint               string        `json:"endpoint"`
+	IAMEndpoint            string        `json:"iam_endpoint"`
+	STSEndpoint            string        `json:"sts_endpoint"`
+	STSRegion              string        `json:"sts_region"`
+	UseSTSRegionFromClient bool          `json:"use_sts_region_from_client"`
+	IAMServerIdHeaderValue string        `json:"iam_server_id_header_value"`
+	AllowedSTSHeaderValues []string      `json:"allowed_sts_header_values"`
+	MaxRetries             int           `json:"max_retries"`
+	RequireIMDSv2          bool          `json:"require_imdsv2"`
+	UseFIPSEndpoint        bool          `json:"use_fips_endpoint"`
+	IMDSTimeout            time.Duration `json:"imds_timeout"`
+	STSNegativeCacheTTL    time.Duration `json:"sts_negative_cache_ttl"`
+	SkipSTSRoleValidation  bool          `json:"skip_sts_role_validation"`
 }
 
 func (c *clientConfig) validateAllowedSTSHeaderValues(headers http.Header) error {
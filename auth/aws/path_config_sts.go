@@ -6,6 +6,10 @@ package aws
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/openbao/openbao/sdk/v2/framework"
 	"github.com/openbao/openbao/sdk/v2/logical"
@@ -14,6 +18,67 @@ import (
 // awsStsEntry is used to store details of an STS role for assumption
 type awsStsEntry struct {
 	StsRole string `json:"sts_role"`
+
+	// StsRoleChain are the intermediary roles assumed in order before
+	// StsRole, each with the credentials of the previous one
+	StsRoleChain []string `json:"sts_role_chain"`
+
+	// ExternalID is passed when assuming StsRole, if set
+	ExternalID string `json:"external_id"`
+
+	// StsRegion and StsEndpoint override the region and endpoint of
+	// config/client for the STS client used to assume StsRole
+	StsRegion   string `json:"sts_region"`
+	StsEndpoint string `json:"sts_endpoint"`
+
+	// SessionTags are passed as session tags when assuming StsRole
+	SessionTags map[string]string `json:"session_tags"`
+
+	// Duration is how long the assumed credentials are valid for, or the
+	// default of the SDK if zero
+	Duration time.Duration `json:"duration"`
+}
+
+const (
+	// minStsDuration and maxStsDuration bound the duration of assumed
+	// role sessions accepted by AWS
+	minStsDuration = 15 * time.Minute
+	maxStsDuration = 12 * time.Hour
+
+	// maxStsSessionTags is the maximum number of session tags accepted by AWS
+	maxStsSessionTags = 50
+
+	// maxChainedStsDuration is the maximum duration of sessions of roles
+	// assumed with the credentials of another assumed role
+	maxChainedStsDuration = time.Hour
+)
+
+// roleChain returns the roles assumed in order to assume the STS role of the
+// entry, ending with the STS role itself
+func (e *awsStsEntry) roleChain() []string {
+	return append(slices.Clone(e.StsRoleChain), e.StsRole)
+}
+
+// sessionKey identifies the session tags and duration of the entry, so that
+// clients assuming the same role with other session parameters are cached
+// separately
+func (e *awsStsEntry) sessionKey() string {
+	if len(e.SessionTags) == 0 && e.Duration == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(e.SessionTags))
+	for key := range e.SessionTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d", int64(e.Duration.Seconds()))
+	for _, key := range keys {
+		fmt.Fprintf(&sb, ";%q=%q", key, e.SessionTags[key])
+	}
+	return sb.String()
 }
 
 func (b *backend) pathListSts() *framework.Path {
@@ -57,6 +122,39 @@ instances in this account.`,
 				Description: `AWS ARN for STS role to be assumed when interacting with the account specified.
 The Vault server must have permissions to assume this role.`,
 			},
+			"sts_role_chain": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `AWS ARNs of intermediary roles assumed in order before the STS
+role, each with the credentials of the previous one. The STS role is assumed
+with the credentials of the last of them.`,
+			},
+			"external_id": {
+				Type: framework.TypeString,
+				Description: `External ID to pass when assuming the STS role, if required by
+the trust policy of the role.`,
+			},
+			"sts_region": {
+				Type: framework.TypeString,
+				Description: `Region of the regional STS endpoint used to assume the STS role,
+overriding the sts_region of config/client. Use this when the global STS
+endpoint is not reachable.`,
+			},
+			"sts_endpoint": {
+				Type: framework.TypeString,
+				Description: `URL of the STS endpoint used to assume the STS role, overriding
+the sts_endpoint of config/client, such as a PrivateLink endpoint.`,
+			},
+			"session_tags": {
+				Type: framework.TypeKVPairs,
+				Description: `Session tags to pass when assuming the STS role, for
+attribute-based access control. The trust policy of the role must allow
+sts:TagSession.`,
+			},
+			"duration_seconds": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long the credentials of the assumed STS role are valid
+for, between 900 seconds and 43200 seconds. Defaults to 900 seconds.`,
+			},
 		},
 
 		ExistenceCheck: b.pathConfigStsExistenceCheck,
@@ -129,7 +227,16 @@ func (b *backend) nonLockedSetAwsStsEntry(ctx context.Context, s logical.Storage
 		return fmt.Errorf("failed to create storage entry for AWS STS configuration")
 	}
 
-	return s.Put(ctx, entry)
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	// Clients of the account may have been created using the previous
+	// configuration, and the account may have been found to lack one
+	b.flushCachedAccountClients(accountID)
+	b.stsMissCache.Delete(accountID)
+
+	return nil
 }
 
 // lockedSetAwsStsEntry creates or updates an STS role association with the given accountID
@@ -194,7 +301,13 @@ func (b *backend) pathConfigStsRead(ctx context.Context, req *logical.Request, d
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"sts_role": stsEntry.StsRole,
+			"sts_role":         stsEntry.StsRole,
+			"sts_role_chain":   stsEntry.StsRoleChain,
+			"external_id":      stsEntry.ExternalID,
+			"sts_region":       stsEntry.StsRegion,
+			"sts_endpoint":     stsEntry.StsEndpoint,
+			"session_tags":     stsEntry.SessionTags,
+			"duration_seconds": int64(stsEntry.Duration.Seconds()),
 		},
 	}, nil
 }
@@ -230,6 +343,56 @@ func (b *backend) pathConfigStsCreateUpdate(ctx context.Context, req *logical.Re
 		return logical.ErrorResponse("sts role cannot be empty"), nil
 	}
 
+	if stsRoleChain, ok := data.GetOk("sts_role_chain"); ok {
+		stsEntry.StsRoleChain = stsRoleChain.([]string)
+		for _, role := range stsEntry.StsRoleChain {
+			if role == "" {
+				return logical.ErrorResponse("sts_role_chain cannot contain empty roles"), nil
+			}
+		}
+	}
+	if externalID, ok := data.GetOk("external_id"); ok {
+		stsEntry.ExternalID = externalID.(string)
+	}
+	if stsRegion, ok := data.GetOk("sts_region"); ok {
+		stsEntry.StsRegion = stsRegion.(string)
+	}
+	if stsEndpoint, ok := data.GetOk("sts_endpoint"); ok {
+		stsEntry.StsEndpoint = stsEndpoint.(string)
+	}
+	if sessionTags, ok := data.GetOk("session_tags"); ok {
+		stsEntry.SessionTags = sessionTags.(map[string]string)
+		if len(stsEntry.SessionTags) > maxStsSessionTags {
+			return logical.ErrorResponse("at most %d session tags can be passed", maxStsSessionTags), nil
+		}
+		for key := range stsEntry.SessionTags {
+			if key == "" {
+				return logical.ErrorResponse("session tag keys cannot be empty"), nil
+			}
+		}
+	}
+	if duration, ok := data.GetOk("duration_seconds"); ok {
+		stsEntry.Duration = time.Duration(duration.(int)) * time.Second
+		if stsEntry.Duration != 0 && (stsEntry.Duration < minStsDuration || stsEntry.Duration > maxStsDuration) {
+			return logical.ErrorResponse("duration_seconds must be between %d and %d",
+				int64(minStsDuration.Seconds()), int64(maxStsDuration.Seconds())), nil
+		}
+	}
+
+	// AWS limits the sessions of chained roles to one hour
+	if len(stsEntry.StsRoleChain) > 0 && stsEntry.Duration > maxChainedStsDuration {
+		return logical.ErrorResponse("duration_seconds cannot exceed %d with sts_role_chain",
+			int64(maxChainedStsDuration.Seconds())), nil
+	}
+
+	// Fail early on roles that cannot be assumed through the configured STS
+	// region or endpoint, such as GovCloud roles with commercial endpoints
+	for _, role := range stsEntry.roleChain() {
+		if err := checkStsPartition(role, stsEntry.StsRegion, stsEntry.StsEndpoint); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
 	// save the provided STS role
 	if err := b.nonLockedSetAwsStsEntry(ctx, req.Storage, accountID, stsEntry); err != nil {
 		return nil, err
@@ -248,7 +411,12 @@ func (b *backend) pathConfigStsDelete(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("missing account id"), nil
 	}
 
-	return nil, req.Storage.Delete(ctx, "config/sts/"+accountID)
+	if err := req.Storage.Delete(ctx, "config/sts/"+accountID); err != nil {
+		return nil, err
+	}
+	b.flushCachedAccountClients(accountID)
+
+	return nil, nil
 }
 
 const pathConfigStsSyn = `
@@ -3,17 +3,30 @@ package github
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	metrics "github.com/armon/go-metrics"
 	"github.com/google/go-github/github"
 	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
 	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/helper/cidrutil"
 	"github.com/openbao/openbao/sdk/v2/logical"
 	"golang.org/x/oauth2"
 )
 
 const operationPrefixGithub = "github"
 
+// teamFallbackKey is the team mapping applied to users that are members of
+// teams of which none are mapped to policies
+const teamFallbackKey = "*"
+
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
 	b := Backend()
 	if err := b.Setup(ctx, conf); err != nil {
@@ -71,15 +84,54 @@ func setupPolicyMap(name, mappingSuffix string) (*framework.PolicyMap, []*framew
 
 func Backend() *backend {
 	var b backend
+	b.clock = time.Now
+	b.membershipCache = newMembershipCache(b.now)
+	b.organizationCache = newOrganizationCache(b.now)
+	b.enterpriseCache = newEnterpriseCache(b.now)
+	b.parentTeamCache = newParentTeamCache(b.now)
+	b.oidcKeySets = newOIDCKeySetCache()
+	b.metrics = metrics.Default()
 
 	// Setup policy maps for teams and users
 	teamMap, teamMapPaths := setupPolicyMap("teams", "team-mapping")
 	b.TeamMap = teamMap
 
+	// Allow the fallback mapping, which is not a valid team name
+	teamMapPaths[1].Pattern = fmt.Sprintf(`map/teams/(?P<key>[-\w]+|%s)`, regexp.QuoteMeta(teamFallbackKey))
+	teamMapPaths[1].HelpDescription = teamMapHelp
+
+	// Team mappings may only apply to requests from certain networks
+	teamMapPaths[1].Fields["bound_cidrs"] = &framework.FieldSchema{
+		Type: framework.TypeCommaStringSlice,
+		Description: `Comma separated list of CIDR blocks. If set, the policies
+of the mapping are only assigned to logins originating from these blocks.`,
+	}
+	// Team mappings may also be written as a list of policies, and may add
+	// metadata to the tokens of the team's members
+	teamMapPaths[1].Fields["policies"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: "List of policies to assign, in addition to those of value.",
+	}
+	teamMapPaths[1].Fields["metadata"] = &framework.FieldSchema{
+		Type: framework.TypeKVPairs,
+		Description: `Metadata added to the tokens of the team's members. Keys set by the
+auth method itself, such as username and org, cannot be mapped.`,
+	}
+	for _, op := range []logical.Operation{logical.CreateOperation, logical.UpdateOperation} {
+		teamMapPaths[1].Callbacks[op] = teamMapWrite(teamMapPaths[1].Callbacks[op])
+	}
+
 	userMap, userMapPaths := setupPolicyMap("users", "user-mapping")
 	b.UserMap = userMap
 
+	// Roles have no default mapping, as the team and user maps already
+	// provide one for every user
+	roleMap, roleMapPaths := setupPolicyMap("roles", "role-mapping")
+	roleMap.DefaultKey = ""
+	b.RoleMap = roleMap
+
 	allPaths := append(teamMapPaths, userMapPaths...)
+	allPaths = append(allPaths, roleMapPaths...)
 	b.Backend = &framework.Backend{
 		Help: backendHelp,
 
@@ -87,11 +139,16 @@ func Backend() *backend {
 			Unauthenticated: []string{
 				"login",
 			},
+			SealWrapStorage: []string{
+				sessionPrefix,
+			},
 		},
 
-		Paths:       append([]*framework.Path{pathConfig(&b), pathLogin(&b)}, allPaths...),
-		AuthRenew:   b.pathLoginRenew,
-		BackendType: logical.TypeCredential,
+		Paths:        append([]*framework.Path{pathConfig(&b), pathConfigStatus(&b), pathConfigOIDC(&b), pathLogin(&b), pathTestLogin(&b)}, allPaths...),
+		AuthRenew:    b.pathLoginRenew,
+		PeriodicFunc: b.periodicFunc,
+		Invalidate:   b.invalidate,
+		BackendType:  logical.TypeCredential,
 	}
 
 	return &b
@@ -103,12 +160,112 @@ type backend struct {
 	TeamMap *framework.PolicyMap
 
 	UserMap *framework.PolicyMap
+
+	// RoleMap maps the role of a user in the organization, "admin" or
+	// "member", to policies
+	RoleMap *framework.PolicyMap
+
+	// appToken caches the installation token minted when authenticating as
+	// a GitHub App. It is guarded by appTokenLock.
+	appToken     *github.InstallationToken
+	appTokenLock sync.Mutex
+
+	// membershipCache holds the teams resolved for recent logins when
+	// membership_cache_ttl is configured
+	membershipCache *membershipCache
+
+	// organizationCache holds the organizations fetched for recent logins
+	// when organization_cache_ttl is configured
+	organizationCache *organizationCache
+
+	// enterpriseCache holds the licenses of the enterprise listed for recent
+	// logins when enterprise_cache_ttl is configured
+	enterpriseCache *enterpriseCache
+
+	// parentTeamCache holds the parent teams fetched for recent logins when
+	// parent_team_cache_ttl is configured
+	parentTeamCache *parentTeamCache
+
+	// oidcKeySets holds the keys fetched to verify the OIDC tokens of
+	// GitHub Actions workflows
+	oidcKeySets *oidcKeySetCache
+
+	// nextRevalidation is when the sessions are revalidated next when
+	// revalidation_interval is configured. It is guarded by
+	// revalidationLock.
+	nextRevalidation time.Time
+	revalidationLock sync.Mutex
+
+	// httpClient, if set, sends the requests to GitHub instead of a cleanhttp
+	// transport with the configured proxy and TLS settings. Tests set it to
+	// reach a test server.
+	httpClient *http.Client
+
+	// transport is shared by the clients of all requests, so that
+	// connections to GitHub are reused across logins. It is rebuilt when the
+	// settings in transportKey change, and guarded by transportLock.
+	transport     *http.Transport
+	transportKey  transportSettings
+	transportLock sync.Mutex
+
+	// clock returns the current time, tests set it to control expirations
+	clock func() time.Time
+
+	// metrics emits the metrics of logins and renewals. It is the global
+	// go-metrics instance of the process, tests set their own.
+	metrics *metrics.Metrics
+}
+
+// invalidate drops the state cached from a configuration written on another
+// node, such as the active node of the cluster
+func (b *backend) invalidate(_ context.Context, key string) {
+	switch key {
+	case "config":
+		b.resetConfigCaches()
+	case oidcConfigPath:
+		b.oidcKeySets.reset()
+	}
+}
+
+// resetConfigCaches drops the installation token and everything fetched from
+// GitHub with the previous configuration
+func (b *backend) resetConfigCaches() {
+	// Any cached installation token may belong to a different app
+	b.resetAppToken()
+
+	// Cached teams may have been resolved for other organizations
+	b.membershipCache.reset()
+	b.organizationCache.reset()
+	b.enterpriseCache.reset()
+	b.parentTeamCache.reset()
+
+	// A changed revalidation_interval applies from the next sweep on
+	b.resetRevalidation()
+}
+
+// now returns the current time according to the clock of the backend
+func (b *backend) now() time.Time {
+	return b.clock()
 }
 
 // Client returns the GitHub client to communicate to GitHub via the
-// configured settings.
-func (b *backend) Client(token string) (*github.Client, error) {
-	tc := cleanhttp.DefaultClient()
+// configured settings. Requests that are rate limited by GitHub are retried
+// as configured, and all requests are sent through the configured proxy
+// trusting the configured CA certificate.
+func (b *backend) Client(token string, config *config) (*github.Client, error) {
+	transport, err := b.httpTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &http.Client{
+		Transport: &rateLimitTransport{
+			base:         transport,
+			maxRetries:   config.MaxRetries,
+			maxRetryWait: config.MaxRetryWait,
+		},
+		Timeout: config.RequestTimeout,
+	}
 	if token != "" {
 		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, tc)
 		tc = oauth2.NewClient(ctx, &tokenSource{Value: token})
@@ -126,6 +283,74 @@ func (b *backend) Client(token string) (*github.Client, error) {
 	return client, nil
 }
 
+// transportSettings are the settings of config the shared transport is
+// built from
+type transportSettings struct {
+	proxyURL            string
+	caCert              string
+	tlsSkipVerify       bool
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+}
+
+// httpTransport returns the transport requests to GitHub are sent with. The
+// transport keeps idle connections open as configured and is shared until
+// the settings change, when the idle connections of the previous transport
+// are closed.
+func (b *backend) httpTransport(config *config) (http.RoundTripper, error) {
+	if b.httpClient != nil {
+		if b.httpClient.Transport == nil {
+			return http.DefaultTransport, nil
+		}
+		return b.httpClient.Transport, nil
+	}
+
+	key := transportSettings{
+		proxyURL:            config.ProxyURL,
+		caCert:              config.CACert,
+		tlsSkipVerify:       config.TLSSkipVerify,
+		maxIdleConns:        config.MaxIdleConns,
+		maxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		idleConnTimeout:     config.IdleConnTimeout,
+	}
+
+	b.transportLock.Lock()
+	defer b.transportLock.Unlock()
+
+	if b.transport != nil && b.transportKey == key {
+		return b.transport, nil
+	}
+
+	transport := cleanhttp.DefaultPooledTransport()
+	transport.MaxIdleConns = config.MaxIdleConns
+	transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = config.IdleConnTimeout
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse configured proxy_url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if b.transport != nil {
+		b.transport.CloseIdleConnections()
+	}
+	b.transport = transport
+	b.transportKey = key
+
+	return transport, nil
+}
+
 // tokenSource is an oauth2.TokenSource implementation.
 type tokenSource struct {
 	Value string
@@ -135,6 +360,44 @@ func (t *tokenSource) Token() (*oauth2.Token, error) {
 	return &oauth2.Token{AccessToken: t.Value}, nil
 }
 
+// teamMapWrite validates the bound CIDRs and metadata of a team mapping
+// before it is written by write
+func teamMapWrite(write framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if boundCIDRsRaw, ok := d.GetOk("bound_cidrs"); ok {
+			boundCIDRs := boundCIDRsRaw.([]string)
+			if valid, err := cidrutil.ValidateCIDRListSlice(boundCIDRs); err != nil || !valid {
+				return logical.ErrorResponse("invalid bound_cidrs: %v", boundCIDRs), nil
+			}
+			// The mapping is stored as written, so keep the parsed list
+			d.Raw["bound_cidrs"] = boundCIDRs
+		}
+
+		// The policies of the default mapping are read from value, so listed
+		// policies are stored there as well
+		if policiesRaw, ok := d.GetOk("policies"); ok {
+			policies := policiesRaw.([]string)
+			if value, ok := d.GetOk("value"); ok {
+				policies = append(strings.Split(value.(string), ","), policies...)
+			}
+			d.Raw["value"] = strings.Join(strutil.RemoveDuplicates(policies, false), ",")
+			delete(d.Raw, "policies")
+		}
+
+		if metadataRaw, ok := d.GetOk("metadata"); ok {
+			metadata := metadataRaw.(map[string]string)
+			for key := range metadata {
+				if slices.Contains(reservedMetadataKeys, key) {
+					return logical.ErrorResponse("metadata key %q is reserved", key), nil
+				}
+			}
+			d.Raw["metadata"] = metadata
+		}
+
+		return write(ctx, req, d)
+	}
+}
+
 const backendHelp = `
 The GitHub credential provider allows authentication via GitHub.
 
@@ -146,3 +409,29 @@ part of.
 After enabling the credential provider, use the "config" route to
 configure it.
 `
+
+const teamMapHelp = `
+Maps a GitHub team, by name, slug or "id-<team_id>", to a comma separated
+list of policies.
+
+Two keys are reserved:
+
+  default  Its policies are assigned to every user, even users that are not
+           a member of any team.
+
+  *        Its policies are only assigned to users that are a member of at
+           least one team, but of no team that is mapped to policies.
+
+The policies of the "default" mapping are always combined with those of the
+user's teams. The "*" mapping is only a fallback: as soon as any of the
+user's teams is mapped explicitly, it is not applied.
+
+Mappings with bound_cidrs only assign their policies to logins from those
+CIDR blocks. Logins from elsewhere still succeed without these policies.
+
+Policies may also be given as a list in policies, which are stored with those
+of value. The metadata of a mapping is added to the tokens of the team's
+members. When several mappings set the same key, the first one wins: teams
+are merged in the order of their slugs, and the default and "*" mappings
+after all teams.
+`
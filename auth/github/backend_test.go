@@ -2,10 +2,15 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -384,3 +389,201 @@ func TestFactory_WithConfig(t *testing.T) {
 		t.Fatal("Factory() returned nil backend")
 	}
 }
+
+// TestBackend_ClientRetriesRateLimit tests that requests rejected by a
+// secondary rate limit are retried after the Retry-After window
+func TestBackend_ClientRetriesRateLimit(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintln(w, `{"message": "You have triggered an abuse detection mechanism.", "documentation_url": "https://developer.github.com/v3/#abuse-rate-limits"}`)
+			return
+		}
+		fmt.Fprintln(w, getUserResponse)
+	}))
+	defer ts.Close()
+
+	b := Backend()
+	client, err := b.clientForConfig("faketoken", &config{
+		BaseURL:      ts.URL + "/",
+		MaxRetries:   1,
+		MaxRetryWait: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	user, _, err := client.Users.Get(context.Background(), "")
+	if err != nil {
+		t.Fatalf("expected the rate limited request to be retried, got: %v", err)
+	}
+	if user.GetLogin() != "user-foo" {
+		t.Errorf("unexpected user %q", user.GetLogin())
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+
+	// Without retries the rate limit error is returned
+	requests = 0
+	client, err = b.clientForConfig("faketoken", &config{BaseURL: ts.URL + "/"})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	_, _, err = client.Users.Get(context.Background(), "")
+	if !isRateLimitError(err) {
+		t.Errorf("expected a rate limit error, got: %v", err)
+	}
+}
+
+// TestBackend_ClientRateLimitWindows tests that requests rejected with 429
+// honor Retry-After, and that rate limits lifting only after max_retry_wait
+// are reported without retrying
+func TestBackend_ClientRateLimitWindows(t *testing.T) {
+	var requests int
+	var limit func(w http.ResponseWriter)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			limit(w)
+			return
+		}
+		fmt.Fprintln(w, getUserResponse)
+	}))
+	defer ts.Close()
+
+	b := Backend()
+
+	tests := map[string]struct {
+		limit    func(w http.ResponseWriter)
+		requests int
+		limited  bool
+	}{
+		"429 within max_retry_wait": {
+			limit: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprintln(w, `{"message": "You have exceeded a secondary rate limit."}`)
+			},
+			requests: 2,
+		},
+		"429 beyond max_retry_wait": {
+			limit: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "3600")
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprintln(w, `{"message": "You have exceeded a secondary rate limit."}`)
+			},
+			requests: 1,
+			limited:  true,
+		},
+		"403 with Retry-After date beyond max_retry_wait": {
+			limit: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintln(w, `{"message": "You have exceeded a secondary rate limit."}`)
+			},
+			requests: 1,
+			limited:  true,
+		},
+		"primary reset beyond max_retry_wait": {
+			limit: func(w http.ResponseWriter) {
+				w.Header().Set(headerRateRemaining, "0")
+				w.Header().Set(headerRateReset, fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintln(w, `{"message": "API rate limit exceeded for user ID 1."}`)
+			},
+			requests: 1,
+			limited:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			requests = 0
+			limit = tc.limit
+
+			// The GitHub client remembers exhausted primary rate limits
+			client, err := b.clientForConfig("faketoken", &config{
+				BaseURL:      ts.URL + "/",
+				MaxRetries:   3,
+				MaxRetryWait: time.Second,
+			})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			_, _, err = client.Users.Get(context.Background(), "")
+			if tc.limited != isRateLimitError(err) {
+				t.Errorf("expected rate limited %t, got: %v", tc.limited, err)
+			}
+			if !tc.limited && err != nil {
+				t.Errorf("expected the rate limited request to be retried, got: %v", err)
+			}
+			if requests != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, requests)
+			}
+		})
+	}
+}
+
+func TestBackend_ClientReusesConnections(t *testing.T) {
+	var lock sync.Mutex
+	var conns int
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, getUserResponse)
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			lock.Lock()
+			conns++
+			lock.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	b := Backend()
+	c := newConfig()
+	c.BaseURL = ts.URL + "/"
+
+	// Clients of separate logins share the idle connection
+	for i := 0; i < 3; i++ {
+		client, err := b.clientForConfig("faketoken", c)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		if _, _, err := client.Users.Get(context.Background(), ""); err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+	}
+	lock.Lock()
+	if conns != 1 {
+		t.Errorf("expected 1 connection, got %d", conns)
+	}
+	lock.Unlock()
+
+	transport := b.transport
+	if transport.MaxIdleConns != defaultMaxIdleConns ||
+		transport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost ||
+		transport.IdleConnTimeout != defaultIdleConnTimeout {
+		t.Errorf("unexpected transport settings: %d, %d, %s",
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	// Changed settings build a new transport
+	c.MaxIdleConnsPerHost = 5
+	c.IdleConnTimeout = time.Minute
+	if _, err := b.clientForConfig("faketoken", c); err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if b.transport == transport {
+		t.Fatal("expected a new transport after the settings changed")
+	}
+	if b.transport.MaxIdleConnsPerHost != 5 || b.transport.IdleConnTimeout != time.Minute {
+		t.Errorf("unexpected transport settings: %d, %s",
+			b.transport.MaxIdleConnsPerHost, b.transport.IdleConnTimeout)
+	}
+}
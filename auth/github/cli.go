@@ -0,0 +1,376 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-secure-stdlib/password"
+	"github.com/openbao/openbao/api/v2"
+)
+
+const (
+	// defaultGitHubURL is where the device flow is started unless a GitHub
+	// Enterprise Server URL is given
+	defaultGitHubURL = "https://github.com"
+
+	// defaultDeviceScope lets the backend read the organization and team
+	// memberships of the user
+	defaultDeviceScope = "read:org"
+
+	// defaultDevicePollInterval is used when GitHub does not specify how
+	// often to poll for the device flow token
+	defaultDevicePollInterval = 5
+
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+type CLIHandler struct {
+	// for tests
+	testStdin    io.Reader
+	testStdout   io.Writer
+	testPollUnit time.Duration
+}
+
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (*api.Secret, error) {
+	mount, ok := m["mount"]
+	if !ok {
+		mount = "github"
+	}
+
+	var token string
+	var err error
+	switch method := m["method"]; method {
+	case "", "token":
+		token, err = h.promptForToken(m)
+	case "device":
+		token, err = h.deviceFlowToken(m)
+	default:
+		return nil, fmt.Errorf("unsupported method %q, must be \"token\" or \"device\"", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return h.performLogin(c, mount, token)
+}
+
+// getStdin returns where tokens passed as "-" are read from
+func (h *CLIHandler) getStdin() io.Reader {
+	if h.testStdin != nil {
+		return h.testStdin
+	}
+	return os.Stdin
+}
+
+// getStdout returns where to write messages for the user. Messages are
+// written to stderr so they do not mix with the output of the command.
+func (h *CLIHandler) getStdout() io.Writer {
+	if h.testStdout != nil {
+		return h.testStdout
+	}
+	return os.Stderr
+}
+
+// promptForToken returns the personal access token given as argument, read
+// from the given file or found in the environment, prompting for it otherwise.
+// The token may be given as an Authorization header value, whose scheme is
+// stripped.
+func (h *CLIHandler) promptForToken(m map[string]string) (string, error) {
+	token, err := h.getToken(m)
+	if err != nil {
+		return "", err
+	}
+	return stripAuthScheme(token), nil
+}
+
+// getToken returns the personal access token from the first source it is
+// given by
+func (h *CLIHandler) getToken(m map[string]string) (string, error) {
+	if token := m["token"]; token == "-" {
+		return h.readStdinToken()
+	} else if token != "" {
+		return token, nil
+	}
+	if path := m["token_path"]; path != "" {
+		return readTokenFile(path)
+	}
+	if token := os.Getenv("VAULT_AUTH_GITHUB_TOKEN"); token != "" {
+		return token, nil
+	}
+	if path := os.Getenv("VAULT_AUTH_GITHUB_TOKEN_FILE"); path != "" {
+		return readTokenFile(path)
+	}
+
+	stdout := h.getStdout()
+	fmt.Fprintf(stdout, "GitHub Personal Access Token (will be hidden): ")
+	token, err := password.Read(os.Stdin)
+	fmt.Fprintf(stdout, "\n")
+	if err != nil {
+		if err == password.ErrInterrupted {
+			return "", fmt.Errorf("user interrupted")
+		}
+
+		return "", fmt.Errorf("An error occurred attempting to "+
+			"ask for a token. The raw error message is shown below, but usually "+
+			"this is because you attempted to pipe a value into the command or "+
+			"you are executing outside of a terminal (tty). The raw error was: %s", err)
+	}
+
+	return token, nil
+}
+
+// readStdinToken reads the token piped to stdin, without prompting for it
+func (h *CLIHandler) readStdinToken() (string, error) {
+	contents, err := io.ReadAll(h.getStdin())
+	if err != nil {
+		return "", fmt.Errorf("failed to read token from stdin: %w", err)
+	}
+
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return "", errors.New("no token was given on stdin")
+	}
+	return token, nil
+}
+
+// stripAuthScheme strips the "Bearer" or "token" scheme of an Authorization
+// header value from the token
+func stripAuthScheme(token string) string {
+	token = strings.TrimSpace(token)
+	for _, scheme := range []string{"bearer ", "token "} {
+		if len(token) > len(scheme) && strings.EqualFold(token[:len(scheme)], scheme) {
+			return strings.TrimSpace(token[len(scheme):])
+		}
+	}
+	return token
+}
+
+// readTokenFile returns the token stored in the file at path, without
+// surrounding whitespace
+func readTokenFile(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("token file %q does not exist", path)
+		}
+		return "", fmt.Errorf("failed to read token file %q: %w", path, err)
+	}
+
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return "", fmt.Errorf("token file %q is empty", path)
+	}
+	return token, nil
+}
+
+// deviceCodeResponse is the response of GitHub starting the device flow
+type deviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+	Error           string `json:"error"`
+	ErrorDesc       string `json:"error_description"`
+}
+
+// deviceTokenResponse is the response of GitHub polling for the device flow
+// token
+type deviceTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Interval    int64  `json:"interval"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+// deviceFlowToken obtains a token using the OAuth device flow of the GitHub
+// OAuth or GitHub App given by client_id. The user authorizes the login by
+// entering the printed code in their browser.
+func (h *CLIHandler) deviceFlowToken(m map[string]string) (string, error) {
+	clientID := m["client_id"]
+	if clientID == "" {
+		return "", errors.New("client_id is required when using the device method")
+	}
+
+	githubURL := strings.TrimSuffix(m["github_url"], "/")
+	if githubURL == "" {
+		githubURL = defaultGitHubURL
+	}
+
+	scope, ok := m["scope"]
+	if !ok {
+		scope = defaultDeviceScope
+	}
+
+	pollUnit := time.Second
+	if h.testPollUnit != 0 {
+		pollUnit = h.testPollUnit
+	}
+
+	client := cleanhttp.DefaultClient()
+
+	var code deviceCodeResponse
+	if err := postDeviceForm(client, githubURL+"/login/device/code", url.Values{
+		"client_id": {clientID},
+		"scope":     {scope},
+	}, &code); err != nil {
+		return "", fmt.Errorf("failed to start device flow: %w", err)
+	}
+	if code.Error != "" {
+		return "", fmt.Errorf("failed to start device flow: %s: %s", code.Error, code.ErrorDesc)
+	}
+
+	fmt.Fprintf(h.getStdout(), "To log in, open %s in your browser and enter the code: %s\n",
+		code.VerificationURI, code.UserCode)
+
+	interval := code.Interval
+	if interval == 0 {
+		interval = defaultDevicePollInterval
+	}
+	expires := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	for {
+		time.Sleep(time.Duration(interval) * pollUnit)
+		if code.ExpiresIn > 0 && time.Now().After(expires) {
+			return "", errors.New("device code expired before the login was authorized")
+		}
+
+		var token deviceTokenResponse
+		if err := postDeviceForm(client, githubURL+"/login/oauth/access_token", url.Values{
+			"client_id":   {clientID},
+			"device_code": {code.DeviceCode},
+			"grant_type":  {deviceGrantType},
+		}, &token); err != nil {
+			return "", fmt.Errorf("failed to poll for device flow token: %w", err)
+		}
+
+		switch token.Error {
+		case "":
+			if token.AccessToken == "" {
+				return "", errors.New("GitHub returned an empty device flow token")
+			}
+			return token.AccessToken, nil
+		case "authorization_pending":
+			// The user has not entered the code yet
+		case "slow_down":
+			// GitHub returns the new interval, which is at least five
+			// seconds longer than the previous one
+			if token.Interval > interval {
+				interval = token.Interval
+			} else {
+				interval += 5
+			}
+		case "expired_token":
+			return "", errors.New("device code expired before the login was authorized")
+		case "access_denied":
+			return "", errors.New("the login was denied by the user")
+		default:
+			return "", fmt.Errorf("device flow failed: %s: %s", token.Error, token.ErrorDesc)
+		}
+	}
+}
+
+// postDeviceForm posts the form to GitHub and decodes the JSON response
+func postDeviceForm(client *http.Client, endpoint string, form url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// performLogin logs in to the GitHub auth method mounted at mount
+func (h *CLIHandler) performLogin(c *api.Client, mount string, token string) (*api.Secret, error) {
+	path := fmt.Sprintf("auth/%s/login", mount)
+	secret, err := c.Logical().Write(path, map[string]interface{}{
+		"token": strings.TrimSpace(token),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("empty response from credential provider")
+	}
+
+	return secret, nil
+}
+
+func (h *CLIHandler) Help() string {
+	help := `
+Usage: vault login -method=github [CONFIG K=V...]
+
+  The GitHub auth method allows users to authenticate using a GitHub
+  personal access token or the GitHub OAuth device flow. Users can generate a
+  personal access token from the settings page on their GitHub account.
+
+  Authenticate using a GitHub token:
+
+      $ vault login -method=github token=abcd1234
+
+  Authenticate using a GitHub token piped to stdin:
+
+      $ echo $GITHUB_TOKEN | vault login -method=github token=-
+
+  Authenticate using the device flow of a GitHub OAuth App:
+
+      $ vault login -method=github method=device client_id=Iv1.abcd1234
+
+Configuration:
+
+  method=<string>
+      How to obtain the GitHub token, either "token" or "device". Defaults to
+      "token".
+
+  mount=<string>
+      Path where the GitHub credential method is mounted. This is usually
+      provided via the -path flag in the "vault login" command, but it can be
+      specified here as well. If specified here, it takes precedence over the
+      value for -path. The default value is "github".
+
+  token=<string>
+      GitHub personal access token to use for authentication. If "-", the
+      token is read from stdin without prompting, such as when it is piped.
+      If not provided, it is read from token_path, the VAULT_AUTH_GITHUB_TOKEN
+      environment variable or the file named by the
+      VAULT_AUTH_GITHUB_TOKEN_FILE environment variable, in that order, or
+      prompted for. Tokens given as an Authorization header value, prefixed
+      with "Bearer " or "token ", are accepted as well.
+
+  token_path=<string>
+      Path of a file containing the GitHub personal access token. Surrounding
+      whitespace is ignored.
+
+  client_id=<string>
+      Client ID of the GitHub OAuth App or GitHub App used for the device
+      flow. Required when method is "device".
+
+  github_url=<string>
+      URL of GitHub Enterprise Server to use for the device flow. Defaults to
+      "https://github.com".
+
+  scope=<string>
+      OAuth scopes requested in the device flow. Defaults to "read:org".
+`
+
+	return strings.TrimSpace(help)
+}
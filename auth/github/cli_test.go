@@ -0,0 +1,154 @@
+package github
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCLIHandler_DeviceFlow tests that the device flow keeps polling while
+// authorization is pending or GitHub asks to slow down
+func TestCLIHandler_DeviceFlow(t *testing.T) {
+	var polls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "client-foo", r.Form.Get("client_id"))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/device/code":
+			assert.Equal(t, "read:org", r.Form.Get("scope"))
+			fmt.Fprintln(w, `{"device_code": "device-foo", "user_code": "ABCD-1234", "verification_uri": "https://github.com/login/device", "expires_in": 900, "interval": 1}`)
+		case "/login/oauth/access_token":
+			assert.Equal(t, "device-foo", r.Form.Get("device_code"))
+			assert.Equal(t, deviceGrantType, r.Form.Get("grant_type"))
+
+			polls++
+			switch polls {
+			case 1:
+				fmt.Fprintln(w, `{"error": "authorization_pending"}`)
+			case 2:
+				fmt.Fprintln(w, `{"error": "slow_down", "interval": 6}`)
+			default:
+				fmt.Fprintln(w, `{"access_token": "gho_foo", "token_type": "bearer"}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	var stdout bytes.Buffer
+	h := &CLIHandler{
+		testStdout:   &stdout,
+		testPollUnit: time.Millisecond,
+	}
+
+	token, err := h.deviceFlowToken(map[string]string{
+		"client_id":  "client-foo",
+		"github_url": ts.URL,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "gho_foo", token)
+	assert.Equal(t, 3, polls)
+	assert.Contains(t, stdout.String(), "https://github.com/login/device")
+	assert.Contains(t, stdout.String(), "ABCD-1234")
+
+	// The device flow requires a client ID
+	_, err = h.deviceFlowToken(map[string]string{"github_url": ts.URL})
+	assert.ErrorContains(t, err, "client_id is required")
+}
+
+// TestCLIHandler_DeviceFlow_Denied tests that the device flow stops once the
+// user denies the login
+func TestCLIHandler_DeviceFlow_Denied(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/device/code":
+			fmt.Fprintln(w, `{"device_code": "device-foo", "user_code": "ABCD-1234", "verification_uri": "https://github.com/login/device", "expires_in": 900, "interval": 1}`)
+		default:
+			fmt.Fprintln(w, `{"error": "access_denied"}`)
+		}
+	}))
+	defer ts.Close()
+
+	h := &CLIHandler{
+		testStdout:   &bytes.Buffer{},
+		testPollUnit: time.Millisecond,
+	}
+
+	_, err := h.deviceFlowToken(map[string]string{
+		"client_id":  "client-foo",
+		"github_url": ts.URL,
+	})
+	assert.ErrorContains(t, err, "denied")
+}
+
+// TestCLIHandler_TokenPath tests that the token is read from token_path or
+// VAULT_AUTH_GITHUB_TOKEN_FILE, unless it is passed explicitly
+func TestCLIHandler_TokenPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(path, []byte("  file-token\n"), 0o600))
+	emptyPath := filepath.Join(dir, "empty")
+	assert.NoError(t, os.WriteFile(emptyPath, []byte("\n"), 0o600))
+
+	t.Setenv("VAULT_AUTH_GITHUB_TOKEN", "")
+	h := &CLIHandler{}
+
+	token, err := h.promptForToken(map[string]string{"token_path": path})
+	assert.NoError(t, err)
+	assert.Equal(t, "file-token", token)
+
+	// An explicitly passed token takes precedence
+	token, err = h.promptForToken(map[string]string{"token": "arg-token", "token_path": path})
+	assert.NoError(t, err)
+	assert.Equal(t, "arg-token", token)
+
+	t.Setenv("VAULT_AUTH_GITHUB_TOKEN_FILE", path)
+	token, err = h.promptForToken(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "file-token", token)
+
+	_, err = h.promptForToken(map[string]string{"token_path": filepath.Join(dir, "missing")})
+	assert.ErrorContains(t, err, "does not exist")
+
+	_, err = h.promptForToken(map[string]string{"token_path": emptyPath})
+	assert.ErrorContains(t, err, "is empty")
+}
+
+// TestCLIHandler_TokenStdin tests that "-" reads the token from stdin and
+// that the scheme of Authorization header values is stripped
+func TestCLIHandler_TokenStdin(t *testing.T) {
+	t.Setenv("VAULT_AUTH_GITHUB_TOKEN", "")
+	t.Setenv("VAULT_AUTH_GITHUB_TOKEN_FILE", "")
+
+	h := &CLIHandler{testStdin: strings.NewReader("stdin-token\n")}
+	token, err := h.promptForToken(map[string]string{"token": "-"})
+	assert.NoError(t, err)
+	assert.Equal(t, "stdin-token", token)
+
+	h = &CLIHandler{testStdin: strings.NewReader("\n")}
+	_, err = h.promptForToken(map[string]string{"token": "-"})
+	assert.ErrorContains(t, err, "no token was given on stdin")
+
+	for _, value := range []string{"Bearer arg-token", "token arg-token", "bearer  arg-token", "arg-token"} {
+		token, err = h.promptForToken(map[string]string{"token": value})
+		assert.NoError(t, err)
+		assert.Equal(t, "arg-token", token, value)
+	}
+
+	t.Setenv("VAULT_AUTH_GITHUB_TOKEN", "Bearer env-token")
+	token, err = h.promptForToken(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "env-token", token)
+}
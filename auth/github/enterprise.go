@@ -0,0 +1,157 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// consumedLicenses is a page of the users consuming a license of a GitHub
+// Enterprise account
+type consumedLicenses struct {
+	Users []consumedLicense `json:"users"`
+}
+
+// consumedLicense is the license of a user of a GitHub Enterprise account
+type consumedLicense struct {
+	GitHubComLogin string `json:"github_com_login"`
+
+	// GitHubComSAMLNameID is the SAML identity linked to the user, which is
+	// empty until the user has authenticated through enterprise SSO
+	GitHubComSAMLNameID string `json:"github_com_saml_name_id"`
+}
+
+// checkMembership verifies the user is an active member of one of the
+// configured organizations. With enterprise_slug configured the user must be
+// a member of the enterprise instead, and is accepted as a member of the
+// primary organization even without an explicit membership, as membership
+// may be implied through enterprise SSO.
+func (b *backend) checkMembership(ctx context.Context, client *github.Client, user *github.User, config *config) (*github.Organization, string, []string, error) {
+	if config.EnterpriseSlug == "" {
+		return b.checkOrganizationMembership(ctx, client, user, config)
+	}
+
+	license, err := b.checkEnterpriseMembership(ctx, user, config)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// Users that never authenticated through enterprise SSO have no linked
+	// SAML identity. The licenses do not tell when it was last used.
+	if config.RequireSAMLIdentity && license.GitHubComSAMLNameID == "" {
+		return nil, "", nil, newAuthError("user has no SAML identity",
+			fmt.Sprintf("user '%s' has no SAML identity linked in enterprise '%s'", user.GetLogin(), config.EnterpriseSlug))
+	}
+
+	// Membership is only implied for users GitHub reports are not members.
+	// Pending memberships and memberships the token may not see are still
+	// denied.
+	org, role, warnings, err := b.checkOrganizationMembership(ctx, client, user, config)
+	if err == nil || !isNotOrgMember(err) || config.anyOrganization() {
+		return org, role, warnings, err
+	}
+
+	org, err = b.cachedOrganization(ctx, client, config, organizationRef{Name: config.Organization, ID: config.OrganizationID})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if err := verifyOrganizationID(org, config.Organization, config.OrganizationID); err != nil {
+		return nil, "", nil, err
+	}
+
+	// Without an explicit membership the user has no role in the organization
+	warnings = append(warnings, fmt.Sprintf("user %q is not an explicit member of organization %q, membership is implied by enterprise %q",
+		user.GetLogin(), config.Organization, config.EnterpriseSlug))
+	return org, "", warnings, nil
+}
+
+// checkEnterpriseMembership verifies the user consumes a license of the
+// enterprise and returns the license of the user. The licenses list every
+// member of the enterprise and its organizations, and are only visible to
+// enterprise owners, so they are listed with the enterprise_token rather than
+// the token of the user. Users missing from cached licenses are denied until
+// the cache expires, so that logins of users outside of the enterprise cannot
+// have every license listed again with the token of the enterprise owner.
+func (b *backend) checkEnterpriseMembership(ctx context.Context, user *github.User, config *config) (*consumedLicense, error) {
+	slug := config.EnterpriseSlug
+	useCache := config.EnterpriseCacheTTL > 0 && !isDryRun(ctx)
+	if useCache {
+		if license, ok := b.enterpriseCache.get(slug, user.GetLogin()); ok {
+			if license == nil {
+				return nil, errNotEnterpriseMember(user, slug)
+			}
+			return license, nil
+		}
+	}
+
+	if config.EnterpriseToken == "" {
+		return nil, fmt.Errorf("enterprise_token is required to check the members of enterprise %q", slug)
+	}
+	client, err := b.clientForConfig(config.EnterpriseToken, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create enterprise client: %w", err)
+	}
+
+	licenses, err := listConsumedLicenses(ctx, client, slug)
+	if err != nil {
+		return nil, err
+	}
+	if useCache {
+		b.enterpriseCache.put(slug, licenses, config.EnterpriseCacheTTL)
+	}
+
+	license, ok := licenses[strings.ToLower(user.GetLogin())]
+	if !ok {
+		return nil, errNotEnterpriseMember(user, slug)
+	}
+	return &license, nil
+}
+
+// errNotEnterpriseMember denies users that do not consume a license of the
+// enterprise
+func errNotEnterpriseMember(user *github.User, slug string) error {
+	return newAuthError("user is not part of required enterprise",
+		fmt.Sprintf("user '%s' is not a member of enterprise '%s'", user.GetLogin(), slug))
+}
+
+// listConsumedLicenses lists the licenses consumed in the enterprise by
+// lowercased login
+func listConsumedLicenses(ctx context.Context, client *github.Client, slug string) (map[string]consumedLicense, error) {
+	licenses := make(map[string]consumedLicense)
+	for page := 1; ; {
+		u := fmt.Sprintf("enterprises/%s/consumed-licenses?per_page=%d&page=%d", url.PathEscape(slug), defaultPerPage, page)
+		req, err := client.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result consumedLicenses
+		resp, err := client.Do(ctx, req, &result)
+		if err != nil {
+			if githubErr, ok := err.(*github.ErrorResponse); ok {
+				switch githubErr.Response.StatusCode {
+				case 404:
+					return nil, newAuthError("enterprise not found",
+						fmt.Sprintf("enterprise '%s' does not exist or is not visible to the enterprise_token", slug))
+				case 403:
+					return nil, newAuthError("insufficient permissions",
+						fmt.Sprintf("the enterprise_token is not allowed to list the members of enterprise '%s', which requires an enterprise owner", slug))
+				}
+			}
+			return nil, fmt.Errorf("failed to list members of enterprise %q: %w", slug, err)
+		}
+
+		for _, license := range result.Users {
+			licenses[strings.ToLower(license.GitHubComLogin)] = license
+		}
+
+		if resp.NextPage == 0 {
+			return licenses, nil
+		}
+		page = resp.NextPage
+	}
+}
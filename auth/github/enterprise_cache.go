@@ -0,0 +1,65 @@
+package github
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// enterpriseCache caches the consumed licenses of the enterprise so that
+// logins do not list every license of the enterprise each time
+type enterpriseCache struct {
+	lock    sync.Mutex
+	entries map[string]enterpriseCacheEntry
+	now     func() time.Time
+}
+
+type enterpriseCacheEntry struct {
+	// licenses are the licenses of the enterprise by lowercased login
+	licenses map[string]consumedLicense
+	expires  time.Time
+}
+
+func newEnterpriseCache(now func() time.Time) *enterpriseCache {
+	return &enterpriseCache{
+		entries: make(map[string]enterpriseCacheEntry),
+		now:     now,
+	}
+}
+
+// get returns the cached license of the user in the enterprise and whether
+// the licenses of the enterprise are cached. The license is nil if the user
+// has none.
+func (c *enterpriseCache) get(slug, login string) (*consumedLicense, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[strings.ToLower(slug)]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, false
+	}
+	license, ok := entry.licenses[strings.ToLower(login)]
+	if !ok {
+		return nil, true
+	}
+	return &license, true
+}
+
+// put caches the licenses of the enterprise for ttl
+func (c *enterpriseCache) put(slug string, licenses map[string]consumedLicense, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries[strings.ToLower(slug)] = enterpriseCacheEntry{
+		licenses: licenses,
+		expires:  c.now().Add(ttl),
+	}
+}
+
+// reset drops all cached licenses
+func (c *enterpriseCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]enterpriseCacheEntry)
+}
@@ -0,0 +1,157 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// userTeamsQuery lists the teams of the organization the user is a member
+// of. Unlike the REST API, which lists the teams of the user in every
+// organization, only the teams of the organization are returned.
+const userTeamsQuery = `query($org: String!, $login: String!, $first: Int!, $after: String) {
+  organization(login: $org) {
+    teams(first: $first, after: $after, userLogins: [$login]) {
+      nodes {
+        databaseId
+        name
+        slug
+        parentTeam {
+          databaseId
+          name
+          slug
+        }
+      }
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+    }
+  }
+}`
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+type graphQLTeam struct {
+	DatabaseID int64  `json:"databaseId"`
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+}
+
+type userTeamsResponse struct {
+	Data struct {
+		Organization *struct {
+			Teams struct {
+				Nodes []struct {
+					graphQLTeam
+					ParentTeam *graphQLTeam `json:"parentTeam"`
+				} `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"teams"`
+		} `json:"organization"`
+	} `json:"data"`
+	Errors []graphQLError `json:"errors"`
+}
+
+// graphQLURL returns the GraphQL endpoint of the GitHub instance the client
+// talks to. GitHub Enterprise Server serves the REST API under /api/v3/ and
+// GraphQL under /api/graphql.
+func graphQLURL(client *github.Client) string {
+	u := *client.BaseURL
+	if strings.HasSuffix(u.Path, "/api/v3/") {
+		u.Path = strings.TrimSuffix(u.Path, "v3/") + "graphql"
+	} else {
+		u.Path += "graphql"
+	}
+	return u.String()
+}
+
+// fetchUserTeamsGraphQL retrieves the teams of the user in the organization
+// with the GraphQL API, requesting perPage teams per page
+func fetchUserTeamsGraphQL(ctx context.Context, client *github.Client, org *github.Organization, user *github.User, perPage int) ([]*github.Team, error) {
+	endpoint := graphQLURL(client)
+	variables := map[string]interface{}{
+		"org":   org.GetLogin(),
+		"login": user.GetLogin(),
+		"first": perPage,
+	}
+
+	var teams []*github.Team
+	for {
+		req, err := client.NewRequest(http.MethodPost, endpoint, &graphQLRequest{
+			Query:     userTeamsQuery,
+			Variables: variables,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var result userTeamsResponse
+		if _, err := client.Do(ctx, req, &result); err != nil {
+			return nil, err
+		}
+		if len(result.Errors) > 0 {
+			messages := make([]string, 0, len(result.Errors))
+			for _, e := range result.Errors {
+				messages = append(messages, e.Message)
+			}
+			return nil, fmt.Errorf("GraphQL query failed: %s", strings.Join(messages, "; "))
+		}
+		if result.Data.Organization == nil {
+			return nil, fmt.Errorf("organization %q not found", org.GetLogin())
+		}
+
+		page := result.Data.Organization.Teams
+		for _, node := range page.Nodes {
+			team := &github.Team{
+				ID:           github.Int64(node.DatabaseID),
+				Name:         github.String(node.Name),
+				Slug:         github.String(node.Slug),
+				Organization: org,
+			}
+			if node.ParentTeam != nil {
+				team.Parent = &github.Team{
+					ID:   github.Int64(node.ParentTeam.DatabaseID),
+					Name: github.String(node.ParentTeam.Name),
+					Slug: github.String(node.ParentTeam.Slug),
+				}
+			}
+			teams = append(teams, team)
+		}
+
+		if !page.PageInfo.HasNextPage {
+			return teams, nil
+		}
+		variables["after"] = page.PageInfo.EndCursor
+	}
+}
+
+// graphQLUnavailable reports whether the error indicates that the GitHub
+// instance does not serve the GraphQL API, as is the case for older GitHub
+// Enterprise Server versions
+func graphQLUnavailable(err error) bool {
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+	switch errResp.Response.StatusCode {
+	case http.StatusNotFound, http.StatusNotImplemented:
+		return true
+	default:
+		return false
+	}
+}
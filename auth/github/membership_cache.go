@@ -0,0 +1,146 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// membershipCache caches the teams resolved for a user in an organization so
+// that repeated logins do not page through the user's teams every time.
+// Concurrent lookups of the same user share a single request to GitHub.
+type membershipCache struct {
+	lock     sync.Mutex
+	entries  map[string]membershipCacheEntry
+	inflight map[string]*membershipCall
+	now      func() time.Time
+
+	// generation is incremented on every reset so that lookups started
+	// before it are not cached
+	generation uint64
+
+	// nextSweep is when expired entries of users that did not log in again
+	// are removed next
+	nextSweep time.Time
+}
+
+type membershipCacheEntry struct {
+	teams   []*github.Team
+	expires time.Time
+}
+
+// membershipCall is a team lookup in progress that other logins of the same
+// user wait for
+type membershipCall struct {
+	done       chan struct{}
+	generation uint64
+	teams      []*github.Team
+	err        error
+}
+
+func newMembershipCache(now func() time.Time) *membershipCache {
+	return &membershipCache{
+		entries:  make(map[string]membershipCacheEntry),
+		inflight: make(map[string]*membershipCall),
+		now:      now,
+	}
+}
+
+// membershipCacheKey identifies a user in an organization
+func membershipCacheKey(org *github.Organization, user *github.User) string {
+	return fmt.Sprintf("%d/%s", org.GetID(), user.GetLogin())
+}
+
+// get returns the cached teams for the key, calling fetch on a miss or when
+// the cached teams are older than ttl. Failed lookups are not cached.
+//
+// The lookup is shared by every login of the user waiting for it, so it is
+// not canceled with the context of the login that started it. Each login
+// only stops waiting when its own context is done.
+func (c *membershipCache) get(ctx context.Context, key string, ttl time.Duration, fetch func(context.Context) ([]*github.Team, error)) ([]*github.Team, error) {
+	c.lock.Lock()
+	now := c.now()
+	if entry, ok := c.entries[key]; ok {
+		if now.Before(entry.expires) {
+			c.lock.Unlock()
+			return entry.teams, nil
+		}
+		delete(c.entries, key)
+	}
+	call, ok := c.inflight[key]
+	if !ok {
+		call = &membershipCall{
+			done:       make(chan struct{}),
+			generation: c.generation,
+		}
+		c.inflight[key] = call
+		go c.fetch(context.WithoutCancel(ctx), key, ttl, call, fetch)
+	}
+	c.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.teams, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch completes the lookup of the call and caches its teams
+func (c *membershipCache) fetch(ctx context.Context, key string, ttl time.Duration, call *membershipCall, fetch func(context.Context) ([]*github.Team, error)) {
+	call.teams, call.err = fetch(ctx)
+
+	c.lock.Lock()
+	if call.generation == c.generation {
+		delete(c.inflight, key)
+		if call.err == nil {
+			now := c.now()
+			c.entries[key] = membershipCacheEntry{
+				teams:   call.teams,
+				expires: now.Add(ttl),
+			}
+			c.sweep(now, ttl)
+		}
+	}
+	c.lock.Unlock()
+	close(call.done)
+}
+
+// sweep removes expired entries, at most once per ttl. The lock must be held.
+func (c *membershipCache) sweep(now time.Time, ttl time.Duration) {
+	if now.Before(c.nextSweep) {
+		return
+	}
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.nextSweep = now.Add(ttl)
+}
+
+// reset drops all cached teams. Lookups already in progress are not cached
+// once they complete.
+func (c *membershipCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]membershipCacheEntry)
+	c.inflight = make(map[string]*membershipCall)
+	c.generation++
+}
+
+// cachedUserTeams gets the teams of the user in the organization, consulting
+// the membership cache first when membership_cache_ttl is configured
+func (b *backend) cachedUserTeams(ctx context.Context, client *github.Client, config *config, org *github.Organization, user *github.User) ([]*github.Team, error) {
+	if config.MembershipCacheTTL <= 0 || isDryRun(ctx) {
+		return b.getUserTeams(ctx, client, config, org, user)
+	}
+
+	return b.membershipCache.get(ctx, membershipCacheKey(org, user), config.MembershipCacheTTL, func(ctx context.Context) ([]*github.Team, error) {
+		return b.getUserTeams(ctx, client, config, org, user)
+	})
+}
@@ -0,0 +1,114 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+type apiCallsKey struct{}
+
+// apiCalls counts the requests made to the GitHub API with a context
+// returned by withAPICalls, by endpoint, along with the last rate limit
+// reported by GitHub
+type apiCalls struct {
+	lock      sync.Mutex
+	endpoints map[string]int
+	seen      bool
+	remaining int
+}
+
+// withAPICalls returns a context that counts the requests made with it
+func withAPICalls(ctx context.Context) (context.Context, *apiCalls) {
+	calls := &apiCalls{endpoints: make(map[string]int)}
+	return context.WithValue(ctx, apiCallsKey{}, calls), calls
+}
+
+// record counts the request, including retries of rate limited requests,
+// and keeps the rate limit of the response if it reports one
+func (c *apiCalls) record(req *http.Request, resp *http.Response) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.endpoints[apiEndpoint(req.URL.Path)]++
+	if resp == nil {
+		return
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get(headerRateRemaining)); err == nil {
+		c.seen = true
+		c.remaining = remaining
+	}
+}
+
+// apiEndpoint returns the kind of GitHub API endpoint of the path, which
+// is used as a label of the metrics. Paths of GitHub Enterprise Server are
+// prefixed with /api/v3.
+func apiEndpoint(path string) string {
+	path = strings.TrimPrefix(path, "/api/v3")
+	path = strings.TrimPrefix(path, "/api")
+
+	switch {
+	case path == "/user":
+		return "user"
+	case path == "/user/emails":
+		return "emails"
+	case path == "/graphql":
+		return "graphql"
+	case strings.Contains(path, "/teams/") && strings.Contains(path, "/memberships/"):
+		return "team_membership"
+	case path == "/user/teams", strings.HasPrefix(path, "/orgs/") && strings.Contains(path, "/teams"):
+		return "teams"
+	case strings.HasPrefix(path, "/teams/"):
+		return "team"
+	case strings.HasPrefix(path, "/user/memberships/orgs"), strings.HasPrefix(path, "/orgs/") && strings.Contains(path, "/memberships/"):
+		return "membership"
+	case path == "/user/orgs", strings.HasPrefix(path, "/orgs/"), strings.HasPrefix(path, "/organizations/"):
+		return "organization"
+	case strings.HasPrefix(path, "/enterprises/"):
+		return "enterprise"
+	case strings.HasPrefix(path, "/app/"):
+		return "app"
+	case strings.HasPrefix(path, "/scim/"):
+		return "scim"
+	default:
+		return "other"
+	}
+}
+
+// emitAPIMetrics emits the metrics of a login or renewal that started at
+// start: the duration, the number of GitHub API calls by endpoint and in
+// total, and the last rate limit reported by GitHub
+func (b *backend) emitAPIMetrics(operation string, start time.Time, calls *apiCalls) {
+	b.metrics.MeasureSince([]string{"github", operation, "duration"}, start)
+
+	calls.lock.Lock()
+	defer calls.lock.Unlock()
+
+	endpoints := make([]string, 0, len(calls.endpoints))
+	for endpoint := range calls.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	var total int
+	for _, endpoint := range endpoints {
+		count := calls.endpoints[endpoint]
+		total += count
+		b.metrics.IncrCounterWithLabels([]string{"github", operation, "api_calls"}, float32(count),
+			[]metrics.Label{{Name: "endpoint", Value: endpoint}})
+	}
+
+	// Sampled per request, so that logins making an unusual number of
+	// calls stand out
+	b.metrics.AddSample([]string{"github", operation, "api_calls_per_request"}, float32(total))
+
+	if calls.seen {
+		b.metrics.SetGauge([]string{"github", "rate_limit", "remaining"}, float32(calls.remaining))
+	}
+}
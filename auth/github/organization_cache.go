@@ -0,0 +1,90 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// organizationCache caches the organizations fetched on login so that
+// logins to a stable organization do not fetch it every time
+type organizationCache struct {
+	lock    sync.Mutex
+	entries map[string]organizationCacheEntry
+	now     func() time.Time
+}
+
+type organizationCacheEntry struct {
+	org     *github.Organization
+	expires time.Time
+}
+
+func newOrganizationCache(now func() time.Time) *organizationCache {
+	return &organizationCache{
+		entries: make(map[string]organizationCacheEntry),
+		now:     now,
+	}
+}
+
+// organizationCacheKey identifies a configured organization by name and ID.
+// Organization names are case-insensitive.
+func organizationCacheKey(candidate organizationRef) string {
+	return fmt.Sprintf("%s/%d", strings.ToLower(candidate.Name), candidate.ID)
+}
+
+// get returns the cached organization for the key, or nil if it is missing
+// or expired
+func (c *organizationCache) get(key string) *github.Organization {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil
+	}
+	return entry.org
+}
+
+// put caches the organization for the key for ttl
+func (c *organizationCache) put(key string, org *github.Organization, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries[key] = organizationCacheEntry{
+		org:     org,
+		expires: c.now().Add(ttl),
+	}
+}
+
+// reset drops all cached organizations
+func (c *organizationCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]organizationCacheEntry)
+}
+
+// cachedOrganization gets the organization, consulting the organization
+// cache first when organization_cache_ttl is configured. A cached
+// organization whose ID does not match is fetched again.
+func (b *backend) cachedOrganization(ctx context.Context, client *github.Client, config *config, candidate organizationRef) (*github.Organization, error) {
+	if config.OrganizationCacheTTL <= 0 || isDryRun(ctx) {
+		return getOrganization(ctx, client, candidate)
+	}
+
+	key := organizationCacheKey(candidate)
+	if org := b.organizationCache.get(key); org != nil && org.GetID() == candidate.ID {
+		return org, nil
+	}
+
+	org, err := getOrganization(ctx, client, candidate)
+	if err != nil {
+		return nil, err
+	}
+	b.organizationCache.put(key, org, config.OrganizationCacheTTL)
+	return org, nil
+}
@@ -0,0 +1,62 @@
+package github
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// parentTeamCache caches the parent teams fetched on login so that logins of
+// members of nested teams do not fetch every ancestor each time
+type parentTeamCache struct {
+	lock    sync.Mutex
+	entries map[int64]parentTeamCacheEntry
+	now     func() time.Time
+}
+
+type parentTeamCacheEntry struct {
+	// team is nil for parent teams that are not visible, whose own parents
+	// are unknown
+	team    *github.Team
+	expires time.Time
+}
+
+func newParentTeamCache(now func() time.Time) *parentTeamCache {
+	return &parentTeamCache{
+		entries: make(map[int64]parentTeamCacheEntry),
+		now:     now,
+	}
+}
+
+// get returns the cached team with the ID and whether it is cached. The
+// team is nil if it was not visible.
+func (c *parentTeamCache) get(id int64) (*github.Team, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, false
+	}
+	return entry.team, true
+}
+
+// put caches the team with the ID for ttl
+func (c *parentTeamCache) put(id int64, team *github.Team, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries[id] = parentTeamCacheEntry{
+		team:    team,
+		expires: c.now().Add(ttl),
+	}
+}
+
+// reset drops all cached teams
+func (c *parentTeamCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[int64]parentTeamCacheEntry)
+}
@@ -0,0 +1,90 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/go-github/github"
+)
+
+// maxParentTeamDepth bounds how many levels of parent teams are resolved
+// above each team of the user
+const maxParentTeamDepth = 10
+
+// withParentTeams returns the teams followed by their ancestors that are not
+// among them already. Members of a child team are implicit members of its
+// parent teams, but GitHub only lists the teams the user is a direct member
+// of, each referencing its direct parent. The parent of an ancestor is only
+// known once the ancestor is fetched, so every ancestor is fetched once and
+// chains shared by several teams are only walked the first time. With
+// parent_team_cache_ttl, ancestors fetched by earlier logins are reused.
+func (b *backend) withParentTeams(ctx context.Context, client *github.Client, config *config, org *github.Organization, teams []*github.Team) ([]*github.Team, error) {
+	seen := make(map[int64]struct{}, len(teams))
+	for _, t := range teams {
+		seen[t.GetID()] = struct{}{}
+	}
+
+	resolved := slices.Clone(teams)
+	for _, t := range teams {
+		parent := t.Parent
+		for depth := 0; parent != nil && parent.ID != nil; depth++ {
+			if _, ok := seen[parent.GetID()]; ok {
+				break
+			}
+			if depth == maxParentTeamDepth {
+				b.Logger().Warn("parent teams nested too deeply, ignoring the remaining parents",
+					"team", t.GetSlug(), "max_depth", maxParentTeamDepth)
+				break
+			}
+			seen[parent.GetID()] = struct{}{}
+
+			team, err := b.getParentTeam(ctx, client, config, org, parent)
+			if err != nil {
+				return nil, err
+			}
+			if team == nil {
+				b.Logger().Debug("parent team not found, ignoring its parents", "team", parent.GetSlug())
+				resolved = append(resolved, parent)
+				break
+			}
+			resolved = append(resolved, team)
+			parent = team.Parent
+		}
+	}
+
+	return resolved, nil
+}
+
+// getParentTeam fetches the parent team, consulting the parent team cache
+// first when parent_team_cache_ttl is configured. Parent teams that are not
+// visible, such as secret teams, are returned as nil. Cached teams are shared
+// by concurrent logins, so they must not be modified.
+func (b *backend) getParentTeam(ctx context.Context, client *github.Client, config *config, org *github.Organization, parent *github.Team) (*github.Team, error) {
+	useCache := config.ParentTeamCacheTTL > 0 && !isDryRun(ctx)
+	if useCache {
+		if team, ok := b.parentTeamCache.get(parent.GetID()); ok {
+			return team, nil
+		}
+	}
+
+	team, _, err := client.Teams.GetTeam(ctx, parent.GetID())
+	if err != nil {
+		// Secret parent teams may not be visible to the user
+		var githubErr *github.ErrorResponse
+		if !errors.As(err, &githubErr) || githubErr.Response == nil || githubErr.Response.StatusCode != http.StatusNotFound {
+			return nil, fmt.Errorf("failed to get parent team %q: %w", parent.GetSlug(), err)
+		}
+		team = nil
+	}
+	if team != nil && team.Organization == nil {
+		team.Organization = org
+	}
+
+	if useCache {
+		b.parentTeamCache.put(parent.GetID(), team, config.ParentTeamCacheTTL)
+	}
+	return team, nil
+}
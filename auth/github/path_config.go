@@ -2,6 +2,8 @@ package github
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/url"
 	"os"
@@ -11,6 +13,7 @@ import (
 
 	"github.com/google/go-github/github"
 	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/helper/policyutil"
 	"github.com/openbao/openbao/sdk/v2/helper/tokenutil"
 	"github.com/openbao/openbao/sdk/v2/logical"
 )
@@ -20,6 +23,48 @@ const (
 	maxOrganizationNameLength = 39 // GitHub's max org name length
 	minOrganizationNameLength = 1
 	maxBaseURLLength          = 2048 // Reasonable URL length limit
+
+	// defaultRequestTimeout bounds requests to GitHub unless configured otherwise
+	defaultRequestTimeout = 30 * time.Second
+
+	// Idle connections kept open to GitHub unless configured otherwise. The
+	// logins of a mount all go to the same host, so as many idle connections
+	// are kept per host as in total.
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+
+	// How long tokens may be renewed without reaching GitHub after their
+	// last verification unless configured otherwise
+	defaultRenewGracePeriod = time.Hour
+
+	// How long the members of the enterprise are cached unless configured
+	// otherwise
+	defaultEnterpriseCacheTTL = 5 * time.Minute
+
+	// Team identifiers that can be used as group alias
+	groupAliasFormatName = "name"
+	groupAliasFormatSlug = "slug"
+	groupAliasFormatID   = "id"
+
+	// Casings the username of the user can be normalized to
+	usernameCasePreserve = "preserve"
+	usernameCaseLower    = "lower"
+	usernameCaseUpper    = "upper"
+
+	// User identifiers that can be used as entity alias
+	userAliasNameLogin = "login"
+	userAliasNameID    = "id"
+	userAliasNameEmail = "email"
+
+	// How the SCIM externalId of the user is used
+	scimIdentityDisabled = "disabled"
+	scimIdentityMetadata = "metadata"
+	scimIdentityAlias    = "alias"
+
+	// Whether logins verify the membership of an organization
+	membershipCheckOrganization = "organization"
+	membershipCheckNone         = "none"
 )
 
 var (
@@ -64,6 +109,29 @@ func validateBaseURL(baseURL string) error {
 	return nil
 }
 
+// validateProxyURL validates the proxy URL format
+func validateProxyURL(proxyURL string) error {
+	if proxyURL == "" {
+		return nil // Empty proxy URL is valid (uses the environment)
+	}
+
+	parsedURL, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy_url format: %w", err)
+	}
+
+	switch parsedURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("proxy_url must use http, https or socks5 scheme")
+	}
+	if parsedURL.Host == "" {
+		return fmt.Errorf("proxy_url must include a host")
+	}
+
+	return nil
+}
+
 func pathConfig(b *backend) *framework.Path {
 	p := &framework.Path{
 		Pattern: "config",
@@ -75,13 +143,179 @@ func pathConfig(b *backend) *framework.Path {
 		Fields: map[string]*framework.FieldSchema{
 			"organization": {
 				Type:        framework.TypeString,
-				Description: "The organization users must be part of",
-				Required:    true,
+				Description: "The organization users must be part of. Required unless allow_any_org is set.",
 			},
 			"organization_id": {
 				Type:        framework.TypeInt64,
 				Description: "The ID of the organization users must be part of",
 			},
+			"auto_set_organization_id": {
+				Type:    framework.TypeBool,
+				Default: true,
+				Description: `Store the organization IDs fetched on login when they are
+not configured. When disabled, the IDs are fetched again on every login
+instead of being written to the config.`,
+			},
+			"organizations": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Additional organizations users may be part of instead
+of the organization. Users are authenticated by the first organization they
+are an active member of.`,
+			},
+			"organization_ids": {
+				Type: framework.TypeCommaIntSlice,
+				Description: `The IDs of the additional organizations, in the same order
+as organizations. IDs that are not provided are fetched automatically.`,
+			},
+			"enterprise_slug": {
+				Type: framework.TypeString,
+				Description: `The slug of the GitHub Enterprise account users must be
+a member of. When set, members of the enterprise are accepted even if their
+membership of the organization is only implied through the enterprise.`,
+			},
+			"enterprise_token": {
+				Type: framework.TypeString,
+				Description: `The token of an enterprise owner, used to list the members of
+the enterprise. Required with enterprise_slug.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:      "Enterprise Token",
+					Sensitive: true,
+				},
+			},
+			"enterprise_cache_ttl": {
+				Type:    framework.TypeDurationSecond,
+				Default: int(defaultEnterpriseCacheTTL.Seconds()),
+				Description: `How long the members of the enterprise are cached and
+reused by later logins. Users missing from the cached members are denied until
+they expire. Set to 0 to disable the cache.`,
+			},
+			"require_saml_identity": {
+				Type: framework.TypeBool,
+				Description: `Deny users that have no SAML identity linked in the
+enterprise, as they never authenticated through enterprise SSO. Users that did
+once are accepted however long ago it was. Requires enterprise_slug.`,
+			},
+			"require_2fa": {
+				Type: framework.TypeBool,
+				Description: `Deny users that do not have two-factor authentication
+enabled. Unless GitHub reports it to the user's token, the status is read from
+the organization members, which requires a GitHub App or an organization owner.
+Logins are denied when the status cannot be read.`,
+			},
+			"allow_any_org": {
+				Type: framework.TypeBool,
+				Description: `Accept users of any organization they are an active member
+of when organization is empty. Users are authenticated by their first active
+organization membership, and only teams of that organization are mapped.`,
+			},
+			"membership_check": {
+				Type:    framework.TypeString,
+				Default: membershipCheckOrganization,
+				Description: `Whether logins verify the organization membership of the
+user, "organization" or "none". With "none", ANY GitHub user can authenticate
+and is only granted the base_policies: the login only verifies that the user
+controls the GitHub account.`,
+				AllowedValues: []interface{}{membershipCheckOrganization, membershipCheckNone},
+			},
+			"allow_private_membership": {
+				Type: framework.TypeBool,
+				Description: `Accept users whose membership of the organization is
+private by listing the organizations of the user with their token when the
+membership cannot be read.`,
+			},
+			"required_teams": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Teams users must be a member of, by name or slug. Users
+must be a member of at least one of them. If empty, any member of the
+organization can authenticate.`,
+			},
+			"allowed_teams": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `If set, only members of at least one of these teams, by
+slug, can authenticate, regardless of the teams policies are mapped to.`,
+			},
+			"allowed_users": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "If set, only these GitHub users can authenticate.",
+			},
+			"denied_users": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "GitHub users that cannot authenticate, even if they are part of allowed_users.",
+			},
+			"required_scopes": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `OAuth scopes the token must be granted, such as read:org.
+Tokens that do not report their scopes, such as fine-grained personal access
+tokens, are accepted with a warning.`,
+			},
+			"return_team_details": {
+				Type:        framework.TypeBool,
+				Description: "Return the resolved teams and the policies mapped to each of them in the login response.",
+			},
+			"store_token": {
+				Type:    framework.TypeBool,
+				Default: true,
+				Description: `Store the GitHub token of the user with the issued token
+so that it can be verified again on renewal. When disabled, tokens cannot be
+renewed and users have to log in again instead.`,
+			},
+			"base_policies": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Policies granted to every user once their organization
+membership is verified, unlike token_policies which are attached to every token.`,
+			},
+			"deny_if_no_policies": {
+				Type:        framework.TypeBool,
+				Description: "Deny the login of users that are assigned no policies other than the default policy.",
+			},
+			"strict_resource_owner": {
+				Type: framework.TypeBool,
+				Description: `Deny the login of fine-grained personal access tokens whose
+resource owner cannot be determined. By default such logins are allowed with a
+warning. Tokens scoped to another resource owner are always denied.`,
+			},
+			"owner_token_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `The TTL of tokens issued to owners of the organization, whose
+role is "admin", instead of token_ttl. Defaults to 0, which uses token_ttl.`,
+			},
+			"owner_token_max_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `The maximum TTL of tokens issued to owners of the organization,
+whose role is "admin", instead of token_max_ttl. Defaults to 0, which uses
+token_max_ttl.`,
+			},
+			"group_alias_format": {
+				Type: framework.TypeString,
+				Description: `The team identifier used as the group alias of each team of
+the user, either "name", "slug" or "id". Defaults to "slug".`,
+				Default: groupAliasFormatSlug,
+			},
+			"username_case": {
+				Type: framework.TypeString,
+				Description: `The casing the GitHub login of the user is normalized to for the
+entity alias, the username metadata and user mappings, either "preserve",
+"lower" or "upper". Defaults to "preserve".`,
+				Default: usernameCasePreserve,
+			},
+			"user_alias_name": {
+				Type: framework.TypeString,
+				Description: `The user identifier used as the entity alias, either "login",
+"id" for the numeric GitHub user ID, which is kept when the user is renamed,
+or "email" for the public or primary verified email of the user. Defaults to
+"login".`,
+				Default: userAliasNameLogin,
+			},
+			"scim_identity": {
+				Type: framework.TypeString,
+				Description: `Resolve the SCIM externalId of the user in the primary
+organization, either "disabled", "metadata" to add it to the token metadata,
+or "alias" to also use it, prefixed with "scim:", as the entity alias instead
+of the GitHub login. With "alias", logins are denied when the identity cannot
+be read. Requires SAML SSO with SCIM provisioning, and a GitHub App or a token
+of an organization owner. Defaults to "disabled".`,
+				Default: scimIdentityDisabled,
+			},
 			"base_url": {
 				Type: framework.TypeString,
 				Description: `The API endpoint to use. Useful if you
@@ -92,6 +326,221 @@ API-compatible authentication server.`,
 					Group: "GitHub Options",
 				},
 			},
+			"proxy_url": {
+				Type:        framework.TypeString,
+				Description: "The URL of the HTTP proxy used to reach the GitHub API.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Proxy URL",
+					Group: "GitHub Options",
+				},
+			},
+			"ca_cert": {
+				Type:        framework.TypeString,
+				Description: "The PEM encoded CA certificate to trust in addition to the system CAs, for GitHub Enterprise Server using an internal CA.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "CA Certificate",
+					Group: "GitHub Options",
+				},
+			},
+			"tls_skip_verify": {
+				Type:        framework.TypeBool,
+				Description: "Skip verification of the GitHub API TLS certificate. Only use this for development.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Skip TLS Verification",
+					Group: "GitHub Options",
+				},
+			},
+			"request_timeout": {
+				Type:        framework.TypeDurationSecond,
+				Default:     int(defaultRequestTimeout.Seconds()),
+				Description: "The timeout of requests to the GitHub API, including retries of rate limited requests. Set to 0 to disable the timeout.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Request Timeout",
+					Group: "GitHub Options",
+				},
+			},
+			"max_idle_conns": {
+				Type:        framework.TypeInt,
+				Default:     defaultMaxIdleConns,
+				Description: "The maximum number of idle connections to GitHub kept open for reuse. Set to 0 for no limit.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Max Idle Connections",
+					Group: "GitHub Options",
+				},
+			},
+			"max_idle_conns_per_host": {
+				Type:        framework.TypeInt,
+				Default:     defaultMaxIdleConnsPerHost,
+				Description: "The maximum number of idle connections kept open for reuse per GitHub host. Set to 0 to use the Go default of 2.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Max Idle Connections Per Host",
+					Group: "GitHub Options",
+				},
+			},
+			"idle_conn_timeout": {
+				Type:        framework.TypeDurationSecond,
+				Default:     int(defaultIdleConnTimeout.Seconds()),
+				Description: "How long idle connections to GitHub are kept open for reuse. Set to 0 to keep them open until GitHub closes them.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Idle Connection Timeout",
+					Group: "GitHub Options",
+				},
+			},
+			"unwrap_address": {
+				Type: framework.TypeString,
+				Description: `The address of the OpenBao API that response-wrapping tokens
+given as wrapped_token on login are unwrapped at. Logins with wrapped_token
+are rejected unless it is set.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Unwrap Address",
+					Group: "GitHub Options",
+				},
+			},
+			"app_id": {
+				Type: framework.TypeInt64,
+				Description: `The ID of the GitHub App to authenticate as. When set,
+organization membership and teams are resolved using an installation
+token of the app instead of the user's token.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "App ID",
+					Group: "GitHub App",
+				},
+			},
+			"installation_id": {
+				Type:        framework.TypeInt64,
+				Description: "The ID of the GitHub App installation in the organization.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Installation ID",
+					Group: "GitHub App",
+				},
+			},
+			"private_key": {
+				Type:        framework.TypeString,
+				Description: "The PEM encoded private key of the GitHub App.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:      "Private Key",
+					Group:     "GitHub App",
+					Sensitive: true,
+				},
+			},
+			"max_retries": {
+				Type:        framework.TypeInt,
+				Default:     defaultMaxRetries,
+				Description: "The maximum number of times a request rate limited by GitHub is retried, including 429 responses. Set to 0 to disable retries.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Max Retries",
+					Group: "GitHub Options",
+				},
+			},
+			"max_retry_wait": {
+				Type:        framework.TypeDurationSecond,
+				Default:     int(defaultMaxRetryWait.Seconds()),
+				Description: "The maximum time to wait before retrying a request rate limited by GitHub. Rate limits that lift later fail the request without retrying it.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Max Retry Wait",
+					Group: "GitHub Options",
+				},
+			},
+			"use_graphql": {
+				Type: framework.TypeBool,
+				Description: `Query the teams of the user in the organization with the GraphQL API,
+which returns them in fewer requests. Falls back to the REST API when GraphQL is
+unavailable.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Use GraphQL",
+					Group: "GitHub Options",
+				},
+			},
+			"resolve_parent_teams": {
+				Type: framework.TypeBool,
+				Description: `Also map policies to the parent teams of the teams of the user,
+of which GitHub considers them implicit members. Each parent team is fetched
+once per login, up to 10 levels up.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Resolve Parent Teams",
+					Group: "GitHub Options",
+				},
+			},
+			"teams_per_page": {
+				Type:        framework.TypeInt,
+				Default:     defaultPerPage,
+				Description: "The number of teams requested per page when listing the teams of a user, between 1 and 100.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Teams Per Page",
+					Group: "GitHub Options",
+				},
+			},
+			"organization_cache_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long the organizations fetched on login are cached
+and reused by later logins. Defaults to 0, which disables the cache.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Organization Cache TTL",
+					Group: "GitHub Options",
+				},
+			},
+			"parent_team_cache_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long the parent teams fetched on login with
+resolve_parent_teams are cached and reused by later logins. Defaults to 0,
+which disables the cache.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Parent Team Cache TTL",
+					Group: "GitHub Options",
+				},
+			},
+			"rate_limit_warning_threshold": {
+				Type:    framework.TypeInt,
+				Default: defaultRateLimitWarningThreshold,
+				Description: `Warn on login when fewer requests than this remain in the
+GitHub API rate limit. Set to 0 to disable the warning.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Rate Limit Warning Threshold",
+					Group: "GitHub Options",
+				},
+			},
+			"membership_cache_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long the teams resolved for a user are cached
+and reused by later logins. Defaults to 0, which disables the cache.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Membership Cache TTL",
+					Group: "GitHub Options",
+				},
+			},
+			"revalidation_interval": {
+				Type: framework.TypeDurationSecond,
+				Description: `How often the organization membership of the users of
+active tokens is revalidated in the background. Tokens of users that are no
+longer members are denied renewal, so combine it with a short token_ttl.
+Defaults to 0, which disables revalidation.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Revalidation Interval",
+					Group: "GitHub Options",
+				},
+			},
+			"renew_on_github_error": {
+				Type: framework.TypeBool,
+				Description: `If set, tokens are renewed with the policies they already have
+when GitHub cannot be reached or fails with a server error, for up to
+renew_grace_period after the user was last verified. Tokens of users that
+GitHub reports as no longer authorized are still denied renewal.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Renew On GitHub Error",
+					Group: "GitHub Options",
+				},
+			},
+			"renew_grace_period": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long after the last successful verification of the user
+tokens may be renewed while GitHub is unavailable, if renew_on_github_error
+is set. Defaults to 1h.`,
+				Default: int(defaultRenewGracePeriod.Seconds()),
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:  "Renew Grace Period",
+					Group: "GitHub Options",
+				},
+			},
 			"ttl": {
 				Type:        framework.TypeDurationSecond,
 				Description: tokenutil.DeprecationText("token_ttl"),
@@ -135,7 +584,15 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, dat
 		return nil, err
 	}
 	if c == nil {
-		c = &config{}
+		c = newConfig()
+	}
+
+	// Update whether users of any organization are accepted, and whether
+	// the membership is verified at all, which decide whether the
+	// organization is required
+	b.updateAllowAnyOrg(c, data)
+	if errResp := b.updateMembershipCheck(c, data); errResp != nil {
+		return errResp, nil
 	}
 
 	// Update organization settings
@@ -143,56 +600,465 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, dat
 		return errResp, nil
 	}
 
-	// Update base URL and get parsed URL for later use
-	parsedURL, errResp := b.updateBaseURL(c, data)
-	if errResp != nil {
-		return errResp, nil
+	// Update the enterprise users must be part of
+	if errResp := b.updateEnterprise(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update whether users without an SSO identity in the enterprise are denied
+	if errResp := b.updateRequireSAMLIdentity(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update whether users without two-factor authentication are denied
+	b.updateRequire2FA(c, data)
+
+	// Update whether private memberships are accepted
+	b.updateAllowPrivateMembership(c, data)
+
+	// Update the teams users must be part of
+	b.updateRequiredTeams(c, data)
+
+	// Update the teams allowed to authenticate
+	b.updateAllowedTeams(c, data)
+
+	// Update the users allowed or denied to authenticate
+	b.updateUserRestrictions(c, data)
+
+	// Update the scopes tokens must be granted
+	b.updateRequiredScopes(c, data)
+
+	// Update whether team details are returned on login
+	b.updateReturnTeamDetails(c, data)
+
+	// Update whether GitHub tokens are stored for renewal
+	b.updateStoreToken(c, data)
+
+	// Update whether organization IDs fetched on login are stored
+	b.updateAutoSetOrganizationID(c, data)
+
+	// Update the policies granted to verified members
+	b.updateBasePolicies(c, data)
+
+	// Update whether users without policies are denied
+	b.updateDenyIfNoPolicies(c, data)
+
+	// Update whether fine-grained tokens of unknown resource owners are denied
+	b.updateStrictResourceOwner(c, data)
+
+	// Update the team identifier used for group aliases
+	if errResp := b.updateGroupAliasFormat(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update the casing usernames are normalized to
+	if errResp := b.updateUsernameCase(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update the user identifier used for the entity alias
+	if errResp := b.updateUserAliasName(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update how the SCIM externalId of the user is used
+	if errResp := b.updateSCIMIdentity(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update base URL and get parsed URL for later use
+	parsedURL, errResp := b.updateBaseURL(c, data)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	// Update proxy, timeout and TLS settings
+	if errResp := b.updateHTTPSettings(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update connection reuse settings
+	if errResp := b.updateConnectionSettings(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update the address wrapped tokens are unwrapped at
+	if errResp := b.updateUnwrapAddress(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update GitHub App settings
+	if errResp := b.updateAppSettings(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// A GitHub App installation cannot list the organizations of users
+	if c.anyOrganization() && c.appMode() {
+		return logical.ErrorResponse("organization is required in GitHub App mode"), nil
+	}
+
+	// The SCIM identity is resolved in the primary organization
+	if c.anyOrganization() && c.scimIdentity() != scimIdentityDisabled {
+		return logical.ErrorResponse("organization is required to resolve the SCIM identity with scim_identity"), nil
+	}
+
+	// Update retry settings
+	if errResp := b.updateRetrySettings(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update whether teams are queried with the GraphQL API
+	b.updateUseGraphQL(c, data)
+
+	// Update whether policies are mapped to parent teams
+	b.updateResolveParentTeams(c, data)
+
+	// Update team listing page size
+	if errResp := b.updateTeamsPerPage(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update membership cache settings
+	if errResp := b.updateMembershipCacheTTL(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update organization cache settings
+	if errResp := b.updateOrganizationCacheTTL(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update parent team cache settings
+	if errResp := b.updateParentTeamCacheTTL(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update background revalidation settings
+	if errResp := b.updateRevalidationInterval(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update whether tokens are renewed while GitHub is unavailable
+	if errResp := b.updateRenewOnGitHubError(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Handle organization ID auto-fetching if needed
+	if err := b.handleOrganizationIDAutoFetch(ctx, c, parsedURL, &resp); err != nil {
+		return nil, err
+	}
+
+	// Parse token fields
+	if errResp := b.parseTokenFields(c, req, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Handle legacy TTL upgrades
+	if errResp := b.handleTTLUpgrades(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Update token TTLs of organization owners
+	if errResp := b.updateOwnerTokenTTLs(c, data); errResp != nil {
+		return errResp, nil
+	}
+
+	// Settings that restrict logins to an organization would give a false
+	// sense of security without membership checks
+	if errResp := c.validateMembershipCheck(); errResp != nil {
+		return errResp, nil
+	}
+	if c.skipMembershipCheck() {
+		resp.AddWarning(noMembershipCheckWarning)
+	}
+
+	// Save configuration to storage
+	if err := b.saveConfig(ctx, req.Storage, c); err != nil {
+		return nil, err
+	}
+
+	// Other nodes reset their caches once the write is replicated
+	b.resetConfigCaches()
+
+	// Return response with warnings if any
+	if len(resp.Warnings) == 0 {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+// updateOrganization validates and updates the organization settings in config
+func (b *backend) updateOrganization(c *config, data *framework.FieldData) *logical.Response {
+	if organizationRaw, ok := data.GetOk("organization"); ok {
+		org := organizationRaw.(string)
+		// With allow_any_org or without membership checks the organization
+		// may be cleared
+		if org != "" || !c.organizationOptional() {
+			if err := validateOrganizationName(org); err != nil {
+				return logical.ErrorResponse("invalid organization: %s", err.Error())
+			}
+		}
+		// Organizations are resolved by ID on login, so the ID of a
+		// previously configured organization must not be kept
+		if !strings.EqualFold(c.Organization, org) {
+			c.OrganizationID = 0
+		}
+		c.Organization = org
+	}
+	if c.Organization == "" && !c.organizationOptional() {
+		return logical.ErrorResponse("organization is a required parameter")
+	}
+
+	if organizationRaw, ok := data.GetOk("organization_id"); ok {
+		c.OrganizationID = organizationRaw.(int64)
+	}
+
+	if organizationsRaw, ok := data.GetOk("organizations"); ok {
+		organizations := organizationsRaw.([]string)
+		for _, org := range organizations {
+			if err := validateOrganizationName(org); err != nil {
+				return logical.ErrorResponse("invalid organization %q in organizations: %s", org, err.Error())
+			}
+		}
+		c.Organizations = organizations
+		// Previously fetched IDs may belong to other organizations
+		c.OrganizationIDs = make([]int64, len(organizations))
+	}
+
+	if organizationIDsRaw, ok := data.GetOk("organization_ids"); ok {
+		organizationIDs := organizationIDsRaw.([]int)
+		if len(organizationIDs) != len(c.Organizations) {
+			return logical.ErrorResponse("organization_ids must contain one ID for each of the organizations")
+		}
+		c.OrganizationIDs = make([]int64, len(organizationIDs))
+		for i, id := range organizationIDs {
+			c.OrganizationIDs[i] = int64(id)
+		}
+	}
+
+	// Additional organizations are alternatives to the organization, they
+	// cannot restrict logins when any organization is accepted
+	if c.anyOrganization() && len(c.Organizations) > 0 {
+		return logical.ErrorResponse("organizations cannot be set without organization")
+	}
+
+	return nil
+}
+
+// updateMembershipCheck validates and updates whether logins verify the
+// organization membership of the user in config
+func (b *backend) updateMembershipCheck(c *config, data *framework.FieldData) *logical.Response {
+	if modeRaw, ok := data.GetOk("membership_check"); ok {
+		mode := modeRaw.(string)
+		switch mode {
+		case membershipCheckOrganization, membershipCheckNone:
+		default:
+			return logical.ErrorResponse("membership_check must be one of %q or %q",
+				membershipCheckOrganization, membershipCheckNone)
+		}
+		c.MembershipCheck = mode
+	}
+	return nil
+}
+
+// updateAllowAnyOrg updates whether users of any organization are accepted in config
+func (b *backend) updateAllowAnyOrg(c *config, data *framework.FieldData) {
+	if allowAnyOrgRaw, ok := data.GetOk("allow_any_org"); ok {
+		c.AllowAnyOrg = allowAnyOrgRaw.(bool)
+	}
+}
+
+// updateEnterprise validates and updates the enterprise settings in config
+func (b *backend) updateEnterprise(c *config, data *framework.FieldData) *logical.Response {
+	if enterpriseSlugRaw, ok := data.GetOk("enterprise_slug"); ok {
+		slug := enterpriseSlugRaw.(string)
+		if slug != "" && !orgNamePattern.MatchString(slug) {
+			return logical.ErrorResponse("invalid enterprise_slug: must be alphanumeric with hyphens, cannot start or end with hyphen")
+		}
+		c.EnterpriseSlug = slug
+	}
+	if enterpriseTokenRaw, ok := data.GetOk("enterprise_token"); ok {
+		c.EnterpriseToken = enterpriseTokenRaw.(string)
+	}
+	if ttlRaw, ok := data.GetOk("enterprise_cache_ttl"); ok {
+		ttl := time.Duration(ttlRaw.(int)) * time.Second
+		if ttl < 0 {
+			return logical.ErrorResponse("enterprise_cache_ttl cannot be negative")
+		}
+		c.EnterpriseCacheTTL = ttl
+	}
+
+	// Only enterprise owners may list the members of the enterprise, which
+	// users logging in rarely are
+	if c.EnterpriseSlug != "" && c.EnterpriseToken == "" {
+		return logical.ErrorResponse("enterprise_token is required when enterprise_slug is set")
+	}
+	return nil
+}
+
+// updateRequireSAMLIdentity updates whether enterprise users without a linked
+// SAML identity are denied in config
+func (b *backend) updateRequireSAMLIdentity(c *config, data *framework.FieldData) *logical.Response {
+	if requireSAMLIdentityRaw, ok := data.GetOk("require_saml_identity"); ok {
+		c.RequireSAMLIdentity = requireSAMLIdentityRaw.(bool)
+	}
+
+	// SAML identities are only known to the enterprise
+	if c.RequireSAMLIdentity && c.EnterpriseSlug == "" {
+		return logical.ErrorResponse("require_saml_identity requires enterprise_slug")
+	}
+	return nil
+}
+
+// updateRequire2FA updates whether users without two-factor authentication
+// are denied in config
+func (b *backend) updateRequire2FA(c *config, data *framework.FieldData) {
+	if require2FARaw, ok := data.GetOk("require_2fa"); ok {
+		c.Require2FA = require2FARaw.(bool)
+	}
+}
+
+// updateAllowPrivateMembership updates whether private memberships are accepted in config
+func (b *backend) updateAllowPrivateMembership(c *config, data *framework.FieldData) {
+	if allowPrivateMembershipRaw, ok := data.GetOk("allow_private_membership"); ok {
+		c.AllowPrivateMembership = allowPrivateMembershipRaw.(bool)
+	}
+}
+
+// updateAllowedTeams updates the teams allowed to authenticate in config
+func (b *backend) updateAllowedTeams(c *config, data *framework.FieldData) {
+	if allowedTeamsRaw, ok := data.GetOk("allowed_teams"); ok {
+		c.AllowedTeams = allowedTeamsRaw.([]string)
+	}
+}
+
+// updateRequiredTeams updates the required teams in config
+func (b *backend) updateRequiredTeams(c *config, data *framework.FieldData) {
+	if requiredTeamsRaw, ok := data.GetOk("required_teams"); ok {
+		c.RequiredTeams = requiredTeamsRaw.([]string)
+	}
+}
+
+// updateUserRestrictions updates the allowed and denied users in config
+func (b *backend) updateUserRestrictions(c *config, data *framework.FieldData) {
+	if allowedUsersRaw, ok := data.GetOk("allowed_users"); ok {
+		c.AllowedUsers = allowedUsersRaw.([]string)
+	}
+	if deniedUsersRaw, ok := data.GetOk("denied_users"); ok {
+		c.DeniedUsers = deniedUsersRaw.([]string)
+	}
+}
+
+// updateRequiredScopes updates the required token scopes in config
+func (b *backend) updateRequiredScopes(c *config, data *framework.FieldData) {
+	if requiredScopesRaw, ok := data.GetOk("required_scopes"); ok {
+		c.RequiredScopes = requiredScopesRaw.([]string)
+	}
+}
+
+// updateReturnTeamDetails updates whether team details are returned in config
+func (b *backend) updateReturnTeamDetails(c *config, data *framework.FieldData) {
+	if returnTeamDetailsRaw, ok := data.GetOk("return_team_details"); ok {
+		c.ReturnTeamDetails = returnTeamDetailsRaw.(bool)
 	}
+}
 
-	// Handle organization ID auto-fetching if needed
-	if err := b.handleOrganizationIDAutoFetch(ctx, c, parsedURL, &resp); err != nil {
-		return nil, err
+// updateStoreToken updates whether GitHub tokens are stored for renewal in config
+func (b *backend) updateStoreToken(c *config, data *framework.FieldData) {
+	if storeTokenRaw, ok := data.GetOk("store_token"); ok {
+		c.StoreToken = storeTokenRaw.(bool)
 	}
+}
 
-	// Parse token fields
-	if errResp := b.parseTokenFields(c, req, data); errResp != nil {
-		return errResp, nil
+// updateAutoSetOrganizationID updates whether organization IDs fetched on
+// login are stored in config
+func (b *backend) updateAutoSetOrganizationID(c *config, data *framework.FieldData) {
+	if autoSetRaw, ok := data.GetOk("auto_set_organization_id"); ok {
+		c.AutoSetOrganizationID = autoSetRaw.(bool)
 	}
+}
 
-	// Handle legacy TTL upgrades
-	if errResp := b.handleTTLUpgrades(c, data); errResp != nil {
-		return errResp, nil
+// updateBasePolicies updates the policies granted to verified members in config
+func (b *backend) updateBasePolicies(c *config, data *framework.FieldData) {
+	if basePoliciesRaw, ok := data.GetOk("base_policies"); ok {
+		c.BasePolicies = policyutil.SanitizePolicies(basePoliciesRaw.([]string), policyutil.DoNotAddDefaultPolicy)
 	}
+}
 
-	// Save configuration to storage
-	if err := b.saveConfig(ctx, req.Storage, c); err != nil {
-		return nil, err
+// updateDenyIfNoPolicies updates whether users without policies are denied in config
+func (b *backend) updateDenyIfNoPolicies(c *config, data *framework.FieldData) {
+	if denyRaw, ok := data.GetOk("deny_if_no_policies"); ok {
+		c.DenyIfNoPolicies = denyRaw.(bool)
 	}
+}
 
-	// Return response with warnings if any
-	if len(resp.Warnings) == 0 {
-		return nil, nil
+// updateStrictResourceOwner updates whether fine-grained tokens whose resource
+// owner cannot be determined are denied in config
+func (b *backend) updateStrictResourceOwner(c *config, data *framework.FieldData) {
+	if strictRaw, ok := data.GetOk("strict_resource_owner"); ok {
+		c.StrictResourceOwner = strictRaw.(bool)
 	}
-	return &resp, nil
 }
 
-// updateOrganization validates and updates the organization settings in config
-func (b *backend) updateOrganization(c *config, data *framework.FieldData) *logical.Response {
-	if organizationRaw, ok := data.GetOk("organization"); ok {
-		org := organizationRaw.(string)
-		if err := validateOrganizationName(org); err != nil {
-			return logical.ErrorResponse("invalid organization: %s", err.Error())
+// updateGroupAliasFormat validates and updates the group alias format in config
+func (b *backend) updateGroupAliasFormat(c *config, data *framework.FieldData) *logical.Response {
+	if formatRaw, ok := data.GetOk("group_alias_format"); ok {
+		format := formatRaw.(string)
+		switch format {
+		case groupAliasFormatName, groupAliasFormatSlug, groupAliasFormatID:
+		default:
+			return logical.ErrorResponse("group_alias_format must be one of %q, %q or %q",
+				groupAliasFormatName, groupAliasFormatSlug, groupAliasFormatID)
 		}
-		c.Organization = org
+		c.GroupAliasFormat = format
 	}
-	if c.Organization == "" {
-		return logical.ErrorResponse("organization is a required parameter")
+	return nil
+}
+
+// updateUsernameCase validates and updates the username casing in config
+func (b *backend) updateUsernameCase(c *config, data *framework.FieldData) *logical.Response {
+	if caseRaw, ok := data.GetOk("username_case"); ok {
+		usernameCase := caseRaw.(string)
+		switch usernameCase {
+		case usernameCasePreserve, usernameCaseLower, usernameCaseUpper:
+		default:
+			return logical.ErrorResponse("username_case must be one of %q, %q or %q",
+				usernameCasePreserve, usernameCaseLower, usernameCaseUpper)
+		}
+		c.UsernameCase = usernameCase
 	}
+	return nil
+}
 
-	if organizationRaw, ok := data.GetOk("organization_id"); ok {
-		c.OrganizationID = organizationRaw.(int64)
+// updateUserAliasName validates and updates the user identifier used for the
+// entity alias in config
+func (b *backend) updateUserAliasName(c *config, data *framework.FieldData) *logical.Response {
+	if nameRaw, ok := data.GetOk("user_alias_name"); ok {
+		name := nameRaw.(string)
+		switch name {
+		case userAliasNameLogin, userAliasNameID, userAliasNameEmail:
+		default:
+			return logical.ErrorResponse("user_alias_name must be one of %q, %q or %q",
+				userAliasNameLogin, userAliasNameID, userAliasNameEmail)
+		}
+		c.UserAliasName = name
 	}
+	return nil
+}
 
+// updateSCIMIdentity validates and updates how the SCIM externalId of the
+// user is used in config
+func (b *backend) updateSCIMIdentity(c *config, data *framework.FieldData) *logical.Response {
+	if modeRaw, ok := data.GetOk("scim_identity"); ok {
+		mode := modeRaw.(string)
+		switch mode {
+		case scimIdentityDisabled, scimIdentityMetadata, scimIdentityAlias:
+		default:
+			return logical.ErrorResponse("scim_identity must be one of %q, %q or %q",
+				scimIdentityDisabled, scimIdentityMetadata, scimIdentityAlias)
+		}
+		c.SCIMIdentity = mode
+	}
 	return nil
 }
 
@@ -219,9 +1085,264 @@ func (b *backend) updateBaseURL(c *config, data *framework.FieldData) (*url.URL,
 	return nil, nil
 }
 
+// updateHTTPSettings validates and updates the proxy, timeout and TLS settings in config
+func (b *backend) updateHTTPSettings(c *config, data *framework.FieldData) *logical.Response {
+	if proxyURLRaw, ok := data.GetOk("proxy_url"); ok {
+		proxyURL := proxyURLRaw.(string)
+		if err := validateProxyURL(proxyURL); err != nil {
+			return logical.ErrorResponse("invalid proxy_url: %s", err.Error())
+		}
+		c.ProxyURL = proxyURL
+	}
+	if requestTimeoutRaw, ok := data.GetOk("request_timeout"); ok {
+		requestTimeout := time.Duration(requestTimeoutRaw.(int)) * time.Second
+		if requestTimeout < 0 {
+			return logical.ErrorResponse("request_timeout cannot be negative")
+		}
+		c.RequestTimeout = requestTimeout
+	}
+	if caCertRaw, ok := data.GetOk("ca_cert"); ok {
+		caCert := caCertRaw.(string)
+		if caCert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(caCert)) {
+			return logical.ErrorResponse("invalid ca_cert: no PEM encoded certificates found")
+		}
+		c.CACert = caCert
+	}
+	if tlsSkipVerifyRaw, ok := data.GetOk("tls_skip_verify"); ok {
+		c.TLSSkipVerify = tlsSkipVerifyRaw.(bool)
+	}
+	return nil
+}
+
+// updateConnectionSettings validates and updates how idle connections to
+// GitHub are kept for reuse in config
+func (b *backend) updateConnectionSettings(c *config, data *framework.FieldData) *logical.Response {
+	if maxIdleConnsRaw, ok := data.GetOk("max_idle_conns"); ok {
+		maxIdleConns := maxIdleConnsRaw.(int)
+		if maxIdleConns < 0 {
+			return logical.ErrorResponse("max_idle_conns cannot be negative")
+		}
+		c.MaxIdleConns = maxIdleConns
+	}
+	if maxIdleConnsPerHostRaw, ok := data.GetOk("max_idle_conns_per_host"); ok {
+		maxIdleConnsPerHost := maxIdleConnsPerHostRaw.(int)
+		if maxIdleConnsPerHost < 0 {
+			return logical.ErrorResponse("max_idle_conns_per_host cannot be negative")
+		}
+		c.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	}
+	if idleConnTimeoutRaw, ok := data.GetOk("idle_conn_timeout"); ok {
+		idleConnTimeout := time.Duration(idleConnTimeoutRaw.(int)) * time.Second
+		if idleConnTimeout < 0 {
+			return logical.ErrorResponse("idle_conn_timeout cannot be negative")
+		}
+		c.IdleConnTimeout = idleConnTimeout
+	}
+	return nil
+}
+
+// updateUnwrapAddress validates and updates the address of the OpenBao API
+// wrapped tokens are unwrapped at in config
+func (b *backend) updateUnwrapAddress(c *config, data *framework.FieldData) *logical.Response {
+	unwrapAddressRaw, ok := data.GetOk("unwrap_address")
+	if !ok {
+		return nil
+	}
+	unwrapAddress := unwrapAddressRaw.(string)
+	if unwrapAddress != "" {
+		parsedURL, err := url.Parse(unwrapAddress)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return logical.ErrorResponse("invalid unwrap_address %q: must be an http or https URL", unwrapAddress)
+		}
+	}
+	c.UnwrapAddress = unwrapAddress
+	return nil
+}
+
+// updateAppSettings validates and updates the GitHub App settings in config
+func (b *backend) updateAppSettings(c *config, data *framework.FieldData) *logical.Response {
+	if appIDRaw, ok := data.GetOk("app_id"); ok {
+		c.AppID = appIDRaw.(int64)
+	}
+	if installationIDRaw, ok := data.GetOk("installation_id"); ok {
+		c.InstallationID = installationIDRaw.(int64)
+	}
+	if privateKeyRaw, ok := data.GetOk("private_key"); ok {
+		c.PrivateKey = privateKeyRaw.(string)
+	}
+
+	if !c.appMode() {
+		if c.InstallationID != 0 || c.PrivateKey != "" {
+			return logical.ErrorResponse("app_id is required when installation_id or private_key is set")
+		}
+		return nil
+	}
+
+	if c.InstallationID == 0 {
+		return logical.ErrorResponse("installation_id is required when app_id is set")
+	}
+	if c.PrivateKey == "" {
+		return logical.ErrorResponse("private_key is required when app_id is set")
+	}
+	if _, err := parseAppPrivateKey(c.PrivateKey); err != nil {
+		return logical.ErrorResponse("invalid private_key: %s", err.Error())
+	}
+
+	return nil
+}
+
+// updateRetrySettings validates and updates the rate limit retry settings in config
+func (b *backend) updateRetrySettings(c *config, data *framework.FieldData) *logical.Response {
+	if maxRetriesRaw, ok := data.GetOk("max_retries"); ok {
+		maxRetries := maxRetriesRaw.(int)
+		if maxRetries < 0 {
+			return logical.ErrorResponse("max_retries cannot be negative")
+		}
+		c.MaxRetries = maxRetries
+	}
+	if maxRetryWaitRaw, ok := data.GetOk("max_retry_wait"); ok {
+		maxRetryWait := time.Duration(maxRetryWaitRaw.(int)) * time.Second
+		if maxRetryWait < 0 {
+			return logical.ErrorResponse("max_retry_wait cannot be negative")
+		}
+		c.MaxRetryWait = maxRetryWait
+	}
+	if thresholdRaw, ok := data.GetOk("rate_limit_warning_threshold"); ok {
+		threshold := thresholdRaw.(int)
+		if threshold < 0 {
+			return logical.ErrorResponse("rate_limit_warning_threshold cannot be negative")
+		}
+		c.RateLimitWarningThreshold = threshold
+	}
+	return nil
+}
+
+// updateUseGraphQL updates whether teams are queried with the GraphQL API in config
+func (b *backend) updateUseGraphQL(c *config, data *framework.FieldData) {
+	if useGraphQLRaw, ok := data.GetOk("use_graphql"); ok {
+		c.UseGraphQL = useGraphQLRaw.(bool)
+	}
+}
+
+// updateResolveParentTeams updates whether policies are mapped to the parent
+// teams of the user's teams in config
+func (b *backend) updateResolveParentTeams(c *config, data *framework.FieldData) {
+	if resolveRaw, ok := data.GetOk("resolve_parent_teams"); ok {
+		c.ResolveParentTeams = resolveRaw.(bool)
+	}
+}
+
+// updateTeamsPerPage validates and updates the team listing page size in config
+func (b *backend) updateTeamsPerPage(c *config, data *framework.FieldData) *logical.Response {
+	if perPageRaw, ok := data.GetOk("teams_per_page"); ok {
+		perPage := perPageRaw.(int)
+		if perPage < 1 || perPage > maxPerPage {
+			return logical.ErrorResponse("teams_per_page must be between 1 and %d", maxPerPage)
+		}
+		c.TeamsPerPage = perPage
+	}
+	return nil
+}
+
+// updateMembershipCacheTTL validates and updates the membership cache TTL in config
+func (b *backend) updateMembershipCacheTTL(c *config, data *framework.FieldData) *logical.Response {
+	if ttlRaw, ok := data.GetOk("membership_cache_ttl"); ok {
+		ttl := time.Duration(ttlRaw.(int)) * time.Second
+		if ttl < 0 {
+			return logical.ErrorResponse("membership_cache_ttl cannot be negative")
+		}
+		c.MembershipCacheTTL = ttl
+	}
+	return nil
+}
+
+// updateOrganizationCacheTTL validates and updates the organization cache TTL in config
+func (b *backend) updateOrganizationCacheTTL(c *config, data *framework.FieldData) *logical.Response {
+	if ttlRaw, ok := data.GetOk("organization_cache_ttl"); ok {
+		ttl := time.Duration(ttlRaw.(int)) * time.Second
+		if ttl < 0 {
+			return logical.ErrorResponse("organization_cache_ttl cannot be negative")
+		}
+		c.OrganizationCacheTTL = ttl
+	}
+	return nil
+}
+
+// updateParentTeamCacheTTL validates and updates the parent team cache TTL in config
+func (b *backend) updateParentTeamCacheTTL(c *config, data *framework.FieldData) *logical.Response {
+	if ttlRaw, ok := data.GetOk("parent_team_cache_ttl"); ok {
+		ttl := time.Duration(ttlRaw.(int)) * time.Second
+		if ttl < 0 {
+			return logical.ErrorResponse("parent_team_cache_ttl cannot be negative")
+		}
+		c.ParentTeamCacheTTL = ttl
+	}
+	return nil
+}
+
+// updateRevalidationInterval validates and updates the revalidation interval in config
+func (b *backend) updateRevalidationInterval(c *config, data *framework.FieldData) *logical.Response {
+	if intervalRaw, ok := data.GetOk("revalidation_interval"); ok {
+		interval := time.Duration(intervalRaw.(int)) * time.Second
+		if interval < 0 {
+			return logical.ErrorResponse("revalidation_interval cannot be negative")
+		}
+		c.RevalidationInterval = interval
+	}
+	return nil
+}
+
+// updateRenewOnGitHubError validates and updates whether tokens are renewed
+// while GitHub is unavailable, and for how long, in config
+func (b *backend) updateRenewOnGitHubError(c *config, data *framework.FieldData) *logical.Response {
+	if renewRaw, ok := data.GetOk("renew_on_github_error"); ok {
+		c.RenewOnGitHubError = renewRaw.(bool)
+	}
+	if periodRaw, ok := data.GetOk("renew_grace_period"); ok {
+		c.RenewGracePeriod = time.Duration(periodRaw.(int)) * time.Second
+	}
+	if c.RenewGracePeriod < 0 {
+		return logical.ErrorResponse("renew_grace_period cannot be negative")
+	}
+	if c.RenewOnGitHubError && c.RenewGracePeriod == 0 {
+		return logical.ErrorResponse("renew_grace_period must be set when renew_on_github_error is enabled")
+	}
+	return nil
+}
+
+// updateOwnerTokenTTLs validates and updates the token TTLs of organization owners in config
+func (b *backend) updateOwnerTokenTTLs(c *config, data *framework.FieldData) *logical.Response {
+	if ttlRaw, ok := data.GetOk("owner_token_ttl"); ok {
+		c.OwnerTokenTTL = time.Duration(ttlRaw.(int)) * time.Second
+	}
+	if maxTTLRaw, ok := data.GetOk("owner_token_max_ttl"); ok {
+		c.OwnerTokenMaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	}
+
+	if c.OwnerTokenTTL < 0 || c.OwnerTokenMaxTTL < 0 {
+		return logical.ErrorResponse("owner_token_ttl and owner_token_max_ttl cannot be negative")
+	}
+	if c.OwnerTokenTTL > 0 && c.OwnerTokenMaxTTL > 0 && c.OwnerTokenTTL > c.OwnerTokenMaxTTL {
+		return logical.ErrorResponse("owner_token_ttl cannot be greater than owner_token_max_ttl")
+	}
+	return nil
+}
+
 // handleOrganizationIDAutoFetch attempts to auto-fetch the organization ID if not set
 func (b *backend) handleOrganizationIDAutoFetch(ctx context.Context, c *config, parsedURL *url.URL, resp *logical.Response) error {
-	if c.OrganizationID != 0 {
+	if !c.missingOrganizationIDs() {
+		return nil
+	}
+
+	// A GitHub App can always look up the organization it is installed in
+	if c.appMode() {
+		client, err := b.installationClient(ctx, c)
+		if err != nil {
+			return fmt.Errorf("failed to create GitHub App client: %w", err)
+		}
+		if err := c.setOrganizationID(ctx, client); err != nil {
+			return fmt.Errorf("unable to fetch the organization_id for organization '%s', you must manually set it in the config: %w", c.Organization, err)
+		}
 		return nil
 	}
 
@@ -238,7 +1359,8 @@ func (b *backend) handleOrganizationIDAutoFetch(ctx context.Context, c *config,
 
 // fetchAndSetOrganizationID creates a GitHub client and fetches the organization ID
 func (b *backend) fetchAndSetOrganizationID(ctx context.Context, c *config, githubToken string, parsedURL *url.URL) error {
-	client, err := b.Client(githubToken)
+	// The stored base_url applies when it is not part of this update
+	client, err := b.clientForConfig(githubToken, c)
 	if err != nil {
 		return fmt.Errorf("failed to create GitHub client: %w", err)
 	}
@@ -303,9 +1425,57 @@ func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, data
 	}
 
 	d := map[string]interface{}{
-		"organization_id": config.OrganizationID,
-		"organization":    config.Organization,
-		"base_url":        config.BaseURL,
+		"organization_id":              config.OrganizationID,
+		"organization":                 config.Organization,
+		"base_url":                     config.BaseURL,
+		"proxy_url":                    config.ProxyURL,
+		"request_timeout":              int64(config.RequestTimeout.Seconds()),
+		"max_idle_conns":               config.MaxIdleConns,
+		"max_idle_conns_per_host":      config.MaxIdleConnsPerHost,
+		"idle_conn_timeout":            int64(config.IdleConnTimeout.Seconds()),
+		"unwrap_address":               config.UnwrapAddress,
+		"ca_cert":                      config.CACert,
+		"tls_skip_verify":              config.TLSSkipVerify,
+		"organizations":                config.Organizations,
+		"organization_ids":             config.OrganizationIDs,
+		"enterprise_slug":              config.EnterpriseSlug,
+		"enterprise_cache_ttl":         int64(config.EnterpriseCacheTTL.Seconds()),
+		"require_saml_identity":        config.RequireSAMLIdentity,
+		"require_2fa":                  config.Require2FA,
+		"allow_any_org":                config.AllowAnyOrg,
+		"membership_check":             config.membershipCheck(),
+		"allow_private_membership":     config.AllowPrivateMembership,
+		"required_teams":               config.RequiredTeams,
+		"allowed_teams":                config.AllowedTeams,
+		"allowed_users":                config.AllowedUsers,
+		"denied_users":                 config.DeniedUsers,
+		"required_scopes":              config.RequiredScopes,
+		"return_team_details":          config.ReturnTeamDetails,
+		"store_token":                  config.StoreToken,
+		"auto_set_organization_id":     config.AutoSetOrganizationID,
+		"base_policies":                config.BasePolicies,
+		"deny_if_no_policies":          config.DenyIfNoPolicies,
+		"strict_resource_owner":        config.StrictResourceOwner,
+		"owner_token_ttl":              int64(config.OwnerTokenTTL.Seconds()),
+		"owner_token_max_ttl":          int64(config.OwnerTokenMaxTTL.Seconds()),
+		"group_alias_format":           config.GroupAliasFormat,
+		"username_case":                config.usernameCase(),
+		"user_alias_name":              config.userAliasName(),
+		"scim_identity":                config.scimIdentity(),
+		"app_id":                       config.AppID,
+		"installation_id":              config.InstallationID,
+		"max_retries":                  config.MaxRetries,
+		"max_retry_wait":               int64(config.MaxRetryWait.Seconds()),
+		"rate_limit_warning_threshold": config.RateLimitWarningThreshold,
+		"use_graphql":                  config.UseGraphQL,
+		"resolve_parent_teams":         config.ResolveParentTeams,
+		"teams_per_page":               config.TeamsPerPage,
+		"membership_cache_ttl":         int64(config.MembershipCacheTTL.Seconds()),
+		"organization_cache_ttl":       int64(config.OrganizationCacheTTL.Seconds()),
+		"parent_team_cache_ttl":        int64(config.ParentTeamCacheTTL.Seconds()),
+		"revalidation_interval":        int64(config.RevalidationInterval.Seconds()),
+		"renew_on_github_error":        config.RenewOnGitHubError,
+		"renew_grace_period":           int64(config.RenewGracePeriod.Seconds()),
 	}
 	config.PopulateTokenData(d)
 
@@ -331,8 +1501,9 @@ func (b *backend) Config(ctx context.Context, s logical.Storage) (*config, error
 		return nil, nil
 	}
 
-	var result config
-	if err := entry.DecodeJSON(&result); err != nil {
+	// Configs stored before settings were added keep their defaults
+	result := newConfig()
+	if err := entry.DecodeJSON(result); err != nil {
 		return nil, fmt.Errorf("error reading configuration: %w", err)
 	}
 
@@ -343,7 +1514,29 @@ func (b *backend) Config(ctx context.Context, s logical.Storage) (*config, error
 		result.TokenMaxTTL = result.MaxTTL
 	}
 
-	return &result, nil
+	return result, nil
+}
+
+// newConfig returns a config with the default settings
+func newConfig() *config {
+	return &config{
+		MaxRetries:                defaultMaxRetries,
+		MaxRetryWait:              defaultMaxRetryWait,
+		RateLimitWarningThreshold: defaultRateLimitWarningThreshold,
+		RequestTimeout:            defaultRequestTimeout,
+		MaxIdleConns:              defaultMaxIdleConns,
+		MaxIdleConnsPerHost:       defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:           defaultIdleConnTimeout,
+		GroupAliasFormat:          groupAliasFormatSlug,
+		UsernameCase:              usernameCasePreserve,
+		UserAliasName:             userAliasNameLogin,
+		TeamsPerPage:              defaultPerPage,
+		StoreToken:                true,
+		AutoSetOrganizationID:     true,
+		MembershipCheck:           membershipCheckOrganization,
+		RenewGracePeriod:          defaultRenewGracePeriod,
+		EnterpriseCacheTTL:        defaultEnterpriseCacheTTL,
+	}
 }
 
 type config struct {
@@ -354,19 +1547,377 @@ type config struct {
 	BaseURL        string        `json:"base_url" structs:"base_url" mapstructure:"base_url"`
 	TTL            time.Duration `json:"ttl" structs:"ttl" mapstructure:"ttl"`
 	MaxTTL         time.Duration `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
+	AppID          int64         `json:"app_id" structs:"app_id" mapstructure:"app_id"`
+	InstallationID int64         `json:"installation_id" structs:"installation_id" mapstructure:"installation_id"`
+	PrivateKey     string        `json:"private_key" structs:"private_key" mapstructure:"private_key"`
+	MaxRetries     int           `json:"max_retries" structs:"max_retries" mapstructure:"max_retries"`
+	MaxRetryWait   time.Duration `json:"max_retry_wait" structs:"max_retry_wait" mapstructure:"max_retry_wait"`
+	ProxyURL       string        `json:"proxy_url" structs:"proxy_url" mapstructure:"proxy_url"`
+	RequestTimeout time.Duration `json:"request_timeout" structs:"request_timeout" mapstructure:"request_timeout"`
+	CACert         string        `json:"ca_cert" structs:"ca_cert" mapstructure:"ca_cert"`
+	TLSSkipVerify  bool          `json:"tls_skip_verify" structs:"tls_skip_verify" mapstructure:"tls_skip_verify"`
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout tune how idle
+	// connections to GitHub are kept open for reuse across requests
+	MaxIdleConns        int           `json:"max_idle_conns" structs:"max_idle_conns" mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host" structs:"max_idle_conns_per_host" mapstructure:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout" structs:"idle_conn_timeout" mapstructure:"idle_conn_timeout"`
+
+	// UnwrapAddress is the address of the OpenBao API the wrapped_token of
+	// logins is unwrapped at, with logins using wrapped_token rejected when
+	// it is empty
+	UnwrapAddress string `json:"unwrap_address" structs:"unwrap_address" mapstructure:"unwrap_address"`
+
+	// RateLimitWarningThreshold is the number of remaining requests below
+	// which logins warn about the rate limit, with zero disabling the warning
+	RateLimitWarningThreshold int `json:"rate_limit_warning_threshold" structs:"rate_limit_warning_threshold" mapstructure:"rate_limit_warning_threshold"`
+
+	// UseGraphQL queries the teams of the user with the GraphQL API, falling
+	// back to the REST API when it is unavailable
+	UseGraphQL bool `json:"use_graphql" structs:"use_graphql" mapstructure:"use_graphql"`
+
+	// ResolveParentTeams maps policies to the ancestors of the teams of the
+	// user as well
+	ResolveParentTeams bool `json:"resolve_parent_teams" structs:"resolve_parent_teams" mapstructure:"resolve_parent_teams"`
+
+	// TeamsPerPage is the page size used when listing teams
+	TeamsPerPage int `json:"teams_per_page" structs:"teams_per_page" mapstructure:"teams_per_page"`
+
+	// MembershipCacheTTL is how long resolved teams are cached, with zero
+	// disabling the cache
+	MembershipCacheTTL time.Duration `json:"membership_cache_ttl" structs:"membership_cache_ttl" mapstructure:"membership_cache_ttl"`
+
+	// OrganizationCacheTTL is how long fetched organizations are cached, with
+	// zero disabling the cache
+	OrganizationCacheTTL time.Duration `json:"organization_cache_ttl" structs:"organization_cache_ttl" mapstructure:"organization_cache_ttl"`
+
+	// ParentTeamCacheTTL is how long fetched parent teams are cached, with
+	// zero disabling the cache
+	ParentTeamCacheTTL time.Duration `json:"parent_team_cache_ttl" structs:"parent_team_cache_ttl" mapstructure:"parent_team_cache_ttl"`
+
+	// OwnerTokenTTL and OwnerTokenMaxTTL override the token TTLs of
+	// organization owners, with zero using the token TTLs of other users
+	OwnerTokenTTL    time.Duration `json:"owner_token_ttl" structs:"owner_token_ttl" mapstructure:"owner_token_ttl"`
+	OwnerTokenMaxTTL time.Duration `json:"owner_token_max_ttl" structs:"owner_token_max_ttl" mapstructure:"owner_token_max_ttl"`
+
+	// RevalidationInterval is how often the sessions of active tokens are
+	// revalidated, with zero disabling revalidation
+	RevalidationInterval time.Duration `json:"revalidation_interval" structs:"revalidation_interval" mapstructure:"revalidation_interval"`
+
+	// RenewOnGitHubError renews tokens with their current policies while
+	// GitHub is unavailable, for up to RenewGracePeriod after the user was
+	// last verified
+	RenewOnGitHubError bool          `json:"renew_on_github_error" structs:"renew_on_github_error" mapstructure:"renew_on_github_error"`
+	RenewGracePeriod   time.Duration `json:"renew_grace_period" structs:"renew_grace_period" mapstructure:"renew_grace_period"`
+
+	// Organizations are additional organizations users may be part of, with
+	// the ID of each at the same index of OrganizationIDs
+	Organizations   []string `json:"organizations" structs:"organizations" mapstructure:"organizations"`
+	OrganizationIDs []int64  `json:"organization_ids" structs:"organization_ids" mapstructure:"organization_ids"`
+
+	// EnterpriseSlug is the GitHub Enterprise account users must be part of
+	EnterpriseSlug string `json:"enterprise_slug" structs:"enterprise_slug" mapstructure:"enterprise_slug"`
+
+	// EnterpriseToken is the token of an enterprise owner the members of the
+	// enterprise are listed with, and EnterpriseCacheTTL how long they are
+	// cached, with zero disabling the cache
+	EnterpriseToken    string        `json:"enterprise_token" structs:"enterprise_token" mapstructure:"enterprise_token"`
+	EnterpriseCacheTTL time.Duration `json:"enterprise_cache_ttl" structs:"enterprise_cache_ttl" mapstructure:"enterprise_cache_ttl"`
+
+	// RequireSAMLIdentity denies users without a SAML identity linked in the
+	// enterprise
+	RequireSAMLIdentity bool `json:"require_saml_identity" structs:"require_saml_identity" mapstructure:"require_saml_identity"`
+
+	// Require2FA denies users that do not have two-factor authentication
+	// enabled
+	Require2FA bool `json:"require_2fa" structs:"require_2fa" mapstructure:"require_2fa"`
+
+	// AllowAnyOrg accepts users of any organization they are an active
+	// member of when Organization is empty
+	AllowAnyOrg bool `json:"allow_any_org" structs:"allow_any_org" mapstructure:"allow_any_org"`
+
+	// MembershipCheck is whether logins verify the organization membership
+	// of the user, with membershipCheckNone accepting any GitHub user
+	MembershipCheck string `json:"membership_check" structs:"membership_check" mapstructure:"membership_check"`
+
+	// AllowPrivateMembership accepts users whose organization membership is
+	// private if the organization is listed among the user's organizations
+	AllowPrivateMembership bool `json:"allow_private_membership" structs:"allow_private_membership" mapstructure:"allow_private_membership"`
+
+	// RequiredTeams are the names or slugs of teams users must be part of
+	RequiredTeams []string `json:"required_teams" structs:"required_teams" mapstructure:"required_teams"`
+
+	// AllowedTeams are the slugs of the teams users must be part of to
+	// authenticate, maintained apart from the policy mappings
+	AllowedTeams []string `json:"allowed_teams" structs:"allowed_teams" mapstructure:"allowed_teams"`
+
+	// AllowedUsers restricts logins to these users if set, while DeniedUsers
+	// are never allowed to log in
+	AllowedUsers []string `json:"allowed_users" structs:"allowed_users" mapstructure:"allowed_users"`
+	DeniedUsers  []string `json:"denied_users" structs:"denied_users" mapstructure:"denied_users"`
+
+	// RequiredScopes are the OAuth scopes tokens must be granted
+	RequiredScopes []string `json:"required_scopes" structs:"required_scopes" mapstructure:"required_scopes"`
+
+	// ReturnTeamDetails returns the resolved teams and their policies in
+	// the login response
+	ReturnTeamDetails bool `json:"return_team_details" structs:"return_team_details" mapstructure:"return_team_details"`
+
+	// StoreToken stores the GitHub token of the user with the issued token
+	// so that renewals can verify it again
+	StoreToken bool `json:"store_token" structs:"store_token" mapstructure:"store_token"`
+
+	// AutoSetOrganizationID stores the organization IDs fetched on login
+	// when they are not configured
+	AutoSetOrganizationID bool `json:"auto_set_organization_id" structs:"auto_set_organization_id" mapstructure:"auto_set_organization_id"`
+
+	// BasePolicies are granted to every user whose organization membership
+	// has been verified
+	BasePolicies []string `json:"base_policies" structs:"base_policies" mapstructure:"base_policies"`
+
+	// DenyIfNoPolicies denies the login of users that are assigned no
+	// policies other than default
+	DenyIfNoPolicies bool `json:"deny_if_no_policies" structs:"deny_if_no_policies" mapstructure:"deny_if_no_policies"`
+
+	// StrictResourceOwner denies the login of fine-grained PATs whose
+	// resource owner cannot be determined
+	StrictResourceOwner bool `json:"strict_resource_owner" structs:"strict_resource_owner" mapstructure:"strict_resource_owner"`
+
+	// GroupAliasFormat is the team identifier used as group alias, one of
+	// name, slug or id
+	GroupAliasFormat string `json:"group_alias_format" structs:"group_alias_format" mapstructure:"group_alias_format"`
+
+	// UsernameCase is the casing the login of the user is normalized to,
+	// one of preserve, lower or upper
+	UsernameCase string `json:"username_case" structs:"username_case" mapstructure:"username_case"`
+
+	// UserAliasName is the user identifier used as entity alias, one of
+	// login, id or email
+	UserAliasName string `json:"user_alias_name" structs:"user_alias_name" mapstructure:"user_alias_name"`
+
+	// SCIMIdentity is how the SCIM externalId of the user is used, one of
+	// disabled, metadata or alias
+	SCIMIdentity string `json:"scim_identity" structs:"scim_identity" mapstructure:"scim_identity"`
+}
+
+// usernameCase returns the configured username casing. Configurations
+// written before it was introduced preserve the casing.
+func (c *config) usernameCase() string {
+	if c.UsernameCase == "" {
+		return usernameCasePreserve
+	}
+	return c.UsernameCase
+}
+
+// userAliasName returns the user identifier used as entity alias.
+// Configurations written before user_alias_name use the login.
+func (c *config) userAliasName() string {
+	if c.UserAliasName == "" {
+		return userAliasNameLogin
+	}
+	return c.UserAliasName
+}
+
+// scimIdentity returns how the SCIM externalId of the user is used.
+// Configurations written before scim_identity do not resolve it.
+func (c *config) scimIdentity() string {
+	if c.SCIMIdentity == "" {
+		return scimIdentityDisabled
+	}
+	return c.SCIMIdentity
+}
+
+// normalizeUsername returns the login of the user in the configured casing.
+// GitHub logins are case insensitive, but not always returned in the same
+// casing, while entity aliases are case sensitive.
+func (c *config) normalizeUsername(login string) string {
+	switch c.usernameCase() {
+	case usernameCaseLower:
+		return strings.ToLower(login)
+	case usernameCaseUpper:
+		return strings.ToUpper(login)
+	default:
+		return login
+	}
+}
+
+// userAllowed reports whether the user may log in. GitHub logins are case
+// insensitive, and denied users are rejected even if they are also allowed.
+func (c *config) userAllowed(login string) bool {
+	for _, denied := range c.DeniedUsers {
+		if strings.EqualFold(denied, login) {
+			return false
+		}
+	}
+
+	if len(c.AllowedUsers) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedUsers {
+		if strings.EqualFold(allowed, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsConfig returns the TLS configuration for requests to GitHub, or nil if
+// the defaults should be used
+func (c *config) tlsConfig() (*tls.Config, error) {
+	if c.CACert == "" && !c.TLSSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TLSSkipVerify,
+	}
+
+	if c.CACert != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, fmt.Errorf("failed to parse configured ca_cert")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	return tlsConfig, nil
+}
+
+// organizationRef identifies an organization users may be part of
+type organizationRef struct {
+	Name string
+	ID   int64
+}
+
+// membershipCheck returns whether logins verify the organization membership
+// of the user, which configs written before it was configurable do
+func (c *config) membershipCheck() string {
+	if c.MembershipCheck == "" {
+		return membershipCheckOrganization
+	}
+	return c.MembershipCheck
+}
+
+// skipMembershipCheck reports whether any GitHub user is accepted without
+// verifying the membership of an organization
+func (c *config) skipMembershipCheck() bool {
+	return c.membershipCheck() == membershipCheckNone
+}
+
+// organizationOptional reports whether the organization may be left empty
+func (c *config) organizationOptional() bool {
+	return c.AllowAnyOrg || c.skipMembershipCheck()
+}
+
+// validateMembershipCheck rejects settings that depend on the organization
+// membership of the user when it is not verified
+func (c *config) validateMembershipCheck() *logical.Response {
+	if !c.skipMembershipCheck() {
+		return nil
+	}
+
+	var conflicts []string
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"organization", c.Organization != ""},
+		{"organizations", len(c.Organizations) > 0},
+		{"allow_any_org", c.AllowAnyOrg},
+		{"enterprise_slug", c.EnterpriseSlug != ""},
+		{"require_2fa", c.Require2FA},
+		{"required_teams", len(c.RequiredTeams) > 0},
+		{"allowed_teams", len(c.AllowedTeams) > 0},
+		{"scim_identity", c.scimIdentity() != scimIdentityDisabled},
+		{"app_id", c.appMode()},
+	} {
+		if setting.set {
+			conflicts = append(conflicts, setting.name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return logical.ErrorResponse("membership_check %q cannot be combined with settings that depend on the organization: %s",
+			membershipCheckNone, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// anyOrganization reports whether users of any organization are accepted,
+// rather than those of the configured organizations
+func (c *config) anyOrganization() bool {
+	return c.AllowAnyOrg && c.Organization == ""
+}
+
+// candidateOrganizations returns the organizations users may be part of,
+// starting with the primary organization. There are none when any
+// organization is accepted or the membership is not verified.
+func (c *config) candidateOrganizations() []organizationRef {
+	if c.anyOrganization() || c.skipMembershipCheck() {
+		return nil
+	}
+	candidates := []organizationRef{{Name: c.Organization, ID: c.OrganizationID}}
+	for i, name := range c.Organizations {
+		var id int64
+		if i < len(c.OrganizationIDs) {
+			id = c.OrganizationIDs[i]
+		}
+		candidates = append(candidates, organizationRef{Name: name, ID: id})
+	}
+	return candidates
+}
+
+// missingOrganizationIDs reports whether the ID of any configured
+// organization is unknown
+func (c *config) missingOrganizationIDs() bool {
+	for _, candidate := range c.candidateOrganizations() {
+		if candidate.ID == 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *config) setOrganizationID(ctx context.Context, client *github.Client) error {
-	org, _, err := client.Organizations.Get(ctx, c.Organization)
+	if c.OrganizationID == 0 {
+		orgID, err := fetchOrganizationID(ctx, client, c.Organization)
+		if err != nil {
+			return err
+		}
+		c.OrganizationID = orgID
+	}
+
+	if len(c.OrganizationIDs) != len(c.Organizations) {
+		c.OrganizationIDs = make([]int64, len(c.Organizations))
+	}
+	for i, name := range c.Organizations {
+		if c.OrganizationIDs[i] != 0 {
+			continue
+		}
+		orgID, err := fetchOrganizationID(ctx, client, name)
+		if err != nil {
+			return err
+		}
+		c.OrganizationIDs[i] = orgID
+	}
+
+	return nil
+}
+
+// fetchOrganizationID looks up the ID of the named organization
+func fetchOrganizationID(ctx context.Context, client *github.Client, name string) (int64, error) {
+	org, _, err := client.Organizations.Get(ctx, name)
 	if err != nil {
-		return fmt.Errorf("failed to get organization '%s' from GitHub API: %w", c.Organization, err)
+		return 0, fmt.Errorf("failed to get organization '%s' from GitHub API: %w", name, err)
 	}
 
 	orgID := org.GetID()
 	if orgID == 0 {
-		return fmt.Errorf("organization_id not found for organization '%s' - organization may not exist or may be private", c.Organization)
+		return 0, fmt.Errorf("organization_id not found for organization '%s' - organization may not exist or may be private", name)
 	}
 
-	c.OrganizationID = orgID
-	return nil
+	return orgID, nil
 }
@@ -0,0 +1,300 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/helper/policyutil"
+	"github.com/openbao/openbao/sdk/v2/helper/tokenutil"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+const (
+	// defaultOIDCIssuer is the issuer of the OIDC tokens of GitHub Actions
+	defaultOIDCIssuer = "https://token.actions.githubusercontent.com"
+
+	// defaultOIDCJWKSURL serves the keys GitHub Actions signs its OIDC
+	// tokens with
+	defaultOIDCJWKSURL = defaultOIDCIssuer + "/.well-known/jwks"
+
+	// oidcConfigPath is where the OIDC login configuration is stored
+	oidcConfigPath = "config/oidc"
+)
+
+func pathConfigOIDC(b *backend) *framework.Path {
+	p := &framework.Path{
+		Pattern: "config/oidc",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixGithub,
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"jwks_url": {
+				Type:        framework.TypeString,
+				Description: "URL of the keys the OIDC tokens are signed with.",
+				Default:     defaultOIDCJWKSURL,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "JWKS URL",
+				},
+			},
+			"bound_issuer": {
+				Type:        framework.TypeString,
+				Description: "Issuer the OIDC tokens must have been issued by.",
+				Default:     defaultOIDCIssuer,
+			},
+			"bound_audiences": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "List of audiences of which the OIDC tokens must have one. Required.",
+			},
+			"bound_repository_owners": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `List of users or organizations whose workflows may log in. At least one of
+bound_repository_owners and bound_repositories is required.`,
+			},
+			"bound_repositories": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "List of repositories, as owner/name, whose workflows may log in.",
+			},
+			"bound_workflows": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "List of workflow names that may log in. If empty, any workflow may log in.",
+			},
+			"repository_policies": {
+				Type: framework.TypeKVPairs,
+				Description: `Policies assigned to the workflows of a repository, as a map of repositories
+to comma separated lists of policies.`,
+			},
+			"claim_mappings": {
+				Type:        framework.TypeKVPairs,
+				Description: "Mappings of claims of the OIDC token to metadata keys of the token.",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigOIDCWrite,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb:   "configure",
+					OperationSuffix: "oidc",
+				},
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigOIDCRead,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "oidc-configuration",
+				},
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathConfigOIDCDelete,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "oidc-configuration",
+				},
+			},
+		},
+
+		HelpSynopsis:    pathConfigOIDCHelpSyn,
+		HelpDescription: pathConfigOIDCHelpDesc,
+	}
+
+	tokenutil.AddTokenFields(p.Fields)
+	p.Fields["token_policies"].Description += ". This will apply to all tokens generated by OIDC logins, in addition to the policies of repository_policies."
+	return p
+}
+
+// oidcConfig configures the login of GitHub Actions workflows with the OIDC
+// tokens GitHub issues them
+type oidcConfig struct {
+	tokenutil.TokenParams
+
+	JWKSURL               string              `json:"jwks_url" structs:"jwks_url" mapstructure:"jwks_url"`
+	BoundIssuer           string              `json:"bound_issuer" structs:"bound_issuer" mapstructure:"bound_issuer"`
+	BoundAudiences        []string            `json:"bound_audiences" structs:"bound_audiences" mapstructure:"bound_audiences"`
+	BoundRepositoryOwners []string            `json:"bound_repository_owners" structs:"bound_repository_owners" mapstructure:"bound_repository_owners"`
+	BoundRepositories     []string            `json:"bound_repositories" structs:"bound_repositories" mapstructure:"bound_repositories"`
+	BoundWorkflows        []string            `json:"bound_workflows" structs:"bound_workflows" mapstructure:"bound_workflows"`
+	RepositoryPolicies    map[string][]string `json:"repository_policies" structs:"repository_policies" mapstructure:"repository_policies"`
+	ClaimMappings         map[string]string   `json:"claim_mappings" structs:"claim_mappings" mapstructure:"claim_mappings"`
+}
+
+// OIDCConfig returns the OIDC login configuration, or nil if OIDC logins
+// have not been configured
+func (b *backend) OIDCConfig(ctx context.Context, s logical.Storage) (*oidcConfig, error) {
+	entry, err := s.Get(ctx, oidcConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OIDC config from storage: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	result := &oidcConfig{}
+	if err := entry.DecodeJSON(result); err != nil {
+		return nil, fmt.Errorf("error reading OIDC configuration: %w", err)
+	}
+	return result, nil
+}
+
+// repositoryPolicies returns the policies mapped to the repository.
+// Repository names are case-insensitive.
+func (c *oidcConfig) repositoryPolicies(repository string) []string {
+	for name, policies := range c.RepositoryPolicies {
+		if strings.EqualFold(name, repository) {
+			return policies
+		}
+	}
+	return nil
+}
+
+func (b *backend) pathConfigOIDCWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	c, err := b.OIDCConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = &oidcConfig{
+			JWKSURL:     defaultOIDCJWKSURL,
+			BoundIssuer: defaultOIDCIssuer,
+		}
+	}
+
+	if raw, ok := data.GetOk("jwks_url"); ok {
+		c.JWKSURL = strings.TrimSpace(raw.(string))
+	}
+	if c.JWKSURL == "" {
+		c.JWKSURL = defaultOIDCJWKSURL
+	}
+	parsedURL, err := url.Parse(c.JWKSURL)
+	if err != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return logical.ErrorResponse("jwks_url must be an http or https URL"), nil
+	}
+
+	if raw, ok := data.GetOk("bound_issuer"); ok {
+		c.BoundIssuer = strings.TrimSpace(raw.(string))
+	}
+	if c.BoundIssuer == "" {
+		c.BoundIssuer = defaultOIDCIssuer
+	}
+
+	if raw, ok := data.GetOk("bound_audiences"); ok {
+		c.BoundAudiences = trimmedNonEmpty(raw.([]string))
+	}
+	if raw, ok := data.GetOk("bound_repository_owners"); ok {
+		c.BoundRepositoryOwners = trimmedNonEmpty(raw.([]string))
+	}
+	if raw, ok := data.GetOk("bound_repositories"); ok {
+		c.BoundRepositories = trimmedNonEmpty(raw.([]string))
+	}
+	if raw, ok := data.GetOk("bound_workflows"); ok {
+		c.BoundWorkflows = trimmedNonEmpty(raw.([]string))
+	}
+
+	// Any repository can request a token for any audience, so the tokens
+	// must be bound to the workflows of known owners or repositories
+	if len(c.BoundAudiences) == 0 {
+		return logical.ErrorResponse("bound_audiences must be set"), nil
+	}
+	if len(c.BoundRepositoryOwners) == 0 && len(c.BoundRepositories) == 0 {
+		return logical.ErrorResponse("at least one of bound_repository_owners and bound_repositories must be set"), nil
+	}
+	for _, repository := range c.BoundRepositories {
+		if owner, name, ok := strings.Cut(repository, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return logical.ErrorResponse("invalid repository %q in bound_repositories, must be owner/name", repository), nil
+		}
+	}
+
+	if raw, ok := data.GetOk("repository_policies"); ok {
+		c.RepositoryPolicies = make(map[string][]string)
+		for repository, policies := range raw.(map[string]string) {
+			c.RepositoryPolicies[repository] = policyutil.ParsePolicies(policies)
+		}
+	}
+
+	if raw, ok := data.GetOk("claim_mappings"); ok {
+		c.ClaimMappings = raw.(map[string]string)
+		for claim, key := range c.ClaimMappings {
+			if slices.Contains(reservedOIDCMetadataKeys, key) {
+				return logical.ErrorResponse("claim %q cannot be mapped to metadata key %q set by the auth method", claim, key), nil
+			}
+		}
+	}
+
+	if err := c.ParseTokenFields(req, data); err != nil {
+		return logical.ErrorResponse("failed to parse token fields: %s", err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(oidcConfigPath, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage entry for OIDC config: %w", err)
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, fmt.Errorf("failed to store OIDC config: %w", err)
+	}
+
+	// Keys fetched from a previous URL must not be trusted anymore
+	b.oidcKeySets.reset()
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigOIDCRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	c, err := b.OIDCConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, nil
+	}
+
+	d := map[string]interface{}{
+		"jwks_url":                c.JWKSURL,
+		"bound_issuer":            c.BoundIssuer,
+		"bound_audiences":         c.BoundAudiences,
+		"bound_repository_owners": c.BoundRepositoryOwners,
+		"bound_repositories":      c.BoundRepositories,
+		"bound_workflows":         c.BoundWorkflows,
+		"repository_policies":     c.RepositoryPolicies,
+		"claim_mappings":          c.ClaimMappings,
+	}
+	c.PopulateTokenData(d)
+
+	return &logical.Response{
+		Data: d,
+	}, nil
+}
+
+func (b *backend) pathConfigOIDCDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, oidcConfigPath); err != nil {
+		return nil, fmt.Errorf("failed to delete OIDC config: %w", err)
+	}
+	b.oidcKeySets.reset()
+	return nil, nil
+}
+
+// trimmedNonEmpty trims the values and drops the empty ones
+func trimmedNonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+const pathConfigOIDCHelpSyn = `
+Configure the login of GitHub Actions workflows with OIDC tokens
+`
+
+const pathConfigOIDCHelpDesc = `
+GitHub Actions workflows can log in with the short-lived OIDC token GitHub
+issues them, passed as oidc_token to the login endpoint, instead of a
+personal access token. The token is verified against the keys served at
+jwks_url, and its repository_owner, repository and workflow claims must match
+the bound values. The tokens get the token_policies and the policies mapped
+to the repository in repository_policies.
+`
@@ -0,0 +1,130 @@
+package github
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+func pathConfigStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/status",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixGithub,
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigStatusRead,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "status",
+				},
+			},
+		},
+	}
+}
+
+// pathConfigStatusRead checks that GitHub can be reached and that the
+// configured organizations still exist under their IDs. Failures are
+// reported in the response data rather than as errors so the endpoint can be
+// monitored.
+func (b *backend) pathConfigStatusRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"reachable": false,
+				"error":     "the GitHub auth method has not been configured",
+			},
+		}, nil
+	}
+
+	// Keep track of the rate limit GitHub reports for the requests below
+	ctx, rateStatus := withRateLimitStatus(ctx)
+
+	status := map[string]interface{}{
+		"reachable": false,
+	}
+	resp := &logical.Response{Data: status}
+
+	// In GitHub App mode the installation token is used, anonymous requests
+	// are sufficient otherwise as organizations are public
+	var token string
+	if config.appMode() {
+		token, err = b.installationToken(ctx, config)
+		if err != nil {
+			status["error"] = err.Error()
+			return resp, nil
+		}
+		status["reachable"] = true
+	}
+	client, err := b.clientForConfig(token, config)
+	if err != nil {
+		status["error"] = err.Error()
+		return resp, nil
+	}
+
+	var organizations []map[string]interface{}
+	for _, candidate := range config.candidateOrganizations() {
+		orgStatus, reachable := organizationStatus(ctx, client, candidate)
+		if reachable {
+			status["reachable"] = true
+		}
+		organizations = append(organizations, orgStatus)
+	}
+	status["organizations"] = organizations
+
+	// Without configured organizations, reaching GitHub is checked with an
+	// anonymous request
+	if config.anyOrganization() || config.skipMembershipCheck() {
+		if _, ghResp, err := client.Zen(ctx); ghResp != nil {
+			status["reachable"] = true
+		} else if err != nil {
+			status["error"] = err.Error()
+		}
+	}
+
+	if remaining, reset, ok := rateStatus.budget(); ok {
+		status["rate_limit_remaining"] = remaining
+		status["rate_limit_reset"] = reset.Format(time.RFC3339)
+	}
+
+	return resp, nil
+}
+
+// organizationStatus fetches the organization and reports whether it still
+// exists under its ID with the configured name, and whether GitHub responded
+func organizationStatus(ctx context.Context, client *github.Client, candidate organizationRef) (map[string]interface{}, bool) {
+	status := map[string]interface{}{
+		"organization":    candidate.Name,
+		"organization_id": candidate.ID,
+		"valid":           false,
+	}
+
+	var org *github.Organization
+	var resp *github.Response
+	var err error
+	if candidate.ID == 0 {
+		org, resp, err = client.Organizations.Get(ctx, candidate.Name)
+	} else {
+		org, resp, err = client.Organizations.GetByID(ctx, candidate.ID)
+	}
+	reachable := resp != nil
+	if err != nil {
+		status["error"] = err.Error()
+		return status, reachable
+	}
+
+	status["current_name"] = org.GetLogin()
+	status["valid"] = candidate.ID != 0 && org.GetID() == candidate.ID &&
+		strings.EqualFold(org.GetLogin(), candidate.Name)
+	return status, reachable
+}
@@ -2,12 +2,18 @@ package github
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/openbao/openbao/sdk/v2/logical"
 
@@ -34,16 +40,130 @@ func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
 // request to base_url
 func setupTestServer(t *testing.T) *httptest.Server {
 	t.Helper()
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return httptest.NewServer(testServerHandler(t))
+}
+
+// useTestServer sends the requests of the backend to the test server
+// regardless of the configured base_url
+func useTestServer(b *backend, ts *httptest.Server) {
+	target, _ := url.Parse(ts.URL)
+	b.httpClient = &http.Client{
+		Transport: testServerTransport{target: target},
+	}
+}
+
+// testServerTransport redirects every request to target
+type testServerTransport struct {
+	target *url.URL
+}
+
+func (t testServerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// testServerHandler responds to the requests made to base_url with mock
+// GitHub API responses
+func testServerHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var resp string
 		url := r.URL.String()
-		if strings.Contains(url, "/user/orgs") {
+		w.Header().Set(requestIDHeader, testRequestID)
+
+		// Tokens that expire report their expiration on every request
+		switch r.Header.Get("Authorization") {
+		case "Bearer " + testExpiredToken:
+			w.Header().Set(tokenExpirationHeader, "2000-01-01 00:00:00 UTC")
+		case "Bearer " + testExpiringToken:
+			w.Header().Set(tokenExpirationHeader, "2099-01-01 00:00:00 +0000")
+		case "Bearer " + testForeignOwnerToken, "Bearer " + testUnknownOwnerToken:
+			w.Header().Set(tokenExpirationHeader, "2099-01-01 00:00:00 +0000")
+		case "Bearer " + testScopedToken:
+			w.Header().Set(tokenScopesHeader, "repo, admin:org")
+		case "Bearer " + testLowRateLimitToken:
+			w.Header().Set(headerRateRemaining, "42")
+			w.Header().Set(headerRateReset, "4102444800")
+		case "":
+			// Anonymous requests have their own rate limit
+			w.Header().Set(headerRateRemaining, "59")
+			w.Header().Set(headerRateReset, "4102444800")
+		}
+
+		if r.Header.Get("Authorization") == "Bearer "+testRateLimitedToken {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+			w.WriteHeader(403)
+			resp = `{"message": "API rate limit exceeded for user ID 1."}`
+		} else if strings.HasSuffix(r.URL.Path, "/api/graphql") {
+			// GitHub Enterprise Server versions without the GraphQL API
+			w.WriteHeader(404)
+			resp = `{"message": "Not Found"}`
+		} else if r.URL.Path == "/graphql" {
+			resp = userTeamsGraphQLResponse
+		} else if r.URL.Path == "/user/memberships/orgs" {
+			resp = listOrgMembershipsResponse
+		} else if strings.Contains(url, "/user/memberships/orgs/") {
+			// Fine-grained tokens are denied the memberships in organizations
+			// other than their resource owner
+			switch r.Header.Get("Authorization") {
+			case "Bearer " + testForeignOwnerToken:
+				w.WriteHeader(403)
+				resp = `{"message": "Resource not accessible by personal access token"}`
+			case "Bearer " + testUnknownOwnerToken:
+				w.WriteHeader(404)
+				resp = `{"message": "Not Found"}`
+			default:
+				resp = getOrgMembershipResponse
+			}
+		} else if strings.Contains(url, "/orgs/bar-org/memberships/") {
+			// The user is not a member of bar-org
+			w.WriteHeader(404)
+			resp = `{"message": "Not Found"}`
+		} else if strings.Contains(url, "/orgs/bar-org") {
+			resp = getOtherOrgResponse
+		} else if strings.Contains(url, "/enterprises/foo-enterprise/consumed-licenses") {
+			// Only enterprise owners may list the licenses
+			if r.Header.Get("Authorization") != "Bearer "+testEnterpriseToken {
+				w.WriteHeader(403)
+				resp = `{"message": "Must be an owner of the enterprise"}`
+			} else {
+				resp = listConsumedLicensesResponse
+			}
+		} else if strings.Contains(url, "/enterprises/") {
+			w.WriteHeader(404)
+			resp = `{"message": "Not Found"}`
+		} else if strings.Contains(url, "/app/installations/") {
+			w.WriteHeader(201)
+			resp = createInstallationTokenResponse
+		} else if strings.Contains(url, "/orgs/foo-org/teams") {
+			// Organization teams are only listed in GitHub App mode
+			if r.Header.Get("Authorization") != "Bearer "+testInstallationToken {
+				w.WriteHeader(401)
+			}
+			resp = string(listOrgTeamsResponse)
+		} else if strings.Contains(url, "/teams/1/memberships/") {
+			resp = getTeamMembershipResponse
+		} else if strings.Contains(url, "/organizations/12345") {
+			resp = getOrgResponse
+		} else if strings.Contains(url, "/organizations/67890") {
+			resp = getOtherOrgResponse
+		} else if strings.Contains(url, "/organizations/") {
+			w.WriteHeader(404)
+			resp = `{"message": "Not Found"}`
+		} else if strings.Contains(url, "/user/orgs") {
 			resp = string(listOrgResponse)
+		} else if strings.Contains(url, "/user/emails") {
+			resp = listUserEmailsResponse
 		} else if strings.Contains(url, "/user/teams") {
 			resp = string(listUserTeamsResponse)
 		} else if strings.Contains(url, "/orgs/foo-org/memberships/") {
 			// Mock response for GetOrgMembership API
 			resp = getOrgMembershipResponse
+			if r.Header.Get("Authorization") == "Bearer "+testOwnerToken {
+				resp = strings.Replace(resp, `"role": "member"`, `"role": "admin"`, 1)
+			}
 		} else if strings.Contains(url, "/user") {
 			resp = getUserResponse
 		} else if strings.Contains(url, "/orgs/foo-org") {
@@ -62,8 +182,64 @@ func setupTestServer(t *testing.T) *httptest.Server {
 		if _, err := fmt.Fprintln(w, resp); err != nil {
 			t.Logf("failed to write response: %v", err)
 		}
-	}))
-} // TestGitHub_WriteReadConfig tests that we can successfully read and write
+	})
+}
+
+// TestGitHub_ConfigStatus tests that the status reports whether the
+// configured organizations still exist under their IDs without a user token
+func TestGitHub_ConfigStatus(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+	useTestServer(b, ts)
+
+	readStatus := func() map[string]interface{} {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config/status",
+			Operation: logical.ReadOperation,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp.Data
+	}
+
+	// Without a configuration there is nothing to check
+	status := readStatus()
+	assert.Equal(t, false, status["reachable"])
+	assert.Contains(t, status["error"], "has not been configured")
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":     "foo-org",
+			"organization_id":  12345,
+			"organization_ids": "99999",
+			"organizations":    "gone-org",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	status = readStatus()
+	assert.Equal(t, true, status["reachable"])
+	assert.Equal(t, 59, status["rate_limit_remaining"])
+	assert.Equal(t, "2100-01-01T00:00:00Z", status["rate_limit_reset"])
+
+	organizations := status["organizations"].([]map[string]interface{})
+	assert.Len(t, organizations, 2)
+	assert.Equal(t, int64(12345), organizations[0]["organization_id"])
+	assert.Equal(t, "foo-org", organizations[0]["current_name"])
+	assert.Equal(t, true, organizations[0]["valid"])
+	assert.Equal(t, int64(99999), organizations[1]["organization_id"])
+	assert.Equal(t, false, organizations[1]["valid"])
+	assert.Contains(t, organizations[1]["error"], "404")
+}
+
+// TestGitHub_WriteReadConfig tests that we can successfully read and write
 // the github auth config
 func TestGitHub_WriteReadConfig(t *testing.T) {
 	b, s := createBackendWithStorage(t)
@@ -223,6 +399,52 @@ func TestGitHub_WriteConfig_ErrorNoOrg(t *testing.T) {
 	assert.Contains(t, resp.Error().Error(), "organization is a required parameter")
 }
 
+// TestGitHub_WriteConfig_InvalidGroupAliasFormat tests that an error is
+// returned for an unknown group_alias_format
+func TestGitHub_WriteConfig_InvalidGroupAliasFormat(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":       "foo-org",
+			"organization_id":    12345,
+			"group_alias_format": "login",
+		},
+		Storage: s,
+	})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Error(t, resp.Error())
+	assert.Contains(t, resp.Error().Error(), "group_alias_format must be one of")
+}
+
+// TestGitHub_WriteConfig_InvalidTeamsPerPage tests that an error is returned
+// for a teams_per_page outside of the page sizes GitHub supports
+func TestGitHub_WriteConfig_InvalidTeamsPerPage(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	for _, perPage := range []int{0, 101} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":    "foo-org",
+				"organization_id": 12345,
+				"teams_per_page":  perPage,
+			},
+			Storage: s,
+		})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, resp)
+		assert.Error(t, resp.Error())
+		assert.Contains(t, resp.Error().Error(), "teams_per_page must be between 1 and 100")
+	}
+}
+
 // https://docs.github.com/en/rest/reference/users#get-the-authenticated-user
 // Note: many of the fields have been omitted
 var getUserResponse = `
@@ -238,6 +460,21 @@ var getUserResponse = `
 
 // https://docs.github.com/en/rest/reference/orgs#get-an-organization
 // Note: many of the fields have been omitted, we only care about 'login' and 'id'
+var listUserEmailsResponse = `
+[
+	{
+		"email": "secondary@example.com",
+		"primary": false,
+		"verified": true
+	},
+	{
+		"email": "user-foo@example.com",
+		"primary": true,
+		"verified": true
+	}
+]
+`
+
 var getOrgResponse = `
 {
 	"login": "foo-org",
@@ -249,6 +486,15 @@ var getOrgResponse = `
 }
 `
 
+// getOtherOrgResponse is an organization the user is not a member of
+var getOtherOrgResponse = `
+{
+	"login": "bar-org",
+	"id": 67890,
+	"type": "Organization"
+}
+`
+
 // https://docs.github.com/en/rest/reference/orgs#list-organizations-for-the-authenticated-user
 var listOrgResponse = []byte(fmt.Sprintf(`[%v]`, getOrgResponse))
 
@@ -266,6 +512,114 @@ var listUserTeamsResponse = []byte(fmt.Sprintf(`[
   }
 ]`, getOrgResponse))
 
+// https://docs.github.com/en/graphql/reference/objects#organization
+var userTeamsGraphQLResponse = `
+{
+	"data": {
+		"organization": {
+			"teams": {
+				"nodes": [
+					{
+						"databaseId": 2,
+						"name": "GraphQL team",
+						"slug": "graphql-team"
+					}
+				],
+				"pageInfo": {
+					"hasNextPage": false,
+					"endCursor": "Y3Vyc29yOnYyOpMCqmdyYXBocWwtdGVhbQI="
+				}
+			}
+		}
+	}
+}
+`
+
+// https://docs.github.com/en/enterprise-cloud@latest/rest/enterprise-admin/license#list-enterprise-consumed-licenses
+// Note: many of the fields have been omitted
+var listConsumedLicensesResponse = `
+{
+	"total_seats_consumed": 2,
+	"total_seats_purchased": 10,
+	"users": [
+		{
+			"github_com_login": "user-bar",
+			"github_com_enterprise_roles": ["Member"],
+			"github_com_saml_name_id": "user-bar@example.com"
+		},
+		{
+			"github_com_login": "user-foo",
+			"github_com_enterprise_roles": ["Member"]
+		}
+	]
+}
+`
+
+const (
+	// testExpiredToken is a token the test server reports as expired
+	testExpiredToken = "expiredtoken"
+
+	// testExpiringToken is a token the test server reports as expiring in the future
+	testExpiringToken = "expiringtoken"
+
+	// testRateLimitedToken is a token the test server always rate limits
+	testRateLimitedToken = "ratelimitedtoken"
+
+	// testScopedToken is a token the test server reports the scopes of
+	testScopedToken = "scopedtoken"
+
+	// testLowRateLimitToken is a token the test server reports 42 remaining
+	// requests for
+	testLowRateLimitToken = "lowratelimittoken"
+
+	// testOwnerToken is a token of a user the test server reports as an
+	// owner of foo-org
+	testOwnerToken = "ownertoken"
+
+	// testForeignOwnerToken is a fine-grained token the test server reports
+	// as scoped to another resource owner
+	testForeignOwnerToken = "foreignownertoken"
+
+	// testUnknownOwnerToken is a fine-grained token whose resource owner the
+	// test server does not reveal
+	testUnknownOwnerToken = "unknownownertoken"
+
+	// testEnterpriseToken is a token of an owner of foo-enterprise
+	testEnterpriseToken = "enterprisetoken"
+)
+
+// testRequestID is the ID the test server assigns to every request
+const testRequestID = "0400:1C2A:3B4C5D:6E7F80:61A8B9C0"
+
+// testInstallationToken is the token minted for the GitHub App installation
+const testInstallationToken = "ghs_installation"
+
+// https://docs.github.com/en/rest/apps/apps#create-an-installation-access-token-for-an-app
+var createInstallationTokenResponse = fmt.Sprintf(`
+{
+	"token": %q,
+	"expires_at": "2099-01-01T00:00:00Z"
+}
+`, testInstallationToken)
+
+// https://docs.github.com/en/rest/teams/teams#list-teams
+// Note: many of the fields have been omitted
+var listOrgTeamsResponse = []byte(`[
+{
+    "id": 1,
+    "name": "Foo team",
+    "slug": "foo-team"
+  }
+]`)
+
+// https://docs.github.com/en/rest/teams/members#get-team-membership-for-a-user
+var getTeamMembershipResponse = `
+{
+    "role": "member",
+    "state": "active"
+}
+`
+
 // https://docs.github.com/en/rest/reference/orgs#get-organization-membership-for-a-user
 // Note: many of the fields have been omitted
 var getOrgMembershipResponse = `
@@ -285,3 +639,108 @@ var getOrgMembershipResponse = `
     }
 }
 `
+
+// https://docs.github.com/en/rest/orgs/members#list-organization-memberships-for-the-authenticated-user
+// Note: many of the fields have been omitted
+var listOrgMembershipsResponse = `
+[
+  {
+    "state": "pending",
+    "role": "member",
+    "organization": {
+      "login": "bar-org",
+      "id": 67890
+    }
+  },
+  {
+    "state": "active",
+    "role": "member",
+    "organization": {
+      "login": "foo-org",
+      "id": 12345
+    }
+  }
+]
+`
+
+// testAppPrivateKey generates a PEM encoded private key for a GitHub App
+func testAppPrivateKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+}
+
+// TestGitHub_WriteReadConfig_App tests that the GitHub App settings are
+// validated and that the private key is never returned
+func TestGitHub_WriteReadConfig_App(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	// An app_id without the remaining settings is rejected
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"app_id":       1234,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Error(t, resp.Error())
+	assert.Contains(t, resp.Error().Error(), "installation_id is required")
+
+	// An invalid private key is rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":    "foo-org",
+			"app_id":          1234,
+			"installation_id": 42,
+			"private_key":     "not a key",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Error(t, resp.Error())
+	assert.Contains(t, resp.Error().Error(), "invalid private_key")
+
+	// The organization ID is fetched using the installation token
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":    "foo-org",
+			"base_url":        ts.URL,
+			"app_id":          1234,
+			"installation_id": 42,
+			"private_key":     testAppPrivateKey(t),
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	assert.Equal(t, int64(12345), resp.Data["organization_id"])
+	assert.Equal(t, int64(1234), resp.Data["app_id"])
+	assert.Equal(t, int64(42), resp.Data["installation_id"])
+	assert.Nil(t, resp.Data["private_key"])
+}
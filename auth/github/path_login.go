@@ -2,10 +2,18 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
 	"github.com/openbao/openbao/sdk/v2/framework"
 	"github.com/openbao/openbao/sdk/v2/helper/cidrutil"
 	"github.com/openbao/openbao/sdk/v2/helper/policyutil"
@@ -15,8 +23,54 @@ import (
 const (
 	// GitHub API pagination constants
 	defaultPerPage = 100
+	maxPerPage     = 100
+
+	// tokenExpirationHeader is returned by GitHub on authenticated requests
+	// made with tokens that expire, such as fine-grained PATs
+	tokenExpirationHeader = "GitHub-Authentication-Token-Expiration"
+
+	// tokenScopesHeader lists the scopes granted to classic PATs and OAuth
+	// tokens. Fine-grained PATs do not have scopes and omit it.
+	tokenScopesHeader = "X-OAuth-Scopes"
+
+	// requestIDHeader identifies a request in the logs of GitHub
+	requestIDHeader = "X-GitHub-Request-Id"
+
+	// foreignResourceOwnerMessage is the message GitHub denies requests of
+	// fine-grained PATs with that concern resources of another owner
+	foreignResourceOwnerMessage = "Resource not accessible by personal access token"
+
+	// noMembershipCheckWarning is returned by config writes and logins when
+	// membership_check is none
+	noMembershipCheckWarning = "membership_check is none: ANY GitHub user can authenticate, no organization membership is verified"
 )
 
+// impliedScopes lists for a scope the broader scopes that include it
+var impliedScopes = map[string][]string{
+	"read:org":   {"write:org", "admin:org"},
+	"write:org":  {"admin:org"},
+	"read:user":  {"user"},
+	"user:email": {"user"},
+}
+
+// tokenExpirationLayouts are the formats GitHub uses for the token expiration header
+var tokenExpirationLayouts = []string{
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05 -0700",
+}
+
+// reservedMetadataKeys are the token metadata keys set on login, which team
+// mappings cannot set
+var reservedMetadataKeys = []string{
+	"username",
+	"org",
+	"org_role",
+	"user_id",
+	"user_email",
+	"scim_external_id",
+	"token_expiration",
+}
+
 // AuthenticationError represents errors during GitHub authentication
 type AuthenticationError struct {
 	Reason  string
@@ -30,6 +84,10 @@ func (e *AuthenticationError) Error() string {
 	return e.Reason
 }
 
+// reasonNotOrgMember is the reason logins are denied when GitHub reports the
+// user is not a member of the organization
+const reasonNotOrgMember = "user is not part of required org"
+
 // newAuthError creates a new authentication error
 func newAuthError(reason, details string) *AuthenticationError {
 	return &AuthenticationError{
@@ -52,6 +110,14 @@ func pathLogin(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "GitHub personal API token",
 			},
+			"oidc_token": {
+				Type:        framework.TypeString,
+				Description: "OIDC token of a GitHub Actions workflow, to log in with instead of token",
+			},
+			"wrapped_token": {
+				Type:        framework.TypeString,
+				Description: "Response-wrapping token wrapping the GitHub token under the token key, to log in with instead of token",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -63,17 +129,62 @@ func pathLogin(b *backend) *framework.Path {
 
 func (b *backend) pathLoginAliasLookahead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	token := data.Get("token").(string)
+	if oidcToken := data.Get("oidc_token").(string); oidcToken != "" {
+		if token != "" {
+			return logical.ErrorResponse("only one of token and oidc_token can be provided"), nil
+		}
+		return b.pathLoginOIDCAliasLookahead(ctx, req, oidcToken)
+	}
+
+	// A wrapping token can only be unwrapped once, which is left to the
+	// login, so the alias is not known ahead of it
+	if data.Get("wrapped_token").(string) != "" {
+		return nil, nil
+	}
+
+	// Only the user is needed to resolve the alias, the membership and
+	// teams are verified by the login itself
+	config, err := b.loadAndValidateConfig(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	client, err := b.clientForConfig(token, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+	user, _, err := b.getGitHubUser(ctx, client)
+	if err != nil {
+		return nil, wrapRateLimitError(fmt.Errorf("failed to get GitHub user: %w", err))
+	}
 
-	verifyResp, err := b.verifyCredentials(ctx, req, token)
+	var email string
+	if config.userAliasName() == userAliasNameEmail {
+		email = b.getUserEmail(ctx, client, user)
+	}
+	aliasName, err := config.userAlias(user, email)
 	if err != nil {
 		return nil, err
 	}
+	if config.scimIdentity() == scimIdentityAlias {
+		if config.appMode() {
+			client, err = b.installationClient(ctx, config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create GitHub App client: %w", err)
+			}
+		}
+		externalID, _, err := b.resolveSCIMExternalID(ctx, client, config, nil, user)
+		if err != nil {
+			return nil, wrapRateLimitError(err)
+		}
+		if externalID != "" {
+			aliasName = scimAlias(externalID)
+		}
+	}
 
 	return &logical.Response{
-		Warnings: verifyResp.Warnings,
 		Auth: &logical.Auth{
 			Alias: &logical.Alias{
-				Name: *verifyResp.User.Login,
+				Name: aliasName,
 			},
 		},
 	}, nil
@@ -82,27 +193,110 @@ func (b *backend) pathLoginAliasLookahead(ctx context.Context, req *logical.Requ
 func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	token := data.Get("token").(string)
 
-	verifyResp, err := b.verifyCredentials(ctx, req, token)
+	// GitHub Actions workflows log in with their OIDC token instead
+	if oidcToken := data.Get("oidc_token").(string); oidcToken != "" {
+		if token != "" {
+			return logical.ErrorResponse("only one of token and oidc_token can be provided"), nil
+		}
+		return b.pathLoginOIDC(ctx, req, oidcToken)
+	}
+
+	// Automated logins may send the token wrapped, to keep it out of the
+	// request
+	if wrappedToken := data.Get("wrapped_token").(string); wrappedToken != "" {
+		if token != "" {
+			return logical.ErrorResponse("only one of token and wrapped_token can be provided"), nil
+		}
+		config, err := b.loadAndValidateConfig(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		token, err = b.unwrapToken(ctx, config, wrappedToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, calls := withAPICalls(ctx)
+	defer b.emitAPIMetrics("login", time.Now(), calls)
+
+	verifyResp, err := b.verifyCredentials(ctx, req, token, false)
 	if err != nil {
 		return nil, err
 	}
 
-	auth := &logical.Auth{
-		InternalData: map[string]interface{}{
+	// In GitHub App mode the installation token is minted again on renewal,
+	// so only the user's login has to be kept rather than their token.
+	// Without a stored token, renewals are denied and require a new login.
+	var internalData map[string]interface{}
+	switch {
+	case verifyResp.Config.appMode():
+		internalData = map[string]interface{}{
+			"app_user": verifyResp.User.GetLogin(),
+		}
+	case !verifyResp.Config.StoreToken:
+		internalData = map[string]interface{}{
+			"store_token": false,
+		}
+	default:
+		internalData = map[string]interface{}{
 			"token": token,
-		},
+		}
+	}
+
+	aliasName, err := verifyResp.aliasName()
+	if err != nil {
+		return nil, err
+	}
+
+	username := verifyResp.Config.normalizeUsername(verifyResp.User.GetLogin())
+	auth := &logical.Auth{
+		InternalData: internalData,
 		Metadata: map[string]string{
-			"username": *verifyResp.User.Login,
-			"org":      *verifyResp.Org.Login,
+			"username": username,
 		},
-		DisplayName: *verifyResp.User.Login,
+		DisplayName: username,
 		Alias: &logical.Alias{
-			Name: *verifyResp.User.Login,
+			Name: aliasName,
 		},
 	}
+	if verifyResp.Org != nil {
+		auth.Metadata["org"] = verifyResp.Org.GetLogin()
+	}
+	for key, value := range verifyResp.Metadata {
+		auth.Metadata[key] = value
+	}
+	if verifyResp.OrgRole != "" {
+		auth.Metadata["org_role"] = verifyResp.OrgRole
+	}
+	if verifyResp.User.ID != nil {
+		auth.Metadata["user_id"] = strconv.FormatInt(verifyResp.User.GetID(), 10)
+	}
+	if verifyResp.UserEmail != "" {
+		auth.Metadata["user_email"] = verifyResp.UserEmail
+	}
+	if verifyResp.ExternalID != "" {
+		auth.Metadata["scim_external_id"] = verifyResp.ExternalID
+	}
+	if !verifyResp.TokenExpiration.IsZero() {
+		auth.Metadata["token_expiration"] = verifyResp.TokenExpiration.Format(time.RFC3339)
+	}
 	if err := verifyResp.Config.PopulateTokenAuth(auth, req); err != nil {
 		return nil, fmt.Errorf("failed to populate token auth: %w", err)
 	}
+	verifyResp.Config.applyOwnerTokenTTLs(auth, verifyResp.OrgRole)
+
+	// Track the token so its membership is revalidated in the background.
+	// Tokens that cannot be renewed do not need to be revalidated.
+	if verifyResp.Config.appMode() || verifyResp.Config.StoreToken {
+		sessionID, err := b.createSession(ctx, req.Storage, verifyResp.Config, auth, token)
+		if err != nil {
+			return nil, err
+		}
+		if sessionID != "" {
+			auth.InternalData["session_id"] = sessionID
+		}
+	}
 
 	// Add in configured policies from user/group mapping
 	if len(verifyResp.Policies) > 0 {
@@ -114,15 +308,17 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *fra
 		Auth:     auth,
 	}
 
-	for _, teamName := range verifyResp.TeamNames {
-		if teamName == "" {
-			continue
+	// Team details reveal the structure of the organization, so they are
+	// only returned when enabled
+	if verifyResp.Config.ReturnTeamDetails {
+		resp.Data = map[string]interface{}{
+			"teams":         verifyResp.TeamNames,
+			"team_policies": verifyResp.TeamPolicies,
 		}
-		resp.Auth.GroupAliases = append(resp.Auth.GroupAliases, &logical.Alias{
-			Name: teamName,
-		})
 	}
 
+	resp.Auth.GroupAliases = verifyResp.GroupAliases
+
 	return resp, nil
 }
 
@@ -130,16 +326,43 @@ func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, d *f
 	if req.Auth == nil {
 		return nil, fmt.Errorf("request auth was nil")
 	}
+	if repository, ok := req.Auth.InternalData["oidc_repository"].(string); ok {
+		return b.pathLoginRenewOIDC(ctx, req, repository)
+	}
 
-	tokenRaw, ok := req.Auth.InternalData["token"]
-	if !ok {
-		return nil, fmt.Errorf("token created in previous version of Vault cannot be validated properly at renewal time")
+	if err := b.checkSession(ctx, req); err != nil {
+		return nil, err
 	}
-	token := tokenRaw.(string)
 
-	verifyResp, err := b.verifyCredentials(ctx, req, token)
+	ctx, calls := withAPICalls(ctx)
+	defer b.emitAPIMetrics("renew", time.Now(), calls)
+
+	var verifyResp *verifyCredentialsResp
+	var err error
+	if appUser, ok := req.Auth.InternalData["app_user"].(string); ok {
+		verifyResp, err = b.verifyAppUser(ctx, req, appUser)
+	} else {
+		tokenRaw, ok := req.Auth.InternalData["token"]
+		if !ok {
+			if stored, ok := req.Auth.InternalData["store_token"].(bool); ok && !stored {
+				return nil, newAuthError("token not stored",
+					"the GitHub token is not stored when store_token is disabled, log in again to obtain a new token")
+			}
+			return nil, fmt.Errorf("token created in previous version of Vault cannot be validated properly at renewal time")
+		}
+		verifyResp, err = b.verifyCredentials(ctx, req, tokenRaw.(string), false)
+	}
 	if err != nil {
-		return nil, err
+		return b.renewWithoutGitHub(ctx, req, err)
+	}
+
+	// When any organization is accepted, the user may have joined another
+	// organization listed before the one selected on login
+	if verifyResp.Config.anyOrganization() {
+		if org := req.Auth.Metadata["org"]; org != "" && !strings.EqualFold(org, verifyResp.Org.GetLogin()) {
+			return nil, newAuthError("organization changed",
+				fmt.Sprintf("user is now authenticated by organization '%s' instead of '%s', log in again", verifyResp.Org.GetLogin(), org))
+		}
 	}
 
 	if !policyutil.EquivalentPolicies(verifyResp.Policies, req.Auth.TokenPolicies) {
@@ -150,17 +373,67 @@ func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, d *f
 	resp.Auth.Period = verifyResp.Config.TokenPeriod
 	resp.Auth.TTL = verifyResp.Config.TokenTTL
 	resp.Auth.MaxTTL = verifyResp.Config.TokenMaxTTL
+	verifyResp.Config.applyOwnerTokenTTLs(resp.Auth, verifyResp.OrgRole)
 	resp.Warnings = verifyResp.Warnings
+	if err := b.renewSession(ctx, req.Storage, resp.Auth); err != nil {
+		return nil, err
+	}
+
+	// Replace the old aliases
+	resp.Auth.GroupAliases = verifyResp.GroupAliases
+	resp.Auth.InternalData["verified_at"] = b.now().Format(time.RFC3339)
+
+	return resp, nil
+}
+
+// renewWithoutGitHub renews the token with the policies and aliases it
+// already has when verifying the user failed because GitHub is unavailable
+// and renew_on_github_error is set. The token does not outlive the
+// renew_grace_period counted from the last successful verification of the
+// user, so that users removed during an outage lose access once it is over.
+// Any other failure is returned as is.
+func (b *backend) renewWithoutGitHub(ctx context.Context, req *logical.Request, verifyErr error) (*logical.Response, error) {
+	if !isGitHubUnavailable(verifyErr) {
+		return nil, verifyErr
+	}
+	config, err := b.Config(ctx, req.Storage)
+	if err != nil || config == nil || !config.RenewOnGitHubError {
+		return nil, verifyErr
+	}
 
-	// Remove old aliases
-	resp.Auth.GroupAliases = nil
+	// Tokens issued before the verification time was recorded were last
+	// verified when they were issued
+	verifiedAt := req.Auth.IssueTime
+	if raw, ok := req.Auth.InternalData["verified_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			verifiedAt = t
+		}
+	}
+	deadline := verifiedAt.Add(config.RenewGracePeriod)
+	remaining := deadline.Sub(b.now())
+	if remaining <= 0 {
+		return nil, fmt.Errorf("GitHub has been unavailable for longer than renew_grace_period: %w", verifyErr)
+	}
 
-	for _, teamName := range verifyResp.TeamNames {
-		resp.Auth.GroupAliases = append(resp.Auth.GroupAliases, &logical.Alias{
-			Name: teamName,
-		})
+	resp := &logical.Response{Auth: req.Auth}
+	resp.Auth.TTL = config.TokenTTL
+	resp.Auth.MaxTTL = config.TokenMaxTTL
+	config.applyOwnerTokenTTLs(resp.Auth, req.Auth.Metadata["org_role"])
+	ttl := max(resp.Auth.TTL, config.TokenPeriod)
+	if ttl == 0 || ttl > remaining {
+		ttl = remaining
+	}
+	resp.Auth.TTL = ttl
+	resp.Auth.Period = 0
+	if err := b.renewSession(ctx, req.Storage, resp.Auth); err != nil {
+		return nil, err
 	}
 
+	b.Logger().Warn("GitHub unavailable, renewing token with its current policies",
+		"user", req.Auth.Metadata["username"], "grace_period_ends", deadline, "error", verifyErr)
+	resp.AddWarning(fmt.Sprintf("GitHub is unavailable, the token was renewed with its current policies until %s at the latest: %s",
+		deadline.UTC().Format(time.RFC3339), verifyErr))
+
 	return resp, nil
 }
 
@@ -171,38 +444,223 @@ func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, d *f
 // 3. Authenticates with GitHub
 // 4. Verifies organization membership
 // 5. Resolves team memberships and policies
-func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, token string) (*verifyCredentialsResp, error) {
+//
+// A dry run resolves the token the same way, but neither stores any change to
+// the configuration nor reads or fills the caches, so that it leaves no trace.
+func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, token string, dryRun bool) (*verifyCredentialsResp, error) {
+	if dryRun {
+		ctx = withDryRun(ctx)
+	}
+
 	// Load and validate configuration
 	config, err := b.loadAndValidateConfig(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 
+	// Keep track of the rate limit GitHub reports for the requests below
+	ctx, rateStatus := withRateLimitStatus(ctx)
+
 	// Create authenticated GitHub client
 	client, err := b.createConfiguredClient(ctx, req.Storage, token, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GitHub client: %w", err)
+		return nil, wrapRateLimitError(fmt.Errorf("failed to create GitHub client: %w", err))
+	}
+
+	// Get the authenticated user from GitHub
+	user, userResp, err := b.getGitHubUser(ctx, client)
+	if err != nil {
+		b.Logger().Info("login denied, failed to get GitHub user", "error", err, "request_id", requestIDFromResponse(userResp))
+		return nil, wrapRateLimitError(fmt.Errorf("failed to get GitHub user: %w", err))
+	}
+	logger := b.Logger().With("user", user.GetLogin())
+	logger.Debug("authenticated GitHub user", "request_id", requestIDFromResponse(userResp))
+
+	// Reject tokens that have already expired
+	expiration, err := tokenExpiration(userResp)
+	if err != nil {
+		return nil, err
+	}
+	if !expiration.IsZero() && !expiration.After(b.now()) {
+		logger.Info("login denied, token expired", "expiration", expiration)
+		return nil, newAuthError("token expired",
+			fmt.Sprintf("token expired at %s", expiration.Format(time.RFC3339)))
+	}
+
+	// Reject tokens that lack the required scopes
+	scopesWarning, err := checkRequiredScopes(config, userResp)
+	if err != nil {
+		logger.Info("login denied, token is missing required scopes", "error", err)
+		return nil, err
+	}
+
+	// Reject fine-grained PATs whose resource owner is another account
+	ownerWarning, err := checkTokenResourceOwner(ctx, client, config, userResp)
+	if err != nil {
+		logger.Info("login denied, token is not scoped to the organization", "error", err)
+		return nil, wrapRateLimitError(err)
+	}
+
+	verifyResp, err := b.authorizeUser(ctx, req, client, config, user)
+	if err != nil {
+		return nil, wrapRateLimitError(err)
+	}
+	if scopesWarning != "" {
+		verifyResp.Warnings = append(verifyResp.Warnings, scopesWarning)
+	}
+	if ownerWarning != "" {
+		verifyResp.Warnings = append(verifyResp.Warnings, ownerWarning)
+	}
+	verifyResp.TokenExpiration = expiration
+	verifyResp.UserEmail = b.getUserEmail(ctx, client, user)
+	verifyResp.addRateLimitWarning(config, rateStatus)
+
+	return verifyResp, nil
+}
+
+// verifyAppUser re-authorizes a user that previously logged in while the
+// backend was in GitHub App mode. The user's identity is taken from the
+// original login, so no user token is required.
+func (b *backend) verifyAppUser(ctx context.Context, req *logical.Request, login string) (*verifyCredentialsResp, error) {
+	config, err := b.loadAndValidateConfig(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !config.appMode() {
+		return nil, fmt.Errorf("token was created using GitHub App authentication, which is no longer configured")
+	}
+
+	user := &github.User{
+		Login: github.String(login),
+	}
+
+	ctx, rateStatus := withRateLimitStatus(ctx)
+	verifyResp, err := b.authorizeUser(ctx, req, nil, config, user)
+	if err != nil {
+		return nil, wrapRateLimitError(err)
+	}
+	verifyResp.addRateLimitWarning(config, rateStatus)
+	return verifyResp, nil
+}
+
+// authorizeUser verifies organization membership of an authenticated user
+// and resolves their teams and policies. In GitHub App mode the organization
+// is inspected with the installation token instead of the given user client.
+func (b *backend) authorizeUser(ctx context.Context, req *logical.Request, client *github.Client, config *config, user *github.User) (*verifyCredentialsResp, error) {
+	logger := b.Logger().With("user", user.GetLogin())
+
+	// Check user restrictions first, they require no requests to GitHub
+	if !config.userAllowed(user.GetLogin()) {
+		logger.Info("login denied by allowed_users or denied_users")
+		return nil, logical.ErrPermissionDenied
+	}
+
+	// Suspended users may still hold valid tokens and active memberships
+	if suspendedAt := user.GetSuspendedAt(); !suspendedAt.IsZero() {
+		logger.Info("login denied, user is suspended", "suspended_at", suspendedAt)
+		return nil, newAuthError("user is suspended",
+			fmt.Sprintf("user '%s' was suspended at %s", user.GetLogin(), suspendedAt.Format(time.RFC3339)))
+	}
+
+	if config.skipMembershipCheck() {
+		return b.authorizeWithoutMembership(config, user)
+	}
+
+	if config.appMode() {
+		appClient, err := b.installationClient(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GitHub App client: %w", err)
+		}
+		client = appClient
+	}
+
+	// Verify the user is a member of the required organization or enterprise
+	org, role, warnings, err := b.checkMembership(ctx, client, user, config)
+	if err != nil {
+		logger.Info("login denied, organization membership not verified", "org", config.Organization,
+			"error", err, "request_id", requestIDFromError(err))
+		return nil, err
+	}
+	logger = logger.With("org", org.GetLogin())
+	logger.Debug("organization membership verified", "role", role)
+
+	// Only owners and GitHub Apps can see whether other members have
+	// two-factor authentication enabled
+	if config.Require2FA {
+		if err := checkTwoFactor(ctx, client, config, org, user, role); err != nil {
+			logger.Info("login denied, two-factor authentication not verified", "error", err, "request_id", requestIDFromError(err))
+			return nil, err
+		}
 	}
 
-	// Authenticate and authorize the user
-	user, org, warnings, err := b.authenticateAndAuthorizeUser(ctx, req, client, config)
+	// Organizations are resolved by ID, so keep the configured name in sync
+	// when the organization has been renamed
+	warning, err := b.updateRenamedOrganization(ctx, req.Storage, config, org)
 	if err != nil {
 		return nil, err
 	}
+	if warning != "" {
+		logger.Warn(warning)
+		warnings = append(warnings, warning)
+	}
 
 	// Resolve user's team memberships and policies
-	teamNames, policies, err := b.resolveUserPolicies(ctx, req.Storage, client, org, user)
+	var remoteAddr string
+	if req.Connection != nil {
+		remoteAddr = req.Connection.RemoteAddr
+	}
+	teams, policies, err := b.resolveUserPolicies(ctx, req.Storage, client, config, org, role, user, remoteAddr)
 	if err != nil {
+		logger.Info("login denied, failed to resolve teams and policies", "error", err, "request_id", requestIDFromError(err))
 		return nil, err
 	}
+	warnings = append(warnings, policies.Warnings...)
+	teamNames := b.extractTeamNames(teams)
+	logger.Debug("teams resolved", "teams", teamNames)
+
+	// Base policies are only granted now that the membership is verified,
+	// and are granted again on renewal as they are part of the policies
+	if len(config.BasePolicies) > 0 {
+		policies.Policies = strutil.RemoveDuplicatesStable(append(policies.Policies, config.BasePolicies...), false)
+	}
+
+	// Members that were not granted anything explicitly may be denied
+	if config.DenyIfNoPolicies && !grantsPolicies(policies.Policies, config.TokenPolicies) {
+		logger.Info("login denied, no policies matched")
+		return nil, newAuthError("no policies matched",
+			fmt.Sprintf("no policies other than default are mapped to user '%s' or their teams", user.GetLogin()))
+	}
+
+	// The SCIM identity only denies the login when it is used as the alias
+	// and cannot be read
+	var externalID string
+	if config.scimIdentity() != scimIdentityDisabled {
+		var warning string
+		externalID, warning, err = b.resolveSCIMExternalID(ctx, client, config, org, user)
+		if err != nil {
+			logger.Info("login denied, SCIM identity not resolved", "error", err, "request_id", requestIDFromError(err))
+			return nil, err
+		}
+		if warning != "" {
+			logger.Warn(warning)
+			warnings = append(warnings, warning)
+		}
+	}
+	logger.Info("login authorized", "policies", policies.Policies)
 
 	return &verifyCredentialsResp{
-		User:      user,
-		Org:       org,
-		Policies:  policies,
-		TeamNames: teamNames,
-		Config:    config,
-		Warnings:  warnings,
+		User:     user,
+		Org:      org,
+		OrgRole:  role,
+		Policies: policies.Policies,
+
+		TeamPolicies: policies.TeamPolicies,
+		Metadata:     policies.Metadata,
+		TeamNames:    teamNames,
+		GroupAliases: groupAliases(teams, config.GroupAliasFormat),
+		ExternalID:   externalID,
+		Config:       config,
+		Warnings:     warnings,
 	}, nil
 }
 
@@ -213,49 +671,136 @@ func (b *backend) loadAndValidateConfig(ctx context.Context, req *logical.Reques
 		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 	if config == nil {
+		b.Logger().Warn("login denied, GitHub auth backend has not been configured")
 		return nil, newAuthError("configuration not set", "GitHub auth backend has not been configured")
 	}
+	b.Logger().Debug("configuration loaded", "org", config.Organization)
 
 	// Check for CIDR restrictions
 	if err := b.checkCIDRMatch(req, config); err != nil {
+		var remoteAddr string
+		if req.Connection != nil {
+			remoteAddr = req.Connection.RemoteAddr
+		}
+		b.Logger().Info("login denied by token_bound_cidrs", "remote_addr", remoteAddr)
 		return nil, err
 	}
 
 	return config, nil
 }
 
-// authenticateAndAuthorizeUser performs GitHub user authentication and organization authorization
-func (b *backend) authenticateAndAuthorizeUser(ctx context.Context, req *logical.Request, client *github.Client, config *config) (*github.User, *github.Organization, []string, error) {
-	// Get the authenticated user from GitHub
-	user, err := b.getGitHubUser(ctx, client)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to get GitHub user: %w", err)
-	}
-
-	// Verify the user is a member of the required organization
-	org, warnings, err := b.checkOrganizationMembership(ctx, client, user, config)
-	if err != nil {
-		return nil, nil, nil, err
+// authorizeWithoutMembership authorizes any GitHub user when membership_check
+// is none, only verifying that they control the account of the token. Only
+// the base policies are granted, as no organization, teams or role are known.
+func (b *backend) authorizeWithoutMembership(config *config, user *github.User) (*verifyCredentialsResp, error) {
+	logger := b.Logger().With("user", user.GetLogin())
+
+	policies := strutil.RemoveDuplicatesStable(slices.Clone(config.BasePolicies), false)
+	if config.DenyIfNoPolicies && !grantsPolicies(policies, config.TokenPolicies) {
+		logger.Info("login denied, no policies matched")
+		return nil, newAuthError("no policies matched",
+			fmt.Sprintf("no policies other than default are granted to user '%s'", user.GetLogin()))
 	}
+	logger.Warn("login authorized without verifying organization membership", "policies", policies)
 
-	return user, org, warnings, nil
+	return &verifyCredentialsResp{
+		User:     user,
+		Policies: policies,
+		Config:   config,
+		Warnings: []string{noMembershipCheckWarning},
+	}, nil
 }
 
-// resolveUserPolicies resolves the user's team memberships and associated policies
-func (b *backend) resolveUserPolicies(ctx context.Context, storage logical.Storage, client *github.Client, org *github.Organization, user *github.User) ([]string, []string, error) {
+// resolveUserPolicies resolves the user's team memberships and associated
+// policies for a request from remoteAddr
+func (b *backend) resolveUserPolicies(ctx context.Context, storage logical.Storage, client *github.Client, config *config, org *github.Organization, role string, user *github.User, remoteAddr string) ([]*github.Team, *userPolicies, error) {
 	// Get all teams the user belongs to in the organization
-	teamNames, err := b.getUserTeams(ctx, client, org, user)
+	teams, err := b.cachedUserTeams(ctx, client, config, org, user)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get user teams: %w", err)
 	}
 
-	// Get policies mapped to the user's teams and username
-	policies, err := b.getPoliciesForUser(ctx, storage, teamNames, user.GetLogin())
+	// Only members of the required teams may authenticate
+	if err := checkRequiredTeams(config, user, b.extractTeamNames(teams)); err != nil {
+		return nil, nil, err
+	}
+
+	// Teams mapped to policies are still denied unless allowed
+	if err := checkAllowedTeams(config, user, teams); err != nil {
+		return nil, nil, err
+	}
+
+	// Policies may also be mapped to the parent teams of the user's teams
+	policyTeams := teams
+	if config.ResolveParentTeams {
+		policyTeams, err = b.withParentTeams(ctx, client, config, org, teams)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve parent teams: %w", err)
+		}
+	}
+
+	// Get policies mapped to the user's teams, username and organization role
+	policies, err := b.getPoliciesForUser(ctx, storage, policyTeams, config.normalizeUsername(user.GetLogin()), role, remoteAddr)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get policies: %w", err)
 	}
 
-	return teamNames, policies, nil
+	return teams, policies, nil
+}
+
+// grantsPolicies reports whether any of the given policy lists contains a
+// policy other than the default policy
+func grantsPolicies(policyLists ...[]string) bool {
+	for _, policies := range policyLists {
+		for _, policy := range policies {
+			if policy != "" && policy != "default" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkRequiredTeams verifies the user is a member of at least one of the
+// required teams, matching team names and slugs case-insensitively. Any user
+// passes when no teams are required.
+func checkRequiredTeams(config *config, user *github.User, teamNames []string) error {
+	if len(config.RequiredTeams) == 0 {
+		return nil
+	}
+
+	for _, required := range config.RequiredTeams {
+		for _, teamName := range teamNames {
+			if strings.EqualFold(required, teamName) {
+				return nil
+			}
+		}
+	}
+
+	return newAuthError("user is not part of required team",
+		fmt.Sprintf("user '%s' is not a member of any of the required teams: %s",
+			user.GetLogin(), strings.Join(config.RequiredTeams, ", ")))
+}
+
+// checkAllowedTeams verifies the user is a member of at least one of the
+// allowed teams, matching team slugs case-insensitively. Any user passes when
+// no teams are allowed explicitly.
+func checkAllowedTeams(config *config, user *github.User, teams []*github.Team) error {
+	if len(config.AllowedTeams) == 0 {
+		return nil
+	}
+
+	for _, t := range teams {
+		for _, allowed := range config.AllowedTeams {
+			if strings.EqualFold(allowed, t.GetSlug()) {
+				return nil
+			}
+		}
+	}
+
+	return newAuthError("user is not part of allowed team",
+		fmt.Sprintf("user '%s' is not a member of any of the allowed teams: %s",
+			user.GetLogin(), strings.Join(config.AllowedTeams, ", ")))
 }
 
 // checkCIDRMatch verifies the request comes from an allowed CIDR
@@ -273,7 +818,25 @@ func (b *backend) checkCIDRMatch(req *logical.Request, config *config) error {
 
 // createConfiguredClient creates a GitHub client with proper configuration
 func (b *backend) createConfiguredClient(ctx context.Context, storage logical.Storage, token string, config *config) (*github.Client, error) {
-	client, err := b.Client(token)
+	client, err := b.clientForConfig(token, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle organization ID auto-setup if needed
+	if config.missingOrganizationIDs() {
+		if err := b.setupOrganizationID(ctx, storage, client, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// clientForConfig creates a GitHub client for the given token that talks to
+// the configured base URL
+func (b *backend) clientForConfig(token string, config *config) (*github.Client, error) {
+	client, err := b.Client(token, config)
 	if err != nil {
 		return nil, err
 	}
@@ -286,13 +849,6 @@ func (b *backend) createConfiguredClient(ctx context.Context, storage logical.St
 		client.BaseURL = parsedURL
 	}
 
-	// Handle organization ID auto-setup if needed
-	if config.OrganizationID == 0 {
-		if err := b.setupOrganizationID(ctx, storage, client, config); err != nil {
-			return nil, err
-		}
-	}
-
 	return client, nil
 }
 
@@ -303,6 +859,11 @@ func (b *backend) setupOrganizationID(ctx context.Context, storage logical.Stora
 		return fmt.Errorf("failed to set the organization_id on login for organization '%s': %w", config.Organization, err)
 	}
 
+	// The fetched IDs are only used for this login
+	if !config.AutoSetOrganizationID || isDryRun(ctx) {
+		return nil
+	}
+
 	entry, err := logical.StorageEntryJSON("config", config)
 	if err != nil {
 		return fmt.Errorf("failed to create storage entry: %w", err)
@@ -316,104 +877,616 @@ func (b *backend) setupOrganizationID(ctx context.Context, storage logical.Stora
 }
 
 // getGitHubUser retrieves the current user from GitHub API
-func (b *backend) getGitHubUser(ctx context.Context, client *github.Client) (*github.User, error) {
-	user, _, err := client.Users.Get(ctx, "")
+func (b *backend) getGitHubUser(ctx context.Context, client *github.Client) (*github.User, *github.Response, error) {
+	user, resp, err := client.Users.Get(ctx, "")
 	if err != nil {
-		return nil, newAuthError("failed to get user from GitHub", err.Error())
+		// Being rate limited, timing out or GitHub being unavailable says
+		// nothing about the validity of the token
+		if isRateLimitError(err) || errors.Is(err, context.DeadlineExceeded) || isGitHubUnavailable(err) {
+			return nil, resp, err
+		}
+		return nil, resp, newAuthError("failed to get user from GitHub", err.Error())
 	}
 	if user.Login == nil {
-		return nil, newAuthError("invalid user response", "user login is nil")
+		return nil, nil, newAuthError("invalid user response", "user login is nil")
 	}
-	return user, nil
+	return user, resp, nil
 }
 
-// checkOrganizationMembership verifies the user is a member of the required organization
-func (b *backend) checkOrganizationMembership(ctx context.Context, client *github.Client, user *github.User, config *config) (*github.Organization, []string, error) {
-	var warnings []string
+// getUserEmail returns the email of the user, preferring the public profile
+// email over the primary verified email of the account. An empty string is
+// returned when neither is visible to the token, for example because it lacks
+// the user:email scope.
+func (b *backend) getUserEmail(ctx context.Context, client *github.Client, user *github.User) string {
+	if email := user.GetEmail(); email != "" {
+		return email
+	}
 
-	// First, get the organization details
-	org, _, err := client.Organizations.Get(ctx, config.Organization)
+	emails, _, err := client.Users.ListEmails(ctx, &github.ListOptions{PerPage: defaultPerPage})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get organization %q: %w", config.Organization, err)
+		return ""
 	}
+	for _, email := range emails {
+		if email.GetPrimary() && email.GetVerified() {
+			return email.GetEmail()
+		}
+	}
+	return ""
+}
 
-	// Verify the organization ID matches our config
-	if org.GetID() != config.OrganizationID {
-		return nil, nil, newAuthError("organization ID mismatch",
-			fmt.Sprintf("organization '%s' has ID %d, but config expects ID %d",
-				config.Organization, org.GetID(), config.OrganizationID))
+// tokenExpiration returns the expiration of the token used for the given
+// response. A zero time is returned for tokens that do not expire, such as
+// classic PATs, which omit the expiration header.
+func tokenExpiration(resp *github.Response) (time.Time, error) {
+	if resp == nil || resp.Response == nil {
+		return time.Time{}, nil
 	}
 
-	// Check membership using the more efficient GetOrgMembership API
-	membership, _, err := client.Organizations.GetOrgMembership(ctx, user.GetLogin(), config.Organization)
-	if err != nil {
-		// Handle different error cases
-		if githubErr, ok := err.(*github.ErrorResponse); ok {
-			switch githubErr.Response.StatusCode {
-			case 404:
-				// User is not a member or membership is private
-				return nil, nil, newAuthError("user is not part of required org",
-					fmt.Sprintf("user '%s' is not a member of organization '%s' or membership is private",
-						user.GetLogin(), config.Organization))
-			case 403:
-				// Requester lacks permission to view membership
-				return nil, nil, newAuthError("insufficient permissions",
-					fmt.Sprintf("insufficient permissions to check membership for user '%s' in organization '%s'",
-						user.GetLogin(), config.Organization))
-			default:
-				return nil, nil, fmt.Errorf("failed to check organization membership: %w", err)
-			}
+	value := resp.Header.Get(tokenExpirationHeader)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range tokenExpirationLayouts {
+		if expiration, err := time.Parse(layout, value); err == nil {
+			return expiration, nil
 		}
-		return nil, nil, fmt.Errorf("failed to check organization membership: %w", err)
+	}
+	return time.Time{}, fmt.Errorf("failed to parse %s header %q", tokenExpirationHeader, value)
+}
+
+// tokenScopes returns the scopes granted to the token used for the given
+// response, and false if the token does not report its scopes
+func tokenScopes(resp *github.Response) ([]string, bool) {
+	if resp == nil || resp.Response == nil {
+		return nil, false
+	}
+
+	values := resp.Header.Values(tokenScopesHeader)
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	var scopes []string
+	for _, value := range values {
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes, true
+}
+
+// checkRequiredScopes verifies the token was granted all required scopes.
+// When the token does not report its scopes, as is the case for fine-grained
+// PATs, a warning is returned instead.
+func checkRequiredScopes(config *config, resp *github.Response) (string, error) {
+	if len(config.RequiredScopes) == 0 {
+		return "", nil
+	}
+
+	scopes, ok := tokenScopes(resp)
+	if !ok {
+		return "the scopes of the token could not be determined, so required_scopes were not enforced", nil
+	}
+
+	granted := make(map[string]struct{}, len(scopes))
+	for _, scope := range scopes {
+		granted[scope] = struct{}{}
+	}
+
+	var missing []string
+	for _, required := range config.RequiredScopes {
+		if _, ok := granted[required]; ok {
+			continue
+		}
+		implied := false
+		for _, broader := range impliedScopes[required] {
+			if _, ok := granted[broader]; ok {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			missing = append(missing, required)
+		}
+	}
+
+	if len(missing) > 0 {
+		return "", newAuthError("token is missing required scopes",
+			fmt.Sprintf("token is missing the required scopes: %s", strings.Join(missing, ", ")))
+	}
+	return "", nil
+}
+
+// isFineGrainedToken reports whether the token used for the given response is
+// a fine-grained PAT, which reports an expiration but no scopes
+func isFineGrainedToken(resp *github.Response) bool {
+	if resp == nil || resp.Response == nil {
+		return false
+	}
+	_, hasScopes := tokenScopes(resp)
+	return !hasScopes && resp.Header.Get(tokenExpirationHeader) != ""
+}
+
+// checkTokenResourceOwner verifies a fine-grained PAT is scoped to one of the
+// configured organizations. GitHub does not expose the resource owner of a
+// token, but denies fine-grained PATs access to the memberships of the user in
+// organizations other than their resource owner. When the resource owner
+// cannot be determined, a warning is returned instead unless
+// strict_resource_owner is enabled.
+func checkTokenResourceOwner(ctx context.Context, client *github.Client, config *config, resp *github.Response) (string, error) {
+	// Tokens of any resource owner are accepted along with its organizations
+	if !isFineGrainedToken(resp) || config.anyOrganization() || config.skipMembershipCheck() {
+		return "", nil
+	}
+
+	var undetermined error
+	for _, candidate := range config.candidateOrganizations() {
+		_, _, err := client.Organizations.GetOrgMembership(ctx, "", candidate.Name)
+		if err == nil {
+			return "", nil
+		}
+		if isRateLimitError(err) {
+			return "", err
+		}
+
+		var ghErr *github.ErrorResponse
+		if errors.As(err, &ghErr) && ghErr.Response != nil &&
+			ghErr.Response.StatusCode == http.StatusForbidden &&
+			strings.Contains(ghErr.Message, foreignResourceOwnerMessage) {
+			continue
+		}
+		undetermined = err
+	}
+
+	if undetermined == nil {
+		return "", newAuthError("token not scoped to organization",
+			"the resource owner of the fine-grained token is not one of the configured organizations")
+	}
+	if config.StrictResourceOwner {
+		return "", newAuthError("token resource owner unknown",
+			fmt.Sprintf("failed to determine the resource owner of the fine-grained token: %s", undetermined))
+	}
+	return fmt.Sprintf("the resource owner of the fine-grained token could not be determined: %s", undetermined), nil
+}
+
+// checkOrganizationMembership verifies the user is a member of one of the
+// configured organizations and returns the first organization the user is an
+// active member of, along with the user's role in it
+func (b *backend) checkOrganizationMembership(ctx context.Context, client *github.Client, user *github.User, config *config) (*github.Organization, string, []string, error) {
+	if config.anyOrganization() {
+		org, role, err := firstActiveOrganizationMembership(ctx, client, user)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return org, role, nil, nil
+	}
+
+	var warnings []string
+
+	candidates := config.candidateOrganizations()
+	if len(candidates) == 1 {
+		org, role, err := b.checkSingleOrganizationMembership(ctx, client, user, config, candidates[0])
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return org, role, warnings, nil
+	}
+
+	var notMember []string
+	var apiErr error
+	reason := reasonNotOrgMember
+	for _, candidate := range candidates {
+		org, role, err := b.checkSingleOrganizationMembership(ctx, client, user, config, candidate)
+		if err == nil {
+			return org, role, warnings, nil
+		}
+
+		var authErr *AuthenticationError
+		if !errors.As(err, &authErr) {
+			if apiErr == nil {
+				apiErr = err
+			}
+			continue
+		}
+		notMember = append(notMember, fmt.Sprintf("%s (%s)", candidate.Name, authErr.Reason))
+
+		// The user is only reported as not being a member when GitHub
+		// reported so for every organization, and not for example a pending
+		// membership
+		if authErr.Reason != reasonNotOrgMember {
+			reason = "user is not an active member of required org"
+		}
+	}
+
+	// Failing to query an organization must not be reported as the user not
+	// being a member of it
+	if apiErr != nil {
+		return nil, "", nil, apiErr
+	}
+
+	return nil, "", nil, newAuthError(reason,
+		fmt.Sprintf("user '%s' is not an active member of any configured organization: %s",
+			user.GetLogin(), strings.Join(notMember, ", ")))
+}
+
+// isNotOrgMember reports whether the error is GitHub reporting that the user
+// is not a member of the organization, rather than for example lacking the
+// permission to see the membership or the membership not being active
+func isNotOrgMember(err error) bool {
+	var authErr *AuthenticationError
+	return errors.As(err, &authErr) && authErr.Reason == reasonNotOrgMember
+}
+
+// verifyOrganizationID checks that the organization has the configured ID.
+// A zero ID on either side is rejected rather than compared, as it would
+// otherwise match any organization GitHub reports without an ID.
+func verifyOrganizationID(org *github.Organization, name string, expected int64) error {
+	if expected == 0 || org.GetID() == 0 {
+		return newAuthError("invalid organization ID",
+			fmt.Sprintf("organization '%s' has ID %d and config expects ID %d, zero is never a valid organization ID",
+				name, org.GetID(), expected))
+	}
+	if org.GetID() != expected {
+		return newAuthError("organization ID mismatch",
+			fmt.Sprintf("organization '%s' has ID %d, but config expects ID %d",
+				name, org.GetID(), expected))
+	}
+	return nil
+}
+
+// firstActiveOrganizationMembership returns the first organization the user
+// is an active member of, along with the user's role in it, as listed by
+// GitHub with the user's token
+func firstActiveOrganizationMembership(ctx context.Context, client *github.Client, user *github.User) (*github.Organization, string, error) {
+	opt := &github.ListOrgMembershipsOptions{State: "active"}
+	for {
+		memberships, resp, err := client.Organizations.ListOrgMemberships(ctx, opt)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list organization memberships: %w", err)
+		}
+		for _, membership := range memberships {
+			if membership.GetState() == "active" && membership.GetOrganization().GetID() != 0 {
+				return membership.GetOrganization(), membership.GetRole(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return nil, "", newAuthError("user is not part of any org",
+		fmt.Sprintf("user '%s' is not an active member of any organization", user.GetLogin()))
+}
+
+// checkSingleOrganizationMembership verifies the user is an active member of
+// the given organization and returns the user's role in it, either "admin"
+// or "member"
+func (b *backend) checkSingleOrganizationMembership(ctx context.Context, client *github.Client, user *github.User, config *config, candidate organizationRef) (*github.Organization, string, error) {
+	// First, get the organization details
+	org, err := b.cachedOrganization(ctx, client, config, candidate)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Verify the organization ID matches our config
+	if err := verifyOrganizationID(org, candidate.Name, candidate.ID); err != nil {
+		return nil, "", err
+	}
+
+	// The organization may have been renamed since it was configured
+	name := org.GetLogin()
+
+	// Check membership using the more efficient GetOrgMembership API
+	membership, _, err := client.Organizations.GetOrgMembership(ctx, user.GetLogin(), name)
+	if err != nil {
+		// Handle different error cases
+		if githubErr, ok := err.(*github.ErrorResponse); ok {
+			switch githubErr.Response.StatusCode {
+			case 404:
+				// User is not a member or membership is private. A private
+				// membership is still visible to the user's own token.
+				if config.AllowPrivateMembership && !config.appMode() {
+					member, err := listsOrganization(ctx, client, candidate.ID)
+					if err != nil {
+						return nil, "", err
+					}
+					if member {
+						// The role is not visible without the membership
+						return org, "", nil
+					}
+				}
+				return nil, "", newAuthError(reasonNotOrgMember,
+					fmt.Sprintf("user '%s' is not a member of organization '%s' or membership is private",
+						user.GetLogin(), name))
+			case 403:
+				// Requester lacks permission to view membership
+				return nil, "", newAuthError("insufficient permissions",
+					fmt.Sprintf("insufficient permissions to check membership for user '%s' in organization '%s'",
+						user.GetLogin(), name))
+			default:
+				return nil, "", fmt.Errorf("failed to check organization membership: %w", err)
+			}
+		}
+		return nil, "", fmt.Errorf("failed to check organization membership: %w", err)
 	}
 
 	// Verify the membership is active
 	membershipState := membership.GetState()
 	if membershipState != "active" {
-		return nil, nil, newAuthError("user membership not active",
+		return nil, "", newAuthError("user membership not active",
 			fmt.Sprintf("user '%s' membership in organization '%s' is not active (state: %s)",
-				user.GetLogin(), config.Organization, membershipState))
+				user.GetLogin(), name, membershipState))
+	}
+
+	return org, membership.GetRole(), nil
+}
+
+// getOrganization fetches the organization by its ID when it is known, so
+// that renaming the organization does not break logins, and by name otherwise
+func getOrganization(ctx context.Context, client *github.Client, candidate organizationRef) (*github.Organization, error) {
+	if candidate.ID == 0 {
+		org, _, err := client.Organizations.Get(ctx, candidate.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get organization %q: %w", candidate.Name, err)
+		}
+		return org, nil
 	}
 
-	return org, warnings, nil
+	org, _, err := client.Organizations.GetByID(ctx, candidate.ID)
+	if err != nil {
+		if githubErr, ok := err.(*github.ErrorResponse); ok && githubErr.Response.StatusCode == 404 {
+			return nil, newAuthError("organization not found",
+				fmt.Sprintf("organization '%s' with ID %d does not exist or is not visible to the token",
+					candidate.Name, candidate.ID))
+		}
+		return nil, fmt.Errorf("failed to get organization %q with ID %d: %w", candidate.Name, candidate.ID, err)
+	}
+	return org, nil
 }
 
-// getUserTeams gets all teams for the user in the specified organization
-func (b *backend) getUserTeams(ctx context.Context, client *github.Client, org *github.Organization, user *github.User) ([]string, error) {
-	teams, err := b.fetchUserTeamsForOrg(ctx, client, org)
+// updateRenamedOrganization stores the current name of the organization when
+// it differs from the configured name, returning a warning about the rename.
+// GitHub organization names are case-insensitive, so only actual renames
+// update the config.
+func (b *backend) updateRenamedOrganization(ctx context.Context, storage logical.Storage, config *config, org *github.Organization) (string, error) {
+	var oldName string
+	if org.GetID() == config.OrganizationID {
+		if strings.EqualFold(config.Organization, org.GetLogin()) {
+			return "", nil
+		}
+		oldName = config.Organization
+		config.Organization = org.GetLogin()
+	} else {
+		i := slices.Index(config.OrganizationIDs, org.GetID())
+		if i < 0 || i >= len(config.Organizations) || strings.EqualFold(config.Organizations[i], org.GetLogin()) {
+			return "", nil
+		}
+		oldName = config.Organizations[i]
+		config.Organizations[i] = org.GetLogin()
+	}
+
+	if isDryRun(ctx) {
+		return fmt.Sprintf("organization %q with ID %d has been renamed to %q, the configuration will be updated on the next login",
+			oldName, org.GetID(), org.GetLogin()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("failed to create storage entry: %w", err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		return "", fmt.Errorf("failed to store updated config: %w", err)
+	}
+
+	return fmt.Sprintf("organization %q with ID %d has been renamed to %q, the configuration has been updated",
+		oldName, org.GetID(), org.GetLogin()), nil
+}
+
+// listsOrganization reports whether the organization is among the
+// organizations of the authenticated user, including those the user is a
+// private member of
+func listsOrganization(ctx context.Context, client *github.Client, orgID int64) (bool, error) {
+	opt := &github.ListOptions{PerPage: defaultPerPage}
+	for {
+		orgs, resp, err := client.Organizations.List(ctx, "", opt)
+		if err != nil {
+			return false, fmt.Errorf("failed to list organizations of user: %w", err)
+		}
+		for _, org := range orgs {
+			if org.GetID() == orgID {
+				return true, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// requestIDFromResponse returns the ID GitHub assigned to the request, if any
+func requestIDFromResponse(resp *github.Response) string {
+	if resp == nil || resp.Response == nil {
+		return ""
+	}
+	return resp.Header.Get(requestIDHeader)
+}
+
+// requestIDFromError returns the ID GitHub assigned to the request that
+// failed with the error, if any
+func requestIDFromError(err error) string {
+	var errResp *github.ErrorResponse
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var resp *http.Response
+	switch {
+	case errors.As(err, &errResp):
+		resp = errResp.Response
+	case errors.As(err, &rateLimitErr):
+		resp = rateLimitErr.Response
+	case errors.As(err, &abuseErr):
+		resp = abuseErr.Response
+	}
+	if resp == nil {
+		return ""
+	}
+	return resp.Header.Get(requestIDHeader)
+}
+
+// getUserTeams gets all teams for the user in the specified organization.
+// With use_graphql the teams are queried with the GraphQL API first, falling
+// back to the REST API if that fails.
+func (b *backend) getUserTeams(ctx context.Context, client *github.Client, config *config, org *github.Organization, user *github.User) ([]*github.Team, error) {
+	if config.UseGraphQL {
+		teams, err := fetchUserTeamsGraphQL(ctx, client, org, user, config.TeamsPerPage)
+		if err == nil {
+			return teams, nil
+		}
+		if isRateLimitError(err) {
+			return nil, fmt.Errorf("failed to query user teams: %w", err)
+		}
+		if graphQLUnavailable(err) {
+			b.Logger().Debug("GraphQL API unavailable, listing teams with the REST API", "error", err)
+		} else {
+			b.Logger().Warn("failed to query teams with the GraphQL API, listing them with the REST API", "error", err)
+		}
+	}
+
+	if config.appMode() {
+		return b.fetchOrgTeamsForMember(ctx, client, org, user, config.TeamsPerPage)
 	}
-	return b.extractTeamNames(teams), nil
+	return b.fetchUserTeamsForOrg(ctx, client, org, config.TeamsPerPage)
 }
 
 // fetchUserTeamsForOrg retrieves all teams for a user in a specific organization
-// using pagination to handle large team lists efficiently
-func (b *backend) fetchUserTeamsForOrg(ctx context.Context, client *github.Client, org *github.Organization) ([]*github.Team, error) {
-	var allTeams []*github.Team
+// using the given page size
+func (b *backend) fetchUserTeamsForOrg(ctx context.Context, client *github.Client, org *github.Organization, perPage int) ([]*github.Team, error) {
+	// The teams of the user in every organization are listed, so only the
+	// teams of the specified organization are kept from each page
+	var teams []*github.Team
+	err := listTeamPages(ctx, client, perPage, client.Teams.ListUserTeams, func(page []*github.Team) error {
+		teams = append(teams, b.filterTeamsByOrg(page, org)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user teams: %w", err)
+	}
+
+	return teams, nil
+}
+
+// fetchOrgTeamsForMember retrieves the teams of the organization in which the
+// user has an active membership. Installation tokens cannot list the teams of
+// the authenticated user, so GitHub App mode checks every team of the
+// organization instead.
+func (b *backend) fetchOrgTeamsForMember(ctx context.Context, client *github.Client, org *github.Organization, user *github.User, perPage int) ([]*github.Team, error) {
+	listOrgTeams := func(ctx context.Context, opt *github.ListOptions) ([]*github.Team, *github.Response, error) {
+		return client.Teams.ListTeams(ctx, org.GetLogin(), opt)
+	}
+
+	var memberTeams []*github.Team
+	err := listTeamPages(ctx, client, perPage, listOrgTeams, func(page []*github.Team) error {
+		for _, t := range page {
+			membership, _, err := client.Teams.GetTeamMembership(ctx, t.GetID(), user.GetLogin())
+			if err != nil {
+				if githubErr, ok := err.(*github.ErrorResponse); ok && githubErr.Response.StatusCode == 404 {
+					// The user is not a member of this team
+					continue
+				}
+				return fmt.Errorf("failed to get membership of team %q: %w", t.GetSlug(), err)
+			}
+			if membership.GetState() == "active" {
+				memberTeams = append(memberTeams, t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization teams: %w", err)
+	}
+
+	return memberTeams, nil
+}
 
-	teamOpt := &github.ListOptions{
-		PerPage: defaultPerPage,
+// listTeamPages calls handle with the teams of every page returned by list,
+// requesting perPage teams per page. Pages are requested by number where
+// possible. Some GitHub Enterprise Server versions link the next page without
+// a page number, which leaves NextPage unset, so the next page link is
+// followed instead.
+func listTeamPages(ctx context.Context, client *github.Client, perPage int, list func(context.Context, *github.ListOptions) ([]*github.Team, *github.Response, error), handle func([]*github.Team) error) error {
+	opt := &github.ListOptions{
+		PerPage: perPage,
 	}
 
-	// More efficient approach: Get user's teams directly for the specific organization
-	// This avoids listing ALL user teams across ALL organizations and then filtering
+	teams, resp, err := list(ctx, opt)
 	for {
-		teams, resp, err := client.Teams.ListUserTeams(ctx, teamOpt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list user teams: %w", err)
+			return err
+		}
+		if err := handle(teams); err != nil {
+			return err
 		}
 
-		// Only include teams from the specified organization
-		allTeams = append(allTeams, b.filterTeamsByOrg(teams, org)...)
+		if resp.NextPage != 0 {
+			opt.Page = resp.NextPage
+			teams, resp, err = list(ctx, opt)
+			continue
+		}
 
-		if resp.NextPage == 0 {
-			break
+		next := nextPageLink(resp)
+		if next == "" {
+			return nil
+		}
+		teams, resp, err = getTeamsPage(ctx, client, next)
+	}
+}
+
+// nextPageLink returns the URL of the next page from the Link headers of the
+// response, or an empty string if there is none
+func nextPageLink(resp *github.Response) string {
+	if resp == nil || resp.Response == nil {
+		return ""
+	}
+
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			segments := strings.Split(strings.TrimSpace(link), ";")
+			if len(segments) < 2 {
+				continue
+			}
+
+			href := strings.TrimSpace(segments[0])
+			if !strings.HasPrefix(href, "<") || !strings.HasSuffix(href, ">") {
+				continue
+			}
+
+			for _, segment := range segments[1:] {
+				if strings.TrimSpace(segment) == `rel="next"` {
+					return href[1 : len(href)-1]
+				}
+			}
 		}
-		teamOpt.Page = resp.NextPage
+	}
+	return ""
+}
+
+// getTeamsPage gets the page of teams at the given URL
+func getTeamsPage(ctx context.Context, client *github.Client, pageURL string) ([]*github.Team, *github.Response, error) {
+	req, err := client.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return allTeams, nil
+	var teams []*github.Team
+	resp, err := client.Do(ctx, req, &teams)
+	if err != nil {
+		return nil, resp, err
+	}
+	return teams, resp, nil
 }
 
 // filterTeamsByOrg filters teams to only include those from the specified organization
@@ -449,27 +1522,345 @@ func (b *backend) extractTeamNames(teams []*github.Team) []string {
 	return teamNames
 }
 
-// getPoliciesForUser retrieves policies for teams and user
-func (b *backend) getPoliciesForUser(ctx context.Context, storage logical.Storage, teamNames []string, username string) ([]string, error) {
-	groupPoliciesList, err := b.TeamMap.Policies(ctx, storage, teamNames...)
+// groupAliases returns a single group alias per team, using the team
+// identifier selected by format. Teams without a slug fall back to their
+// name, and teams without either are skipped. Every team the user is a
+// member of gets an alias, whether or not policies are mapped to it. The
+// team ID is kept in the alias metadata, as unlike the name and slug it
+// survives renames of the team.
+func groupAliases(teams []*github.Team, format string) []*logical.Alias {
+	var aliases []*logical.Alias
+
+	for _, t := range teams {
+		var alias string
+		switch format {
+		case groupAliasFormatName:
+			alias = t.GetName()
+		case groupAliasFormatID:
+			if t.ID != nil {
+				alias = strconv.FormatInt(t.GetID(), 10)
+			}
+		default:
+			alias = t.GetSlug()
+			if alias == "" {
+				alias = t.GetName()
+			}
+		}
+
+		if alias == "" {
+			continue
+		}
+		groupAlias := &logical.Alias{Name: alias}
+		if t.ID != nil {
+			groupAlias.Metadata = map[string]string{
+				"team_id": strconv.FormatInt(t.GetID(), 10),
+			}
+		}
+		aliases = append(aliases, groupAlias)
+	}
+
+	return aliases
+}
+
+// teamIDKey returns the key under which policies can be mapped to a team by
+// its ID. Unlike names and slugs, team IDs never change when a team is
+// renamed. Mapping keys may only contain word characters and hyphens, so
+// the ID is prefixed with "id-".
+func teamIDKey(t *github.Team) string {
+	return fmt.Sprintf("id-%d", t.GetID())
+}
+
+// teamIdentifiers returns all keys policies can be mapped to the team by
+func teamIdentifiers(t *github.Team) []string {
+	var identifiers []string
+	if t.Name != nil {
+		identifiers = append(identifiers, *t.Name)
+	}
+	if t.Slug != nil && (t.Name == nil || *t.Name != *t.Slug) {
+		identifiers = append(identifiers, *t.Slug)
+	}
+	if t.ID != nil {
+		identifiers = append(identifiers, teamIDKey(t))
+	}
+	return identifiers
+}
+
+// userPolicies are the policies mapped to a user
+type userPolicies struct {
+	// Policies are all policies mapped to the user
+	Policies []string
+
+	// TeamPolicies are the policies mapped to each team of the user, by
+	// team slug
+	TeamPolicies map[string][]string
+
+	// Metadata is the token metadata mapped to the teams of the user
+	Metadata map[string]string
+
+	// metadataSources are the mappings each metadata key was taken from
+	metadataSources map[string]string
+
+	// Warnings describe which team identifiers matched a policy mapping
+	Warnings []string
+}
+
+// mergeMetadata adds the metadata of the mapping with the given key. Keys
+// already set by an earlier mapping are kept, with a warning if the values
+// differ.
+func (p *userPolicies) mergeMetadata(key string, mapping map[string]interface{}) {
+	metadata, ok := mapping["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(metadata))
+	for name := range metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, ok := metadata[name].(string)
+		if !ok {
+			continue
+		}
+		if source, ok := p.metadataSources[name]; ok {
+			if p.Metadata[name] != value {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("metadata %q of mapping %q ignored, already set by mapping %q", name, key, source))
+			}
+			continue
+		}
+		p.Metadata[name] = value
+		p.metadataSources[name] = key
+	}
+}
+
+// getPoliciesForUser retrieves policies for teams, user and organization role
+func (b *backend) getPoliciesForUser(ctx context.Context, storage logical.Storage, teams []*github.Team, username string, role string, remoteAddr string) (*userPolicies, error) {
+	// Without any names only the policies of the default mapping are returned
+	defaultPoliciesList, err := b.TeamMap.Policies(ctx, storage)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get team policies: %w", err)
 	}
 
+	result := &userPolicies{
+		TeamPolicies:    make(map[string][]string, len(teams)),
+		Metadata:        make(map[string]string),
+		metadataSources: make(map[string]string),
+	}
+
+	// Metadata is merged in the order of the team slugs, so that the
+	// mapping a key is taken from does not depend on the order of the
+	// teams returned by GitHub
+	teams = slices.Clone(teams)
+	sort.SliceStable(teams, func(i, j int) bool {
+		return teams[i].GetSlug() < teams[j].GetSlug()
+	})
+
+	groupPolicies := make(map[string]struct{})
+	for _, p := range defaultPoliciesList {
+		groupPolicies[p] = struct{}{}
+	}
+	teamMatched := false
+	for _, t := range teams {
+		teamPoliciesList := []string{}
+		for _, identifier := range teamIdentifiers(t) {
+			mapping, err := b.TeamMap.Get(ctx, storage, identifier)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get team policies: %w", err)
+			}
+			if mapping == nil {
+				continue
+			}
+			result.Warnings = append(result.Warnings, fmt.Sprintf("team %q matched policy mapping %q", t.GetSlug(), identifier))
+			teamMatched = true
+
+			// Policies of mappings bound to other networks are dropped
+			// without failing the login
+			if !mappingAllowsAddr(mapping, remoteAddr) {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("policies of mapping %q dropped, request is not from its bound_cidrs", identifier))
+				continue
+			}
+
+			for _, p := range mappedPolicies(mapping) {
+				teamPoliciesList = append(teamPoliciesList, p)
+				groupPolicies[p] = struct{}{}
+			}
+			result.mergeMetadata(identifier, mapping)
+		}
+		result.TeamPolicies[t.GetSlug()] = strutil.RemoveDuplicates(teamPoliciesList, false)
+	}
+
+	// Users in teams of which none are mapped get the fallback policies
+	if len(teams) > 0 && !teamMatched {
+		fallback, err := b.TeamMap.Get(ctx, storage, teamFallbackKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get fallback team policies: %w", err)
+		}
+		if fallback != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("no team matched a policy mapping, applying fallback mapping %q", teamFallbackKey))
+			for _, p := range mappedPolicies(fallback) {
+				groupPolicies[p] = struct{}{}
+			}
+			result.mergeMetadata(teamFallbackKey, fallback)
+		}
+	}
+
+	// The default mapping applies to every user, so the metadata of team
+	// mappings takes precedence over it
+	defaultMapping, err := b.TeamMap.Get(ctx, storage, b.TeamMap.DefaultKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default team mapping: %w", err)
+	}
+	if defaultMapping != nil {
+		result.mergeMetadata(b.TeamMap.DefaultKey, defaultMapping)
+	}
+
+	groupPoliciesList := make([]string, 0, len(groupPolicies))
+	for p := range groupPolicies {
+		groupPoliciesList = append(groupPoliciesList, p)
+	}
+	sort.Strings(groupPoliciesList)
+
 	userPoliciesList, err := b.UserMap.Policies(ctx, storage, []string{username}...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user policies: %w", err)
 	}
 
-	return append(groupPoliciesList, userPoliciesList...), nil
+	result.Policies = append(groupPoliciesList, userPoliciesList...)
+
+	if role != "" {
+		rolePoliciesList, err := b.RoleMap.Policies(ctx, storage, role)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role policies: %w", err)
+		}
+		result.Policies = append(result.Policies, rolePoliciesList...)
+	}
+
+	return result, nil
+}
+
+// mappingAllowsAddr reports whether the policies of a mapping apply to a
+// request from remoteAddr. Mappings without bound CIDRs apply everywhere.
+func mappingAllowsAddr(mapping map[string]interface{}, remoteAddr string) bool {
+	boundCIDRsRaw, ok := mapping["bound_cidrs"].([]interface{})
+	if !ok || len(boundCIDRsRaw) == 0 {
+		return true
+	}
+
+	boundCIDRs := make([]string, 0, len(boundCIDRsRaw))
+	for _, cidr := range boundCIDRsRaw {
+		if s, ok := cidr.(string); ok {
+			boundCIDRs = append(boundCIDRs, s)
+		}
+	}
+
+	allowed, err := cidrutil.IPBelongsToCIDRBlocksSlice(remoteAddr, boundCIDRs)
+	return err == nil && allowed
+}
+
+// mappedPolicies parses the comma separated policies of a policy mapping
+func mappedPolicies(mapping map[string]interface{}) []string {
+	value, ok := mapping["value"].(string)
+	if !ok {
+		return nil
+	}
+
+	var policies []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			policies = append(policies, p)
+		}
+	}
+	return policies
+}
+
+// addRateLimitWarning warns when the rate limit reported by the last request
+// to GitHub is close to being exhausted. Logins are not denied, as the rate
+// limit was not exceeded yet.
+func (r *verifyCredentialsResp) addRateLimitWarning(config *config, status *rateLimitStatus) {
+	if config.RateLimitWarningThreshold <= 0 {
+		return
+	}
+	if warning := status.warning(config.RateLimitWarningThreshold); warning != "" {
+		r.Warnings = append(r.Warnings, warning)
+	}
+}
+
+// aliasName returns the name of the entity alias of the user, the prefixed
+// SCIM externalId with scim_identity set to alias if the user has one, and the
+// identifier selected by user_alias_name otherwise
+func (r *verifyCredentialsResp) aliasName() (string, error) {
+	if r.Config.scimIdentity() == scimIdentityAlias && r.ExternalID != "" {
+		return scimAlias(r.ExternalID), nil
+	}
+	return r.Config.userAlias(r.User, r.UserEmail)
+}
+
+// userAlias returns the identifier of the user selected by user_alias_name:
+// the normalized login, the numeric ID or the lowercased email. Users whose
+// identifier cannot be read are denied rather than falling back to another
+// identifier, which would split their entity.
+func (c *config) userAlias(user *github.User, email string) (string, error) {
+	switch c.userAliasName() {
+	case userAliasNameID:
+		if user.ID == nil {
+			return "", newAuthError("user ID unavailable",
+				fmt.Sprintf("GitHub did not return the ID of user '%s'", user.GetLogin()))
+		}
+		return strconv.FormatInt(user.GetID(), 10), nil
+	case userAliasNameEmail:
+		if email == "" {
+			return "", newAuthError("user email unavailable",
+				fmt.Sprintf("the email of user '%s' cannot be read, which requires a public email or a token with the user:email scope", user.GetLogin()))
+		}
+		return strings.ToLower(email), nil
+	default:
+		return c.normalizeUsername(user.GetLogin()), nil
+	}
+}
+
+// applyOwnerTokenTTLs overrides the TTLs of the token of an organization
+// owner with owner_token_ttl and owner_token_max_ttl, if set
+func (c *config) applyOwnerTokenTTLs(auth *logical.Auth, orgRole string) {
+	if orgRole != "admin" {
+		return
+	}
+	if c.OwnerTokenTTL > 0 {
+		auth.TTL = c.OwnerTokenTTL
+	}
+	if c.OwnerTokenMaxTTL > 0 {
+		auth.MaxTTL = c.OwnerTokenMaxTTL
+	}
 }
 
 type verifyCredentialsResp struct {
 	User      *github.User
 	Org       *github.Organization
+	OrgRole   string
 	Policies  []string
 	TeamNames []string
 
+	// GroupAliases holds one alias per team in the configured format
+	GroupAliases []*logical.Alias
+
+	// TeamPolicies are the policies mapped to each team, by team slug
+	TeamPolicies map[string][]string
+
+	// Metadata is the token metadata mapped to the user's teams
+	Metadata map[string]string
+
+	// TokenExpiration is when the user's token expires, zero if it does not
+	TokenExpiration time.Time
+
+	// UserEmail is the public or primary verified email of the user, empty
+	// if it is not visible
+	UserEmail string
+
+	// ExternalID is the SCIM externalId of the user in the organization,
+	// empty if scim_identity is disabled or the user has none
+	ExternalID string
+
 	// Warnings to send back to the caller
 	Warnings []string
 
@@ -0,0 +1,270 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/openbao/openbao/sdk/v2/helper/cidrutil"
+	"github.com/openbao/openbao/sdk/v2/helper/policyutil"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// reservedOIDCMetadataKeys are the token metadata keys set on OIDC logins,
+// which claim mappings cannot set
+var reservedOIDCMetadataKeys = []string{
+	"repository",
+	"repository_owner",
+	"workflow",
+	"ref",
+}
+
+// actionsClaims are the claims of the OIDC tokens of GitHub Actions checked
+// on login
+type actionsClaims struct {
+	Subject         string `json:"sub"`
+	Repository      string `json:"repository"`
+	RepositoryOwner string `json:"repository_owner"`
+	Workflow        string `json:"workflow"`
+	Ref             string `json:"ref"`
+}
+
+// oidcKeySetCache keeps the key sets of the JWKS URLs, so that the keys are
+// only fetched again when a token is signed with an unknown key
+type oidcKeySetCache struct {
+	lock    sync.Mutex
+	entries map[string]*oidc.RemoteKeySet
+}
+
+func newOIDCKeySetCache() *oidcKeySetCache {
+	return &oidcKeySetCache{
+		entries: make(map[string]*oidc.RemoteKeySet),
+	}
+}
+
+// get returns the key set of the JWKS URL, creating it if needed
+func (c *oidcKeySetCache) get(jwksURL string, newKeySet func(string) *oidc.RemoteKeySet) *oidc.RemoteKeySet {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	keySet, ok := c.entries[jwksURL]
+	if !ok {
+		keySet = newKeySet(jwksURL)
+		c.entries[jwksURL] = keySet
+	}
+	return keySet
+}
+
+// reset drops all key sets
+func (c *oidcKeySetCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]*oidc.RemoteKeySet)
+}
+
+// newOIDCKeySet creates a key set fetching the keys from the JWKS URL. The
+// keys are fetched outside of any request, so the key set gets a context of
+// its own.
+func (b *backend) newOIDCKeySet(jwksURL string) *oidc.RemoteKeySet {
+	client := b.httpClient
+	if client == nil {
+		client = cleanhttp.DefaultPooledClient()
+	}
+	return oidc.NewRemoteKeySet(oidc.ClientContext(context.Background(), client), jwksURL)
+}
+
+// verifyOIDCToken verifies the OIDC token of a GitHub Actions workflow
+// against the OIDC configuration and returns its claims
+func (b *backend) verifyOIDCToken(ctx context.Context, req *logical.Request, rawToken string) (*oidcConfig, *actionsClaims, map[string]interface{}, error) {
+	config, err := b.OIDCConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if config == nil {
+		return nil, nil, nil, newAuthError("OIDC login not configured",
+			"the OIDC login of GitHub Actions workflows has not been configured at config/oidc")
+	}
+
+	if len(config.TokenBoundCIDRs) > 0 {
+		if req.Connection == nil || !cidrutil.RemoteAddrIsOk(req.Connection.RemoteAddr, config.TokenBoundCIDRs) {
+			return nil, nil, nil, logical.ErrPermissionDenied
+		}
+	}
+
+	// The audiences are checked below against the bound audiences, of
+	// which the token must have one
+	keySet := b.oidcKeySets.get(config.JWKSURL, b.newOIDCKeySet)
+	verifier := oidc.NewVerifier(config.BoundIssuer, keySet, &oidc.Config{
+		SkipClientIDCheck: true,
+		Now:               b.now,
+	})
+	idToken, err := verifier.Verify(ctx, rawToken)
+	if err != nil {
+		return nil, nil, nil, newAuthError("invalid OIDC token", err.Error())
+	}
+	if !slices.ContainsFunc(idToken.Audience, func(aud string) bool {
+		return slices.Contains(config.BoundAudiences, aud)
+	}) {
+		return nil, nil, nil, newAuthError("OIDC token audience not allowed",
+			fmt.Sprintf("the token audiences %q do not include any of bound_audiences", idToken.Audience))
+	}
+
+	var claims actionsClaims
+	var allClaims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, nil, newAuthError("invalid OIDC token", err.Error())
+	}
+	if err := idToken.Claims(&allClaims); err != nil {
+		return nil, nil, nil, newAuthError("invalid OIDC token", err.Error())
+	}
+	if claims.Subject == "" || claims.Repository == "" || claims.RepositoryOwner == "" {
+		return nil, nil, nil, newAuthError("invalid OIDC token",
+			"the token lacks the sub, repository or repository_owner claim")
+	}
+
+	if !config.repositoryBound(claims.Repository) {
+		return nil, nil, nil, newAuthError("repository not allowed",
+			fmt.Sprintf("repository %q is not allowed by bound_repository_owners or bound_repositories", claims.Repository))
+	}
+	if len(config.BoundWorkflows) > 0 && !slices.Contains(config.BoundWorkflows, claims.Workflow) {
+		return nil, nil, nil, newAuthError("workflow not allowed",
+			fmt.Sprintf("workflow %q is not in bound_workflows", claims.Workflow))
+	}
+
+	return config, &claims, allClaims, nil
+}
+
+// repositoryBound reports whether the workflows of the repository, as
+// owner/name, may log in. Owner and repository names are case-insensitive.
+func (c *oidcConfig) repositoryBound(repository string) bool {
+	owner, _, _ := strings.Cut(repository, "/")
+	for _, bound := range c.BoundRepositoryOwners {
+		if strings.EqualFold(bound, owner) {
+			return true
+		}
+	}
+	for _, bound := range c.BoundRepositories {
+		if strings.EqualFold(bound, repository) {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcPolicies returns the policies of the workflows of the repository
+func (c *oidcConfig) oidcPolicies(repository string) []string {
+	return policyutil.SanitizePolicies(append(slices.Clone(c.TokenPolicies), c.repositoryPolicies(repository)...), false)
+}
+
+func (b *backend) pathLoginOIDCAliasLookahead(ctx context.Context, req *logical.Request, rawToken string) (*logical.Response, error) {
+	_, claims, _, err := b.verifyOIDCToken(ctx, req, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Auth: &logical.Auth{
+			Alias: &logical.Alias{
+				Name: claims.Subject,
+			},
+		},
+	}, nil
+}
+
+// pathLoginOIDC logs in a GitHub Actions workflow with its OIDC token. The
+// token only lives for the duration of the job, so like the JWT auth method
+// it is not kept, and renewals only check that the configuration still
+// allows the repository and workflow with the same policies.
+func (b *backend) pathLoginOIDC(ctx context.Context, req *logical.Request, rawToken string) (*logical.Response, error) {
+	config, claims, allClaims, err := b.verifyOIDCToken(ctx, req, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &logical.Auth{
+		InternalData: map[string]interface{}{
+			"oidc_repository": claims.Repository,
+			"oidc_workflow":   claims.Workflow,
+		},
+		Metadata: map[string]string{
+			"repository":       claims.Repository,
+			"repository_owner": claims.RepositoryOwner,
+			"workflow":         claims.Workflow,
+		},
+		DisplayName: claims.Repository,
+		Alias: &logical.Alias{
+			Name: claims.Subject,
+		},
+	}
+	if claims.Ref != "" {
+		auth.Metadata["ref"] = claims.Ref
+	}
+
+	var warnings []string
+	for claim, key := range config.ClaimMappings {
+		value, ok := allClaims[claim]
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			auth.Metadata[key] = v
+		case bool, float64:
+			auth.Metadata[key] = fmt.Sprint(v)
+		default:
+			warnings = append(warnings, fmt.Sprintf("claim %q is not a string, number or boolean and was not mapped", claim))
+		}
+	}
+
+	if err := config.PopulateTokenAuth(auth, req); err != nil {
+		return nil, fmt.Errorf("failed to populate token auth: %w", err)
+	}
+	auth.Policies = config.oidcPolicies(claims.Repository)
+
+	return &logical.Response{
+		Warnings: warnings,
+		Auth:     auth,
+	}, nil
+}
+
+// pathLoginRenewOIDC renews the token of a GitHub Actions workflow, provided
+// its repository and workflow may still log in with the same policies
+func (b *backend) pathLoginRenewOIDC(ctx context.Context, req *logical.Request, repository string) (*logical.Response, error) {
+	config, err := b.OIDCConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, newAuthError("OIDC login not configured",
+			"the OIDC login of GitHub Actions workflows is no longer configured")
+	}
+	if !config.repositoryBound(repository) {
+		return nil, newAuthError("repository not allowed",
+			fmt.Sprintf("repository %q is no longer allowed to log in", repository))
+	}
+	// Tokens issued before the workflow was kept in the internal data only
+	// have it in their metadata
+	workflow, ok := req.Auth.InternalData["oidc_workflow"].(string)
+	if !ok {
+		workflow = req.Auth.Metadata["workflow"]
+	}
+	if len(config.BoundWorkflows) > 0 && !slices.Contains(config.BoundWorkflows, workflow) {
+		return nil, newAuthError("workflow not allowed",
+			fmt.Sprintf("workflow %q is no longer in bound_workflows", workflow))
+	}
+
+	if !policyutil.EquivalentPolicies(config.oidcPolicies(repository), req.Auth.TokenPolicies) {
+		return nil, fmt.Errorf("policies do not match")
+	}
+
+	resp := &logical.Response{Auth: req.Auth}
+	resp.Auth.Period = config.TokenPeriod
+	resp.Auth.TTL = config.TokenTTL
+	resp.Auth.MaxTTL = config.TokenMaxTTL
+	return resp, nil
+}
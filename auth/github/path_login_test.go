@@ -1,9 +1,28 @@
 package github
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	metrics "github.com/armon/go-metrics"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/google/go-github/github"
+	"github.com/hashicorp/go-hclog"
 	"github.com/openbao/openbao/sdk/v2/logical"
 	"github.com/stretchr/testify/assert"
 )
@@ -49,8 +68,11 @@ func TestGitHub_Login(t *testing.T) {
 	})
 
 	expectedMetaData := map[string]string{
-		"org":      "foo-org",
-		"username": "user-foo",
+		"org":        "foo-org",
+		"org_role":   "member",
+		"username":   "user-foo",
+		"user_id":    "6789",
+		"user_email": "user-foo@example.com",
 	}
 	assert.Equal(t, expectedMetaData, resp.Auth.Metadata)
 	assert.NoError(t, err)
@@ -93,9 +115,9 @@ func TestGitHub_Login_OrgInvalid(t *testing.T) {
 
 	assert.Nil(t, resp)
 	assert.Error(t, err)
-	// With the optimized API usage, we now get an organization ID mismatch error
-	// instead of membership error because we check organization first
-	assert.Contains(t, err.Error(), "organization ID mismatch")
+	// The organization is resolved by its ID, so an unknown ID is reported
+	// instead of a membership error
+	assert.Contains(t, err.Error(), "organization not found")
 }
 
 // TestGitHub_Login_OrgNameChanged tests that we can successfully login with the
@@ -124,7 +146,7 @@ func TestGitHub_Login_OrgNameChanged(t *testing.T) {
 	}
 
 	// attempt a login
-	_, err = b.HandleRequest(context.Background(), &logical.Request{
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
 		Path:      "login",
 		Operation: logical.UpdateOperation,
 		Data: map[string]interface{}{
@@ -133,11 +155,18 @@ func TestGitHub_Login_OrgNameChanged(t *testing.T) {
 		Storage: s,
 	})
 
-	// With the optimized API usage, authentication will fail if the organization
-	// name in config doesn't match the actual organization name, even if IDs match.
-	// This is more secure than the previous behavior.
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to get organization \"old-name\"")
+	// The organization is resolved by its ID, so the login succeeds
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "foo-org", resp.Auth.Metadata["org"])
+	assert.Contains(t, resp.Warnings,
+		`organization "old-name" with ID 12345 has been renamed to "foo-org", the configuration has been updated`)
+
+	// The configured name is updated to the new name
+	stored, err := b.Config(ctx, s)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo-org", stored.Organization)
+	assert.Equal(t, int64(12345), stored.OrganizationID)
 }
 
 // TestGitHub_Login_NoOrgID tests that we can successfully login with the given
@@ -153,8 +182,9 @@ func TestGitHub_Login_NoOrgID(t *testing.T) {
 
 	// write and store config without Org ID
 	config := config{
-		Organization: "foo-org",
-		BaseURL:      ts.URL + "/", // base_url will call the test server
+		Organization:          "foo-org",
+		BaseURL:               ts.URL + "/", // base_url will call the test server
+		AutoSetOrganizationID: true,
 	}
 	entry, err := logical.StorageEntryJSON("config", config)
 	if err != nil {
@@ -175,8 +205,11 @@ func TestGitHub_Login_NoOrgID(t *testing.T) {
 	})
 
 	expectedMetaData := map[string]string{
-		"org":      "foo-org",
-		"username": "user-foo",
+		"org":        "foo-org",
+		"org_role":   "member",
+		"username":   "user-foo",
+		"user_id":    "6789",
+		"user_email": "user-foo@example.com",
 	}
 	assert.Equal(t, expectedMetaData, resp.Auth.Metadata)
 	assert.NoError(t, err)
@@ -195,6 +228,341 @@ func TestGitHub_Login_NoOrgID(t *testing.T) {
 	assert.Equal(t, int64(12345), resp.Data["organization_id"])
 }
 
+// TestGitHub_Login_NoOrgID_AutoSetDisabled tests that the organization ID
+// fetched on login is used for the membership check, but not written to the
+// config, when auto_set_organization_id is disabled
+func TestGitHub_Login_NoOrgID_AutoSetDisabled(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	config := newConfig()
+	config.Organization = "foo-org"
+	config.BaseURL = ts.URL + "/"
+	config.AutoSetOrganizationID = false
+	entry, err := logical.StorageEntryJSON("config", config)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Put(ctx, entry))
+
+	for i := 0; i < 2; i++ {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		assert.Equal(t, "foo-org", resp.Auth.Metadata["org"])
+	}
+
+	stored, err := b.Config(ctx, s)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stored.OrganizationID)
+	assert.False(t, stored.AutoSetOrganizationID)
+}
+
+// TestGitHub_Login_ZeroOrgID tests that an organization ID of zero is never
+// accepted as a match, whether it is configured or reported by GitHub
+func TestGitHub_Login_ZeroOrgID(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/orgs/foo-org" || r.URL.Path == "/organizations/12345" {
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintln(w, `{"login": "foo-org", "id": 0}`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	config := newConfig()
+	config.Organization = "foo-org"
+	config.BaseURL = ts.URL + "/"
+	client, err := b.clientForConfig("faketoken", config)
+	assert.NoError(t, err)
+	user := &github.User{Login: github.String("user-foo")}
+
+	for _, configuredID := range []int64{0, 12345} {
+		config.OrganizationID = configuredID
+		_, _, _, err = b.checkOrganizationMembership(ctx, client, user, config)
+		var authErr *AuthenticationError
+		if assert.ErrorAs(t, err, &authErr) {
+			assert.Equal(t, "invalid organization ID", authErr.Reason)
+		}
+	}
+
+	// Logins fail before the membership is checked, as no ID can be fetched
+	config.OrganizationID = 0
+	entry, err := logical.StorageEntryJSON("config", config)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Put(ctx, entry))
+
+	_, err = b.HandleRequest(ctx, &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.ErrorContains(t, err, "organization_id not found for organization 'foo-org'")
+}
+
+// TestGitHub_Login_Require2FA tests that users without two-factor
+// authentication are denied with require_2fa, whether GitHub reports the
+// status to their token or it is read from the organization members by an
+// owner, and that logins fail when the status cannot be read
+func TestGitHub_Login_Require2FA(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	var twoFactorField atomic.Value
+	twoFactorField.Store("")
+	var twoFactorDisabled atomic.Bool
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintln(w, strings.Replace(getUserResponse, `"type": "User"`, `"type": "User"`+twoFactorField.Load().(string), 1))
+			return
+		case "/orgs/foo-org/members":
+			if r.URL.Query().Get("filter") != "2fa_disabled" {
+				t.Errorf("unexpected request: %s", r.URL)
+			}
+			w.Header().Add("Content-Type", "application/json")
+			if twoFactorDisabled.Load() {
+				fmt.Fprintln(w, `[{"login": "user-bar"}, {"login": "user-foo"}]`)
+				return
+			}
+			fmt.Fprintln(w, `[{"login": "user-bar"}]`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+			"require_2fa":  true,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	login := func(token string) error {
+		t.Helper()
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": token,
+			},
+			Storage: s,
+		})
+		return err
+	}
+
+	// The status is reported to the token of the user
+	twoFactorField.Store(`, "two_factor_authentication": true`)
+	assert.NoError(t, login("faketoken"))
+
+	twoFactorField.Store(`, "two_factor_authentication": false`)
+	var authErr *AuthenticationError
+	if assert.ErrorAs(t, login("faketoken"), &authErr) {
+		assert.Equal(t, "two-factor authentication required", authErr.Reason)
+	}
+
+	// Members cannot see the status of other members
+	twoFactorField.Store("")
+	if assert.ErrorAs(t, login("faketoken"), &authErr) {
+		assert.Equal(t, "two-factor authentication status unavailable", authErr.Reason)
+	}
+
+	// Owners list the members without two-factor authentication
+	assert.NoError(t, login(testOwnerToken))
+
+	twoFactorDisabled.Store(true)
+	if assert.ErrorAs(t, login(testOwnerToken), &authErr) {
+		assert.Equal(t, "two-factor authentication required", authErr.Reason)
+	}
+}
+
+// TestGitHub_Login_SCIMIdentity tests that the SCIM externalId of the user is
+// added to the metadata, used as the entity alias with scim_identity set to
+// alias, that users without a SCIM identity fall back to their login, and
+// that identities that cannot be read deny logins with scim_identity set to
+// alias
+func TestGitHub_Login_SCIMIdentity(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	var unlinked, failing atomic.Bool
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/graphql":
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), "externalIdentities") {
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				break
+			}
+			w.Header().Add("Content-Type", "application/json")
+			if failing.Load() {
+				fmt.Fprintln(w, `{"data": null, "errors": [{"message": "Resource not accessible by integration"}]}`)
+				return
+			}
+			if unlinked.Load() {
+				fmt.Fprintln(w, `{"data": {"organization": {"samlIdentityProvider": {"externalIdentities": {"nodes": []}}}}}`)
+				return
+			}
+			fmt.Fprintln(w, `{"data": {"organization": {"samlIdentityProvider": {"externalIdentities": {"nodes": [
+				{"guid": "7a2ef4a4-0f3c-11ee-be56-0242ac120002", "scimIdentity": {"username": "user.foo@example.com"}}
+			]}}}}}`)
+			return
+		case r.URL.Path == "/scim/v2/organizations/foo-org/Users/7a2ef4a4-0f3c-11ee-be56-0242ac120002":
+			w.Header().Add("Content-Type", "application/scim+json")
+			fmt.Fprintln(w, `{"id": "7a2ef4a4-0f3c-11ee-be56-0242ac120002", "externalId": "E12345", "userName": "user.foo@example.com"}`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	writeConfig := func(mode string) {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":  "foo-org",
+				"base_url":      ts.URL,
+				"scim_identity": mode,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+	}
+	login := func() *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+	lookahead := func() (*logical.Response, error) {
+		t.Helper()
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.AliasLookaheadOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	writeConfig("metadata")
+	resp := login()
+	assert.Equal(t, "E12345", resp.Auth.Metadata["scim_external_id"])
+	assert.Equal(t, "user-foo", resp.Auth.Alias.Name)
+
+	writeConfig("alias")
+	resp = login()
+	assert.Equal(t, "E12345", resp.Auth.Metadata["scim_external_id"])
+	assert.Equal(t, "scim:E12345", resp.Auth.Alias.Name)
+	assert.Equal(t, "user-foo", resp.Auth.Metadata["username"])
+
+	lookaheadResp, err := lookahead()
+	assert.NoError(t, err)
+	assert.Equal(t, "scim:E12345", lookaheadResp.Auth.Alias.Name)
+
+	// Users without a SCIM identity are identified by their login
+	unlinked.Store(true)
+	resp = login()
+	assert.NotContains(t, resp.Auth.Metadata, "scim_external_id")
+	assert.Equal(t, "user-foo", resp.Auth.Alias.Name)
+	assert.Contains(t, resp.Warnings, `user "user-foo" has no SCIM identity in organization "foo-org", using the GitHub login`)
+
+	lookaheadResp, err = lookahead()
+	assert.NoError(t, err)
+	assert.Equal(t, "user-foo", lookaheadResp.Auth.Alias.Name)
+
+	// Identities that cannot be read deny the login rather than identifying
+	// the user by their login
+	unlinked.Store(false)
+	failing.Store(true)
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.ErrorContains(t, err, "Resource not accessible by integration")
+	_, err = lookahead()
+	assert.ErrorContains(t, err, "Resource not accessible by integration")
+
+	// They are only a warning when the identity is not the alias
+	writeConfig("metadata")
+	resp = login()
+	assert.NotContains(t, resp.Auth.Metadata, "scim_external_id")
+	assert.Equal(t, "user-foo", resp.Auth.Alias.Name)
+	assert.Contains(t, resp.Warnings, `failed to resolve the SCIM identity of user "user-foo" in organization "foo-org": GraphQL query failed: Resource not accessible by integration`)
+	failing.Store(false)
+
+	// The identity is not resolved by default
+	writeConfig("disabled")
+	resp = login()
+	assert.NotContains(t, resp.Auth.Metadata, "scim_external_id")
+	assert.Equal(t, "user-foo", resp.Auth.Alias.Name)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"scim_identity": "primary",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+
+	// The identity is resolved in the primary organization
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":  "",
+			"allow_any_org": true,
+			"scim_identity": "alias",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "scim_identity")
+}
+
 // TestGitHub_PathLoginRenew tests the token renewal flow
 func TestGitHub_PathLoginRenew(t *testing.T) {
 	b, s := createBackendWithStorage(t)
@@ -372,6 +740,197 @@ func TestGitHub_PathLoginRenew_MissingToken(t *testing.T) {
 	assert.Contains(t, err.Error(), "token created in previous version")
 }
 
+// TestGitHub_PathLoginRenew_GitHubError tests that tokens are renewed with
+// their current policies while GitHub is unavailable only with
+// renew_on_github_error, and no longer than renew_grace_period
+func TestGitHub_PathLoginRenew_GitHubError(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	var status atomic.Int32
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := int(status.Load()); code != 0 {
+			w.WriteHeader(code)
+			fmt.Fprintln(w, `{"message": "GitHub error"}`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	writeConfig := func(data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := writeConfig(map[string]interface{}{
+		"organization":          "foo-org",
+		"base_url":              ts.URL,
+		"renew_on_github_error": true,
+		"renew_grace_period":    0,
+	})
+	assert.ErrorContains(t, resp.Error(), "renew_grace_period must be set")
+
+	resp = writeConfig(map[string]interface{}{
+		"organization":          "foo-org",
+		"base_url":              ts.URL,
+		"token_ttl":             "30m",
+		"renew_on_github_error": true,
+		"renew_grace_period":    "1h",
+	})
+	assert.NoError(t, resp.Error())
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "foo-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.clock = func() time.Time {
+		return now
+	}
+
+	loginResp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, loginResp.Error())
+	assert.Equal(t, []string{"foo-policy"}, loginResp.Auth.Policies)
+
+	renew := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.RenewOperation,
+			Storage:   s,
+			Auth: &logical.Auth{
+				InternalData:  loginResp.Auth.InternalData,
+				TokenPolicies: loginResp.Auth.Policies,
+				Metadata:      loginResp.Auth.Metadata,
+				DisplayName:   loginResp.Auth.DisplayName,
+				GroupAliases:  loginResp.Auth.GroupAliases,
+				LeaseOptions: logical.LeaseOptions{
+					TTL:       loginResp.Auth.TTL,
+					Renewable: true,
+					IssueTime: now.Add(-time.Hour),
+				},
+			},
+		})
+	}
+
+	// A successful renewal records when the user was verified
+	resp, err = renew()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, now.Format(time.RFC3339), resp.Auth.InternalData["verified_at"])
+
+	now = now.Add(10 * time.Minute)
+	status.Store(http.StatusBadGateway)
+	resp, err = renew()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, 30*time.Minute, resp.Auth.TTL)
+	assert.Equal(t, loginResp.Auth.Policies, resp.Auth.TokenPolicies)
+	assert.Len(t, resp.Warnings, 1)
+	assert.Contains(t, resp.Warnings[0], "GitHub is unavailable")
+
+	// Users denied by GitHub are not renewed
+	status.Store(http.StatusUnauthorized)
+	_, err = renew()
+	assert.ErrorContains(t, err, "401")
+
+	// The token does not outlive the grace period
+	now = now.Add(40 * time.Minute)
+	status.Store(http.StatusServiceUnavailable)
+	resp, err = renew()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, 10*time.Minute, resp.Auth.TTL)
+
+	resp = writeConfig(map[string]interface{}{"renew_on_github_error": false})
+	assert.NoError(t, resp.Error())
+	_, err = renew()
+	assert.ErrorContains(t, err, "503")
+
+	// Unreachable servers are handled like server errors
+	resp = writeConfig(map[string]interface{}{"renew_on_github_error": true})
+	assert.NoError(t, resp.Error())
+	ts.Close()
+	resp, err = renew()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	now = now.Add(11 * time.Minute)
+	_, err = renew()
+	assert.ErrorContains(t, err, "longer than renew_grace_period")
+}
+
+// TestGitHub_PathLoginRenew_StoreTokenDisabled tests that the GitHub token is
+// not stored when store_token is disabled and renewals ask to log in again
+func TestGitHub_PathLoginRenew_StoreTokenDisabled(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+			"store_token":  false,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	loginResp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, loginResp.Error())
+	assert.Equal(t, map[string]interface{}{"store_token": false}, loginResp.Auth.InternalData)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Auth: &logical.Auth{
+			InternalData:  loginResp.Auth.InternalData,
+			TokenPolicies: loginResp.Auth.Policies,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       3600,
+				Renewable: true,
+			},
+		},
+	})
+	var authErr *AuthenticationError
+	assert.True(t, errors.As(err, &authErr))
+	assert.ErrorContains(t, err, "log in again")
+}
+
 // TestGitHub_CheckCIDRMatch tests CIDR validation
 func TestGitHub_CheckCIDRMatch(t *testing.T) {
 	b, s := createBackendWithStorage(t)
@@ -459,3 +1018,3415 @@ func TestGitHub_CheckCIDRMatch(t *testing.T) {
 		})
 	}
 }
+
+// TestGitHub_Login_App tests that in GitHub App mode the organization and
+// teams are resolved with the installation token and that renewal does not
+// need the user's token
+func TestGitHub_Login_App(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	// Write the config
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":    "foo-org",
+			"base_url":        ts.URL,
+			"app_id":          1234,
+			"installation_id": 42,
+			"private_key":     testAppPrivateKey(t),
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Map the team so that we can check it was resolved
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	// attempt a login
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, []string{"team-policy"}, resp.Auth.Policies)
+	assert.Equal(t, map[string]interface{}{"app_user": "user-foo"}, resp.Auth.InternalData)
+
+	// Renew without the user's token
+	renewResp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Auth: &logical.Auth{
+			InternalData:  resp.Auth.InternalData,
+			Policies:      resp.Auth.Policies,
+			TokenPolicies: resp.Auth.Policies,
+			Metadata:      resp.Auth.Metadata,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       3600,
+				Renewable: true,
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, renewResp)
+	if renewResp != nil {
+		assert.NotNil(t, renewResp.Auth)
+	}
+}
+
+// TestGitHub_Login_AppUserTokenScopes tests that in GitHub App mode the
+// user's token is only used to identify the user, and organization
+// membership is checked with the installation token, so that tokens lacking
+// read:org can log in
+func TestGitHub_Login_AppUserTokenScopes(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	var userPaths []string
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer faketoken" {
+			userPaths = append(userPaths, r.URL.Path)
+			if r.URL.Path != "/user" && r.URL.Path != "/user/emails" {
+				w.WriteHeader(403)
+				fmt.Fprintln(w, `{"message": "Resource not accessible by personal access token"}`)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":    "foo-org",
+			"base_url":        ts.URL,
+			"app_id":          1234,
+			"installation_id": 42,
+			"private_key":     testAppPrivateKey(t),
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, []string{"team-policy"}, resp.Auth.Policies)
+	// Only the identity and email of the user are read with their token
+	assert.Equal(t, []string{"/user", "/user/emails"}, userPaths)
+}
+
+// TestGitHub_Login_TokenExpiration tests that the expiration of tokens that
+// expire is surfaced in the metadata and that expired tokens are rejected
+func TestGitHub_Login_TokenExpiration(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	// Write the config
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	// A token with a future expiration logs in and reports it
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": testExpiringToken,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "2099-01-01T00:00:00Z", resp.Auth.Metadata["token_expiration"])
+
+	// An expired token is rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": testExpiredToken,
+		},
+		Storage: s,
+	})
+	assert.Nil(t, resp)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "token expired")
+}
+
+// TestGitHub_Login_Clock tests that token expirations are checked against
+// the clock of the backend
+func TestGitHub_Login_Clock(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info, without base_url
+	ts := setupTestServer(t)
+	defer ts.Close()
+	useTestServer(b, ts)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	login := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": testExpiringToken,
+			},
+			Storage: s,
+		})
+	}
+
+	resp, err := login()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	// The token expires at the start of 2099
+	b.clock = func() time.Time {
+		return time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	resp, err = login()
+	assert.Nil(t, resp)
+	assert.ErrorContains(t, err, "token expired")
+}
+
+// TestGitHub_Login_MultipleOrgs tests that users can log in through any of the
+// configured organizations and that the matched organization is recorded
+func TestGitHub_Login_MultipleOrgs(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	// Write the config, the user is only a member of the additional org
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":  "bar-org",
+			"organizations": "foo-org",
+			"base_url":      ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// the IDs of all organizations should be fetched
+	config, err := b.Config(context.Background(), s)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(67890), config.OrganizationID)
+	assert.Equal(t, []int64{12345}, config.OrganizationIDs)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	// attempt a login
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "foo-org", resp.Auth.Metadata["org"])
+	assert.Equal(t, []string{"team-policy"}, resp.Auth.Policies)
+
+	// Without the additional org the user is rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organizations": []string{},
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "user is not part of required org")
+}
+
+// TestGitHub_Login_TeamIDMapping tests that policies can be mapped to a team
+// by its ID and that the matched identifier is reported
+func TestGitHub_Login_TeamIDMapping(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	// Write the config
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	// Map the team by its ID rather than its name or slug
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/id-1",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-id-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, []string{"team-id-policy"}, resp.Auth.Policies)
+	assert.Contains(t, resp.Warnings, `team "foo-team" matched policy mapping "id-1"`)
+
+	// The ID is only used for policy mapping, not as a group alias
+	var aliases []string
+	for _, alias := range resp.Auth.GroupAliases {
+		aliases = append(aliases, alias.Name)
+	}
+	assert.Equal(t, []string{"foo-team"}, aliases)
+}
+
+// TestGitHub_Login_GroupAliasFormat tests that a single group alias is
+// emitted per team in the configured format
+func TestGitHub_Login_GroupAliasFormat(t *testing.T) {
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	tests := []struct {
+		format  string
+		aliases []string
+	}{
+		{format: "name", aliases: []string{"Foo team"}},
+		{format: "slug", aliases: []string{"foo-team"}},
+		{format: "id", aliases: []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			b, s := createBackendWithStorage(t)
+
+			_, err := b.HandleRequest(context.Background(), &logical.Request{
+				Path:      "config",
+				Operation: logical.UpdateOperation,
+				Data: map[string]interface{}{
+					"organization":       "foo-org",
+					"base_url":           ts.URL,
+					"group_alias_format": tt.format,
+				},
+				Storage: s,
+			})
+			assert.NoError(t, err)
+
+			// Policies are mapped by slug regardless of the alias format
+			_, err = b.HandleRequest(context.Background(), &logical.Request{
+				Path:      "map/teams/foo-team",
+				Operation: logical.UpdateOperation,
+				Data: map[string]interface{}{
+					"value": "team-policy",
+				},
+				Storage: s,
+			})
+			assert.NoError(t, err)
+
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Path:      "login",
+				Operation: logical.UpdateOperation,
+				Data: map[string]interface{}{
+					"token": "faketoken",
+				},
+				Storage: s,
+			})
+			assert.NoError(t, err)
+			assert.NoError(t, resp.Error())
+			assert.Equal(t, []string{"team-policy"}, resp.Auth.Policies)
+
+			var aliases []string
+			for _, alias := range resp.Auth.GroupAliases {
+				aliases = append(aliases, alias.Name)
+			}
+			assert.Equal(t, tt.aliases, aliases)
+		})
+	}
+}
+
+// TestGitHub_Login_GroupAliasTeamRename tests that every team gets a group
+// alias carrying its ID, even without a policy mapping, and that aliases by
+// ID survive a rename of the team
+func TestGitHub_Login_GroupAliasTeamRename(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	var renamed atomic.Bool
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if renamed.Load() && strings.Contains(r.URL.Path, "/user/teams") {
+			w.Header().Add("Content-Type", "application/json")
+			resp := strings.ReplaceAll(string(listUserTeamsResponse), "Foo team", "Bar team")
+			fmt.Fprintln(w, strings.ReplaceAll(resp, "foo-team", "bar-team"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":       "foo-org",
+			"base_url":           ts.URL,
+			"group_alias_format": "id",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	login := func() *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+
+	// No policies are mapped to the team
+	resp := login()
+	assert.Len(t, resp.Auth.GroupAliases, 1)
+	assert.Equal(t, "1", resp.Auth.GroupAliases[0].Name)
+	assert.Equal(t, map[string]string{"team_id": "1"}, resp.Auth.GroupAliases[0].Metadata)
+
+	renamed.Store(true)
+	resp = login()
+	assert.Len(t, resp.Auth.GroupAliases, 1)
+	assert.Equal(t, "1", resp.Auth.GroupAliases[0].Name)
+	assert.Equal(t, map[string]string{"team_id": "1"}, resp.Auth.GroupAliases[0].Metadata)
+
+	// Aliases by slug follow the rename, but keep the team ID
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"group_alias_format": "slug",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp = login()
+	assert.Len(t, resp.Auth.GroupAliases, 1)
+	assert.Equal(t, "bar-team", resp.Auth.GroupAliases[0].Name)
+	assert.Equal(t, map[string]string{"team_id": "1"}, resp.Auth.GroupAliases[0].Metadata)
+}
+
+// TestGitHub_Login_TeamBoundCIDRs tests that the policies of team mappings
+// with bound_cidrs are only assigned to logins from those CIDR blocks
+func TestGitHub_Login_TeamBoundCIDRs(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value":       "admin-policy",
+			"bound_cidrs": "not-a-cidr",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "invalid bound_cidrs")
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value":       "admin-policy",
+			"bound_cidrs": "10.0.0.0/8, 192.168.0.0/24",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	login := func(remoteAddr string) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Connection: &logical.Connection{RemoteAddr: remoteAddr},
+			Storage:    s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+
+	resp = login("10.1.2.3")
+	assert.Equal(t, []string{"admin-policy"}, resp.Auth.Policies)
+
+	// Logins from elsewhere succeed without the policies of the mapping
+	resp = login("172.16.0.1")
+	assert.Empty(t, resp.Auth.Policies)
+	assert.Contains(t, resp.Warnings, `policies of mapping "foo-team" dropped, request is not from its bound_cidrs`)
+}
+
+// TestGitHub_Login_TeamMetadata tests that team mappings accept a list of
+// policies, and that their metadata is merged into the token metadata with
+// the first mapping setting a key taking precedence
+func TestGitHub_Login_TeamMetadata(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"metadata": map[string]interface{}{"username": "root"},
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), `metadata key "username" is reserved`)
+
+	mappings := map[string]map[string]interface{}{
+		"foo-team": {
+			"value":    "foo-policy",
+			"policies": []string{"bar-policy", "foo-policy"},
+			"metadata": map[string]interface{}{"env": "prod", "tier": "1"},
+		},
+		"id-1": {
+			"metadata": map[string]interface{}{"tier": "2"},
+		},
+		"default": {
+			"metadata": map[string]interface{}{"env": "dev", "region": "eu"},
+		},
+	}
+	for key, data := range mappings {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "map/teams/" + key,
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+	}
+
+	// Listed policies are stored with those of value
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "bar-policy,foo-policy", resp.Data["value"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, []string{"bar-policy", "foo-policy"}, resp.Auth.Policies)
+	assert.Equal(t, "prod", resp.Auth.Metadata["env"])
+	assert.Equal(t, "1", resp.Auth.Metadata["tier"])
+	assert.Equal(t, "eu", resp.Auth.Metadata["region"])
+	assert.Equal(t, "user-foo", resp.Auth.Metadata["username"])
+	assert.Contains(t, resp.Warnings, `metadata "tier" of mapping "id-1" ignored, already set by mapping "foo-team"`)
+	assert.Contains(t, resp.Warnings, `metadata "env" of mapping "default" ignored, already set by mapping "foo-team"`)
+}
+
+// TestGitHub_Login_UsernameCase tests that the login of the user is
+// normalized to the configured casing in the alias, the username metadata
+// and the user mapping lookup
+func TestGitHub_Login_UsernameCase(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":  "foo-org",
+			"base_url":      ts.URL,
+			"username_case": "title",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "username_case must be one of")
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/users/user-foo",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "user-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	login := func(usernameCase string) *logical.Response {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":  "foo-org",
+				"base_url":      ts.URL,
+				"username_case": usernameCase,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+
+	for usernameCase, want := range map[string]string{
+		"preserve": "user-foo",
+		"lower":    "user-foo",
+		"upper":    "USER-FOO",
+	} {
+		resp := login(usernameCase)
+		assert.Equal(t, want, resp.Auth.Alias.Name, usernameCase)
+		assert.Equal(t, want, resp.Auth.Metadata["username"], usernameCase)
+		assert.Equal(t, want, resp.Auth.DisplayName, usernameCase)
+		assert.Equal(t, []string{"user-policy"}, resp.Auth.Policies, usernameCase)
+	}
+}
+
+// TestGitHub_Login_UserAliasName tests that the entity alias of logins and
+// of alias lookaheads is the configured user identifier
+func TestGitHub_Login_UserAliasName(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	var noEmails atomic.Bool
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/user/emails" && noEmails.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintln(w, `{"message": "Resource not accessible by personal access token"}`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	writeConfig := func(userAliasName string) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":    "foo-org",
+				"base_url":        ts.URL,
+				"user_alias_name": userAliasName,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	login := func(operation logical.Operation) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: operation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	assert.ErrorContains(t, writeConfig("name").Error(), "user_alias_name must be one of")
+
+	// The email is configured last, as it is read back from the config below
+	for _, tt := range []struct {
+		userAliasName string
+		want          string
+	}{
+		{"login", "user-foo"},
+		{"id", "6789"},
+		{"email", "user-foo@example.com"},
+	} {
+		userAliasName, want := tt.userAliasName, tt.want
+		assert.Nil(t, writeConfig(userAliasName))
+
+		resp, err := login(logical.UpdateOperation)
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		assert.Equal(t, want, resp.Auth.Alias.Name, userAliasName)
+		assert.Equal(t, "user-foo", resp.Auth.Metadata["username"], userAliasName)
+		assert.Equal(t, "6789", resp.Auth.Metadata["user_id"], userAliasName)
+
+		lookahead, err := login(logical.AliasLookaheadOperation)
+		assert.NoError(t, err)
+		assert.Equal(t, want, lookahead.Auth.Alias.Name, userAliasName)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "email", resp.Data["user_alias_name"])
+
+	// Users whose email cannot be read are denied rather than identified by
+	// another identifier
+	noEmails.Store(true)
+	_, err = login(logical.UpdateOperation)
+	assert.ErrorContains(t, err, "user email unavailable")
+	_, err = login(logical.AliasLookaheadOperation)
+	assert.ErrorContains(t, err, "user email unavailable")
+}
+
+// TestGitHub_Login_RateLimited tests that a login which stays rate limited
+// after all retries reports the rate limit rather than an auth failure
+func TestGitHub_Login_RateLimited(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	// Write the config, retrying without waiting for the reset window
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":   "foo-org",
+			"base_url":       ts.URL,
+			"max_retries":    2,
+			"max_retry_wait": 0,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": testRateLimitedToken,
+		},
+		Storage: s,
+	})
+	assert.ErrorContains(t, err, "rate limit exceeded and not lifted within the retries")
+
+	var authErr *AuthenticationError
+	assert.False(t, errors.As(err, &authErr))
+}
+
+// TestGitHub_Login_RateLimitWarning tests that logins warn when fewer
+// requests than rate_limit_warning_threshold remain, without failing
+func TestGitHub_Login_RateLimitWarning(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	login := func(threshold int, token string) *logical.Response {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":                 "foo-org",
+				"base_url":                     ts.URL,
+				"rate_limit_warning_threshold": threshold,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": token,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+
+	warning := "GitHub API rate limit low: 42 remaining, resets at 2100-01-01T00:00:00Z"
+	assert.Contains(t, login(100, testLowRateLimitToken).Warnings, warning)
+	assert.NotContains(t, login(42, testLowRateLimitToken).Warnings, warning)
+	assert.NotContains(t, login(0, testLowRateLimitToken).Warnings, warning)
+
+	// Responses that do not report the rate limit are not warned about
+	assert.Empty(t, login(100, "faketoken").Warnings)
+}
+
+// TestGitHub_Login_MembershipCache tests that resolved teams are cached when
+// membership_cache_ttl is set and dropped when the config is rewritten
+func TestGitHub_Login_MembershipCache(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	writeConfig := func(data map[string]interface{}) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+	}
+	writeConfig(map[string]interface{}{
+		"organization":         "foo-org",
+		"base_url":             ts.URL,
+		"membership_cache_ttl": "1h",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	entry, ok := b.membershipCache.entries["12345/user-foo"]
+	assert.True(t, ok)
+	assert.Len(t, entry.teams, 1)
+
+	// Rewriting the config invalidates the cache
+	writeConfig(map[string]interface{}{
+		"membership_cache_ttl": "1h",
+	})
+	assert.Empty(t, b.membershipCache.entries)
+
+	// So does rewriting it on another node
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, b.membershipCache.entries)
+
+	b.invalidate(context.Background(), "config")
+	assert.Empty(t, b.membershipCache.entries)
+}
+
+// TestGitHub_Login_OrganizationCache tests that fetched organizations are
+// cached when organization_cache_ttl is set, refetched when the ID does not
+// match and dropped when the config is rewritten
+func TestGitHub_Login_OrganizationCache(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	writeConfig := func(data map[string]interface{}) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+	}
+	login := func() {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+	}
+	writeConfig(map[string]interface{}{
+		"organization":           "foo-org",
+		"base_url":               ts.URL,
+		"organization_cache_ttl": "1h",
+	})
+
+	login()
+	org := b.organizationCache.get("foo-org/12345")
+	assert.NotNil(t, org)
+	assert.Equal(t, "foo-display-name", org.GetName())
+
+	// Cached organizations are reused by later logins
+	b.organizationCache.put("foo-org/12345", &github.Organization{
+		ID:    github.Int64(12345),
+		Login: github.String("foo-org"),
+		Name:  github.String("cached"),
+	}, time.Hour)
+	login()
+	assert.Equal(t, "cached", b.organizationCache.get("foo-org/12345").GetName())
+
+	// Cached organizations with another ID are fetched again
+	b.organizationCache.put("foo-org/12345", &github.Organization{
+		ID:    github.Int64(9999),
+		Login: github.String("foo-org"),
+	}, time.Hour)
+	login()
+	assert.Equal(t, int64(12345), b.organizationCache.get("foo-org/12345").GetID())
+
+	// Rewriting the config invalidates the cache
+	writeConfig(map[string]interface{}{
+		"organization_cache_ttl": "1h",
+	})
+	assert.Empty(t, b.organizationCache.entries)
+}
+
+// TestGitHub_MembershipCache_Concurrent tests that concurrent lookups of the
+// same user only fetch the teams once, and that a canceled login neither
+// cancels the lookup nor fails the other logins waiting for it
+func TestGitHub_MembershipCache_Concurrent(t *testing.T) {
+	cache := newMembershipCache(time.Now)
+
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) ([]*github.Team, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return []*github.Team{{Name: github.String("foo-team")}}, nil
+	}
+
+	// The login starting the lookup is canceled while waiting for it
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := cache.get(ctx, "12345/user-foo", time.Hour, fetch)
+		canceled <- err
+	}()
+	for atomic.LoadInt32(&fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.ErrorIs(t, <-canceled, context.Canceled)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			teams, err := cache.get(context.Background(), "12345/user-foo", time.Hour, fetch)
+			assert.NoError(t, err)
+			assert.Len(t, teams, 1)
+		}()
+	}
+
+	// Give the lookups time to queue up behind the first one
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// Failed lookups are not cached
+	_, err := cache.get(context.Background(), "12345/user-bar", time.Hour, func(context.Context) ([]*github.Team, error) {
+		return nil, errors.New("boom")
+	})
+	assert.Error(t, err)
+	assert.NotContains(t, cache.entries, "12345/user-bar")
+}
+
+// TestGitHub_MembershipCache_Expired tests that expired teams are removed,
+// including those of users that do not log in again
+func TestGitHub_MembershipCache_Expired(t *testing.T) {
+	now := time.Now()
+	cache := newMembershipCache(func() time.Time { return now })
+	fetch := func(context.Context) ([]*github.Team, error) {
+		return []*github.Team{{Name: github.String("foo-team")}}, nil
+	}
+
+	_, err := cache.get(context.Background(), "12345/user-foo", time.Hour, fetch)
+	assert.NoError(t, err)
+	assert.Contains(t, cache.entries, "12345/user-foo")
+
+	now = now.Add(2 * time.Hour)
+	_, err = cache.get(context.Background(), "12345/user-bar", time.Hour, fetch)
+	assert.NoError(t, err)
+	assert.NotContains(t, cache.entries, "12345/user-foo")
+	assert.Contains(t, cache.entries, "12345/user-bar")
+}
+
+// TestGitHub_GetUserEmail tests that the public email is preferred and that
+// the email is omitted when the token cannot list the user's emails
+func TestGitHub_GetUserEmail(t *testing.T) {
+	b, _ := createBackendWithStorage(t)
+
+	// The token lacks the user:email scope
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	client, err := b.clientForConfig("faketoken", &config{BaseURL: ts.URL + "/"})
+	assert.NoError(t, err)
+
+	user := &github.User{Login: github.String("user-foo")}
+	assert.Equal(t, "", b.getUserEmail(context.Background(), client, user))
+
+	user.Email = github.String("public@example.com")
+	assert.Equal(t, "public@example.com", b.getUserEmail(context.Background(), client, user))
+}
+
+// TestGitHub_Login_RequiredTeams tests that only members of the required
+// teams can log in, matching team names and slugs case-insensitively
+func TestGitHub_Login_RequiredTeams(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	login := func(requiredTeams string) (*logical.Response, error) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":   "foo-org",
+				"base_url":       ts.URL,
+				"required_teams": requiredTeams,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	// The user is a member of foo-team, named "Foo team"
+	for _, requiredTeams := range []string{"", "FOO-TEAM", "platform-admins,foo team"} {
+		resp, err := login(requiredTeams)
+		assert.NoError(t, err, requiredTeams)
+		assert.NoError(t, resp.Error(), requiredTeams)
+	}
+
+	_, err := login("platform-admins")
+	var authErr *AuthenticationError
+	assert.True(t, errors.As(err, &authErr))
+	assert.ErrorContains(t, err, "user is not part of required team")
+}
+
+// TestGitHub_Login_AllowedTeams tests that only members of the allowed teams
+// can authenticate, even when their teams are mapped to policies
+func TestGitHub_Login_AllowedTeams(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "foo-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	login := func(allowedTeams, requiredTeams string) (*logical.Response, error) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":   "foo-org",
+				"base_url":       ts.URL,
+				"allowed_teams":  allowedTeams,
+				"required_teams": requiredTeams,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	// The user is a member of foo-team, named "Foo team"
+	for _, allowedTeams := range []string{"", "FOO-TEAM", "platform-admins,foo-team"} {
+		resp, err := login(allowedTeams, "")
+		assert.NoError(t, err, allowedTeams)
+		assert.NoError(t, resp.Error(), allowedTeams)
+		assert.Equal(t, []string{"foo-policy"}, resp.Auth.Policies, allowedTeams)
+	}
+
+	// Teams are only allowed by slug, and the policy mapping of foo-team
+	// does not allow it
+	for _, allowedTeams := range []string{"platform-admins", "Foo team"} {
+		_, err := login(allowedTeams, "")
+		var authErr *AuthenticationError
+		assert.True(t, errors.As(err, &authErr), allowedTeams)
+		assert.ErrorContains(t, err, "user is not part of allowed team", allowedTeams)
+	}
+
+	// Users must pass both the required and the allowed teams
+	_, err = login("foo-team", "platform-admins")
+	assert.ErrorContains(t, err, "user is not part of required team")
+	_, err = login("platform-admins", "foo-team")
+	assert.ErrorContains(t, err, "user is not part of allowed team")
+}
+
+// TestGitHub_Login_DenyIfNoPolicies tests that users assigned no policies
+// other than default are denied when deny_if_no_policies is set
+func TestGitHub_Login_DenyIfNoPolicies(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	login := func(tokenPolicies string) (*logical.Response, error) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":        "foo-org",
+				"base_url":            ts.URL,
+				"deny_if_no_policies": true,
+				"token_policies":      tokenPolicies,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	// Neither mappings nor the default policy grant anything
+	for _, tokenPolicies := range []string{"", "default"} {
+		_, err := login(tokenPolicies)
+		var authErr *AuthenticationError
+		assert.True(t, errors.As(err, &authErr), tokenPolicies)
+		assert.ErrorContains(t, err, "no policies matched")
+	}
+
+	// Policies configured for every token are granted
+	resp, err := login("config-policy")
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	// So are policies mapped to the teams of the user
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err = login("")
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, []string{"team-policy"}, resp.Auth.Policies)
+}
+
+// TestGitHub_Login_Proxy tests that requests to GitHub are sent through the
+// configured proxy
+func TestGitHub_Login_Proxy(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// The test server acts as the proxy for a GitHub host that does not resolve
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     "http://github.example.invalid/",
+			"proxy_url":    ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "user-foo", resp.Auth.Metadata["username"])
+}
+
+// TestGitHub_Login_Timeout tests that a hung GitHub endpoint fails the login
+// once the request timeout expires
+func TestGitHub_Login_Timeout(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":    "foo-org",
+			"organization_id": 12345,
+			"base_url":        ts.URL,
+			"request_timeout": "1s",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestGitHub_Login_CACert tests that a GitHub Enterprise Server using an
+// internal CA is trusted once its CA certificate is configured
+func TestGitHub_Login_CACert(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	ts := httptest.NewTLSServer(testServerHandler(t))
+	defer ts.Close()
+
+	caCert := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: ts.Certificate().Raw,
+	}))
+
+	login := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	// Without the CA certificate the server is not trusted
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":    "foo-org",
+			"organization_id": 12345,
+			"base_url":        ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	_, err = login()
+	assert.ErrorContains(t, err, "certificate")
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"ca_cert": caCert,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	resp, err := login()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "foo-org", resp.Auth.Metadata["org"])
+
+	// An invalid CA certificate is rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"ca_cert": "not a certificate",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "invalid ca_cert")
+}
+
+// TestGitHub_Login_RoleMapping tests that policies can be mapped to the role
+// of the user in the organization
+func TestGitHub_Login_RoleMapping(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	for role, policy := range map[string]string{"admin": "admin-policy", "member": "member-policy"} {
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "map/roles/" + role,
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"value": policy,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "member", resp.Auth.Metadata["org_role"])
+	assert.Contains(t, resp.Auth.Policies, "member-policy")
+	assert.NotContains(t, resp.Auth.Policies, "admin-policy")
+}
+
+// TestGitHub_Login_OwnerTokenTTL tests that tokens of organization owners
+// are issued and renewed with the owner TTLs while members keep the defaults
+func TestGitHub_Login_OwnerTokenTTL(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":        "foo-org",
+			"base_url":            ts.URL,
+			"token_ttl":           "2h",
+			"token_max_ttl":       "24h",
+			"owner_token_ttl":     "10m",
+			"owner_token_max_ttl": "1h",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	for token, expected := range map[string][2]time.Duration{
+		"faketoken":    {2 * time.Hour, 24 * time.Hour},
+		testOwnerToken: {10 * time.Minute, time.Hour},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": token,
+			},
+			Storage:    s,
+			Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		assert.Equal(t, expected[0], resp.Auth.TTL)
+		assert.Equal(t, expected[1], resp.Auth.MaxTTL)
+
+		// Renewals keep the same TTLs
+		auth := resp.Auth
+		auth.TokenPolicies = auth.Policies
+		auth.TTL, auth.MaxTTL = 0, 0
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:       "login",
+			Operation:  logical.RenewOperation,
+			Auth:       auth,
+			Storage:    s,
+			Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		assert.Equal(t, expected[0], resp.Auth.TTL)
+		assert.Equal(t, expected[1], resp.Auth.MaxTTL)
+	}
+
+	// The owner TTL cannot exceed the owner max TTL
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"owner_token_ttl": "2h",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "owner_token_ttl cannot be greater than owner_token_max_ttl")
+}
+
+// TestGitHub_Login_UserRestrictions tests that denied users cannot log in and
+// that allowed_users restricts logins to the listed users
+func TestGitHub_Login_UserRestrictions(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	login := func(allowedUsers, deniedUsers string) error {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":  "foo-org",
+				"base_url":      ts.URL,
+				"allowed_users": allowedUsers,
+				"denied_users":  deniedUsers,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		return err
+	}
+
+	assert.NoError(t, login("", ""))
+	assert.NoError(t, login("other-user,USER-FOO", "other-user"))
+	assert.ErrorIs(t, login("", "User-Foo"), logical.ErrPermissionDenied)
+	assert.ErrorIs(t, login("other-user", ""), logical.ErrPermissionDenied)
+
+	// Denied users are rejected even if they are allowed
+	assert.ErrorIs(t, login("user-foo", "user-foo"), logical.ErrPermissionDenied)
+}
+
+// TestGitHub_Login_ReturnTeamDetails tests that the resolved teams and their
+// policies are only returned when return_team_details is enabled
+func TestGitHub_Login_ReturnTeamDetails(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "foo-policy,bar-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	login := func(returnTeamDetails bool) *logical.Response {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":        "foo-org",
+				"base_url":            ts.URL,
+				"return_team_details": returnTeamDetails,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+
+	resp := login(false)
+	assert.Nil(t, resp.Data)
+
+	resp = login(true)
+	assert.Equal(t, []string{"Foo team", "foo-team"}, resp.Data["teams"])
+	assert.Equal(t, map[string][]string{
+		"foo-team": {"bar-policy", "foo-policy"},
+	}, resp.Data["team_policies"])
+	assert.Equal(t, []string{"bar-policy", "foo-policy"}, resp.Auth.Policies)
+}
+
+// TestGitHub_Login_GraphQL tests that teams are queried with the GraphQL API
+// when enabled, and listed with the REST API when GraphQL is unavailable
+func TestGitHub_Login_GraphQL(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	for team, policy := range map[string]string{
+		"foo-team":     "rest-policy",
+		"graphql-team": "graphql-policy",
+	} {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "map/teams/" + team,
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"value": policy,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+	}
+
+	login := func(baseURL string, useGraphQL bool) *logical.Response {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization": "foo-org",
+				"base_url":     baseURL,
+				"use_graphql":  useGraphQL,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+
+	resp := login(ts.URL, false)
+	assert.Equal(t, []string{"rest-policy"}, resp.Auth.Policies)
+
+	resp = login(ts.URL, true)
+	assert.Equal(t, []string{"graphql-policy"}, resp.Auth.Policies)
+
+	// GitHub Enterprise Server serves GraphQL at /api/graphql, which the test
+	// server does not
+	resp = login(ts.URL+"/api/v3/", true)
+	assert.Equal(t, []string{"rest-policy"}, resp.Auth.Policies)
+}
+
+// TestGitHub_Login_ResolveParentTeams tests that policies mapped to the
+// ancestors of the teams of the user are granted with resolve_parent_teams,
+// fetching each ancestor once
+func TestGitHub_Login_ResolveParentTeams(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// Both teams of the user are children of platform, itself a child of
+	// engineering
+	userTeams := fmt.Sprintf(`[
+		{"id": 1, "name": "Foo team", "slug": "foo-team", "organization": %[1]v,
+			"parent": {"id": 10, "name": "Platform", "slug": "platform"}},
+		{"id": 2, "name": "Bar team", "slug": "bar-team", "organization": %[1]v,
+			"parent": {"id": 10, "name": "Platform", "slug": "platform"}}
+	]`, getOrgResponse)
+	parentTeams := map[string]string{
+		"/teams/10": `{"id": 10, "name": "Platform", "slug": "platform",
+			"parent": {"id": 20, "name": "Engineering", "slug": "engineering"}}`,
+		"/teams/20": `{"id": 20, "name": "Engineering", "slug": "engineering", "parent": null}`,
+	}
+
+	var lock sync.Mutex
+	fetched := make(map[string]int)
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/user/teams" {
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintln(w, userTeams)
+			return
+		}
+		if team, ok := parentTeams[r.URL.Path]; ok {
+			lock.Lock()
+			fetched[r.URL.Path]++
+			lock.Unlock()
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintln(w, team)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	for team, policy := range map[string]string{
+		"foo-team": "foo-policy",
+		"platform": "platform-policy",
+		"id-20":    "engineering-policy",
+	} {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "map/teams/" + team,
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"value": policy,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+	}
+
+	writeConfig := func(data map[string]interface{}) {
+		t.Helper()
+		data["organization"] = "foo-org"
+		data["base_url"] = ts.URL
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+	}
+	login := func() *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+
+	writeConfig(map[string]interface{}{"resolve_parent_teams": false})
+	resp := login()
+	assert.Equal(t, []string{"foo-policy"}, resp.Auth.Policies)
+	assert.Empty(t, fetched)
+
+	writeConfig(map[string]interface{}{"resolve_parent_teams": true})
+	resp = login()
+	assert.Equal(t, []string{"engineering-policy", "foo-policy", "platform-policy"}, resp.Auth.Policies)
+	assert.Equal(t, map[string]int{"/teams/10": 1, "/teams/20": 1}, fetched)
+
+	// Without the cache, every login fetches the parent teams again
+	login()
+	assert.Equal(t, map[string]int{"/teams/10": 2, "/teams/20": 2}, fetched)
+
+	// With the cache, they are fetched again once it is reset by writing the
+	// config or expires
+	writeConfig(map[string]interface{}{"parent_team_cache_ttl": "1h"})
+	resp = login()
+	assert.Equal(t, []string{"engineering-policy", "foo-policy", "platform-policy"}, resp.Auth.Policies)
+	login()
+	assert.Equal(t, map[string]int{"/teams/10": 3, "/teams/20": 3}, fetched)
+
+	now := time.Now().Add(2 * time.Hour)
+	b.clock = func() time.Time { return now }
+	login()
+	assert.Equal(t, map[string]int{"/teams/10": 4, "/teams/20": 4}, fetched)
+
+	// Group aliases are only created for the teams of the user
+	var aliases []string
+	for _, alias := range resp.Auth.GroupAliases {
+		aliases = append(aliases, alias.Name)
+	}
+	assert.ElementsMatch(t, []string{"foo-team", "bar-team"}, aliases)
+}
+
+// TestGitHub_FetchUserTeamsForOrg_LinkPagination tests that teams on every
+// page are collected when the next page is only linked in the Link header,
+// without a page number
+func TestGitHub_FetchUserTeamsForOrg_LinkPagination(t *testing.T) {
+	b, _ := createBackendWithStorage(t)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("after") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/user/teams?per_page=100&after=cursor1>; rel="next"`, ts.URL))
+			fmt.Fprintf(w, `[{"id": 1, "name": "Foo team", "slug": "foo-team", "organization": %s}]`, getOrgResponse)
+			return
+		}
+		fmt.Fprintf(w, `[{"id": 2, "name": "Bar team", "slug": "bar-team", "organization": %s}]`, getOrgResponse)
+	}))
+	defer ts.Close()
+
+	client, err := b.clientForConfig("faketoken", &config{BaseURL: ts.URL + "/"})
+	assert.NoError(t, err)
+
+	org := &github.Organization{ID: github.Int64(12345), Login: github.String("foo-org")}
+	teams, err := b.fetchUserTeamsForOrg(context.Background(), client, org, defaultPerPage)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Foo team", "foo-team", "Bar team", "bar-team"}, b.extractTeamNames(teams))
+}
+
+// TestGitHub_FetchUserTeamsForOrg_PerPage tests that teams are listed with
+// the given page size and that teams of other organizations are dropped
+func TestGitHub_FetchUserTeamsForOrg_PerPage(t *testing.T) {
+	b, _ := createBackendWithStorage(t)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("per_page"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/user/teams?per_page=1&page=2>; rel="next"`, ts.URL))
+			fmt.Fprintf(w, `[{"id": 1, "name": "Foo team", "slug": "foo-team", "organization": %s}]`, getOrgResponse)
+		case "2":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/user/teams?per_page=1&page=3>; rel="next"`, ts.URL))
+			fmt.Fprintf(w, `[{"id": 2, "name": "Other team", "slug": "other-team", "organization": %s}]`, getOtherOrgResponse)
+		default:
+			fmt.Fprintf(w, `[{"id": 3, "name": "Bar team", "slug": "bar-team", "organization": %s}]`, getOrgResponse)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := b.clientForConfig("faketoken", &config{BaseURL: ts.URL + "/"})
+	assert.NoError(t, err)
+
+	org := &github.Organization{ID: github.Int64(12345), Login: github.String("foo-org")}
+	teams, err := b.fetchUserTeamsForOrg(context.Background(), client, org, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Foo team", "foo-team", "Bar team", "bar-team"}, b.extractTeamNames(teams))
+}
+
+// TestGitHub_Login_RequiredScopes tests that tokens missing a required scope
+// are rejected and that tokens without scopes are accepted with a warning
+func TestGitHub_Login_RequiredScopes(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	login := func(requiredScopes, token string) (*logical.Response, error) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":    "foo-org",
+				"base_url":        ts.URL,
+				"required_scopes": requiredScopes,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": token,
+			},
+			Storage: s,
+		})
+	}
+
+	// read:org is included in the granted admin:org scope
+	resp, err := login("repo,read:org", testScopedToken)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	_, err = login("read:org,user:email", testScopedToken)
+	var authErr *AuthenticationError
+	assert.True(t, errors.As(err, &authErr))
+	assert.ErrorContains(t, err, "user:email")
+	assert.NotContains(t, err.Error(), "read:org")
+
+	// The scopes of this token are unknown
+	resp, err = login("read:org", "faketoken")
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Contains(t, resp.Warnings, "the scopes of the token could not be determined, so required_scopes were not enforced")
+}
+
+// TestGitHub_Login_ResourceOwner tests that fine-grained tokens scoped to
+// another resource owner are denied, and that tokens whose resource owner is
+// unknown are only denied in strict mode
+func TestGitHub_Login_ResourceOwner(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	login := func(strict bool, token string) (*logical.Response, error) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":          "foo-org",
+				"base_url":              ts.URL,
+				"strict_resource_owner": strict,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": token,
+			},
+			Storage: s,
+		})
+	}
+
+	// The fine-grained token is scoped to foo-org
+	resp, err := login(true, testExpiringToken)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	_, err = login(false, testForeignOwnerToken)
+	var authErr *AuthenticationError
+	assert.True(t, errors.As(err, &authErr))
+	assert.ErrorContains(t, err, "token not scoped to organization")
+
+	resp, err = login(false, testUnknownOwnerToken)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Len(t, resp.Warnings, 1)
+	assert.Contains(t, resp.Warnings[0], "the resource owner of the fine-grained token could not be determined")
+
+	_, err = login(true, testUnknownOwnerToken)
+	assert.True(t, errors.As(err, &authErr))
+	assert.ErrorContains(t, err, "token resource owner unknown")
+}
+
+// TestGitHub_Login_TeamFallbackMapping tests that the "*" mapping only
+// applies when none of the user's teams are mapped to policies
+func TestGitHub_Login_TeamFallbackMapping(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	mapTeam := func(team, policy string) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "map/teams/" + team,
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"value": policy,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+	}
+	login := func() *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		return resp
+	}
+
+	mapTeam("default", "default-policy")
+	mapTeam("*", "fallback-policy")
+
+	// The user's only team is not mapped
+	resp := login()
+	assert.Equal(t, []string{"default-policy", "fallback-policy"}, resp.Auth.Policies)
+
+	mapTeam("foo-team", "foo-policy")
+	resp = login()
+	assert.Equal(t, []string{"default-policy", "foo-policy"}, resp.Auth.Policies)
+}
+
+// TestGitHub_RevalidationInterval tests that the sessions of active tokens
+// are revalidated in the background every revalidation_interval, and that
+// tokens of users that are no longer members are denied renewal
+func TestGitHub_RevalidationInterval(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+	now := time.Now()
+	b.clock = func() time.Time { return now }
+
+	var removed, rateLimited atomic.Bool
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/orgs/foo-org/memberships/") {
+			switch {
+			case rateLimited.Load():
+				w.Header().Set(headerRateRemaining, "0")
+				w.Header().Set(headerRateReset, fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+				w.WriteHeader(403)
+				fmt.Fprintln(w, `{"message": "API rate limit exceeded for user ID 1."}`)
+				return
+			case removed.Load():
+				w.WriteHeader(404)
+				fmt.Fprintln(w, `{"message": "Not Found"}`)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	writeConfig := func(interval string) {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"organization":          "foo-org",
+				"base_url":              ts.URL,
+				"token_ttl":             "1h",
+				"revalidation_interval": interval,
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, resp)
+	}
+	writeConfig("5m")
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/default",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "test-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	// The TTL is left as configured
+	loginResp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, loginResp.Error())
+	assert.Equal(t, time.Hour, loginResp.Auth.TTL)
+	assert.NotEmpty(t, loginResp.Auth.InternalData["session_id"])
+
+	renew := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.RenewOperation,
+			Storage:   s,
+			Auth: &logical.Auth{
+				InternalData:  loginResp.Auth.InternalData,
+				TokenPolicies: loginResp.Auth.Policies,
+				DisplayName:   loginResp.Auth.DisplayName,
+			},
+		})
+	}
+	sweep := func() {
+		t.Helper()
+		now = now.Add(5 * time.Minute)
+		assert.NoError(t, b.periodicFunc(context.Background(), &logical.Request{Storage: s}))
+	}
+	revoked := func() bool {
+		t.Helper()
+		sess, err := getSession(context.Background(), s, loginResp.Auth.InternalData["session_id"].(string))
+		assert.NoError(t, err)
+		assert.NotNil(t, sess)
+		return sess.Revoked
+	}
+
+	// Active members keep their session
+	sweep()
+	assert.False(t, revoked())
+	resp, err := renew()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, resp.Auth.TTL)
+
+	// Rate limited sweeps are skipped rather than revoking the session
+	rateLimited.Store(true)
+	sweep()
+	assert.False(t, revoked())
+	rateLimited.Store(false)
+
+	// Sweeps do not run more often than the interval
+	removed.Store(true)
+	assert.NoError(t, b.periodicFunc(context.Background(), &logical.Request{Storage: s}))
+	assert.False(t, revoked())
+
+	// Removed members have their session revoked, which denies renewals
+	// even once they are added back
+	sweep()
+	assert.True(t, revoked())
+	removed.Store(false)
+	_, err = renew()
+	assert.ErrorContains(t, err, "session revoked")
+
+	// Disabling revalidation removes the sessions and their GitHub tokens
+	writeConfig("0")
+	assert.NoError(t, b.periodicFunc(context.Background(), &logical.Request{Storage: s}))
+	ids, err := s.List(context.Background(), sessionPrefix)
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+	_, err = renew()
+	assert.NoError(t, err)
+}
+
+// TestGitHub_Login_Enterprise tests that members of the configured enterprise
+// are accepted even without an explicit membership of the organization
+func TestGitHub_Login_Enterprise(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	var licenseRequests int
+	var membership string
+	var otherUser bool
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/consumed-licenses") {
+			licenseRequests++
+		}
+		if otherUser && r.URL.Path == "/user" {
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintln(w, `{"login": "user-baz", "id": 1234}`)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/orgs/bar-org/memberships/") {
+			switch membership {
+			case "pending":
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprintln(w, `{"state": "pending", "role": "member"}`)
+				return
+			case "forbidden":
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintln(w, `{"message": "Must have admin rights"}`)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	writeConfig := func(data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	login := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	// The members of the enterprise are only visible to its owners
+	resp := writeConfig(map[string]interface{}{
+		"organization":    "bar-org",
+		"enterprise_slug": "foo-enterprise",
+		"base_url":        ts.URL,
+	})
+	assert.ErrorContains(t, resp.Error(), "enterprise_token is required")
+
+	// The user is not an explicit member of bar-org
+	resp = writeConfig(map[string]interface{}{
+		"organization":     "bar-org",
+		"enterprise_slug":  "foo-enterprise",
+		"enterprise_token": testEnterpriseToken,
+		"base_url":         ts.URL,
+	})
+	assert.Nil(t, resp)
+
+	resp, err := login()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "bar-org", resp.Auth.Metadata["org"])
+	assert.NotContains(t, resp.Auth.Metadata, "org_role")
+	assert.Contains(t, strings.Join(resp.Warnings, "\n"), "membership is implied by enterprise")
+
+	// The members of the enterprise are cached, and the token is never
+	// returned
+	_, err = login()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, licenseRequests)
+
+	// Users missing from the cached members are denied without listing
+	// the members again
+	otherUser = true
+	_, err = login()
+	assert.ErrorContains(t, err, "user is not part of required enterprise")
+	assert.Equal(t, 1, licenseRequests)
+	otherUser = false
+
+	// Membership is only implied for users that are not members, not for
+	// pending memberships or memberships that cannot be read
+	var authErr *AuthenticationError
+	membership = "pending"
+	_, err = login()
+	assert.ErrorAs(t, err, &authErr)
+	assert.Equal(t, "user membership not active", authErr.Reason)
+
+	membership = "forbidden"
+	_, err = login()
+	assert.ErrorAs(t, err, &authErr)
+	assert.Equal(t, "insufficient permissions", authErr.Reason)
+	membership = ""
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(defaultEnterpriseCacheTTL.Seconds()), resp.Data["enterprise_cache_ttl"])
+	assert.NotContains(t, resp.Data, "enterprise_token")
+
+	// Tokens of users that are not owners of the enterprise are denied
+	resp = writeConfig(map[string]interface{}{
+		"enterprise_token": "faketoken",
+	})
+	assert.Nil(t, resp)
+
+	_, err = login()
+	assert.ErrorAs(t, err, &authErr)
+	assert.Equal(t, "insufficient permissions", authErr.Reason)
+	assert.Equal(t, 2, licenseRequests)
+
+	// Users must be a member of the enterprise
+	resp = writeConfig(map[string]interface{}{
+		"enterprise_slug":  "bar-enterprise",
+		"enterprise_token": testEnterpriseToken,
+	})
+	assert.Nil(t, resp)
+
+	_, err = login()
+	assert.ErrorContains(t, err, "enterprise not found")
+
+	// Invalid slugs are rejected
+	resp = writeConfig(map[string]interface{}{
+		"enterprise_slug": "-foo",
+	})
+	assert.ErrorContains(t, resp.Error(), "invalid enterprise_slug")
+}
+
+// TestGitHub_Login_AliasLookahead tests that the alias lookahead only gets
+// the user, while the login still verifies the membership
+func TestGitHub_Login_AliasLookahead(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	var paths []string
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	// The user is not a member of bar-org
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":  "bar-org",
+			"base_url":      ts.URL,
+			"username_case": "lower",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	login := &logical.Request{
+		Path:      "login",
+		Operation: logical.AliasLookaheadOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	}
+	paths = nil
+	resp, err = b.HandleRequest(context.Background(), login)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-foo", resp.Auth.Alias.Name)
+	assert.Equal(t, []string{"/user"}, paths)
+
+	login.Operation = logical.UpdateOperation
+	_, err = b.HandleRequest(context.Background(), login)
+	assert.ErrorContains(t, err, "user is not part of required org")
+}
+
+// TestGitHub_Login_Suspended tests that suspended users are denied even
+// though their membership is active
+func TestGitHub_Login_Suspended(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/user" {
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintln(w, `{"login": "user-foo", "id": 6789, "suspended_at": "2024-01-01T00:00:00Z"}`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	var authErr *AuthenticationError
+	assert.ErrorAs(t, err, &authErr)
+	assert.Equal(t, "user is suspended", authErr.Reason)
+}
+
+// TestGitHub_Login_RequireSAMLIdentity tests that enterprise users without a
+// SAML identity are only denied when require_saml_identity is set
+func TestGitHub_Login_RequireSAMLIdentity(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	writeConfig := func(data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	login := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	// The enterprise is required to look up SAML identities
+	resp := writeConfig(map[string]interface{}{
+		"organization":          "foo-org",
+		"base_url":              ts.URL,
+		"require_saml_identity": true,
+	})
+	assert.ErrorContains(t, resp.Error(), "require_saml_identity requires enterprise_slug")
+
+	// user-foo has no SAML identity, which is accepted by default
+	resp = writeConfig(map[string]interface{}{
+		"organization":     "foo-org",
+		"base_url":         ts.URL,
+		"enterprise_slug":  "foo-enterprise",
+		"enterprise_token": testEnterpriseToken,
+	})
+	assert.Nil(t, resp)
+
+	resp, err := login()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	resp = writeConfig(map[string]interface{}{
+		"require_saml_identity": true,
+	})
+	assert.Nil(t, resp)
+
+	_, err = login()
+	var authErr *AuthenticationError
+	assert.ErrorAs(t, err, &authErr)
+	assert.Equal(t, "user has no SAML identity", authErr.Reason)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, true, resp.Data["require_saml_identity"])
+}
+
+// TestGitHub_Login_PrivateMembership tests that users whose membership is
+// private are only accepted when allow_private_membership is set
+func TestGitHub_Login_PrivateMembership(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// The membership of the user cannot be read, but foo-org is listed
+	// among the organizations of the user
+	handler := testServerHandler(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/orgs/foo-org/memberships/") {
+			w.WriteHeader(404)
+			fmt.Fprintln(w, `{"message": "Not Found"}`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	writeConfig := func(data map[string]interface{}) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, resp)
+	}
+	login := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+
+	writeConfig(map[string]interface{}{
+		"organization": "foo-org",
+		"base_url":     ts.URL,
+	})
+	_, err := login()
+	assert.ErrorContains(t, err, "user is not part of required org")
+
+	writeConfig(map[string]interface{}{
+		"allow_private_membership": true,
+	})
+	resp, err := login()
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "foo-org", resp.Auth.Metadata["org"])
+	assert.NotContains(t, resp.Auth.Metadata, "org_role")
+
+	// Organizations the user is not listed in are still rejected
+	writeConfig(map[string]interface{}{
+		"organization":    "bar-org",
+		"organization_id": 67890,
+	})
+	_, err = login()
+	assert.ErrorContains(t, err, "user is not part of required org")
+}
+
+// TestGitHub_Login_Logging tests that login decisions are logged with the
+// user, organization and GitHub request ID, but never the token
+func TestGitHub_Login_Logging(t *testing.T) {
+	var buf bytes.Buffer
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.Logger = hclog.New(&hclog.LoggerOptions{
+		Output:     &buf,
+		Level:      hclog.Trace,
+		JSONFormat: true,
+	})
+	b := Backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	s := config.StorageView
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	login := func(org string) {
+		if org != "" {
+			_, err := b.HandleRequest(context.Background(), &logical.Request{
+				Path:      "config",
+				Operation: logical.UpdateOperation,
+				Data: map[string]interface{}{
+					"organization": org,
+				},
+				Storage: s,
+			})
+			assert.NoError(t, err)
+		}
+		buf.Reset()
+		_, _ = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+	}
+	entries := func() map[string]map[string]interface{} {
+		assert.NotContains(t, buf.String(), "faketoken")
+		result := make(map[string]map[string]interface{})
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var entry map[string]interface{}
+			assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+			result[entry["@message"].(string)] = entry
+		}
+		return result
+	}
+
+	login("")
+	logs := entries()
+	assert.Contains(t, logs, "configuration loaded")
+	assert.Equal(t, testRequestID, logs["authenticated GitHub user"]["request_id"])
+	assert.Contains(t, logs, "teams resolved")
+	authorized := logs["login authorized"]
+	assert.Equal(t, "user-foo", authorized["user"])
+	assert.Equal(t, "foo-org", authorized["org"])
+
+	// The user is not a member of bar-org
+	login("bar-org")
+	denied := entries()["login denied, organization membership not verified"]
+	assert.Equal(t, "user-foo", denied["user"])
+	assert.Equal(t, "bar-org", denied["org"])
+}
+
+// TestGitHub_Login_OIDC tests the login of GitHub Actions workflows with
+// their OIDC token
+func TestGitHub_Login_OIDC(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"}},
+		})
+	}))
+	defer jwks.Close()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	assert.NoError(t, err)
+	sign := func(audience, repository, workflow string, expiry time.Time) string {
+		owner, _, _ := strings.Cut(repository, "/")
+		token, err := jwt.Signed(signer).Claims(jwt.Claims{
+			Issuer:   defaultOIDCIssuer,
+			Subject:  "repo:" + repository + ":ref:refs/heads/main",
+			Audience: jwt.Audience{audience},
+			IssuedAt: jwt.NewNumericDate(expiry.Add(-5 * time.Minute)),
+			Expiry:   jwt.NewNumericDate(expiry),
+		}).Claims(map[string]interface{}{
+			"repository":       repository,
+			"repository_owner": owner,
+			"workflow":         workflow,
+			"ref":              "refs/heads/main",
+			"environment":      "production",
+		}).Serialize()
+		assert.NoError(t, err)
+		return token
+	}
+	login := func(token string) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"oidc_token": token,
+			},
+			Storage:    s,
+			Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		})
+	}
+	valid := time.Now().Add(5 * time.Minute)
+
+	// Logins are denied until OIDC logins are configured
+	_, err = login(sign("openbao", "foo-org/deploy", "release", valid))
+	assert.ErrorContains(t, err, "OIDC login not configured")
+
+	// The tokens must be bound to known owners or repositories
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config/oidc",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"jwks_url":        jwks.URL,
+			"bound_audiences": "openbao",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config/oidc",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"jwks_url":                jwks.URL,
+			"bound_audiences":         "openbao",
+			"bound_repository_owners": "foo-org",
+			"repository_policies":     map[string]interface{}{"foo-org/deploy": "deploy,release"},
+			"claim_mappings":          map[string]interface{}{"environment": "environment"},
+			"token_policies":          "ci",
+			"token_ttl":               "10m",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = login(sign("openbao", "foo-org/deploy", "release", valid))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ci", "deploy", "release"}, resp.Auth.Policies)
+	assert.Equal(t, "repo:foo-org/deploy:ref:refs/heads/main", resp.Auth.Alias.Name)
+	assert.Equal(t, "foo-org/deploy", resp.Auth.DisplayName)
+	assert.Equal(t, 10*time.Minute, resp.Auth.TTL)
+	assert.Equal(t, map[string]string{
+		"repository":       "foo-org/deploy",
+		"repository_owner": "foo-org",
+		"workflow":         "release",
+		"ref":              "refs/heads/main",
+		"environment":      "production",
+	}, resp.Auth.Metadata)
+
+	// The token is renewed as long as the configuration grants the same
+	// policies
+	renew := func() (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.RenewOperation,
+			Storage:   s,
+			Auth: &logical.Auth{
+				InternalData:  resp.Auth.InternalData,
+				Policies:      resp.Auth.Policies,
+				TokenPolicies: resp.Auth.Policies,
+				Metadata:      resp.Auth.Metadata,
+				LeaseOptions: logical.LeaseOptions{
+					TTL:       resp.Auth.TTL,
+					Renewable: true,
+				},
+			},
+		})
+	}
+	renewResp, err := renew()
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, renewResp.Auth.TTL)
+
+	// Other repositories get the token policies only
+	otherResp, err := login(sign("openbao", "foo-org/other", "release", valid))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ci"}, otherResp.Auth.Policies)
+
+	// Tokens of other owners, for other audiences or expired are denied
+	_, err = login(sign("openbao", "bar-org/deploy", "release", valid))
+	assert.ErrorContains(t, err, "repository not allowed")
+	_, err = login(sign("other", "foo-org/deploy", "release", valid))
+	assert.ErrorContains(t, err, "OIDC token audience not allowed")
+	_, err = login(sign("openbao", "foo-org/deploy", "release", time.Now().Add(-time.Minute)))
+	assert.ErrorContains(t, err, "invalid OIDC token")
+
+	// Tokens are not accepted together with personal access tokens
+	resp2, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token":      "faketoken",
+			"oidc_token": sign("openbao", "foo-org/deploy", "release", valid),
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp2.IsError())
+
+	// Binding the workflows denies the others, including the renewal of
+	// tokens issued to them before
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config/oidc",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"bound_workflows": "deploy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	_, err = login(sign("openbao", "foo-org/deploy", "release", valid))
+	assert.ErrorContains(t, err, "workflow not allowed")
+	_, err = renew()
+	assert.ErrorContains(t, err, "no longer in bound_workflows")
+
+	// Tokens whose policies changed are denied renewal as well
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config/oidc",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"bound_workflows":     "release",
+			"repository_policies": map[string]interface{}{"foo-org/deploy": "deploy"},
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	_, err = renew()
+	assert.ErrorContains(t, err, "policies do not match")
+}
+
+// TestGitHub_Login_AnyOrg tests that users of any organization are accepted
+// with allow_any_org, by their first active organization membership
+func TestGitHub_Login_AnyOrg(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	config := func(data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// The organization is required unless allow_any_org is set
+	resp := config(map[string]interface{}{"base_url": ts.URL})
+	assert.True(t, resp.IsError())
+	resp = config(map[string]interface{}{"base_url": ts.URL, "allow_any_org": true, "organizations": "bar-org"})
+	assert.True(t, resp.IsError())
+	resp = config(map[string]interface{}{
+		"base_url":        ts.URL,
+		"allow_any_org":   true,
+		"app_id":          1234,
+		"installation_id": 42,
+		"private_key":     testAppPrivateKey(t),
+	})
+	assert.True(t, resp.IsError())
+	assert.Contains(t, resp.Error().Error(), "organization is required in GitHub App mode")
+
+	resp = config(map[string]interface{}{"base_url": ts.URL, "allow_any_org": true})
+	assert.Nil(t, resp)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "", resp.Data["organization"])
+	assert.Equal(t, true, resp.Data["allow_any_org"])
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	// The pending membership of bar-org is skipped, and the teams of the
+	// selected organization are mapped
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo-org", resp.Auth.Metadata["org"])
+	assert.Contains(t, resp.Auth.Policies, "team-policy")
+
+	// Renewals are denied once another organization is selected
+	renewReq := &logical.Request{
+		Path:      "login",
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Auth: &logical.Auth{
+			InternalData:  resp.Auth.InternalData,
+			Policies:      resp.Auth.Policies,
+			TokenPolicies: resp.Auth.Policies,
+			Metadata:      map[string]string{"org": "bar-org", "username": "user-foo"},
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       time.Hour,
+				Renewable: true,
+			},
+		},
+	}
+	_, err = b.HandleRequest(context.Background(), renewReq)
+	assert.ErrorContains(t, err, "organization changed")
+
+	renewReq.Auth.Metadata = resp.Auth.Metadata
+	_, err = b.HandleRequest(context.Background(), renewReq)
+	assert.NoError(t, err)
+
+	// Setting the organization restores the membership check
+	resp = config(map[string]interface{}{"organization": "bar-org"})
+	assert.Nil(t, resp)
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.Error(t, err)
+}
+
+// TestGitHub_Login_BasePolicies tests that base_policies are granted to
+// verified members on login and renewal
+func TestGitHub_Login_BasePolicies(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":  "foo-org",
+			"base_url":      ts.URL,
+			"base_policies": "read-only,Team-Policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"read-only", "team-policy"}, resp.Data["base_policies"])
+
+	login := &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	}
+	resp, err = b.HandleRequest(context.Background(), login)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"team-policy", "read-only"}, resp.Auth.Policies)
+
+	// The base policies are granted again on renewal
+	renewResp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Auth: &logical.Auth{
+			InternalData:  resp.Auth.InternalData,
+			Policies:      resp.Auth.Policies,
+			TokenPolicies: resp.Auth.Policies,
+			Metadata:      resp.Auth.Metadata,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       time.Hour,
+				Renewable: true,
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, renewResp.Auth)
+
+	// The alias lookahead does not grant policies
+	login.Operation = logical.AliasLookaheadOperation
+	resp, err = b.HandleRequest(context.Background(), login)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Auth.Policies)
+
+	// Users whose membership is not verified are denied despite the base
+	// policies
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "bar-org",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	login.Operation = logical.UpdateOperation
+	_, err = b.HandleRequest(context.Background(), login)
+	assert.Error(t, err)
+}
+
+// TestGitHub_Login_Metrics tests that logins emit their duration, the GitHub
+// API calls they made by endpoint and the remaining rate limit
+func TestGitHub_Login_Metrics(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	sink := metrics.NewInmemSink(time.Hour, time.Hour)
+	metricsConfig := metrics.DefaultConfig("")
+	metricsConfig.EnableHostname = false
+	metricsConfig.EnableRuntimeMetrics = false
+	m, err := metrics.New(metricsConfig, sink)
+	assert.NoError(t, err)
+	b.metrics = m
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": testLowRateLimitToken,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	data := sink.Data()
+	assert.Len(t, data, 1)
+	counters := data[0].Counters
+	assert.Equal(t, 1, counters["github.login.api_calls;endpoint=user"].Count)
+	assert.Equal(t, float64(1), counters["github.login.api_calls;endpoint=user"].Sum)
+	assert.Contains(t, counters, "github.login.api_calls;endpoint=teams")
+
+	var total float64
+	for key, counter := range counters {
+		if strings.HasPrefix(key, "github.login.api_calls;") {
+			total += counter.Sum
+		}
+	}
+	samples := data[0].Samples
+	assert.Equal(t, 1, samples["github.login.api_calls_per_request"].Count)
+	assert.Equal(t, total, samples["github.login.api_calls_per_request"].Sum)
+	assert.Equal(t, 1, samples["github.login.duration"].Count)
+	assert.Equal(t, float32(42), data[0].Gauges["github.rate_limit.remaining"].Value)
+}
+
+// TestAPIEndpoint tests that the requests to the GitHub API are labeled by
+// the kind of endpoint
+func TestAPIEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"/user":                               "user",
+		"/api/v3/user":                        "user",
+		"/user/emails":                        "emails",
+		"/user/teams":                         "teams",
+		"/orgs/foo-org/teams":                 "teams",
+		"/teams/1/memberships/user-foo":       "team_membership",
+		"/orgs/foo-org/memberships/user-foo":  "membership",
+		"/user/memberships/orgs/foo-org":      "membership",
+		"/orgs/foo-org":                       "organization",
+		"/organizations/12345":                "organization",
+		"/enterprises/foo/consumed-licenses":  "enterprise",
+		"/graphql":                            "graphql",
+		"/api/graphql":                        "graphql",
+		"/app/installations/42/access_tokens": "app",
+		"/scim/v2/organizations/o/Users/1":    "scim",
+		"/teams/7":                            "team",
+		"/rate_limit":                         "other",
+	}
+	for path, endpoint := range tests {
+		assert.Equal(t, endpoint, apiEndpoint(path), path)
+	}
+}
+
+// TestGitHub_TestLogin tests that test/login reports what a login would be
+// granted without issuing a token, and that it requires authentication
+func TestGitHub_TestLogin(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization":   "foo-org",
+			"base_url":       ts.URL,
+			"token_policies": "base-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "team-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	testLogin := func() *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "test/login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		assert.Nil(t, resp.Auth)
+		return resp
+	}
+
+	resp := testLogin()
+	assert.Equal(t, true, resp.Data["authorized"])
+	assert.Equal(t, "user-foo", resp.Data["username"])
+	assert.Equal(t, "foo-org", resp.Data["org"])
+	assert.Equal(t, []string{"Foo team", "foo-team"}, resp.Data["teams"])
+	assert.Equal(t, []string{"foo-team"}, resp.Data["group_aliases"])
+	assert.Equal(t, []string{"base-policy", "team-policy"}, resp.Data["policies"])
+
+	// Denied logins are reported rather than returned as errors
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"denied_users": "user-foo",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp = testLogin()
+	assert.Equal(t, false, resp.Data["authorized"])
+	assert.NotEmpty(t, resp.Data["error"])
+
+	assert.NotContains(t, b.SpecialPaths().Unauthenticated, "test/login")
+}
+
+// TestGitHub_TestLogin_DryRun tests that test/login neither stores changes to
+// the configuration nor fills the caches
+func TestGitHub_TestLogin_DryRun(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	testLogin := func(config config) *logical.Response {
+		t.Helper()
+		entry, err := logical.StorageEntryJSON("config", config)
+		assert.NoError(t, err)
+		assert.NoError(t, s.Put(ctx, entry))
+
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Path:      "test/login",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"token": "faketoken",
+			},
+			Storage: s,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Error())
+		assert.Equal(t, true, resp.Data["authorized"])
+		return resp
+	}
+
+	// The organization has been renamed since it was configured
+	resp := testLogin(config{
+		Organization:         "old-name",
+		OrganizationID:       12345,
+		BaseURL:              ts.URL + "/",
+		MembershipCacheTTL:   time.Hour,
+		OrganizationCacheTTL: time.Hour,
+	})
+	assert.Equal(t, "foo-org", resp.Data["org"])
+	assert.Contains(t, resp.Warnings,
+		`organization "old-name" with ID 12345 has been renamed to "foo-org", the configuration will be updated on the next login`)
+
+	stored, err := b.Config(ctx, s)
+	assert.NoError(t, err)
+	assert.Equal(t, "old-name", stored.Organization)
+	assert.Empty(t, b.membershipCache.entries)
+	assert.Empty(t, b.organizationCache.entries)
+
+	// The organization ID is only fetched for the dry run
+	testLogin(config{
+		Organization:          "foo-org",
+		BaseURL:               ts.URL + "/",
+		AutoSetOrganizationID: true,
+	})
+
+	stored, err = b.Config(ctx, s)
+	assert.NoError(t, err)
+	assert.Zero(t, stored.OrganizationID)
+}
+
+func TestGitHub_Login_WrappedToken(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	// Each wrapping token can only be unwrapped once, and is authenticated
+	// by itself
+	wrapped := map[string]string{
+		"wrapping-token":       `{"data": {"token": "faketoken"}}`,
+		"wrapping-token-empty": `{"data": {"other": "value"}}`,
+	}
+	var lock sync.Mutex
+	openbao := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v1/sys/wrapping/unwrap" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		body, ok := wrapped[r.Header.Get("X-Vault-Token")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, `{"errors": ["wrapping token is not valid or does not exist"]}`)
+			return
+		}
+		delete(wrapped, r.Header.Get("X-Vault-Token"))
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintln(w, body)
+	}))
+	defer openbao.Close()
+
+	login := func(data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "login",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+	}
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"organization": "foo-org",
+			"base_url":     ts.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	// Wrapped tokens are rejected until unwrap_address is configured
+	_, err = login(map[string]interface{}{"wrapped_token": "wrapping-token"})
+	assert.ErrorContains(t, err, "unwrap_address must be configured")
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"unwrap_address": "not a url",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "invalid unwrap_address")
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"unwrap_address": openbao.URL,
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err = login(map[string]interface{}{
+		"token":         "faketoken",
+		"wrapped_token": "wrapping-token",
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "only one of token and wrapped_token can be provided")
+
+	// The alias is only known once the login unwraps the token
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.AliasLookaheadOperation,
+		Data:      map[string]interface{}{"wrapped_token": "wrapping-token"},
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	resp, err = login(map[string]interface{}{"wrapped_token": "wrapping-token"})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, "user-foo", resp.Auth.Metadata["username"])
+	assert.Equal(t, "faketoken", resp.Auth.InternalData["token"])
+
+	// The wrapping token cannot be used again
+	_, err = login(map[string]interface{}{"wrapped_token": "wrapping-token"})
+	assert.ErrorContains(t, err, "invalid wrapped token")
+
+	_, err = login(map[string]interface{}{"wrapped_token": "wrapping-token-empty"})
+	assert.ErrorContains(t, err, "does not wrap a GitHub token")
+}
+
+// TestGitHub_Login_NoMembershipCheck tests that any GitHub user is granted
+// only the base policies when membership_check is none, and that settings
+// depending on the organization are rejected
+func TestGitHub_Login_NoMembershipCheck(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// use a test server to return our mock GH org info
+	ts := setupTestServer(t)
+	defer ts.Close()
+
+	writeConfig := func(data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "config",
+			Operation: logical.UpdateOperation,
+			Data:      data,
+			Storage:   s,
+		})
+	}
+
+	resp, err := writeConfig(map[string]interface{}{
+		"organization":  "foo-org",
+		"base_url":      ts.URL,
+		"base_policies": "read-only",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "map/teams/foo-team",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"value": "foo-policy",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+
+	resp, err = writeConfig(map[string]interface{}{"membership_check": "sometimes"})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "membership_check must be one of")
+
+	// The organization must be cleared explicitly
+	resp, err = writeConfig(map[string]interface{}{
+		"membership_check": "none",
+		"required_teams":   "foo-team",
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "cannot be combined with settings that depend on the organization: organization, required_teams")
+
+	resp, err = writeConfig(map[string]interface{}{
+		"membership_check": "none",
+		"organization":     "",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Contains(t, resp.Warnings, noMembershipCheckWarning)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "config",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "none", resp.Data["membership_check"])
+
+	// Only the base policies are granted, not those of the user's teams
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "login",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"token": "faketoken",
+		},
+		Storage: s,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Error())
+	assert.Equal(t, []string{"read-only"}, resp.Auth.Policies)
+	assert.Equal(t, "user-foo", resp.Auth.Metadata["username"])
+	assert.NotContains(t, resp.Auth.Metadata, "org")
+	assert.Empty(t, resp.Auth.GroupAliases)
+	assert.Contains(t, resp.Warnings, noMembershipCheckWarning)
+
+	// Checking the membership again requires an organization
+	resp, err = writeConfig(map[string]interface{}{"membership_check": "organization"})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, resp.Error(), "organization is a required parameter")
+}
@@ -0,0 +1,140 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/helper/policyutil"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+func pathTestLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "test/login",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixGithub,
+			OperationVerb:   "test",
+			OperationSuffix: "login",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"token": {
+				Type:        framework.TypeString,
+				Description: "GitHub personal API token to test",
+				Required:    true,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathTestLoginWrite,
+			},
+		},
+
+		HelpSynopsis:    pathTestLoginHelpSyn,
+		HelpDescription: pathTestLoginHelpDesc,
+	}
+}
+
+// pathTestLoginWrite resolves a token like a login does, but only reports
+// the user, organization, teams and policies it would be granted without
+// issuing a token or storing anything. Denied logins are reported in the
+// response data.
+func (b *backend) pathTestLoginWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	token := data.Get("token").(string)
+	if token == "" {
+		return logical.ErrorResponse("token is required"), nil
+	}
+
+	verifyResp, err := b.verifyCredentials(ctx, req, token, true)
+	if err != nil {
+		var authErr *AuthenticationError
+		if !errors.As(err, &authErr) && !errors.Is(err, logical.ErrPermissionDenied) {
+			return nil, err
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"authorized": false,
+				"error":      err.Error(),
+			},
+		}, nil
+	}
+
+	aliasName, err := verifyResp.aliasName()
+	if err != nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"authorized": false,
+				"error":      err.Error(),
+			},
+		}, nil
+	}
+
+	config := verifyResp.Config
+	policies := policyutil.SanitizePolicies(append(slices.Clone(config.TokenPolicies), verifyResp.Policies...), false)
+
+	var groupAliases []string
+	for _, alias := range verifyResp.GroupAliases {
+		groupAliases = append(groupAliases, alias.Name)
+	}
+
+	status := map[string]interface{}{
+		"authorized":    true,
+		"username":      config.normalizeUsername(verifyResp.User.GetLogin()),
+		"alias":         aliasName,
+		"org":           verifyResp.Org.GetLogin(),
+		"teams":         verifyResp.TeamNames,
+		"team_policies": verifyResp.TeamPolicies,
+		"group_aliases": groupAliases,
+		"policies":      policies,
+	}
+	if verifyResp.OrgRole != "" {
+		status["org_role"] = verifyResp.OrgRole
+	}
+	if verifyResp.User.ID != nil {
+		status["user_id"] = strconv.FormatInt(verifyResp.User.GetID(), 10)
+	}
+	if verifyResp.ExternalID != "" {
+		status["scim_external_id"] = verifyResp.ExternalID
+	}
+	if !verifyResp.TokenExpiration.IsZero() {
+		status["token_expiration"] = verifyResp.TokenExpiration.Format(time.RFC3339)
+	}
+
+	return &logical.Response{
+		Data:     status,
+		Warnings: verifyResp.Warnings,
+	}, nil
+}
+
+type dryRunKey struct{}
+
+// withDryRun returns a context for the requests of a dry run login, which must
+// not store changes to the configuration or touch the caches
+func withDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// isDryRun reports whether the context belongs to a dry run login
+func isDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+const pathTestLoginHelpSyn = `
+Check how a GitHub token would log in, without logging in
+`
+
+const pathTestLoginHelpDesc = `
+This path resolves a GitHub personal access token like a login does, and
+returns the user, organization, teams, group aliases and policies the login
+would be granted. No token is issued, no lease is created, and neither the
+configuration nor the caches are updated. Logins that
+would be denied are reported with authorized set to false and the reason in
+error. Unlike login, this path requires authentication.
+`
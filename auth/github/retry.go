@@ -0,0 +1,277 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// defaultMaxRetries is how often a rate limited request is retried
+	// unless configured otherwise
+	defaultMaxRetries = 3
+
+	// defaultMaxRetryWait bounds how long to wait before retrying a rate
+	// limited request unless configured otherwise
+	defaultMaxRetryWait = 10 * time.Second
+
+	// defaultRateLimitWarningThreshold is the number of remaining requests
+	// below which logins warn about the rate limit unless configured
+	// otherwise
+	defaultRateLimitWarningThreshold = 100
+
+	// Headers GitHub reports the rate limit of the token in
+	headerRateRemaining = "X-RateLimit-Remaining"
+	headerRateReset     = "X-RateLimit-Reset"
+)
+
+// rateLimitTransport retries requests that GitHub rejected because a primary
+// or secondary rate limit was exceeded. Once the retries are exhausted, or
+// when the rate limit lifts only after maxRetryWait, the last response is
+// returned, so the GitHub client reports the rate limit error as usual.
+type rateLimitTransport struct {
+	base         http.RoundTripper
+	maxRetries   int
+	maxRetryWait time.Duration
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if calls, ok := req.Context().Value(apiCallsKey{}).(*apiCalls); ok {
+			calls.record(req, resp)
+		}
+		if err == nil {
+			if status, ok := req.Context().Value(rateLimitStatusKey{}).(*rateLimitStatus); ok {
+				status.record(resp)
+			}
+		}
+		if err != nil || attempt >= t.maxRetries {
+			return resp, err
+		}
+
+		wait, limited, err := rateLimitWait(resp, t.maxRetryWait)
+		if err != nil {
+			return nil, err
+		}
+		if !limited {
+			return resp, nil
+		}
+
+		retryReq, ok := rewindRequest(req)
+		if !ok {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		req = retryReq
+	}
+}
+
+// rateLimitStatus holds the rate limit reported by the last response to a
+// request made with a context returned by withRateLimitStatus
+type rateLimitStatus struct {
+	lock      sync.Mutex
+	seen      bool
+	remaining int
+	reset     time.Time
+}
+
+type rateLimitStatusKey struct{}
+
+// withRateLimitStatus returns a context that records the rate limit reported
+// by GitHub for the requests made with it
+func withRateLimitStatus(ctx context.Context) (context.Context, *rateLimitStatus) {
+	status := &rateLimitStatus{}
+	return context.WithValue(ctx, rateLimitStatusKey{}, status), status
+}
+
+// record keeps the rate limit of the response, if it reports one
+func (s *rateLimitStatus) record(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get(headerRateRemaining))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get(headerRateReset), 10, 64)
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seen = true
+	s.remaining = remaining
+	s.reset = time.Unix(reset, 0).UTC()
+}
+
+// warning returns a warning when the last reported number of remaining
+// requests is below threshold, or an empty string otherwise
+func (s *rateLimitStatus) warning(threshold int) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.seen || s.remaining >= threshold {
+		return ""
+	}
+	return fmt.Sprintf("GitHub API rate limit low: %d remaining, resets at %s",
+		s.remaining, s.reset.Format(time.RFC3339))
+}
+
+// budget returns the last reported number of remaining requests and when
+// the rate limit resets, or false if GitHub reported none
+func (s *rateLimitStatus) budget() (int, time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.remaining, s.reset, s.seen
+}
+
+// rateLimitWait reports whether the response is a rate limit error worth
+// retrying and how long to wait before doing so. A rate limit that lifts
+// only after maxWait is not retried, as the retry would be rejected as well.
+// The body of the response is preserved so it can still be returned to the
+// caller.
+func rateLimitWait(resp *http.Response, maxWait time.Duration) (time.Duration, bool, error) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read GitHub response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	probe := *resp
+	probe.Body = io.NopCloser(bytes.NewReader(body))
+
+	var wait time.Duration
+	switch e := github.CheckResponse(&probe).(type) {
+	case *github.RateLimitError:
+		wait = time.Until(e.Rate.Reset.Time)
+	case *github.AbuseRateLimitError:
+		wait = secondaryRateLimitWait(resp, maxWait)
+	default:
+		if !isSecondaryRateLimit(resp) {
+			return 0, false, nil
+		}
+		wait = secondaryRateLimitWait(resp, maxWait)
+	}
+
+	if wait > maxWait {
+		return 0, false, nil
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true, nil
+}
+
+// isSecondaryRateLimit reports whether GitHub rejected the request because a
+// secondary rate limit was exceeded without linking the abuse documentation
+// the GitHub client recognizes. GitHub answers those with 429, or with 403
+// and a Retry-After header.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("Retry-After") != ""
+	default:
+		return false
+	}
+}
+
+// secondaryRateLimitWait returns how long GitHub asks to wait before retrying
+// a request rejected by a secondary rate limit. Retry-After is given either
+// in seconds or as a date. Without it, the reset of an exhausted primary rate
+// limit is waited for, and otherwise GitHub leaves the wait unspecified.
+func secondaryRateLimitWait(resp *http.Response, maxWait time.Duration) time.Duration {
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.ParseInt(retryAfter, 10, 64); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return time.Until(date)
+		}
+	}
+	if resp.Header.Get(headerRateRemaining) == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get(headerRateReset), 10, 64); err == nil {
+			return time.Until(time.Unix(reset, 0))
+		}
+	}
+	return maxWait
+}
+
+// rewindRequest returns a copy of the request that can be sent again, or
+// false if its body cannot be replayed
+func rewindRequest(req *http.Request) (*http.Request, bool) {
+	retryReq := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retryReq, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retryReq.Body = body
+	return retryReq, true
+}
+
+// isRateLimitError reports whether the error was caused by GitHub rate
+// limiting the request
+func isRateLimitError(err error) bool {
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr) {
+		return true
+	}
+	var githubErr *github.ErrorResponse
+	return errors.As(err, &githubErr) && githubErr.Response != nil && isSecondaryRateLimit(githubErr.Response)
+}
+
+// isGitHubUnavailable reports whether the error was caused by GitHub being
+// unreachable or failing with a server error, rather than by GitHub denying
+// the user
+func isGitHubUnavailable(err error) bool {
+	var authErr *AuthenticationError
+	if errors.As(err, &authErr) {
+		return false
+	}
+	var githubErr *github.ErrorResponse
+	if errors.As(err, &githubErr) {
+		return githubErr.Response != nil && githubErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// wrapRateLimitError distinguishes requests that stayed rate limited after
+// all retries from authentication failures
+func wrapRateLimitError(err error) error {
+	if isRateLimitError(err) {
+		return fmt.Errorf("GitHub API rate limit exceeded and not lifted within the retries: %w", err)
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// sessionPrefix is where the sessions revalidated in the background are
+// stored. The entries hold GitHub tokens, so they are seal wrapped.
+const sessionPrefix = "sessions/"
+
+// session tracks a token issued by a login so that the organization
+// membership of its user can be revalidated in the background.
+//
+// Auth methods cannot revoke the tokens they issued, so a session whose user
+// is no longer a member is marked as revoked and its token is denied renewal.
+type session struct {
+	Login string `json:"login"`
+
+	// Token is the user's GitHub token, the same one kept in the internal
+	// data of the issued token. It is not kept in GitHub App mode, where
+	// membership is checked with the installation token instead.
+	Token string `json:"token,omitempty"`
+
+	// Expires is when the token expires unless it is renewed, after which
+	// the session is removed
+	Expires time.Time `json:"expires"`
+
+	// Revoked is set once revalidation found the user is no longer an
+	// active member
+	Revoked bool `json:"revoked"`
+}
+
+// createSession stores a session for the login when revalidation_interval is
+// configured and returns its ID, or an empty ID otherwise
+func (b *backend) createSession(ctx context.Context, storage logical.Storage, config *config, auth *logical.Auth, token string) (string, error) {
+	if config.RevalidationInterval <= 0 {
+		return "", nil
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	s := &session{
+		Login:   auth.DisplayName,
+		Expires: b.sessionExpiration(auth),
+	}
+	if !config.appMode() {
+		s.Token = token
+	}
+
+	if err := putSession(ctx, storage, id, s); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// checkSession denies the renewal of a token whose session was revoked by
+// the background revalidation, even if the user has been added back since
+func (b *backend) checkSession(ctx context.Context, req *logical.Request) error {
+	id, ok := req.Auth.InternalData["session_id"].(string)
+	if !ok {
+		return nil
+	}
+	s, err := getSession(ctx, req.Storage, id)
+	if err != nil {
+		return err
+	}
+	if s != nil && s.Revoked {
+		return newAuthError("session revoked",
+			fmt.Sprintf("user '%s' is no longer an active member of the organization", s.Login))
+	}
+	return nil
+}
+
+// renewSession extends the session of the renewed token to its new
+// expiration. Sessions that were removed, such as once revalidation was
+// disabled, are not created again.
+func (b *backend) renewSession(ctx context.Context, storage logical.Storage, auth *logical.Auth) error {
+	id, ok := auth.InternalData["session_id"].(string)
+	if !ok {
+		return nil
+	}
+	s, err := getSession(ctx, storage, id)
+	if err != nil || s == nil {
+		return err
+	}
+
+	s.Expires = b.sessionExpiration(auth)
+	return putSession(ctx, storage, id, s)
+}
+
+// sessionExpiration returns when the token of the auth expires if it is not
+// renewed
+func (b *backend) sessionExpiration(auth *logical.Auth) time.Time {
+	ttl := max(auth.TTL, auth.Period)
+	if ttl == 0 {
+		ttl = b.System().DefaultLeaseTTL()
+	}
+	return b.now().Add(ttl)
+}
+
+func getSession(ctx context.Context, storage logical.Storage, id string) (*session, error) {
+	entry, err := storage.Get(ctx, sessionPrefix+id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var s session
+	if err := entry.DecodeJSON(&s); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return &s, nil
+}
+
+func putSession(ctx context.Context, storage logical.Storage, id string, s *session) error {
+	entry, err := logical.StorageEntryJSON(sessionPrefix+id, s)
+	if err != nil {
+		return fmt.Errorf("failed to create storage entry for session: %w", err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+// periodicFunc revalidates the stored sessions every revalidation_interval.
+// It is called by the rollback manager about once a minute. Once
+// revalidation is disabled, the remaining sessions are removed so that no
+// GitHub token is kept for it.
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	config, err := b.Config(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	if config == nil || config.RevalidationInterval <= 0 {
+		return deleteSessions(ctx, req.Storage)
+	}
+
+	b.revalidationLock.Lock()
+	if !b.nextRevalidation.IsZero() && b.now().Before(b.nextRevalidation) {
+		b.revalidationLock.Unlock()
+		return nil
+	}
+	b.nextRevalidation = b.now().Add(config.RevalidationInterval)
+	b.revalidationLock.Unlock()
+
+	return b.revalidateSessions(ctx, req.Storage, config)
+}
+
+// resetRevalidation lets the next call of periodicFunc revalidate the
+// sessions, so that a changed revalidation_interval applies right away
+func (b *backend) resetRevalidation() {
+	b.revalidationLock.Lock()
+	defer b.revalidationLock.Unlock()
+	b.nextRevalidation = time.Time{}
+}
+
+// deleteSessions removes all stored sessions
+func deleteSessions(ctx context.Context, storage logical.Storage) error {
+	ids, err := storage.List(ctx, sessionPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+	for _, id := range ids {
+		if err := storage.Delete(ctx, sessionPrefix+id); err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+	}
+	return nil
+}
+
+// revalidateSessions checks that the user of every stored session is still
+// an active member of a configured organization, revoking the sessions of
+// users that are not. Expired sessions are removed.
+func (b *backend) revalidateSessions(ctx context.Context, storage logical.Storage, config *config) error {
+	ids, err := storage.List(ctx, sessionPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	for _, id := range ids {
+		s, err := getSession(ctx, storage, id)
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			continue
+		}
+
+		if b.now().After(s.Expires) {
+			if err := storage.Delete(ctx, sessionPrefix+id); err != nil {
+				return fmt.Errorf("failed to delete expired session: %w", err)
+			}
+			continue
+		}
+		if s.Revoked {
+			continue
+		}
+
+		err = b.revalidateSession(ctx, config, s)
+		var authErr *AuthenticationError
+		switch {
+		case err == nil:
+		case isRateLimitError(err):
+			// The remaining sessions are revalidated in the next sweep
+			b.Logger().Warn("GitHub API rate limit exceeded, postponing session revalidation", "error", err)
+			return nil
+		case errors.As(err, &authErr), errors.Is(err, logical.ErrPermissionDenied):
+			b.Logger().Info("revoking session of user that is no longer authorized", "user", s.Login, "reason", err)
+			s.Revoked = true
+			if err := putSession(ctx, storage, id, s); err != nil {
+				return err
+			}
+		default:
+			// A failing request must not revoke the session
+			b.Logger().Warn("failed to revalidate session", "user", s.Login, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// revalidateSession checks that the user of the session may still log in and
+// is an active member of a configured organization
+func (b *backend) revalidateSession(ctx context.Context, config *config, s *session) error {
+	if !config.userAllowed(s.Login) {
+		return logical.ErrPermissionDenied
+	}
+
+	var client *github.Client
+	var err error
+	switch {
+	case config.appMode():
+		client, err = b.installationClient(ctx, config)
+	case s.Token != "":
+		client, err = b.clientForConfig(s.Token, config)
+	default:
+		// The session was created in GitHub App mode, which is no longer
+		// configured, so it is revalidated on renewal instead
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+
+	user := &github.User{
+		Login: github.String(s.Login),
+	}
+	_, _, _, err = b.checkMembership(ctx, client, user, config)
+	return err
+}
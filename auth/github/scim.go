@@ -0,0 +1,168 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// externalIdentityQuery looks up the identity of the user linked through the
+// SAML identity provider of the organization. The GUID of the identity is the
+// ID of the user in the SCIM API.
+const externalIdentityQuery = `query($org: String!, $login: String!) {
+  organization(login: $org) {
+    samlIdentityProvider {
+      externalIdentities(first: 1, login: $login) {
+        nodes {
+          guid
+          scimIdentity {
+            username
+          }
+        }
+      }
+    }
+  }
+}`
+
+type externalIdentityResponse struct {
+	Data struct {
+		Organization *struct {
+			SAMLIdentityProvider *struct {
+				ExternalIdentities struct {
+					Nodes []struct {
+						GUID         string `json:"guid"`
+						SCIMIdentity *struct {
+							Username string `json:"username"`
+						} `json:"scimIdentity"`
+					} `json:"nodes"`
+				} `json:"externalIdentities"`
+			} `json:"samlIdentityProvider"`
+		} `json:"organization"`
+	} `json:"data"`
+	Errors []graphQLError `json:"errors"`
+}
+
+// scimAliasPrefix prefixes the SCIM externalId in entity aliases, so that it
+// never matches the login, ID or email another user is identified by
+const scimAliasPrefix = "scim:"
+
+// scimUser is a user provisioned in an organization through SCIM
+type scimUser struct {
+	ExternalID string `json:"externalId"`
+}
+
+// scimAlias returns the name of the entity alias of a user with the SCIM
+// externalId
+func scimAlias(externalID string) string {
+	return scimAliasPrefix + externalID
+}
+
+// resolveSCIMExternalID returns the SCIM externalId of the user in the
+// primary organization. Users GitHub reports without a SCIM identity are
+// identified by their GitHub login instead, with a warning explaining why.
+// Identities that cannot be read are only a warning in metadata mode. With
+// scim_identity set to alias they deny the login, as identifying the user by
+// their login instead would put them on another entity.
+//
+// The identity is always resolved in the primary organization rather than in
+// the organization the membership was verified in, so that the alias
+// lookahead, which does not verify the membership, resolves the same alias as
+// the login. The login passes the organization it verified, which saves a
+// request when it is the primary organization.
+func (b *backend) resolveSCIMExternalID(ctx context.Context, client *github.Client, config *config, verified *github.Organization, user *github.User) (string, string, error) {
+	org, err := b.scimOrganization(ctx, client, config, verified)
+	if err == nil {
+		var externalID string
+		externalID, err = fetchSCIMExternalID(ctx, client, org, user.GetLogin())
+		if err == nil {
+			if externalID == "" {
+				return "", fmt.Sprintf("user %q has no SCIM identity in organization %q, using the GitHub login",
+					user.GetLogin(), org), nil
+			}
+			return externalID, "", nil
+		}
+	} else {
+		org = config.Organization
+	}
+
+	if config.scimIdentity() == scimIdentityAlias {
+		return "", "", fmt.Errorf("failed to resolve the SCIM identity of user %q in organization %q: %w",
+			user.GetLogin(), org, err)
+	}
+	return "", fmt.Sprintf("failed to resolve the SCIM identity of user %q in organization %q: %s",
+		user.GetLogin(), org, err), nil
+}
+
+// scimOrganization returns the current name of the primary organization,
+// taken from the verified organization when it is the primary organization
+func (b *backend) scimOrganization(ctx context.Context, client *github.Client, config *config, verified *github.Organization) (string, error) {
+	if verified != nil && config.OrganizationID != 0 && verified.GetID() == config.OrganizationID {
+		return verified.GetLogin(), nil
+	}
+	org, err := b.cachedOrganization(ctx, client, config, organizationRef{Name: config.Organization, ID: config.OrganizationID})
+	if err != nil {
+		return "", err
+	}
+	return org.GetLogin(), nil
+}
+
+// fetchSCIMExternalID looks up the SCIM identity of the login in the
+// organization, and returns its externalId. An empty string is only returned
+// when GitHub reports that the user has no SCIM identity, any failure to
+// read it is returned as an error.
+func fetchSCIMExternalID(ctx context.Context, client *github.Client, org, login string) (string, error) {
+	req, err := client.NewRequest(http.MethodPost, graphQLURL(client), &graphQLRequest{
+		Query: externalIdentityQuery,
+		Variables: map[string]interface{}{
+			"org":   org,
+			"login": login,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var result externalIdentityResponse
+	if _, err := client.Do(ctx, req, &result); err != nil {
+		return "", err
+	}
+	if len(result.Errors) > 0 {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return "", fmt.Errorf("GraphQL query failed: %s", strings.Join(messages, "; "))
+	}
+	if result.Data.Organization == nil {
+		return "", fmt.Errorf("organization %q not found", org)
+	}
+
+	// Organizations without SAML SSO have no identity provider
+	provider := result.Data.Organization.SAMLIdentityProvider
+	if provider == nil {
+		return "", nil
+	}
+	nodes := provider.ExternalIdentities.Nodes
+	if len(nodes) == 0 || nodes[0].SCIMIdentity == nil || nodes[0].GUID == "" {
+		return "", nil
+	}
+
+	u := fmt.Sprintf("scim/v2/organizations/%s/Users/%s", url.PathEscape(org), url.PathEscape(nodes[0].GUID))
+	req, err = client.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/scim+json")
+
+	// The SCIM user of a linked identity exists, so it not being found is
+	// not reported as the user having none
+	var user scimUser
+	if _, err := client.Do(ctx, req, &user); err != nil {
+		return "", err
+	}
+	return user.ExternalID, nil
+}
@@ -0,0 +1,88 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// twoFactorStatus is the two-factor authentication status GitHub reports to
+// the token of the authenticated user
+type twoFactorStatus struct {
+	TwoFactorAuthentication *bool `json:"two_factor_authentication"`
+}
+
+// checkTwoFactor verifies that the user has two-factor authentication
+// enabled. GitHub reports the status of the authenticated user to their own
+// token, so it is read first unless the client is that of a GitHub App.
+// Otherwise the members of the organization without two-factor
+// authentication are listed, which only GitHub Apps and organization owners
+// may do. Logins fail closed when the status cannot be read.
+func checkTwoFactor(ctx context.Context, client *github.Client, config *config, org *github.Organization, user *github.User, role string) error {
+	if !config.appMode() {
+		req, err := client.NewRequest(http.MethodGet, "user", nil)
+		if err != nil {
+			return err
+		}
+		var status twoFactorStatus
+		if _, err := client.Do(ctx, req, &status); err != nil {
+			return fmt.Errorf("failed to get the two-factor authentication status: %w", err)
+		}
+		if status.TwoFactorAuthentication != nil {
+			if !*status.TwoFactorAuthentication {
+				return twoFactorDisabledError(user)
+			}
+			return nil
+		}
+	}
+
+	unavailable := newAuthError("two-factor authentication status unavailable",
+		fmt.Sprintf("the two-factor authentication status of user '%s' cannot be read, which requires a GitHub App or an owner of organization '%s'",
+			user.GetLogin(), org.GetLogin()))
+	if !config.appMode() && role != "admin" {
+		return unavailable
+	}
+
+	opt := &github.ListMembersOptions{
+		Filter: "2fa_disabled",
+		ListOptions: github.ListOptions{
+			PerPage: config.TeamsPerPage,
+		},
+	}
+	for {
+		members, resp, err := client.Organizations.ListMembers(ctx, org.GetLogin(), opt)
+		if err != nil {
+			if isRateLimitError(err) {
+				return fmt.Errorf("failed to list members without two-factor authentication: %w", err)
+			}
+			var githubErr *github.ErrorResponse
+			if errors.As(err, &githubErr) && githubErr.Response != nil {
+				switch githubErr.Response.StatusCode {
+				case http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity:
+					return unavailable
+				}
+			}
+			return fmt.Errorf("failed to list members without two-factor authentication: %w", err)
+		}
+
+		for _, member := range members {
+			if strings.EqualFold(member.GetLogin(), user.GetLogin()) {
+				return twoFactorDisabledError(user)
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func twoFactorDisabledError(user *github.User) error {
+	return newAuthError("two-factor authentication required",
+		fmt.Sprintf("user '%s' does not have two-factor authentication enabled", user.GetLogin()))
+}
@@ -0,0 +1,47 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// unwrapToken returns the GitHub token wrapped in the response-wrapping
+// token, so that automated logins never send the token itself. Plugins
+// cannot unwrap through the system view, so the wrapping token is unwrapped
+// with the API of OpenBao at the configured unwrap_address, authenticated
+// by the wrapping token alone. The wrapped data must hold the GitHub token
+// under the token key.
+func (b *backend) unwrapToken(ctx context.Context, config *config, wrappedToken string) (string, error) {
+	if config.UnwrapAddress == "" {
+		return "", newAuthError("wrapped tokens not enabled",
+			"unwrap_address must be configured to log in with wrapped_token")
+	}
+
+	clientConfig := api.DefaultConfig()
+	if clientConfig.Error != nil {
+		return "", fmt.Errorf("failed to configure the OpenBao client: %w", clientConfig.Error)
+	}
+	clientConfig.Address = config.UnwrapAddress
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to create the OpenBao client: %w", err)
+	}
+	// Only the wrapping token may authenticate the request
+	client.ClearToken()
+
+	secret, err := client.Logical().UnwrapWithContext(ctx, wrappedToken)
+	if err != nil {
+		return "", newAuthError("invalid wrapped token", fmt.Sprintf("failed to unwrap wrapped_token: %s", err))
+	}
+	if secret == nil || secret.Data == nil {
+		return "", newAuthError("invalid wrapped token", "wrapped_token does not wrap any data")
+	}
+	token, ok := secret.Data["token"].(string)
+	if !ok || token == "" {
+		return "", newAuthError("invalid wrapped token", "wrapped_token does not wrap a GitHub token under the token key")
+	}
+
+	return token, nil
+}
@@ -5,6 +5,7 @@ package consul
 
 import (
 	"context"
+	"sync"
 
 	"github.com/openbao/openbao/sdk/v2/framework"
 	"github.com/openbao/openbao/sdk/v2/logical"
@@ -29,14 +30,23 @@ func Backend() *backend {
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
 				"config/access",
+				clusterPrefix,
 			},
 		},
 
 		Paths: []*framework.Path{
 			pathConfigAccess(&b),
+			pathConfigRotateRoot(&b),
+			pathConfigCheck(&b),
+			pathListClusters(&b),
+			pathConfigClusters(&b),
 			pathListRoles(&b),
 			pathRoles(&b),
+			pathRoleImport(&b),
+			pathRoleValidate(&b),
 			pathToken(&b),
+			pathListTokens(&b),
+			pathTokens(&b),
 		},
 
 		Secrets: []*framework.Secret{
@@ -46,9 +56,27 @@ func Backend() *backend {
 		RunningVersion: ReportedVersion,
 	}
 
+	b.envAccess, b.envAccessErr = accessConfigFromEnv()
+
 	return &b
 }
 
 type backend struct {
 	*framework.Backend
+
+	// configMutex serializes writes of the access configuration
+	configMutex sync.Mutex
+
+	// envAccess is the access configuration read from the environment when
+	// the backend was created, used until config/access is written.
+	// envAccessErr is the error reading it, if any.
+	envAccess    *accessConfig
+	envAccessErr error
+
+	// revocations holds a slot for every token being revoked, bounding them
+	// to the max_concurrent_revocations it was created for, revocationsLimit.
+	// Both are guarded by revocationsMutex.
+	revocationsMutex sync.Mutex
+	revocations      chan struct{}
+	revocationsLimit int
 }
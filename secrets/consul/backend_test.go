@@ -5,10 +5,16 @@ package consul
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,8 +96,10 @@ func testBackendConfigAccess(t *testing.T, version string, autoBootstrap bool) {
 	}
 
 	expected := map[string]any{
-		"address": connData["address"].(string),
-		"scheme":  "http",
+		"address":            connData["address"].(string),
+		"scheme":             "http",
+		"max_retries":        defaultMaxRetries,
+		"descriptive_tokens": false,
 	}
 	if !reflect.DeepEqual(expected, resp.Data) {
 		t.Fatalf("bad: expected:%#v\nactual:%#v\n", expected, resp.Data)
@@ -495,6 +503,71 @@ func TestBackend_LocalToken(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	t.Run("local node identity", func(t *testing.T) {
+		// Node agents must not get tokens replicated to other datacenters
+		req.Operation = logical.UpdateOperation
+		req.Path = "roles/node_local"
+		req.Data = map[string]any{
+			"node_identities": []string{"node-1:dc1"},
+			"local":           true,
+		}
+		if _, err := b.HandleRequest(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+
+		req.Operation = logical.ReadOperation
+		req.Data = nil
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil {
+			t.Fatal("resp nil")
+		}
+		if local, _ := resp.Data["local"].(bool); !local {
+			t.Fatalf("expected role to be local, got %#v", resp.Data)
+		}
+
+		req.Path = "creds/node_local"
+		resp, err = b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil {
+			t.Fatal("resp nil")
+		}
+		if resp.IsError() {
+			t.Fatalf("resp is error: %v", resp.Error())
+		}
+
+		if err := mapstructure.Decode(resp.Data, &d); err != nil {
+			t.Fatal(err)
+		}
+		if !d.Local {
+			t.Fatalf("requested local token, got global one")
+		}
+
+		// Verify that Consul created the token local and with the identity
+		mgmtConfig := consulapi.DefaultNonPooledConfig()
+		mgmtConfig.Address = connData["address"].(string)
+		mgmtConfig.Token = connData["token"].(string)
+		mgmtClient, err := consulapi.NewClient(mgmtConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, _, err := mgmtClient.ACL().TokenRead(d.Accessor, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !token.Local {
+			t.Fatalf("expected Consul token to be local")
+		}
+		if len(token.NodeIdentities) != 1 || token.NodeIdentities[0].NodeName != "node-1" || token.NodeIdentities[0].Datacenter != "dc1" {
+			t.Fatalf("unexpected node identities: %#v", token.NodeIdentities)
+		}
+	})
 }
 
 func TestBackend_Basic(t *testing.T) {
@@ -525,7 +598,7 @@ func testBackendBasic(t *testing.T, version string) {
 		LogicalBackend: b,
 		Steps: []logicaltest.TestStep{
 			testAccStepConfig(t, connData),
-			testAccStepWriteRole(t, "test", "test", ""),
+			testAccStepWriteRole(t, "test", "test", "", ""),
 			testAccStepReadToken(t, "test", connData),
 		},
 	})
@@ -536,10 +609,10 @@ func TestBackend_crud(t *testing.T) {
 	logicaltest.Test(t, logicaltest.TestCase{
 		LogicalBackend: b,
 		Steps: []logicaltest.TestStep{
-			testAccStepWriteRole(t, "test", "write", ""),
-			testAccStepWriteRole(t, "test2", "write", ""),
-			testAccStepWriteRole(t, "test3", "write", ""),
-			testAccStepReadRole(t, "test", "write", 0),
+			testAccStepWriteRole(t, "test", "write", "", ""),
+			testAccStepWriteRole(t, "test2", "write", "", ""),
+			testAccStepWriteRole(t, "test3", "write", "", ""),
+			testAccStepReadRole(t, "test", "write", 0, 0),
 			testAccStepListRole(t, []string{"test", "test2", "test3"}),
 			testAccStepDeleteRole(t, "test"),
 		},
@@ -551,13 +624,498 @@ func TestBackend_role_ttl(t *testing.T) {
 	logicaltest.Test(t, logicaltest.TestCase{
 		LogicalBackend: b,
 		Steps: []logicaltest.TestStep{
-			testAccStepWriteRole(t, "test", "write", "6h"),
-			testAccStepReadRole(t, "test", "write", 6*time.Hour),
+			testAccStepWriteRole(t, "test", "write", "6h", "12h"),
+			testAccStepReadRole(t, "test", "write", 6*time.Hour, 12*time.Hour),
 			testAccStepDeleteRole(t, "test"),
 		},
 	})
 }
 
+func TestBackend_role_max_ttl(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// max_ttl must not be lower than ttl
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test",
+		Data: map[string]any{
+			"consul_policies": []string{"test"},
+			"ttl":             "2h",
+			"max_ttl":         "1h",
+		},
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error for max_ttl lower than ttl")
+	}
+
+	req.Data = map[string]any{
+		"consul_policies": []string{"test"},
+		"ttl":             "1h",
+		"max_ttl":         "2h",
+	}
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+	}
+
+	// Renewals are capped at max_ttl from when the token was issued
+	req.Operation = logical.RenewOperation
+	req.Path = ""
+	req.Data = nil
+	req.Secret = &logical.Secret{
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       time.Hour,
+			IssueTime: time.Now().Add(-90 * time.Minute),
+		},
+		InternalData: map[string]any{
+			"secret_type": SecretTokenType,
+			"role":        "test",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to renew token: resp:%#v err:%s", resp, err)
+	}
+	if resp.Secret.TTL > 30*time.Minute {
+		t.Fatalf("expected renewal to be capped at max_ttl, got TTL %s", resp.Secret.TTL)
+	}
+	if resp.Secret.MaxTTL != 2*time.Hour {
+		t.Fatalf("bad: max_ttl: %s", resp.Secret.MaxTTL)
+	}
+}
+
+func TestBackend_role_default_lease_ttl(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]any) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s %s: resp:%#v err:%s", operation, path, resp, err)
+		}
+		return resp
+	}
+	writeAccess := func(defaultLeaseTTL string) {
+		t.Helper()
+		request(logical.UpdateOperation, "config/access", map[string]any{
+			"address":           "127.0.0.1:8500",
+			"token":             "test-token",
+			"default_lease_ttl": defaultLeaseTTL,
+		})
+	}
+
+	request(logical.UpdateOperation, "roles/with-ttl", map[string]any{"consul_policies": []string{"test"}, "ttl": "1h"})
+	request(logical.UpdateOperation, "roles/no-ttl", map[string]any{"consul_policies": []string{"test"}})
+	request(logical.UpdateOperation, "roles/capped", map[string]any{"consul_policies": []string{"test"}, "max_ttl": "10m"})
+
+	checkRole := func(role string, ttl time.Duration, source string) {
+		t.Helper()
+		resp := request(logical.ReadOperation, "roles/"+role, nil)
+		if resp.Data["effective_ttl"] != int64(ttl.Seconds()) || resp.Data["ttl_source"] != source {
+			t.Fatalf("bad: role %s: expected effective_ttl %d from %s, got: %#v", role, int64(ttl.Seconds()), source, resp.Data)
+		}
+	}
+
+	writeAccess("30m")
+	if resp := request(logical.ReadOperation, "config/access", nil); resp.Data["default_lease_ttl"] != int64(1800) {
+		t.Fatalf("bad: default_lease_ttl: %#v", resp.Data)
+	}
+	checkRole("with-ttl", time.Hour, ttlSourceRole)
+	checkRole("no-ttl", 30*time.Minute, ttlSourceConfig)
+	checkRole("capped", 10*time.Minute, ttlSourceConfig)
+
+	// Renewals of roles without a ttl are extended by the default
+	renewReq := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.RenewOperation,
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       30 * time.Minute,
+				IssueTime: time.Now(),
+			},
+			InternalData: map[string]any{
+				"secret_type": SecretTokenType,
+				"role":        "no-ttl",
+			},
+		},
+	}
+	resp, err := b.HandleRequest(context.Background(), renewReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to renew token: resp:%#v err:%s", resp, err)
+	}
+	if resp.Secret.TTL != 30*time.Minute {
+		t.Fatalf("expected renewal to use default_lease_ttl, got TTL %s", resp.Secret.TTL)
+	}
+
+	// Without a default, roles fall back to the default of the mount
+	writeAccess("0")
+	checkRole("no-ttl", b.System().DefaultLeaseTTL(), ttlSourceSystem)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]any{
+			"address":           "127.0.0.1:8500",
+			"token":             "test-token",
+			"default_lease_ttl": "-1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error for a negative default_lease_ttl")
+	}
+}
+
+func TestBackend_role_legacyPolicy(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Consul records the rules of the policies created for tokens
+	var rules []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/policy":
+			var policy consulapi.ACLPolicy
+			if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+				t.Error(err)
+			}
+			rules = append(rules, policy.Rules)
+			fmt.Fprint(w, `{"ID": "policy"}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/token":
+			fmt.Fprint(w, `{"AccessorID": "accessor", "SecretID": "secret"}`)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]any{
+			"address": strings.TrimPrefix(ts.URL, "http://"),
+			"token":   "management",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write configuration: resp:%#v err:%s", resp, err)
+	}
+
+	// A role written by versions supporting the legacy ACL system
+	policy := `key "" { policy = "read" }`
+	legacy, err := json.Marshal(map[string]any{
+		"policy":     base64.StdEncoding.EncodeToString([]byte(policy)),
+		"token_type": "client",
+		"lease":      time.Hour,
+		"local":      false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.StorageView.Put(context.Background(), &logical.StorageEntry{Key: "policy/legacy", Value: legacy}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "roles/legacy",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to read role: resp:%#v err:%s", resp, err)
+	}
+	if resp.Data["consul_policy_document"] != policy || resp.Data["ttl"] != int64(3600) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The migrated role is stored without the legacy policy
+	entry, err := config.StorageView.Get(context.Background(), "policy/legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored map[string]any
+	if err := entry.DecodeJSON(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored["policy"]; ok || stored["consul_policy_document"] != policy {
+		t.Fatalf("bad: stored role: %#v", stored)
+	}
+
+	// Tokens of the role are generated with its policy
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "creds/legacy",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token: resp:%#v err:%s", resp, err)
+	}
+	if !reflect.DeepEqual(rules, []string{policy}) {
+		t.Fatalf("expected a policy with the legacy rules: %v", rules)
+	}
+}
+
+func TestBackend_role_ttl_validation(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(data map[string]any) *logical.Response {
+		t.Helper()
+		data["consul_policies"] = []string{"test"}
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      "roles/test",
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	read := func() map[string]any {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.ReadOperation,
+			Path:      "roles/test",
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("failed to read role: resp:%#v err:%s", resp, err)
+		}
+		return resp.Data
+	}
+
+	// Durations and bare numbers of seconds are both stored as seconds
+	for _, tc := range []struct {
+		ttl     any
+		seconds int64
+	}{
+		{"6h", 21600},
+		{"21600", 21600},
+		{21600, 21600},
+	} {
+		if resp := write(map[string]any{"ttl": tc.ttl}); resp != nil && resp.IsError() {
+			t.Fatalf("failed to write ttl %v: %#v", tc.ttl, resp)
+		}
+		if ttl := read()["ttl"]; ttl != tc.seconds {
+			t.Fatalf("bad: ttl %v: expected %d, got %#v", tc.ttl, tc.seconds, ttl)
+		}
+	}
+
+	for _, data := range []map[string]any{
+		{"ttl": "-1h"},
+		{"max_ttl": -60},
+		{"lease": "-1s"},
+		{"ttl": "100000h"},
+		{"max_ttl": int64(1) << 40},
+	} {
+		if resp := write(data); resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error for %v, got: %#v", data, resp)
+		}
+	}
+
+	// The deprecated lease is used when ttl is not set, and ttl wins when
+	// both are set
+	if resp := write(map[string]any{"lease": "1h"}); resp != nil && (resp.IsError() || len(resp.Warnings) > 0) {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if ttl := read()["ttl"]; ttl != int64(3600) {
+		t.Fatalf("bad: ttl: %#v", ttl)
+	}
+	resp := write(map[string]any{"lease": "1h", "ttl": "2h"})
+	if resp == nil || resp.IsError() || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "only ttl is used") {
+		t.Fatalf("expected a warning for lease and ttl, got: %#v", resp)
+	}
+	if ttl := read()["ttl"]; ttl != int64(7200) {
+		t.Fatalf("bad: ttl: %#v", ttl)
+	}
+	if resp := write(map[string]any{"lease": "1h", "ttl": "3600"}); resp != nil && (resp.IsError() || len(resp.Warnings) > 0) {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestBackend_role_legacy_policies(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		data     map[string]any
+		policies []string
+		warnings []string
+	}{
+		{
+			name:     "consul_policies",
+			data:     map[string]any{"consul_policies": []string{"test"}},
+			policies: []string{"test"},
+		},
+		{
+			name:     "policies",
+			data:     map[string]any{"policies": []string{"test"}},
+			policies: []string{"test"},
+			warnings: []string{"policies is deprecated, use consul_policies instead"},
+		},
+		{
+			name:     "both equal",
+			data:     map[string]any{"policies": []string{"test"}, "consul_policies": []string{"test"}},
+			policies: []string{"test"},
+			warnings: []string{"policies is deprecated, use consul_policies instead"},
+		},
+		{
+			name:     "both",
+			data:     map[string]any{"policies": []string{"wrong-name"}, "consul_policies": []string{"test"}},
+			policies: []string{"test"},
+			warnings: []string{
+				"policies is deprecated, use consul_policies instead",
+				`policies ["wrong-name"] and consul_policies ["test"] are both set, only consul_policies is used`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Storage:   config.StorageView,
+				Operation: logical.UpdateOperation,
+				Path:      "roles/test",
+				Data:      tc.data,
+			})
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+			}
+			var warnings []string
+			if resp != nil {
+				warnings = resp.Warnings
+			}
+			if !reflect.DeepEqual(warnings, tc.warnings) {
+				t.Fatalf("bad: warnings: expected:%q actual:%q", tc.warnings, warnings)
+			}
+
+			// Only consul_policies is stored and returned
+			resp, err = b.HandleRequest(context.Background(), &logical.Request{
+				Storage:   config.StorageView,
+				Operation: logical.ReadOperation,
+				Path:      "roles/test",
+			})
+			if err != nil || resp == nil || resp.IsError() {
+				t.Fatalf("failed to read role: resp:%#v err:%s", resp, err)
+			}
+			if !reflect.DeepEqual(resp.Data["consul_policies"], tc.policies) {
+				t.Fatalf("bad: consul_policies: %#v", resp.Data["consul_policies"])
+			}
+			if _, ok := resp.Data["policies"]; ok {
+				t.Fatalf("expected no policies in the response: %#v", resp.Data)
+			}
+		})
+	}
+}
+
+func TestBackend_role_templated_policies(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(policies any) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      "roles/test",
+			Data:      map[string]any{"templated_policies": policies},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Objects and JSON strings are both accepted
+	resp := write([]any{
+		map[string]any{
+			"template_name":      "builtin/service",
+			"template_variables": map[string]any{"name": "web"},
+			"datacenters":        []string{"dc1"},
+		},
+		`{"template_name":"builtin/dns"}`,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to write role: %#v", resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "roles/test",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to read role: resp:%#v err:%s", resp, err)
+	}
+	expected := []*templatedPolicy{
+		{TemplateName: "builtin/service", TemplateVariables: &templatedPolicyVariables{Name: "web"}, Datacenters: []string{"dc1"}},
+		{TemplateName: "builtin/dns"},
+	}
+	if !reflect.DeepEqual(resp.Data["templated_policies"], expected) {
+		t.Fatalf("bad: templated_policies: %#v", resp.Data["templated_policies"])
+	}
+
+	acl := aclTemplatedPolicies(expected)
+	if len(acl) != 2 || acl[0].TemplateVariables == nil || acl[0].TemplateVariables.Name != "web" || acl[1].TemplateVariables != nil {
+		t.Fatalf("bad: ACL templated policies: %#v", acl)
+	}
+
+	for policy, expectedErr := range map[string]string{
+		`{"template_name":"builtin/unknown"}`:                        `unknown templated policy "builtin/unknown"`,
+		`{"template_name":"builtin/node"}`:                           `templated policy "builtin/node" requires the name variable`,
+		`{"template_variables":{"name":"web"}}`:                      "is missing a template_name",
+		`{"template_name":"builtin/dns","template_vars":{}}`:         "unknown field",
+		`{"template_name":"builtin/service","template_variables":1}`: "invalid templated policy",
+	} {
+		resp := write(policy)
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), expectedErr) {
+			t.Fatalf("expected %s to be rejected with %q, got: %#v", policy, expectedErr, resp)
+		}
+	}
+}
+
 func testAccStepConfig(t *testing.T, config map[string]any) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.UpdateOperation,
@@ -602,18 +1160,19 @@ func testAccStepReadToken(t *testing.T, name string, conf map[string]any) logica
 	}
 }
 
-func testAccStepWriteRole(t *testing.T, name string, policy string, ttl string) logicaltest.TestStep {
+func testAccStepWriteRole(t *testing.T, name string, policy string, ttl string, maxTTL string) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.UpdateOperation,
 		Path:      "roles/" + name,
 		Data: map[string]any{
 			"consul_policies": []string{policy},
 			"ttl":             ttl,
+			"max_ttl":         maxTTL,
 		},
 	}
 }
 
-func testAccStepReadRole(t *testing.T, name string, policy string, ttl time.Duration) logicaltest.TestStep {
+func testAccStepReadRole(t *testing.T, name string, policy string, ttl time.Duration, maxTTL time.Duration) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.ReadOperation,
 		Path:      "roles/" + name,
@@ -627,6 +1186,11 @@ func testAccStepReadRole(t *testing.T, name string, policy string, ttl time.Dura
 			if ttl != time.Second*time.Duration(l) {
 				return fmt.Errorf("mismatch: %v %v", l, ttl)
 			}
+
+			m := resp.Data["max_ttl"].(int64)
+			if maxTTL != time.Second*time.Duration(m) {
+				return fmt.Errorf("mismatch: %v %v", m, maxTTL)
+			}
 			return nil
 		},
 	}
@@ -795,10 +1359,18 @@ func TestBackend_Enterprise_Partition(t *testing.T) {
 	testBackendEntPartition(t)
 }
 
-func testBackendEntDiffNamespaceRevocation(t *testing.T) {
-	config := logical.TestBackendConfig()
-	config.StorageView = &logical.InmemStorage{}
-	b, err := Factory(context.Background(), config)
+func TestBackend_Enterprise_DefaultNamespace(t *testing.T) {
+	if _, hasLicense := os.LookupEnv("CONSUL_LICENSE"); !hasLicense {
+		t.Skip("Skipping: No enterprise license found")
+	}
+
+	testBackendEntDefaultNamespace(t)
+}
+
+func testBackendEntDiffNamespaceRevocation(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1282,7 +1854,63 @@ func testBackendEntPartition(t *testing.T) {
 	}
 	q := &consulapi.QueryOptions{
 		Datacenter: "DC1",
-		Partition:  "test1",
+		Partition:  "part1",
+	}
+
+	_, _, err = mgmtclient.ACL().TokenRead(d.Accessor, q)
+	if err == nil {
+		t.Fatal("err: expected error")
+	}
+
+	// Service identities are created in the partition of the role
+	req.Operation = logical.UpdateOperation
+	req.Path = "roles/test-part-identity"
+	req.Secret = nil
+	req.Data = map[string]any{
+		"service_identities": []string{"web:dc1"},
+		"ttl":                "6h",
+		"partition":          "part1",
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Path = "creds/test-part-identity"
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil {
+		t.Fatal("resp nil")
+	}
+	if resp.IsError() {
+		t.Fatalf("resp is error: %v", resp.Error())
+	}
+	if err := mapstructure.Decode(resp.Data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Partition != "part1" {
+		t.Fatalf("bad: token generated in partition %q", d.Partition)
+	}
+
+	token, _, err := mgmtclient.ACL().TokenRead(d.Accessor, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Partition != "part1" {
+		t.Fatalf("bad: token created in partition %q", token.Partition)
+	}
+	if len(token.ServiceIdentities) != 1 || token.ServiceIdentities[0].ServiceName != "web" {
+		t.Fatalf("bad: service identities: %#v", token.ServiceIdentities)
+	}
+
+	req.Operation = logical.RevokeOperation
+	req.Secret = resp.Secret
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	_, _, err = mgmtclient.ACL().TokenRead(d.Accessor, q)
@@ -1291,6 +1919,107 @@ func testBackendEntPartition(t *testing.T) {
 	}
 }
 
+func testBackendEntDefaultNamespace(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, consulConfig := consul.PrepareTestContainer(t, "latest-supported", true, true)
+	defer cleanup()
+
+	connData := map[string]any{
+		"address":           consulConfig.Address(),
+		"token":             consulConfig.Token,
+		"default_namespace": "ns1",
+	}
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data:      connData,
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consulmgmtConfig := consulapi.DefaultNonPooledConfig()
+	consulmgmtConfig.Address = connData["address"].(string)
+	consulmgmtConfig.Token = connData["token"].(string)
+	mgmtclient, err := consulapi.NewClient(consulmgmtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		RoleData  map[string]any
+		Namespace string
+	}{
+		"default namespace": {
+			map[string]any{
+				"consul_policies": []string{"ns-test"},
+			},
+			"ns1",
+		},
+		"role namespace": {
+			map[string]any{
+				"consul_policies":  []string{"test"},
+				"consul_namespace": "default",
+			},
+			"default",
+		},
+	}
+
+	for description, tc := range cases {
+		t.Logf("Testing: %s", description)
+
+		req.Operation = logical.UpdateOperation
+		req.Path = "roles/test-ns"
+		req.Data = tc.RoleData
+		_, err = b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Operation = logical.ReadOperation
+		req.Path = "creds/test-ns"
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || resp.IsError() {
+			t.Fatalf("failed to generate token: %#v", resp)
+		}
+		if resp.Data["consul_namespace"] != tc.Namespace {
+			t.Fatalf("bad: namespace: %v, expected %s", resp.Data["consul_namespace"], tc.Namespace)
+		}
+		accessor := resp.Data["accessor"].(string)
+
+		// The token is revoked in the namespace stored in the internal data
+		// of the lease
+		req.Operation = logical.RevokeOperation
+		req.Data = nil
+		req.Secret = resp.Secret
+		_, err = b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Revocation failed: %v", err)
+		}
+		req.Secret = nil
+
+		q := &consulapi.QueryOptions{
+			Namespace: tc.Namespace,
+		}
+		_, _, err = mgmtclient.ACL().TokenRead(accessor, q)
+		if err == nil {
+			t.Fatal("err: expected error")
+		}
+	}
+}
+
 func TestBackendRenewRevokeRolesAndIdentities(t *testing.T) {
 	config := logical.TestBackendConfig()
 	config.StorageView = &logical.InmemStorage{}
@@ -1344,6 +2073,13 @@ func TestBackendRenewRevokeRolesAndIdentities(t *testing.T) {
 				"ttl":                "6h",
 			},
 		},
+		"service identity with datacenters": {
+			"sidc",
+			map[string]any{
+				"service_identities": []string{"service2:dc1,dc2"},
+				"ttl":                "6h",
+			},
+		},
 		"service identity and policies": {
 			"sip",
 			map[string]any{
@@ -1488,6 +2224,30 @@ func TestBackendRenewRevokeRolesAndIdentities(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		// Build a management client and verify that the service identities
+		// are scoped to their datacenters
+		consulmgmtConfig := consulapi.DefaultNonPooledConfig()
+		consulmgmtConfig.Address = connData["address"].(string)
+		consulmgmtConfig.Token = connData["token"].(string)
+		mgmtclient, err := consulapi.NewClient(consulmgmtConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, _, err := mgmtclient.ACL().TokenRead(d.Accessor, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, serviceIdentity := range token.ServiceIdentities {
+			var datacenters []string
+			if serviceIdentity.ServiceName == "service2" {
+				datacenters = []string{"dc1", "dc2"}
+			}
+			if !reflect.DeepEqual(serviceIdentity.Datacenters, datacenters) {
+				t.Fatalf("bad: datacenters of %s: %v", serviceIdentity.ServiceName, serviceIdentity.Datacenters)
+			}
+		}
+
 		req.Operation = logical.RenewOperation
 		req.Secret = generatedSecret
 		resp, err = b.HandleRequest(context.Background(), req)
@@ -1504,14 +2264,7 @@ func TestBackendRenewRevokeRolesAndIdentities(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		// Build a management client and verify that the token does not exist anymore
-		consulmgmtConfig := consulapi.DefaultNonPooledConfig()
-		consulmgmtConfig.Address = connData["address"].(string)
-		consulmgmtConfig.Token = connData["token"].(string)
-		mgmtclient, err := consulapi.NewClient(consulmgmtConfig)
-		if err != nil {
-			t.Fatal(err)
-		}
+		// Verify that the token does not exist anymore
 
 		q := &consulapi.QueryOptions{
 			Datacenter: "DC1",
@@ -1523,3 +2276,660 @@ func TestBackendRenewRevokeRolesAndIdentities(t *testing.T) {
 		}
 	}
 }
+
+func TestBackend_PolicyDocument(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, consulConfig := consul.PrepareTestContainer(t, "latest-supported", false, true)
+	defer cleanup()
+
+	connData := map[string]any{
+		"address": consulConfig.Address(),
+		"token":   consulConfig.Token,
+	}
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data:      connData,
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "roles/inline"
+	req.Data = map[string]any{
+		"consul_policy_document": `key_prefix "foo" { policy = "write" }`,
+		"ttl":                    "6h",
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Path = "creds/inline"
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil {
+		t.Fatal("resp nil")
+	}
+	if resp.IsError() {
+		t.Fatalf("resp is error: %v", resp.Error())
+	}
+
+	generatedSecret := resp.Secret
+	policyID, ok := generatedSecret.InternalData["policy_id"].(string)
+	if !ok || policyID == "" {
+		t.Fatalf("expected policy_id in internal data, got %#v", generatedSecret.InternalData)
+	}
+
+	var d struct {
+		Token string `mapstructure:"token"`
+	}
+	if err := mapstructure.Decode(resp.Data, &d); err != nil {
+		t.Fatal(err)
+	}
+
+	// Build a client and verify that the credentials are granted the policy
+	consulapiConfig := consulapi.DefaultNonPooledConfig()
+	consulapiConfig.Address = connData["address"].(string)
+	consulapiConfig.Token = d.Token
+	client, err := consulapi.NewClient(consulapiConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.KV().Put(&consulapi.KVPair{
+		Key:   "foo",
+		Value: []byte("bar"),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Operation = logical.RevokeOperation
+	req.Secret = generatedSecret
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both the token and its policy are deleted
+	consulmgmtConfig := consulapi.DefaultNonPooledConfig()
+	consulmgmtConfig.Address = connData["address"].(string)
+	consulmgmtConfig.Token = connData["token"].(string)
+	mgmtclient, err := consulapi.NewClient(consulmgmtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.KV().Put(&consulapi.KVPair{
+		Key:   "foo",
+		Value: []byte("bar"),
+	}, nil)
+	if err == nil {
+		t.Fatal("err: expected error")
+	}
+
+	policy, _, err := mgmtclient.ACL().PolicyRead(policyID, nil)
+	if err == nil && policy != nil {
+		t.Fatalf("expected policy %q to be deleted", policyID)
+	}
+
+	t.Run("revoking token with deleted policy", func(t *testing.T) {
+		req.Operation = logical.ReadOperation
+		req.Path = "creds/inline"
+		req.Secret = nil
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil {
+			t.Fatal("resp nil")
+		}
+		if resp.IsError() {
+			t.Fatalf("resp is error: %v", resp.Error())
+		}
+
+		policyID, ok := resp.Secret.InternalData["policy_id"].(string)
+		if !ok || policyID == "" {
+			t.Fatalf("expected policy_id in internal data, got %#v", resp.Secret.InternalData)
+		}
+
+		// Delete the policy of the token using consul api
+		if _, err := mgmtclient.ACL().PolicyDelete(policyID, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		req.Operation = logical.RevokeOperation
+		req.Secret = resp.Secret
+		if _, err := b.HandleRequest(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+
+		// Revoking again finds neither the token nor its policy
+		if _, err := b.HandleRequest(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestBackend_ConsulExpiry(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, consulConfig := consul.PrepareTestContainer(t, "latest-supported", false, true)
+	defer cleanup()
+
+	connData := map[string]any{
+		"address": consulConfig.Address(),
+		"token":   consulConfig.Token,
+	}
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data:      connData,
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "roles/test"
+	req.Data = map[string]any{
+		"consul_policies":   []string{"test"},
+		"ttl":               "30m",
+		"max_ttl":           "1h",
+		"use_consul_expiry": true,
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Path = "creds/test"
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token: %#v", resp)
+	}
+	if len(resp.Warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", resp.Warnings)
+	}
+
+	// The token expires in Consul shortly after the max TTL of the lease
+	consulmgmtConfig := consulapi.DefaultNonPooledConfig()
+	consulmgmtConfig.Address = connData["address"].(string)
+	consulmgmtConfig.Token = connData["token"].(string)
+	mgmtclient, err := consulapi.NewClient(consulmgmtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := mgmtclient.ACL().TokenRead(resp.Data["accessor"].(string), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ExpirationTime == nil {
+		t.Fatal("expected the token to expire in Consul")
+	}
+	expires := time.Until(*token.ExpirationTime)
+	if expires <= time.Hour || expires > time.Hour+consulExpiryGrace {
+		t.Fatalf("bad: token expires in %s", expires)
+	}
+}
+
+func TestBackend_Config_Access_TLS(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, consulConfig, tlsFiles := consul.PrepareTLSTestContainer(t, "latest-supported")
+	defer cleanup()
+
+	// The server certificate is not issued for the address, so the
+	// connection only succeeds when verified against tls_server_name
+	connData := map[string]any{
+		"address":         consulConfig.TLSAddress,
+		"scheme":          "https",
+		"token":           consulConfig.Token,
+		"ca_cert":         tlsFiles.CACert,
+		"client_cert":     tlsFiles.ClientCert,
+		"client_key":      tlsFiles.ClientKey,
+		"tls_server_name": consul.TLSServerName,
+	}
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data:      connData,
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write configuration: resp:%#v err:%s", resp, err)
+	}
+
+	req.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to read configuration: resp:%#v err:%s", resp, err)
+	}
+	if resp.Data["token"] != nil || resp.Data["client_key"] != nil {
+		t.Fatalf("key material should not be set in the response: %#v", resp.Data)
+	}
+	if resp.Data["tls_server_name"] != consul.TLSServerName {
+		t.Fatalf("bad: tls_server_name: %#v", resp.Data["tls_server_name"])
+	}
+
+	req.Operation = logical.UpdateOperation
+	req.Path = "roles/test"
+	req.Data = map[string]any{
+		"consul_policies": []string{"test"},
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Path = "creds/test"
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token over TLS: %#v", resp)
+	}
+
+	req.Operation = logical.RevokeOperation
+	req.Secret = resp.Secret
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A client certificate without its key is rejected
+	req.Operation = logical.UpdateOperation
+	req.Path = "config/access"
+	req.Data = map[string]any{
+		"address":     consulConfig.TLSAddress,
+		"scheme":      "https",
+		"token":       consulConfig.Token,
+		"client_cert": tlsFiles.ClientCert,
+	}
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error for client_cert without client_key")
+	}
+}
+
+func TestBackend_Config_RotateRoot(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, consulConfig := consul.PrepareTestContainer(t, "latest-supported", false, true)
+	defer cleanup()
+
+	// Rotate a copy of the management token so the container token remains
+	// usable to verify the result
+	mgmtConfig := consulapi.DefaultNonPooledConfig()
+	mgmtConfig.Address = consulConfig.Address()
+	mgmtConfig.Token = consulConfig.Token
+	mgmtClient, err := consulapi.NewClient(mgmtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootToken, _, err := mgmtClient.ACL().TokenCreate(&consulapi.ACLToken{
+		Policies: []*consulapi.ACLTokenPolicyLink{{Name: "global-management"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]any{
+			"address": consulConfig.Address(),
+			"token":   rootToken.SecretID,
+		},
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write configuration: resp:%#v err:%s", resp, err)
+	}
+
+	req.Path = "config/rotate-root"
+	req.Data = nil
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to rotate root token: resp:%#v err:%s", resp, err)
+	}
+	accessor, _ := resp.Data["accessor"].(string)
+	if accessor == "" || accessor == rootToken.AccessorID {
+		t.Fatalf("bad: accessor: %#v", resp.Data["accessor"])
+	}
+
+	// The old token is deleted and the new one keeps its policies
+	if _, _, err := mgmtClient.ACL().TokenRead(rootToken.AccessorID, nil); err == nil {
+		t.Fatal("expected the old token to be deleted")
+	}
+	newToken, _, err := mgmtClient.ACL().TokenRead(accessor, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newToken.Policies) != 1 || newToken.Policies[0].Name != "global-management" {
+		t.Fatalf("bad: policies: %#v", newToken.Policies)
+	}
+
+	// Tokens can still be generated using the rotated token
+	req.Path = "roles/test"
+	req.Data = map[string]any{
+		"consul_policies": []string{"test"},
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Path = "creds/test"
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token with the rotated token: %#v", resp)
+	}
+}
+
+func TestBackend_Tokens(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, consulConfig := consul.PrepareTestContainer(t, "latest-supported", false, true)
+	defer cleanup()
+
+	connData := map[string]any{
+		"address": consulConfig.Address(),
+		"token":   consulConfig.Token,
+	}
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data:      connData,
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "roles/test"
+	req.Data = map[string]any{
+		"consul_policies": []string{"test"},
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var secrets []*logical.Secret
+	var accessors []string
+	for i := 0; i < 3; i++ {
+		req.Operation = logical.ReadOperation
+		req.Path = "creds/test"
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || resp.IsError() {
+			t.Fatalf("failed to generate token: %#v", resp)
+		}
+		secrets = append(secrets, resp.Secret)
+		accessors = append(accessors, resp.Data["accessor"].(string))
+	}
+
+	listTokens := func() []string {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.ListOperation,
+			Path:      "tokens/test",
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to list tokens: resp:%#v err:%s", resp, err)
+		}
+		keys, _ := resp.Data["keys"].([]string)
+		sort.Strings(keys)
+		return keys
+	}
+
+	want := append([]string{}, accessors...)
+	sort.Strings(want)
+	if got := listTokens(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad: tokens: %v, expected %v", got, want)
+	}
+
+	// Revoking a lease removes its token from the index
+	req.Operation = logical.RevokeOperation
+	req.Secret = secrets[0]
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Secret = nil
+
+	want = append([]string{}, accessors[1:]...)
+	sort.Strings(want)
+	if got := listTokens(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad: tokens: %v, expected %v", got, want)
+	}
+
+	// The remaining tokens are revoked at once
+	req.Operation = logical.DeleteOperation
+	req.Path = "tokens/test"
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to revoke tokens: resp:%#v err:%s", resp, err)
+	}
+	revoked, _ := resp.Data["revoked"].([]string)
+	sort.Strings(revoked)
+	if !reflect.DeepEqual(revoked, want) {
+		t.Fatalf("bad: revoked: %v, expected %v", revoked, want)
+	}
+	if got := listTokens(); len(got) != 0 {
+		t.Fatalf("bad: tokens: %v", got)
+	}
+
+	consulmgmtConfig := consulapi.DefaultNonPooledConfig()
+	consulmgmtConfig.Address = connData["address"].(string)
+	consulmgmtConfig.Token = connData["token"].(string)
+	mgmtclient, err := consulapi.NewClient(consulmgmtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, accessor := range accessors {
+		if _, _, err := mgmtclient.ACL().TokenRead(accessor, nil); err == nil {
+			t.Fatalf("expected token %s to be deleted", accessor)
+		}
+	}
+
+	// Their leases can still be revoked
+	req.Operation = logical.RevokeOperation
+	req.Secret = secrets[1]
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackend_Config_IssuanceToken(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, consulConfig := consul.PrepareTestContainer(t, "latest-supported", false, true)
+	defer cleanup()
+
+	consulmgmtConfig := consulapi.DefaultNonPooledConfig()
+	consulmgmtConfig.Address = consulConfig.Address()
+	consulmgmtConfig.Token = consulConfig.Token
+	mgmtclient, err := consulapi.NewClient(consulmgmtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An issuance token that is not allowed to do anything
+	deniedToken, _, err := mgmtclient.ACL().TokenCreate(&consulapi.ACLToken{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connData := map[string]any{
+		"address":        consulConfig.Address(),
+		"token":          consulConfig.Token,
+		"issuance_token": deniedToken.SecretID,
+	}
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data:      connData,
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "roles/test"
+	req.Data = map[string]any{
+		"consul_policies": []string{"test"},
+	}
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens are generated with the issuance token
+	req.Operation = logical.ReadOperation
+	req.Path = "creds/test"
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected generating a token with the issuance token to fail: %#v", resp)
+	}
+
+	issuancePolicy, _, err := mgmtclient.ACL().PolicyCreate(&consulapi.ACLPolicy{
+		Name:  "issuance",
+		Rules: `acl = "write"`,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuanceToken, _, err := mgmtclient.ACL().TokenCreate(&consulapi.ACLToken{
+		Policies: []*consulapi.ACLTokenPolicyLink{{ID: issuancePolicy.ID}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connData["issuance_token"] = issuanceToken.SecretID
+	req.Operation = logical.UpdateOperation
+	req.Path = "config/access"
+	req.Data = connData
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither token is returned
+	req.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to read configuration: resp:%#v err:%s", resp, err)
+	}
+	if resp.Data["token"] != nil || resp.Data["issuance_token"] != nil {
+		t.Fatalf("tokens should not be set in the response: %#v", resp.Data)
+	}
+
+	req.Path = "creds/test"
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token: %#v", resp)
+	}
+	accessor := resp.Data["accessor"].(string)
+
+	// Rotating the management token keeps the issuance token
+	req.Operation = logical.UpdateOperation
+	req.Path = "config/rotate-root"
+	req.Data = nil
+	rotateResp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (rotateResp != nil && rotateResp.IsError()) {
+		t.Fatalf("failed to rotate root token: resp:%#v err:%s", rotateResp, err)
+	}
+	conf, _, err := b.(*backend).readConfigAccess(context.Background(), config.StorageView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.IssuanceToken != issuanceToken.SecretID {
+		t.Fatal("expected the issuance token to be kept")
+	}
+	consulmgmtConfig.Token = conf.Token
+	mgmtclient, err = consulapi.NewClient(consulmgmtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens are revoked with the management token
+	req.Operation = logical.RevokeOperation
+	req.Secret = resp.Secret
+	_, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := mgmtclient.ACL().TokenRead(accessor, nil); err == nil {
+		t.Fatalf("expected token %s to be deleted", accessor)
+	}
+}
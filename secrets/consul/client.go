@@ -11,19 +11,54 @@ import (
 	"github.com/openbao/openbao/sdk/v2/logical"
 )
 
-func (b *backend) client(ctx context.Context, s logical.Storage) (*api.Client, error, error) {
+// client returns a Consul client along with the access configuration it was
+// created from. The client authenticates with the management token, which is
+// used to revoke tokens. A non-empty cluster connects to the named cluster
+// instead of the one of config/access.
+func (b *backend) client(ctx context.Context, s logical.Storage, cluster string) (*api.Client, *accessConfig, error, error) {
+	return b.newClient(ctx, s, cluster, false)
+}
+
+// issuanceClient is like client, but authenticates with the issuance token
+// when one is configured, which is used to generate tokens
+func (b *backend) issuanceClient(ctx context.Context, s logical.Storage, cluster string) (*api.Client, *accessConfig, error, error) {
+	return b.newClient(ctx, s, cluster, true)
+}
+
+func (b *backend) newClient(ctx context.Context, s logical.Storage, cluster string, issuance bool) (*api.Client, *accessConfig, error, error) {
 	conf, userErr, intErr := b.readConfigAccess(ctx, s)
 	if intErr != nil {
-		return nil, nil, intErr //nolint:nilnil
+		return nil, nil, nil, intErr //nolint:nilnil
 	}
-	if userErr != nil {
-		return nil, userErr, nil
-	}
-	if conf == nil {
-		return nil, nil, fmt.Errorf("no error received but no configuration found") //nolint:nilnil
+	if cluster != "" {
+		clusterConf, err := readCluster(ctx, s, cluster)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if clusterConf == nil {
+			return nil, nil, errClusterNotConfigured(cluster), nil
+		}
+
+		// Clusters have their own address and tokens, so the other settings
+		// keep their defaults when config/access is missing
+		base := accessConfig{MaxRetries: defaultMaxRetries}
+		if userErr == nil && conf != nil {
+			base = *conf
+		}
+		conf = clusterConf.apply(base)
+	} else {
+		if userErr != nil {
+			return nil, nil, userErr, nil
+		}
+		if conf == nil {
+			return nil, nil, nil, fmt.Errorf("no error received but no configuration found") //nolint:nilnil
+		}
 	}
 
 	consulConf := conf.NewConfig()
+	if issuance && conf.IssuanceToken != "" {
+		consulConf.Token = conf.IssuanceToken
+	}
 	client, err := api.NewClient(consulConf)
-	return client, nil, err
+	return client, conf, nil, err
 }
@@ -5,7 +5,13 @@ package consul
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/openbao/openbao/sdk/v2/framework"
@@ -41,6 +47,12 @@ func pathConfigAccess(b *backend) *framework.Path {
 				Description: "Token for API calls",
 			},
 
+			"issuance_token": {
+				Type: framework.TypeString,
+				Description: `Token used to generate tokens instead of token, which is then
+only used to revoke tokens and rotate itself.`,
+			},
+
 			"ca_cert": {
 				Type: framework.TypeString,
 				Description: `CA certificate to use when verifying Consul server certificate,
@@ -58,6 +70,49 @@ must be x509 PEM encoded and if this is set you need to also set client_key.`,
 				Description: `Client key used for Consul's TLS communication,
 must be x509 PEM encoded and if this is set you need to also set client_cert.`,
 			},
+
+			"max_retries": {
+				Type: framework.TypeInt,
+				Description: `Maximum number of times Consul API calls that failed with
+a server or connection error are retried. Set to 0 to disable retries.`,
+				Default: defaultMaxRetries,
+			},
+
+			"max_concurrent_revocations": {
+				Type: framework.TypeInt,
+				Description: `Maximum number of tokens revoked in Consul at once, with
+further revocations waiting for one to finish. Set to 0 for no limit.`,
+			},
+
+			"default_namespace": {
+				Type: framework.TypeString,
+				Description: `Consul namespace in which tokens are generated for roles
+that do not set consul_namespace. Requires Consul Enterprise.`,
+			},
+
+			"default_partition": {
+				Type: framework.TypeString,
+				Description: `Consul admin partition in which tokens are generated for
+roles that do not set partition. Requires Consul Enterprise.`,
+			},
+
+			"descriptive_tokens": {
+				Type: framework.TypeBool,
+				Description: `If set, the description of generated Consul tokens names the
+mount, role, request ID and display name of the requester.`,
+			},
+
+			"default_lease_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `Lease TTL of tokens generated for roles that do not set ttl,
+instead of the default lease TTL of the mount.`,
+			},
+
+			"tls_server_name": {
+				Type: framework.TypeString,
+				Description: `Name to use as the SNI host and to verify the Consul server
+certificate against, if it differs from the host of the address.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -74,6 +129,12 @@ must be x509 PEM encoded and if this is set you need to also set client_cert.`,
 					OperationSuffix: "access",
 				},
 			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathConfigAccessDelete,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "access-configuration",
+				},
+			},
 		},
 	}
 }
@@ -84,6 +145,15 @@ func (b *backend) readConfigAccess(ctx context.Context, storage logical.Storage)
 		return nil, nil, err //nolint:nilnil
 	}
 	if entry == nil {
+		// A written configuration always takes precedence over the
+		// environment
+		if b.envAccessErr != nil {
+			return nil, b.envAccessErr, nil
+		}
+		if b.envAccess != nil {
+			conf := *b.envAccess
+			return &conf, nil, nil
+		}
 		return nil, fmt.Errorf("access credentials for the backend itself haven't been configured; please configure them at the '/config/access' endpoint"), nil
 	}
 
@@ -95,6 +165,19 @@ func (b *backend) readConfigAccess(ctx context.Context, storage logical.Storage)
 	return conf, nil, nil
 }
 
+// defaultLeaseTTL returns the default_lease_ttl of the access configuration,
+// or zero when the backend is not configured
+func (b *backend) defaultLeaseTTL(ctx context.Context, storage logical.Storage) (time.Duration, error) {
+	conf, userErr, intErr := b.readConfigAccess(ctx, storage)
+	if intErr != nil {
+		return 0, intErr
+	}
+	if userErr != nil || conf == nil {
+		return 0, nil
+	}
+	return conf.DefaultLeaseTTL, nil
+}
+
 func (b *backend) pathConfigAccessRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	conf, userErr, intErr := b.readConfigAccess(ctx, req.Storage)
 	if intErr != nil {
@@ -107,15 +190,47 @@ func (b *backend) pathConfigAccessRead(ctx context.Context, req *logical.Request
 		return nil, fmt.Errorf("no user error reported but consul access configuration not found")
 	}
 
-	return &logical.Response{
+	// The tokens and client key are never returned
+	resp := &logical.Response{
 		Data: map[string]any{
-			"address": conf.Address,
-			"scheme":  conf.Scheme,
+			"address":            conf.Address,
+			"scheme":             conf.Scheme,
+			"max_retries":        conf.MaxRetries,
+			"descriptive_tokens": conf.DescriptiveTokens,
 		},
-	}, nil
+	}
+	if conf.fromEnv {
+		resp.Data["source"] = "environment"
+	}
+	if conf.CACert != "" {
+		resp.Data["ca_cert"] = conf.CACert
+	}
+	if conf.ClientCert != "" {
+		resp.Data["client_cert"] = conf.ClientCert
+	}
+	if conf.TLSServerName != "" {
+		resp.Data["tls_server_name"] = conf.TLSServerName
+	}
+	if conf.DefaultNamespace != "" {
+		resp.Data["default_namespace"] = conf.DefaultNamespace
+	}
+	if conf.DefaultPartition != "" {
+		resp.Data["default_partition"] = conf.DefaultPartition
+	}
+	if conf.DefaultLeaseTTL > 0 {
+		resp.Data["default_lease_ttl"] = int64(conf.DefaultLeaseTTL.Seconds())
+	}
+	if conf.MaxConcurrentRevocations > 0 {
+		resp.Data["max_concurrent_revocations"] = conf.MaxConcurrentRevocations
+	}
+
+	return resp, nil
 }
 
 func (b *backend) pathConfigAccessWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
 	config := accessConfig{
 		Address:    data.Get("address").(string),
 		Scheme:     data.Get("scheme").(string),
@@ -123,6 +238,32 @@ func (b *backend) pathConfigAccessWrite(ctx context.Context, req *logical.Reques
 		CACert:     data.Get("ca_cert").(string),
 		ClientCert: data.Get("client_cert").(string),
 		ClientKey:  data.Get("client_key").(string),
+
+		TLSServerName: data.Get("tls_server_name").(string),
+		MaxRetries:    data.Get("max_retries").(int),
+		IssuanceToken: data.Get("issuance_token").(string),
+
+		DefaultNamespace: data.Get("default_namespace").(string),
+		DefaultPartition: data.Get("default_partition").(string),
+
+		DescriptiveTokens: data.Get("descriptive_tokens").(bool),
+
+		MaxConcurrentRevocations: data.Get("max_concurrent_revocations").(int),
+	}
+
+	if config.MaxRetries < 0 {
+		return logical.ErrorResponse("max_retries must not be negative"), nil
+	}
+	if config.MaxConcurrentRevocations < 0 {
+		return logical.ErrorResponse("max_concurrent_revocations must not be negative"), nil
+	}
+	defaultLeaseTTL, err := roleDuration(data, "default_lease_ttl")
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	config.DefaultLeaseTTL = defaultLeaseTTL
+	if err := config.validateTLS(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
 	// If a token has not been given by the user, we try to boostrap the ACL
@@ -152,6 +293,21 @@ func (b *backend) pathConfigAccessWrite(ctx context.Context, req *logical.Reques
 	return nil, nil //nolint:nilnil
 }
 
+// pathConfigAccessDelete deletes the access configuration. Clients are
+// created from the stored configuration on every request, so credentials
+// requests fail as not configured right away, unless the environment
+// configures the backend.
+func (b *backend) pathConfigAccessDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	if err := req.Storage.Delete(ctx, "config/access"); err != nil {
+		return nil, err
+	}
+
+	return nil, nil //nolint:nilnil
+}
+
 type accessConfig struct {
 	Address    string `json:"address"`
 	Scheme     string `json:"scheme"`
@@ -159,6 +315,93 @@ type accessConfig struct {
 	CACert     string `json:"ca_cert"`
 	ClientCert string `json:"client_cert"`
 	ClientKey  string `json:"client_key"`
+
+	TLSServerName string `json:"tls_server_name"`
+	MaxRetries    int    `json:"max_retries"`
+	IssuanceToken string `json:"issuance_token"`
+
+	DefaultNamespace string `json:"default_namespace"`
+	DefaultPartition string `json:"default_partition"`
+
+	DescriptiveTokens bool `json:"descriptive_tokens"`
+
+	// DefaultLeaseTTL is the lease TTL of roles that do not set their own
+	DefaultLeaseTTL time.Duration `json:"default_lease_ttl"`
+
+	// MaxConcurrentRevocations bounds the tokens revoked at once, with zero
+	// for no limit
+	MaxConcurrentRevocations int `json:"max_concurrent_revocations"`
+
+	// fromEnv is set on configurations read from the environment rather
+	// than from storage
+	fromEnv bool
+}
+
+// The environment variables the access configuration is read from. They are
+// specific to the plugin rather than the CONSUL_HTTP_* variables of the Consul
+// CLI, which may configure the Consul storage or service registration of
+// OpenBao itself, whose token must not be used by every mount.
+const (
+	envAccessAddress = "VAULT_SECRETS_CONFIG_CONSUL_ADDR"
+	envAccessToken   = "VAULT_SECRETS_CONFIG_CONSUL_TOKEN"
+	envAccessSSL     = "VAULT_SECRETS_CONFIG_CONSUL_SSL"
+)
+
+// accessConfigFromEnv returns the access configuration given by the
+// VAULT_SECRETS_CONFIG_CONSUL_* environment variables, or nil when the
+// address is not set
+func accessConfigFromEnv() (*accessConfig, error) {
+	address := os.Getenv(envAccessAddress)
+	if address == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	conf := &accessConfig{
+		Address:    address,
+		Scheme:     "http",
+		Token:      os.Getenv(envAccessToken),
+		MaxRetries: defaultMaxRetries,
+		fromEnv:    true,
+	}
+
+	// The address may be given as a URL, like the Consul CLI accepts
+	if scheme, host, ok := strings.Cut(address, "://"); ok {
+		conf.Scheme = scheme
+		conf.Address = host
+	}
+	if ssl := os.Getenv(envAccessSSL); ssl != "" {
+		enabled, err := strconv.ParseBool(ssl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s environment variable %q: %w", envAccessSSL, ssl, err)
+		}
+		if enabled {
+			conf.Scheme = "https"
+		}
+	}
+	if conf.Scheme != "http" && conf.Scheme != "https" {
+		return nil, fmt.Errorf("invalid scheme %q in %s environment variable", conf.Scheme, envAccessAddress)
+	}
+
+	return conf, nil
+}
+
+// validateTLS checks that the certificates and key are PEM encoded and that
+// the client certificate and key are given together
+func (conf *accessConfig) validateTLS() error {
+	if conf.CACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(conf.CACert)) {
+		return fmt.Errorf("ca_cert must contain a PEM encoded certificate")
+	}
+
+	if (conf.ClientCert == "") != (conf.ClientKey == "") {
+		return fmt.Errorf("client_cert and client_key must be set together")
+	}
+	if conf.ClientCert != "" {
+		if _, err := tls.X509KeyPair([]byte(conf.ClientCert), []byte(conf.ClientKey)); err != nil {
+			return fmt.Errorf("invalid client_cert or client_key: %w", err)
+		}
+	}
+
+	return nil
 }
 
 func (conf *accessConfig) NewConfig() *api.Config {
@@ -166,9 +409,15 @@ func (conf *accessConfig) NewConfig() *api.Config {
 	consulConf.Address = conf.Address
 	consulConf.Scheme = conf.Scheme
 	consulConf.Token = conf.Token
-	consulConf.TLSConfig.CAPem = []byte(conf.CACert)
-	consulConf.TLSConfig.CertPEM = []byte(conf.ClientCert)
-	consulConf.TLSConfig.KeyPEM = []byte(conf.ClientKey)
+
+	if conf.Scheme == "https" {
+		consulConf.TLSConfig.CAPem = []byte(conf.CACert)
+		consulConf.TLSConfig.CertPEM = []byte(conf.ClientCert)
+		consulConf.TLSConfig.KeyPEM = []byte(conf.ClientKey)
+		if conf.TLSServerName != "" {
+			consulConf.TLSConfig.Address = conf.TLSServerName
+		}
+	}
 
 	return consulConf
 }
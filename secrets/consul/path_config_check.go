@@ -0,0 +1,253 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// authorizationRequest is a permission checked by the internal ACL
+// authorization endpoint of Consul, which its UI uses as well. The endpoint
+// is namespace and partition aware.
+type authorizationRequest struct {
+	Resource string `json:"Resource"`
+	Access   string `json:"Access"`
+}
+
+type authorizationResponse struct {
+	authorizationRequest
+	Allow bool `json:"Allow"`
+}
+
+// aclScope is a namespace and partition tokens are generated in
+type aclScope struct {
+	Namespace string
+	Partition string
+}
+
+func pathConfigCheck(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/check",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixConsul,
+			OperationVerb:   "check",
+			OperationSuffix: "access",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigCheckRead,
+			},
+		},
+
+		HelpSynopsis:    pathConfigCheckHelpSyn,
+		HelpDescription: pathConfigCheckHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigCheckRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	conf, userErr, intErr := b.readConfigAccess(ctx, req.Storage)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("no user error reported but consul access configuration not found")
+	}
+
+	scopes, err := b.roleScopes(ctx, req.Storage, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Failures are reported in the response, as finding them is the purpose
+	// of the check
+	ok := true
+	tokens := map[string]any{}
+	for name, token := range map[string]string{
+		"token":          conf.Token,
+		"issuance_token": conf.IssuanceToken,
+	} {
+		if token == "" {
+			continue
+		}
+		result, allowed := checkToken(ctx, conf, token, scopes)
+		tokens[name] = result
+		ok = ok && allowed
+	}
+
+	return &logical.Response{
+		Data: map[string]any{
+			"ok":     ok,
+			"tokens": tokens,
+		},
+	}, nil
+}
+
+// roleScopes returns the namespaces and partitions tokens are generated in,
+// as configured for the mount and its roles
+func (b *backend) roleScopes(ctx context.Context, s logical.Storage, conf *accessConfig) ([]aclScope, error) {
+	seen := map[aclScope]struct{}{
+		{Namespace: conf.DefaultNamespace, Partition: conf.DefaultPartition}: {},
+	}
+
+	roles, err := s.List(ctx, "policy/")
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		roleConfigData, err := readRole(ctx, s, role)
+		if err != nil {
+			return nil, err
+		}
+		if roleConfigData == nil {
+			continue
+		}
+
+		scope := aclScope{Namespace: roleConfigData.ConsulNamespace, Partition: roleConfigData.Partition}
+		if scope.Namespace == "" {
+			scope.Namespace = conf.DefaultNamespace
+		}
+		if scope.Partition == "" {
+			scope.Partition = conf.DefaultPartition
+		}
+		seen[scope] = struct{}{}
+	}
+
+	scopes := make([]aclScope, 0, len(seen))
+	for scope := range seen {
+		scopes = append(scopes, scope)
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		if scopes[i].Partition != scopes[j].Partition {
+			return scopes[i].Partition < scopes[j].Partition
+		}
+		return scopes[i].Namespace < scopes[j].Namespace
+	})
+	return scopes, nil
+}
+
+// checkToken reports whether the token is valid and allowed to create and
+// delete tokens, which requires acl = "write", in each of the scopes
+func checkToken(ctx context.Context, conf *accessConfig, token string, scopes []aclScope) (map[string]any, bool) {
+	result := map[string]any{}
+
+	consulConf := conf.NewConfig()
+	consulConf.Token = token
+	client, err := api.NewClient(consulConf)
+	if err != nil {
+		result["error"] = err.Error()
+		return result, false
+	}
+
+	queryOpts := &api.QueryOptions{}
+	self, _, err := client.ACL().TokenReadSelf(queryOpts.WithContext(ctx))
+	if err != nil {
+		result["error"] = fmt.Sprintf("error reading the token: %s", err)
+		return result, false
+	}
+	result["accessor"] = self.AccessorID
+
+	allowed := true
+	var checks []map[string]any
+	for _, scope := range scopes {
+		check := map[string]any{
+			"consul_namespace": scope.Namespace,
+			"partition":        scope.Partition,
+		}
+
+		allow, err := authorizeACLWrite(ctx, consulConf, scope)
+		if err != nil {
+			check["error"] = fmt.Sprintf("error checking permissions: %s", err)
+			allowed = false
+		} else {
+			check["acl_write"] = allow
+			allowed = allowed && allow
+		}
+		checks = append(checks, check)
+	}
+	result["scopes"] = checks
+
+	return result, allowed
+}
+
+// authorizeACLWrite asks Consul whether the token of consulConf is granted
+// acl = "write" in the scope. The API client only sends PUT requests, but the
+// authorization endpoint requires POST.
+func authorizeACLWrite(ctx context.Context, consulConf *api.Config, scope aclScope) (bool, error) {
+	httpClient, err := api.NewHttpClient(consulConf.Transport, consulConf.TLSConfig)
+	if err != nil {
+		return false, err
+	}
+
+	body, err := json.Marshal([]authorizationRequest{{Resource: "acl", Access: "write"}})
+	if err != nil {
+		return false, err
+	}
+
+	u := &url.URL{
+		Scheme: consulConf.Scheme,
+		Host:   consulConf.Address,
+		Path:   "/v1/internal/acl/authorize",
+	}
+	params := u.Query()
+	if scope.Namespace != "" {
+		params.Set("ns", scope.Namespace)
+	}
+	if scope.Partition != "" {
+		params.Set("partition", scope.Partition)
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-Consul-Token", consulConf.Token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, fmt.Errorf("unexpected response code: %d (%s)", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var authorizations []authorizationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authorizations); err != nil {
+		return false, fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(authorizations) != 1 {
+		return false, fmt.Errorf("expected 1 authorization, got %d", len(authorizations))
+	}
+	return authorizations[0].Allow, nil
+}
+
+const pathConfigCheckHelpSyn = `
+Check that the configured Consul tokens can generate and revoke tokens
+`
+
+const pathConfigCheckHelpDesc = `
+This path checks that the tokens configured at config/access are valid and
+are granted acl = "write", which is required to create and delete tokens, in
+the default namespace and partition of the mount and in those of every role.
+Problems are reported in the response rather than as errors.
+`
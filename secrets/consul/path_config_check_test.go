@@ -0,0 +1,358 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// testConsulACLServer answers the ACL requests of config/check. The
+// "management" token is granted acl = "write" everywhere, the "issuance"
+// token only outside of namespace ns1, and any other token does not exist.
+func testConsulACLServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Consul-Token")
+		if token != "management" && token != "issuance" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("ACL not found"))
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v1/acl/token/self" && r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(map[string]any{"AccessorID": token + "-accessor"})
+		case r.URL.Path == "/v1/internal/acl/authorize" && r.Method == http.MethodPost:
+			var requests []authorizationRequest
+			if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+				t.Errorf("failed to decode authorization request: %s", err)
+			}
+			var responses []authorizationResponse
+			for _, req := range requests {
+				allow := req.Resource == "acl" && req.Access == "write" &&
+					(token == "management" || r.URL.Query().Get("ns") != "ns1")
+				responses = append(responses, authorizationResponse{authorizationRequest: req, Allow: allow})
+			}
+			_ = json.NewEncoder(w).Encode(responses)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func TestConfig_Check(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := testConsulACLServer(t)
+	defer ts.Close()
+
+	check := func(connData map[string]any) map[string]any {
+		t.Helper()
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      "config/access",
+			Data:      connData,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.ReadOperation,
+			Path:      "config/check",
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("failed to check access: resp:%#v err:%s", resp, err)
+		}
+		return resp.Data
+	}
+
+	address := strings.TrimPrefix(ts.URL, "http://")
+	data := check(map[string]any{
+		"address": address,
+		"token":   "management",
+	})
+	if data["ok"] != true {
+		t.Fatalf("bad: %#v", data)
+	}
+	tokens := data["tokens"].(map[string]any)
+	expected := map[string]any{
+		"accessor": "management-accessor",
+		"scopes": []map[string]any{
+			{"consul_namespace": "", "partition": "", "acl_write": true},
+		},
+	}
+	if !reflect.DeepEqual(tokens["token"], expected) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expected, tokens["token"])
+	}
+
+	// The namespaces of the roles are checked as well
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test-ns",
+		Data: map[string]any{
+			"consul_policies":  []string{"test"},
+			"consul_namespace": "ns1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = check(map[string]any{
+		"address":        address,
+		"token":          "management",
+		"issuance_token": "issuance",
+	})
+	if data["ok"] != false {
+		t.Fatalf("bad: %#v", data)
+	}
+	tokens = data["tokens"].(map[string]any)
+	expected = map[string]any{
+		"accessor": "issuance-accessor",
+		"scopes": []map[string]any{
+			{"consul_namespace": "", "partition": "", "acl_write": true},
+			{"consul_namespace": "ns1", "partition": "", "acl_write": false},
+		},
+	}
+	if !reflect.DeepEqual(tokens["issuance_token"], expected) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expected, tokens["issuance_token"])
+	}
+
+	// Invalid tokens are reported
+	data = check(map[string]any{
+		"address": address,
+		"token":   "unknown",
+	})
+	tokens = data["tokens"].(map[string]any)
+	if data["ok"] != false || !strings.Contains(tokens["token"].(map[string]any)["error"].(string), "ACL not found") {
+		t.Fatalf("bad: %#v", data)
+	}
+}
+
+func TestConfig_CheckEnv(t *testing.T) {
+	ts := testConsulACLServer(t)
+	defer ts.Close()
+
+	// The variables of the Consul CLI are not used, they may configure the
+	// Consul storage of OpenBao itself
+	t.Setenv("CONSUL_HTTP_ADDR", ts.URL)
+	t.Setenv("CONSUL_HTTP_TOKEN", "management")
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "config/access",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected the backend not to be configured, got: %#v", resp)
+	}
+
+	t.Setenv("VAULT_SECRETS_CONFIG_CONSUL_ADDR", ts.URL)
+	t.Setenv("VAULT_SECRETS_CONFIG_CONSUL_TOKEN", "management")
+	t.Setenv("VAULT_SECRETS_CONFIG_CONSUL_SSL", "false")
+	b, err = Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]any) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Without config/access the environment is used
+	resp = request(logical.ReadOperation, "config/check", nil)
+	if resp == nil || resp.IsError() || resp.Data["ok"] != true {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	address := strings.TrimPrefix(ts.URL, "http://")
+	resp = request(logical.ReadOperation, "config/access", nil)
+	expected := map[string]any{
+		"address":            address,
+		"scheme":             "http",
+		"max_retries":        defaultMaxRetries,
+		"descriptive_tokens": false,
+		"source":             "environment",
+	}
+	if resp == nil || !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expected, resp)
+	}
+
+	// The token cannot be rotated in the environment
+	resp = request(logical.UpdateOperation, "config/rotate-root", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error rotating the token of the environment, got: %#v", resp)
+	}
+
+	// A written configuration takes precedence over the environment
+	request(logical.UpdateOperation, "config/access", map[string]any{
+		"address": address,
+		"token":   "unknown",
+	})
+	resp = request(logical.ReadOperation, "config/check", nil)
+	if resp == nil || resp.IsError() || resp.Data["ok"] != false {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = request(logical.ReadOperation, "config/access", nil)
+	if resp == nil || resp.Data["source"] != nil {
+		t.Fatalf("expected the written configuration, got: %#v", resp)
+	}
+
+	// Deleting the written configuration falls back to the environment
+	request(logical.DeleteOperation, "config/access", nil)
+	resp = request(logical.ReadOperation, "config/access", nil)
+	if resp == nil || resp.Data["source"] != "environment" {
+		t.Fatalf("expected the environment, got: %#v", resp)
+	}
+	request(logical.UpdateOperation, "config/access", map[string]any{
+		"address": address,
+		"token":   "unknown",
+	})
+
+	// Invalid environment variables are reported when the environment is used
+	t.Setenv("VAULT_SECRETS_CONFIG_CONSUL_SSL", "maybe")
+	b, err = Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = request(logical.ReadOperation, "config/check", map[string]any{})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected the written configuration to be used, got: %#v", resp)
+	}
+	config.StorageView = &logical.InmemStorage{}
+	resp = request(logical.ReadOperation, "config/check", nil)
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "VAULT_SECRETS_CONFIG_CONSUL_SSL") {
+		t.Fatalf("expected an error for VAULT_SECRETS_CONFIG_CONSUL_SSL, got: %#v", resp)
+	}
+}
+
+func TestConfig_RotateRootUnverified(t *testing.T) {
+	// The "legacy" token is not granted anything that can be copied, and the
+	// tokens created by "management" are not granted acl = "write"
+	var created, deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Consul-Token")
+		switch {
+		case r.URL.Path == "/v1/acl/token/self" && r.Method == http.MethodGet:
+			self := map[string]any{"AccessorID": token + "-accessor"}
+			if token == "management" {
+				self["Policies"] = []map[string]any{{"Name": "operator"}}
+			}
+			_ = json.NewEncoder(w).Encode(self)
+		case r.URL.Path == "/v1/acl/token" && r.Method == http.MethodPut:
+			created = append(created, token)
+			_ = json.NewEncoder(w).Encode(map[string]any{"AccessorID": "new-accessor", "SecretID": "new"})
+		case strings.HasPrefix(r.URL.Path, "/v1/acl/token/") && r.Method == http.MethodDelete:
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v1/acl/token/"))
+			_, _ = w.Write([]byte("true"))
+		case r.URL.Path == "/v1/internal/acl/authorize" && r.Method == http.MethodPost:
+			var requests []authorizationRequest
+			if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+				t.Errorf("failed to decode authorization request: %s", err)
+			}
+			var responses []authorizationResponse
+			for _, req := range requests {
+				responses = append(responses, authorizationResponse{authorizationRequest: req, Allow: token != "new"})
+			}
+			_ = json.NewEncoder(w).Encode(responses)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer ts.Close()
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]any) (*logical.Response, error) {
+		t.Helper()
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	address := strings.TrimPrefix(ts.URL, "http://")
+	if _, err := request(logical.UpdateOperation, "config/access", map[string]any{
+		"address": address,
+		"token":   "legacy",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := request(logical.UpdateOperation, "config/rotate-root", nil)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error rotating a legacy token, got: resp:%#v err:%s", resp, err)
+	}
+	if len(created) != 0 {
+		t.Fatalf("expected no token to be created, got: %#v", created)
+	}
+
+	// A new token that is not granted acl = "write" is deleted and the
+	// current token remains in use
+	if _, err := request(logical.UpdateOperation, "config/access", map[string]any{
+		"address": address,
+		"token":   "management",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = request(logical.UpdateOperation, "config/rotate-root", nil)
+	if err == nil || !strings.Contains(err.Error(), `acl = "write"`) {
+		t.Fatalf("expected the new token to be rejected, got: %v", err)
+	}
+	if !reflect.DeepEqual(created, []string{"management"}) || !reflect.DeepEqual(deleted, []string{"new-accessor"}) {
+		t.Fatalf("bad: created:%#v deleted:%#v", created, deleted)
+	}
+	entry, err := config.StorageView.Get(context.Background(), "config/access")
+	if err != nil || entry == nil {
+		t.Fatalf("failed to read configuration: entry:%#v err:%s", entry, err)
+	}
+	var conf accessConfig
+	if err := entry.DecodeJSON(&conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Token != "management" {
+		t.Fatalf("expected the current token to remain in use, got: %q", conf.Token)
+	}
+}
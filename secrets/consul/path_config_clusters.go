@@ -0,0 +1,291 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// clusterPrefix is the storage prefix of the named connections to Consul
+// clusters that roles can generate tokens in
+const clusterPrefix = "config/clusters/"
+
+func pathListClusters(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/clusters/?$",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixConsul,
+			OperationSuffix: "clusters",
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathClusterList,
+		},
+	}
+}
+
+func pathConfigClusters(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/clusters/" + framework.GenericNameRegex("name"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixConsul,
+			OperationSuffix: "cluster",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the cluster.",
+			},
+
+			"address": {
+				Type:        framework.TypeString,
+				Description: "Consul server address of the cluster",
+			},
+
+			"scheme": {
+				Type:        framework.TypeString,
+				Description: "URI scheme for the Consul address",
+				Default:     "http",
+			},
+
+			"token": {
+				Type:        framework.TypeString,
+				Description: "Token for API calls to the cluster",
+			},
+
+			"issuance_token": {
+				Type: framework.TypeString,
+				Description: `Token used to generate tokens in the cluster instead of
+token, which is then only used to revoke tokens.`,
+			},
+
+			"ca_cert": {
+				Type: framework.TypeString,
+				Description: `CA certificate to use when verifying Consul server certificate,
+must be x509 PEM encoded.`,
+			},
+
+			"client_cert": {
+				Type: framework.TypeString,
+				Description: `Client certificate used for Consul's TLS communication,
+must be x509 PEM encoded and if this is set you need to also set client_key.`,
+			},
+
+			"client_key": {
+				Type: framework.TypeString,
+				Description: `Client key used for Consul's TLS communication,
+must be x509 PEM encoded and if this is set you need to also set client_cert.`,
+			},
+
+			"tls_server_name": {
+				Type: framework.TypeString,
+				Description: `Name to use as the SNI host and to verify the Consul server
+certificate against, if it differs from the host of the address.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathClusterRead,
+			logical.UpdateOperation: b.pathClusterWrite,
+			logical.DeleteOperation: b.pathClusterDelete,
+		},
+
+		HelpSynopsis:    pathConfigClustersHelpSyn,
+		HelpDescription: pathConfigClustersHelpDesc,
+	}
+}
+
+// clusterConfig is a named connection to a Consul cluster. Roles that
+// reference it generate and revoke tokens in the cluster, with the other
+// settings of config/access.
+type clusterConfig struct {
+	Address    string `json:"address"`
+	Scheme     string `json:"scheme"`
+	Token      string `json:"token"`
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+
+	TLSServerName string `json:"tls_server_name"`
+	IssuanceToken string `json:"issuance_token"`
+}
+
+// apply returns a copy of the access configuration connecting to the cluster
+// instead
+func (c *clusterConfig) apply(conf accessConfig) *accessConfig {
+	conf.Address = c.Address
+	conf.Scheme = c.Scheme
+	conf.Token = c.Token
+	conf.CACert = c.CACert
+	conf.ClientCert = c.ClientCert
+	conf.ClientKey = c.ClientKey
+	conf.TLSServerName = c.TLSServerName
+	conf.IssuanceToken = c.IssuanceToken
+	return &conf
+}
+
+// readCluster returns the cluster with the given name, or nil if it does not
+// exist
+func readCluster(ctx context.Context, s logical.Storage, name string) (*clusterConfig, error) {
+	entry, err := s.Get(ctx, clusterPrefix+name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving cluster: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var cluster clusterConfig
+	if err := entry.DecodeJSON(&cluster); err != nil {
+		return nil, fmt.Errorf("error reading cluster %q: %w", name, err)
+	}
+	return &cluster, nil
+}
+
+// errClusterNotConfigured is the error of a role referencing a cluster that
+// does not exist
+func errClusterNotConfigured(name string) error {
+	return fmt.Errorf("cluster %q hasn't been configured; please configure it at the '/config/clusters/%s' endpoint", name, name)
+}
+
+// validateRoleCluster checks that the cluster the role generates tokens in
+// exists, so that roles are not written for clusters that were never
+// configured. It returns the user error and the internal error.
+func validateRoleCluster(ctx context.Context, s logical.Storage, role *roleConfig) (error, error) {
+	if role.Cluster == "" {
+		return nil, nil
+	}
+	cluster, err := readCluster(ctx, s, role.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return errClusterNotConfigured(role.Cluster), nil
+	}
+	return nil, nil
+}
+
+func (b *backend) pathClusterList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, clusterPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathClusterRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	cluster, err := readCluster(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	// The tokens and client key are never returned
+	resp := &logical.Response{
+		Data: map[string]any{
+			"address": cluster.Address,
+			"scheme":  cluster.Scheme,
+		},
+	}
+	if cluster.CACert != "" {
+		resp.Data["ca_cert"] = cluster.CACert
+	}
+	if cluster.ClientCert != "" {
+		resp.Data["client_cert"] = cluster.ClientCert
+	}
+	if cluster.TLSServerName != "" {
+		resp.Data["tls_server_name"] = cluster.TLSServerName
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathClusterWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	cluster := clusterConfig{
+		Address:    d.Get("address").(string),
+		Scheme:     d.Get("scheme").(string),
+		Token:      d.Get("token").(string),
+		CACert:     d.Get("ca_cert").(string),
+		ClientCert: d.Get("client_cert").(string),
+		ClientKey:  d.Get("client_key").(string),
+
+		TLSServerName: d.Get("tls_server_name").(string),
+		IssuanceToken: d.Get("issuance_token").(string),
+	}
+
+	if cluster.Address == "" {
+		return logical.ErrorResponse("address is required"), nil
+	}
+	// ACLs of other clusters are not bootstrapped, unlike with config/access
+	if cluster.Token == "" {
+		return logical.ErrorResponse("token is required"), nil
+	}
+	if err := cluster.apply(accessConfig{}).validateTLS(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(clusterPrefix+d.Get("name").(string), cluster)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil //nolint:nilnil
+}
+
+// pathClusterDelete deletes a cluster that no role references. The leases of
+// tokens generated in it cannot be revoked until it is written again.
+func (b *backend) pathClusterDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	roles, err := req.Storage.List(ctx, "policy/")
+	if err != nil {
+		return nil, err
+	}
+	var referencing []string
+	for _, roleName := range roles {
+		role, err := readRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Cluster == name {
+			referencing = append(referencing, roleName)
+		}
+	}
+	if len(referencing) > 0 {
+		slices.Sort(referencing)
+		return logical.ErrorResponse("cluster %q is used by roles: %s", name, strings.Join(referencing, ", ")), nil
+	}
+
+	if err := req.Storage.Delete(ctx, clusterPrefix+name); err != nil {
+		return nil, err
+	}
+	return nil, nil //nolint:nilnil
+}
+
+const pathConfigClustersHelpSyn = `
+Configure a named connection to a Consul cluster
+`
+
+const pathConfigClustersHelpDesc = `
+This path configures the address and tokens of a Consul cluster other than
+the one of config/access. Roles that set cluster to its name generate tokens
+in the cluster, and their leases are revoked in it. The other settings, such
+as max_retries and default_namespace, are those of config/access, or their
+defaults when it is not configured.
+`
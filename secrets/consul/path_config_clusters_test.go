@@ -0,0 +1,237 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// testConsulCluster is a fake Consul cluster that records the tokens created
+// and deleted in it, along with the token each request was made with
+type testConsulCluster struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	next    int
+	created []string
+	deleted []string
+	tokens  []string
+}
+
+func newTestConsulCluster(t *testing.T, name string) *testConsulCluster {
+	cluster := &testConsulCluster{}
+	cluster.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cluster.mu.Lock()
+		defer cluster.mu.Unlock()
+		cluster.tokens = append(cluster.tokens, r.Header.Get("X-Consul-Token"))
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/token":
+			cluster.next++
+			accessor := fmt.Sprintf("%s-accessor-%d", name, cluster.next)
+			cluster.created = append(cluster.created, accessor)
+			fmt.Fprintf(w, `{"AccessorID": %q, "SecretID": "secret"}`, accessor)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+			cluster.deleted = append(cluster.deleted, strings.TrimPrefix(r.URL.Path, "/v1/acl/token/"))
+			_, _ = w.Write([]byte("true"))
+		default:
+			t.Errorf("unexpected request to %s: %s %s", name, r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return cluster
+}
+
+func (c *testConsulCluster) address() string {
+	return strings.TrimPrefix(c.URL, "http://")
+}
+
+func TestConfig_Clusters(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mainCluster := newTestConsulCluster(t, "main")
+	defer mainCluster.Close()
+	eastCluster := newTestConsulCluster(t, "east")
+	defer eastCluster.Close()
+
+	request := func(operation logical.Operation, path string, data map[string]any) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	mustSucceed := func(resp *logical.Response) *logical.Response {
+		t.Helper()
+		if resp != nil && resp.IsError() {
+			t.Fatalf("unexpected error: %#v", resp)
+		}
+		return resp
+	}
+
+	mustSucceed(request(logical.UpdateOperation, "config/access", map[string]any{
+		"address": mainCluster.address(),
+		"token":   "main-management",
+	}))
+
+	resp := request(logical.UpdateOperation, "config/clusters/east", map[string]any{
+		"address": eastCluster.address(),
+	})
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "token is required") {
+		t.Fatalf("expected an error without a token, got: %#v", resp)
+	}
+	mustSucceed(request(logical.UpdateOperation, "config/clusters/east", map[string]any{
+		"address":        eastCluster.address(),
+		"token":          "east-management",
+		"issuance_token": "east-issuance",
+	}))
+
+	// The tokens are never returned
+	resp = mustSucceed(request(logical.ReadOperation, "config/clusters/east", nil))
+	expected := map[string]any{
+		"address": eastCluster.address(),
+		"scheme":  "http",
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expected, resp.Data)
+	}
+	resp = mustSucceed(request(logical.ListOperation, "config/clusters/", nil))
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"east"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	mustSucceed(request(logical.UpdateOperation, "roles/east", map[string]any{
+		"consul_policies": []string{"test"},
+		"cluster":         "east",
+	}))
+	mustSucceed(request(logical.UpdateOperation, "roles/main", map[string]any{
+		"consul_policies": []string{"test"},
+	}))
+	resp = mustSucceed(request(logical.ReadOperation, "roles/east", nil))
+	if resp.Data["cluster"] != "east" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Tokens are generated with the issuance token of the cluster of the role
+	eastResp := mustSucceed(request(logical.ReadOperation, "creds/east", nil))
+	mustSucceed(request(logical.ReadOperation, "creds/east", nil))
+	mainResp := mustSucceed(request(logical.ReadOperation, "creds/main", nil))
+	if !reflect.DeepEqual(eastCluster.created, []string{"east-accessor-1", "east-accessor-2"}) ||
+		!reflect.DeepEqual(mainCluster.created, []string{"main-accessor-1"}) {
+		t.Fatalf("bad: created in east:%v main:%v", eastCluster.created, mainCluster.created)
+	}
+	if !reflect.DeepEqual(eastCluster.tokens, []string{"east-issuance", "east-issuance"}) {
+		t.Fatalf("bad: tokens used in east: %v", eastCluster.tokens)
+	}
+	if eastResp.Secret.InternalData["cluster"] != "east" {
+		t.Fatalf("bad: %#v", eastResp.Secret.InternalData)
+	}
+	if _, ok := mainResp.Secret.InternalData["cluster"]; ok {
+		t.Fatalf("bad: %#v", mainResp.Secret.InternalData)
+	}
+
+	resp = request(logical.DeleteOperation, "config/clusters/east", nil)
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "used by roles: east") {
+		t.Fatalf("expected an error deleting a cluster used by a role, got: %#v", resp)
+	}
+
+	// Leases are revoked in the cluster their token was generated in, even
+	// once the role uses another one
+	mustSucceed(request(logical.UpdateOperation, "roles/east", map[string]any{
+		"consul_policies": []string{"test"},
+	}))
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.RevokeOperation,
+		Secret:    eastResp.Secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to revoke token: resp:%#v err:%s", resp, err)
+	}
+	resp = mustSucceed(request(logical.ReadOperation, "tokens/east/east-accessor-2", nil))
+	if resp.Data["cluster"] != "east" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = mustSucceed(request(logical.DeleteOperation, "tokens/east", nil))
+	if !reflect.DeepEqual(resp.Data["revoked"], []string{"east-accessor-2"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if !reflect.DeepEqual(eastCluster.deleted, []string{"east-accessor-1", "east-accessor-2"}) || len(mainCluster.deleted) != 0 {
+		t.Fatalf("bad: deleted in east:%v main:%v", eastCluster.deleted, mainCluster.deleted)
+	}
+	if eastCluster.tokens[len(eastCluster.tokens)-1] != "east-management" {
+		t.Fatalf("bad: tokens used in east: %v", eastCluster.tokens)
+	}
+
+	// Roles referencing a cluster that does not exist are rejected
+	resp = request(logical.UpdateOperation, "roles/missing", map[string]any{
+		"consul_policies": []string{"test"},
+		"cluster":         "missing",
+	})
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), `cluster "missing" hasn't been configured`) {
+		t.Fatalf("expected an error for the missing cluster, got: %#v", resp)
+	}
+	resp = request(logical.UpdateOperation, "import/roles", map[string]any{
+		"roles": map[string]any{
+			"missing": map[string]any{
+				"consul_policies": []string{"test"},
+				"cluster":         "missing",
+			},
+		},
+	})
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), `cluster "missing" hasn't been configured`) {
+		t.Fatalf("expected an error for the missing cluster, got: %#v", resp)
+	}
+	if resp := request(logical.ReadOperation, "roles/missing", nil); resp != nil {
+		t.Fatalf("expected the role not to be written, got: %#v", resp)
+	}
+
+	// Clusters do not require config/access
+	mustSucceed(request(logical.DeleteOperation, "config/access", nil))
+	mustSucceed(request(logical.UpdateOperation, "roles/east", map[string]any{
+		"consul_policies": []string{"test"},
+		"cluster":         "east",
+	}))
+	mustSucceed(request(logical.ReadOperation, "creds/east", nil))
+	if len(eastCluster.created) != 3 {
+		t.Fatalf("bad: created in east: %v", eastCluster.created)
+	}
+	resp = mustSucceed(request(logical.DeleteOperation, "tokens/east", nil))
+	if !reflect.DeepEqual(resp.Data["revoked"], []string{"east-accessor-3"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if eastCluster.deleted[len(eastCluster.deleted)-1] != "east-accessor-3" {
+		t.Fatalf("bad: deleted in east: %v", eastCluster.deleted)
+	}
+	mustSucceed(request(logical.UpdateOperation, "roles/east", map[string]any{
+		"consul_policies": []string{"test"},
+	}))
+
+	// Unused clusters can be deleted
+	mustSucceed(request(logical.DeleteOperation, "config/clusters/east", nil))
+	resp = request(logical.ReadOperation, "config/clusters/east", nil)
+	if resp != nil {
+		t.Fatalf("expected the cluster to be deleted, got: %#v", resp)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-multierror"
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+func pathConfigRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/rotate-root",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixConsul,
+			OperationVerb:   "rotate",
+			OperationSuffix: "root-token",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigRotateRootUpdate,
+			},
+		},
+
+		HelpSynopsis:    pathConfigRotateRootHelpSyn,
+		HelpDescription: pathConfigRotateRootHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRotateRootUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Prevent the access configuration from being written while the token is
+	// rotated, which would otherwise be overwritten with the rotated token
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	conf, userErr, intErr := b.readConfigAccess(ctx, req.Storage)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("no user error reported but consul access configuration not found")
+	}
+	// The rotated token could not be written back to the environment
+	if conf.fromEnv {
+		return logical.ErrorResponse("the access configuration is read from the environment, write it to config/access to rotate its token"), nil
+	}
+
+	oldClient, err := api.NewClient(conf.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	writeOpts := &api.WriteOptions{}
+	writeOpts = writeOpts.WithContext(ctx)
+	queryOpts := &api.QueryOptions{}
+	queryOpts = queryOpts.WithContext(ctx)
+
+	oldToken, _, err := oldClient.ACL().TokenReadSelf(queryOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the current token: %w", err)
+	}
+	// Legacy and management-type tokens are not granted their privileges
+	// through links that could be copied, so the new token would be granted
+	// nothing
+	if len(oldToken.Policies) == 0 && len(oldToken.Roles) == 0 && len(oldToken.ServiceIdentities) == 0 &&
+		len(oldToken.NodeIdentities) == 0 && len(oldToken.TemplatedPolicies) == 0 {
+		return logical.ErrorResponse("the current token is not granted any policy, role or identity that can be copied to a new token, rotate it manually"), nil
+	}
+
+	// The new token is granted exactly what the current token is granted
+	newToken, _, err := oldClient.ACL().TokenCreate(&api.ACLToken{
+		Description:       "OpenBao root token",
+		Policies:          oldToken.Policies,
+		Roles:             oldToken.Roles,
+		ServiceIdentities: oldToken.ServiceIdentities,
+		NodeIdentities:    oldToken.NodeIdentities,
+		TemplatedPolicies: oldToken.TemplatedPolicies,
+		Local:             oldToken.Local,
+		Namespace:         oldToken.Namespace,
+		Partition:         oldToken.Partition,
+	}, writeOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the new token: %w", err)
+	}
+
+	// If the new token cannot be stored, let's clean up after ourselves so
+	// the current token remains the only one in use
+	abort := func(err error) (*logical.Response, error) {
+		if _, delErr := oldClient.ACL().TokenDelete(newToken.AccessorID, writeOpts); delErr != nil {
+			err = multierror.Append(err, fmt.Errorf("error deleting newly created but unstored token %s: %w", newToken.AccessorID, delErr))
+		}
+		return nil, err
+	}
+
+	conf.Token = newToken.SecretID
+
+	newClient, err := api.NewClient(conf.NewConfig())
+	if err != nil {
+		return abort(err)
+	}
+
+	// Make sure the new token can be used to manage tokens wherever they are
+	// generated before switching to it, as the current token is then gone
+	if _, _, err := newClient.ACL().TokenReadSelf(queryOpts); err != nil {
+		return abort(fmt.Errorf("error verifying the new token: %w", err))
+	}
+	scopes, err := b.roleScopes(ctx, req.Storage, conf)
+	if err != nil {
+		return abort(err)
+	}
+	for _, scope := range scopes {
+		allow, err := authorizeACLWrite(ctx, conf.NewConfig(), scope)
+		if err != nil {
+			return abort(fmt.Errorf("error verifying the permissions of the new token: %w", err))
+		}
+		if !allow {
+			return abort(fmt.Errorf("the new token is not granted acl = \"write\" in namespace %q and partition %q", scope.Namespace, scope.Partition))
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config/access", conf)
+	if err != nil {
+		return abort(fmt.Errorf("error generating new access config JSON: %w", err))
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return abort(fmt.Errorf("error saving new access config: %w", err))
+	}
+
+	// Consul does not allow a token to delete itself, so the old token is
+	// deleted using the new one
+	if _, err := newClient.ACL().TokenDelete(oldToken.AccessorID, writeOpts); err != nil {
+		return nil, fmt.Errorf("error deleting old token %s: %w", oldToken.AccessorID, err)
+	}
+
+	return &logical.Response{
+		Data: map[string]any{
+			"accessor": newToken.AccessorID,
+		},
+	}, nil
+}
+
+const pathConfigRotateRootHelpSyn = `
+Request to rotate the Consul token used by OpenBao
+`
+
+const pathConfigRotateRootHelpDesc = `
+This path rotates the Consul token configured at config/access. A new token
+with the same policies, roles and identities as the current token is created.
+Once it is verified to be granted acl = "write" in the namespaces and
+partitions tokens are generated in, it is stored and the current token is
+deleted. Tokens that are not granted any policy, role or identity, such as
+legacy management tokens, cannot be rotated.
+`
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+func TestConfig_AccessDelete(t *testing.T) {
+	t.Setenv("VAULT_SECRETS_CONFIG_CONSUL_ADDR", "")
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]any) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := request(logical.UpdateOperation, "config/access", map[string]any{
+		"address": "127.0.0.1:8500",
+		"token":   "management",
+	})
+	if resp != nil {
+		t.Fatalf("failed to write configuration: %#v", resp)
+	}
+	resp = request(logical.UpdateOperation, "roles/test", map[string]any{
+		"consul_policies": []string{"test"},
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to write role: %#v", resp)
+	}
+
+	resp = request(logical.DeleteOperation, "config/access", nil)
+	if resp != nil {
+		t.Fatalf("failed to delete configuration: %#v", resp)
+	}
+
+	// Deleting an already deleted configuration succeeds
+	resp = request(logical.DeleteOperation, "config/access", nil)
+	if resp != nil {
+		t.Fatalf("failed to delete configuration again: %#v", resp)
+	}
+
+	for _, path := range []string{"config/access", "creds/test"} {
+		resp = request(logical.ReadOperation, path, nil)
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "haven't been configured") {
+			t.Fatalf("expected a not configured error reading %s, got: %#v", path, resp)
+		}
+	}
+
+	// The role is kept and the configuration can be written again
+	resp = request(logical.ReadOperation, "roles/test", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected the role to be kept, got: %#v", resp)
+	}
+	request(logical.UpdateOperation, "config/access", map[string]any{
+		"address": "127.0.0.1:8500",
+		"token":   "management",
+	})
+	resp = request(logical.ReadOperation, "config/access", nil)
+	if resp == nil || resp.IsError() || resp.Data["address"] != "127.0.0.1:8500" {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
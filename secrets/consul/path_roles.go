@@ -5,12 +5,31 @@ package consul
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/go-uuid"
 	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/helper/identitytpl"
 	"github.com/openbao/openbao/sdk/v2/logical"
 )
 
+const (
+	// renewStrategyExtend extends the lease of the same token on renewal
+	renewStrategyExtend = "extend"
+
+	// renewStrategyReissue replaces the token with a new one on renewal
+	renewStrategyReissue = "reissue"
+
+	// Where the lease TTL of the tokens of a role comes from
+	ttlSourceRole   = "role"
+	ttlSourceConfig = "config"
+	ttlSourceSystem = "system"
+)
+
 func pathListRoles(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "roles/?$",
@@ -48,6 +67,47 @@ or "consul_roles" are required for Consul 1.5 and above, or just "consul_policie
 using Consul 1.4.`,
 			},
 
+			"policies": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Use "consul_policies" instead. If this and "consul_policies" are both specified, only "consul_policies" will be used.`,
+				Deprecated:  true,
+			},
+
+			"consul_policy_ids": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `List of IDs of policies to attach to the token, in
+addition to "consul_policies". Unlike names, IDs are unique across namespaces.`,
+			},
+
+			"ignore_missing_policies": {
+				Type: framework.TypeBool,
+				Description: `If set, "consul_policies" that do not exist in Consul are left
+out of generated tokens with a warning, instead of failing the request.`,
+			},
+
+			"consul_policy_document": {
+				Type: framework.TypeString,
+				Description: `Raw HCL or JSON ACL policy document. A Consul policy
+is created from it for every generated token and deleted when the token is
+revoked.`,
+			},
+
+			"policy_template": {
+				Type: framework.TypeString,
+				Description: `ACL policy document templated with the identity of
+the requester, such as {{identity.entity.name}}. Values are rendered as
+quoted strings. A Consul policy is created from the rendered document for
+every generated token and deleted when the token is revoked.`,
+			},
+
+			"token_description_template": {
+				Type: framework.TypeString,
+				Description: `Template of the description of generated Consul tokens,
+such as "{{.MountPath}}{{.RoleName}} for {{.EntityName}}". Available fields
+are RoleName, MountPath, DisplayName, EntityID, EntityName and RequestID.
+Takes precedence over descriptive_tokens of config/access.`,
+			},
+
 			"consul_roles": {
 				Type: framework.TypeCommaStringSlice,
 				Description: `List of Consul roles to attach to the token. Either "consul_policies"
@@ -61,13 +121,43 @@ and instead be local to the current datacenter.`,
 			},
 
 			"ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `TTL for the Consul token created from the role, as a
+duration such as "6h" or a number of seconds.`,
+			},
+
+			"lease": {
 				Type:        framework.TypeDurationSecond,
-				Description: "TTL for the Consul token created from the role.",
+				Description: `Use "ttl" instead. If this and "ttl" are both specified, only "ttl" will be used.`,
+				Deprecated:  true,
 			},
 
 			"max_ttl": {
-				Type:        framework.TypeDurationSecond,
-				Description: "Max TTL for the Consul token created from the role.",
+				Type: framework.TypeDurationSecond,
+				Description: `Max TTL for the Consul token created from the role, as a
+duration such as "12h" or a number of seconds.`,
+			},
+
+			"use_consul_expiry": {
+				Type: framework.TypeBool,
+				Description: `Indicates that the token should also expire in Consul
+once the lease reaches its max TTL, in case OpenBao fails to revoke it.
+Available in Consul 1.5 and above.`,
+			},
+
+			"no_store": {
+				Type: framework.TypeBool,
+				Description: `If set, generated tokens are returned without a lease, so
+they cannot be renewed or revoked through OpenBao and only expire in Consul
+after their TTL. Requires use_consul_expiry.`,
+			},
+
+			"renew_strategy": {
+				Type: framework.TypeString,
+				Description: `How leases of the role are renewed, either "extend" to
+extend the lease of the same token, or "reissue" to replace the token with a
+new one returned by the renewal. Defaults to "extend".`,
+				Default: renewStrategyExtend,
 			},
 
 			"consul_namespace": {
@@ -82,16 +172,32 @@ created within. Defaults to 'default'. Available in Consul 1.7 and above.`,
 will be created within. Defaults to 'default'. Available in Consul 1.11 and above.`,
 			},
 
+			"cluster": {
+				Type: framework.TypeString,
+				Description: `Name of the cluster configured at config/clusters/<name> to
+generate tokens in, instead of the one of config/access.`,
+			},
+
 			"service_identities": {
 				Type: framework.TypeStringSlice,
 				Description: `List of Service Identities to attach to the
-token, separated by semicolons. Available in Consul 1.5 or above.`,
+token. An identity can be scoped to datacenters as <service>:<dc1>,<dc2>,
+in which case the list must be given as an array. Identities are created in
+the partition and namespace of the token. Available in Consul 1.5 or above.`,
 			},
 
 			"node_identities": {
 				Type: framework.TypeStringSlice,
 				Description: `List of Node Identities to attach to the
-token. Available in Consul 1.8.1 or above.`,
+token. Identities are created in the partition of the token, whose namespace
+must be the default one. Available in Consul 1.8.1 or above.`,
+			},
+
+			"templated_policies": {
+				Type: framework.TypeSlice,
+				Description: `List of templated policies to attach to the token, as
+objects such as {"template_name":"builtin/service","template_variables":{"name":"web"},"datacenters":["dc1"]}.
+Available in Consul 1.17 or above.`,
 			},
 		},
 
@@ -115,87 +221,252 @@ func (b *backend) pathRoleList(ctx context.Context, req *logical.Request, d *fra
 func (b *backend) pathRolesRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
 
-	entry, err := req.Storage.Get(ctx, "policy/"+name)
+	roleConfigData, err := readRole(ctx, req.Storage, name)
 	if err != nil {
 		return nil, err
 	}
-	if entry == nil {
+	if roleConfigData == nil {
 		return nil, nil //nolint:nilnil
 	}
 
-	var roleConfigData roleConfig
-	if err := entry.DecodeJSON(&roleConfigData); err != nil {
+	defaultTTL, err := b.defaultLeaseTTL(ctx, req.Storage)
+	if err != nil {
 		return nil, err
 	}
+	effectiveTTL, ttlSource := roleConfigData.leaseTTL(defaultTTL)
+	if ttlSource == ttlSourceSystem {
+		effectiveTTL = b.System().DefaultLeaseTTL()
+	}
 
 	// Generate the response
 	resp := &logical.Response{
 		Data: map[string]any{
-			"ttl":              int64(roleConfigData.TTL.Seconds()),
-			"max_ttl":          int64(roleConfigData.MaxTTL.Seconds()),
-			"local":            roleConfigData.Local,
-			"consul_namespace": roleConfigData.ConsulNamespace,
-			"partition":        roleConfigData.Partition,
+			"ttl":                     int64(roleConfigData.TTL.Seconds()),
+			"effective_ttl":           int64(effectiveTTL.Seconds()),
+			"ttl_source":              ttlSource,
+			"max_ttl":                 int64(roleConfigData.MaxTTL.Seconds()),
+			"local":                   roleConfigData.Local,
+			"use_consul_expiry":       roleConfigData.UseConsulExpiry,
+			"no_store":                roleConfigData.NoStore,
+			"renew_strategy":          roleConfigData.renewStrategy(),
+			"consul_namespace":        roleConfigData.ConsulNamespace,
+			"partition":               roleConfigData.Partition,
+			"ignore_missing_policies": roleConfigData.IgnoreMissingPolicies,
 		},
 	}
+	if roleConfigData.Cluster != "" {
+		resp.Data["cluster"] = roleConfigData.Cluster
+	}
 	if len(roleConfigData.Policies) > 0 {
 		resp.Data["consul_policies"] = roleConfigData.Policies
 	}
+	if len(roleConfigData.PolicyIDs) > 0 {
+		resp.Data["consul_policy_ids"] = roleConfigData.PolicyIDs
+	}
 	if len(roleConfigData.ConsulRoles) > 0 {
 		resp.Data["consul_roles"] = roleConfigData.ConsulRoles
 	}
+	if roleConfigData.PolicyDocument != "" {
+		resp.Data["consul_policy_document"] = roleConfigData.PolicyDocument
+	}
+	if roleConfigData.PolicyTemplate != "" {
+		resp.Data["policy_template"] = roleConfigData.PolicyTemplate
+	}
+	if roleConfigData.DescriptionTemplate != "" {
+		resp.Data["token_description_template"] = roleConfigData.DescriptionTemplate
+	}
 	if len(roleConfigData.ServiceIdentities) > 0 {
 		resp.Data["service_identities"] = roleConfigData.ServiceIdentities
 	}
 	if len(roleConfigData.NodeIdentities) > 0 {
 		resp.Data["node_identities"] = roleConfigData.NodeIdentities
 	}
+	if len(roleConfigData.TemplatedPolicies) > 0 {
+		resp.Data["templated_policies"] = roleConfigData.TemplatedPolicies
+	}
 
 	return resp, nil
 }
 
 func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, warnings, err := roleFromFieldData(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	userErr, intErr := validateRoleCluster(ctx, req.Storage, role)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+
+	name := d.Get("name").(string)
+	entry, err := logical.StorageEntryJSON("policy/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	if len(warnings) > 0 {
+		return &logical.Response{Warnings: warnings}, nil
+	}
+	return nil, nil //nolint:nilnil
+}
+
+// roleFromFieldData validates the fields of a role and returns its
+// configuration, along with warnings about fields that have no effect.
+// Errors are caused by invalid fields.
+func roleFromFieldData(d *framework.FieldData) (*roleConfig, []string, error) {
 	consulPolicies := d.Get("consul_policies").([]string)
+	policyIDs := d.Get("consul_policy_ids").([]string)
 	roles := d.Get("consul_roles").([]string)
 	serviceIdentities := d.Get("service_identities").([]string)
 	nodeIdentities := d.Get("node_identities").([]string)
+	policyDocument := d.Get("consul_policy_document").(string)
+	policyTemplate := d.Get("policy_template").(string)
+	descriptionTemplate := d.Get("token_description_template").(string)
 
-	var ttl time.Duration
-	ttlRaw, ok := d.GetOk("ttl")
-	if ok {
-		ttl = time.Second * time.Duration(ttlRaw.(int))
+	if err := validateServiceIdentities(serviceIdentities); err != nil {
+		return nil, nil, err
+	}
+	if err := validateNodeIdentitiesNamespace(nodeIdentities, d.Get("consul_namespace").(string)); err != nil {
+		return nil, nil, err
+	}
+	templatedPolicies, err := parseTemplatedPolicies(d.Get("templated_policies").([]any))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, id := range policyIDs {
+		if _, err := uuid.ParseUUID(id); err != nil {
+			return nil, nil, fmt.Errorf("invalid policy ID %q in consul_policy_ids: must be a UUID", id)
+		}
+	}
+	if policyDocument != "" && policyTemplate != "" {
+		return nil, nil, errors.New("consul_policy_document and policy_template are mutually exclusive")
+	}
+	if policyTemplate != "" {
+		_, _, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+			String:            policyTemplate,
+			ValidityCheckOnly: true,
+			Mode:              identitytpl.JSONTemplating,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid policy_template: %w", err)
+		}
 	}
 
-	var maxTTL time.Duration
-	maxTTLRaw, ok := d.GetOk("max_ttl")
-	if ok {
-		maxTTL = time.Second * time.Duration(maxTTLRaw.(int))
+	if descriptionTemplate != "" {
+		if err := validateDescriptionTemplate(descriptionTemplate); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	name := d.Get("name").(string)
-	local := d.Get("local").(bool)
-	namespace := d.Get("consul_namespace").(string)
-	partition := d.Get("partition").(string)
-	entry, err := logical.StorageEntryJSON("policy/"+name, roleConfig{
-		Policies:          consulPolicies,
-		ConsulRoles:       roles,
-		ServiceIdentities: serviceIdentities,
-		NodeIdentities:    nodeIdentities,
-		TTL:               ttl,
-		MaxTTL:            maxTTL,
-		Local:             local,
-		ConsulNamespace:   namespace,
-		Partition:         partition,
-	})
+	var warnings []string
+	if legacyPolicies, ok := d.GetOk("policies"); ok {
+		warnings = append(warnings, "policies is deprecated, use consul_policies instead")
+		if _, ok := d.GetOk("consul_policies"); !ok {
+			consulPolicies = legacyPolicies.([]string)
+		} else if !strutil.EquivalentSlices(legacyPolicies.([]string), consulPolicies) {
+			warnings = append(warnings, fmt.Sprintf("policies %q and consul_policies %q are both set, only consul_policies is used",
+				legacyPolicies, consulPolicies))
+		}
+	}
+
+	ttl, err := roleDuration(d, "ttl")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	lease, err := roleDuration(d, "lease")
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := d.GetOk("ttl"); !ok {
+		ttl = lease
+	} else if _, ok := d.GetOk("lease"); ok && lease != ttl {
+		warnings = append(warnings, fmt.Sprintf("lease (%s) and ttl (%s) are both set, only ttl is used", lease, ttl))
+	}
+	maxTTL, err := roleDuration(d, "max_ttl")
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxTTL > 0 && ttl > maxTTL {
+		return nil, nil, errors.New("ttl cannot be greater than max_ttl")
 	}
 
-	if err := req.Storage.Put(ctx, entry); err != nil {
-		return nil, err
+	// Tokens without a lease are never revoked by OpenBao, so they have to
+	// expire in Consul and cannot own a policy that would outlive them
+	noStore := d.Get("no_store").(bool)
+	if noStore {
+		if !d.Get("use_consul_expiry").(bool) {
+			return nil, nil, errors.New("no_store requires use_consul_expiry")
+		}
+		if policyDocument != "" || policyTemplate != "" {
+			return nil, nil, errors.New("no_store cannot be combined with consul_policy_document or policy_template")
+		}
 	}
 
-	return nil, nil //nolint:nilnil
+	renewStrategy := d.Get("renew_strategy").(string)
+	switch renewStrategy {
+	case renewStrategyExtend:
+	case renewStrategyReissue:
+		// The template would be rendered for whoever renews the lease
+		if policyTemplate != "" {
+			return nil, nil, errors.New("renew_strategy reissue cannot be combined with policy_template")
+		}
+		if noStore {
+			return nil, nil, errors.New("renew_strategy reissue cannot be combined with no_store")
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid renew_strategy %q, must be %q or %q", renewStrategy, renewStrategyExtend, renewStrategyReissue)
+	}
+
+	return &roleConfig{
+		Policies:              consulPolicies,
+		PolicyIDs:             policyIDs,
+		IgnoreMissingPolicies: d.Get("ignore_missing_policies").(bool),
+		ConsulRoles:           roles,
+		PolicyDocument:        policyDocument,
+		PolicyTemplate:        policyTemplate,
+		ServiceIdentities:     serviceIdentities,
+		DescriptionTemplate:   descriptionTemplate,
+		NodeIdentities:        nodeIdentities,
+		TemplatedPolicies:     templatedPolicies,
+		TTL:                   ttl,
+		MaxTTL:                maxTTL,
+		Local:                 d.Get("local").(bool),
+		UseConsulExpiry:       d.Get("use_consul_expiry").(bool),
+		NoStore:               noStore,
+		RenewStrategy:         renewStrategy,
+		ConsulNamespace:       d.Get("consul_namespace").(string),
+		Partition:             d.Get("partition").(string),
+		Cluster:               d.Get("cluster").(string),
+	}, warnings, nil
+}
+
+// maxRoleTTL is the longest ttl and max_ttl of roles. Longer durations are
+// most likely given in the wrong unit.
+const maxRoleTTL = 10 * 365 * 24 * time.Hour
+
+// roleDuration returns the duration of a TTL field of a role, which is
+// given as a duration string or as a number of seconds
+func roleDuration(d *framework.FieldData, field string) (time.Duration, error) {
+	raw, ok := d.GetOk(field)
+	if !ok {
+		return 0, nil
+	}
+	seconds := int64(raw.(int))
+	if seconds < 0 {
+		return 0, fmt.Errorf("%s must not be negative", field)
+	}
+	// Checked in seconds, as larger values overflow a time.Duration
+	if seconds > int64(maxRoleTTL/time.Second) {
+		return 0, fmt.Errorf("%s must not be longer than %d seconds", field, int64(maxRoleTTL/time.Second))
+	}
+	return time.Duration(seconds) * time.Second, nil
 }
 
 func (b *backend) pathRolesDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -207,13 +478,102 @@ func (b *backend) pathRolesDelete(ctx context.Context, req *logical.Request, d *
 }
 
 type roleConfig struct {
-	Policies          []string      `json:"policies"`
-	ConsulRoles       []string      `json:"consul_roles"`
-	ServiceIdentities []string      `json:"service_identities"`
-	NodeIdentities    []string      `json:"node_identities"`
-	TTL               time.Duration `json:"lease"`
-	MaxTTL            time.Duration `json:"max_ttl"`
-	Local             bool          `json:"local"`
-	ConsulNamespace   string        `json:"consul_namespace"`
-	Partition         string        `json:"partition"`
+	Policies          []string           `json:"policies"`
+	PolicyIDs         []string           `json:"policy_ids"`
+	ConsulRoles       []string           `json:"consul_roles"`
+	PolicyDocument    string             `json:"consul_policy_document"`
+	PolicyTemplate    string             `json:"policy_template"`
+	ServiceIdentities []string           `json:"service_identities"`
+	NodeIdentities    []string           `json:"node_identities"`
+	TemplatedPolicies []*templatedPolicy `json:"templated_policies,omitempty"`
+	TTL               time.Duration      `json:"lease"`
+	MaxTTL            time.Duration      `json:"max_ttl"`
+	Local             bool               `json:"local"`
+	UseConsulExpiry   bool               `json:"use_consul_expiry"`
+	NoStore           bool               `json:"no_store"`
+	RenewStrategy     string             `json:"renew_strategy"`
+	ConsulNamespace   string             `json:"consul_namespace"`
+	Partition         string             `json:"partition"`
+
+	// Cluster is the name of the cluster tokens are generated in, empty for
+	// the one of config/access
+	Cluster string `json:"cluster,omitempty"`
+
+	DescriptionTemplate   string `json:"token_description_template"`
+	IgnoreMissingPolicies bool   `json:"ignore_missing_policies"`
+}
+
+// legacyRoleConfig holds the fields of roles written by versions supporting
+// the legacy ACL system of Consul
+type legacyRoleConfig struct {
+	// Policy is the base64 encoded ACL policy of the tokens of the role
+	Policy string `json:"policy"`
+}
+
+// readRole returns the role with the given name, or nil if it does not exist.
+// Roles written with a legacy base64 policy are migrated to a
+// consul_policy_document, from which the same policy is created for every
+// token, and stored again so that they are only migrated once.
+func readRole(ctx context.Context, s logical.Storage, name string) (*roleConfig, error) {
+	entry, err := s.Get(ctx, "policy/"+name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var role roleConfig
+	if err := entry.DecodeJSON(&role); err != nil {
+		return nil, err
+	}
+	var legacy legacyRoleConfig
+	if err := entry.DecodeJSON(&legacy); err != nil {
+		return nil, err
+	}
+	if legacy.Policy == "" {
+		return &role, nil
+	}
+
+	rules, err := base64.StdEncoding.DecodeString(legacy.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the legacy policy of role %q: %w", name, err)
+	}
+	role.PolicyDocument = string(rules)
+
+	entry, err = logical.StorageEntryJSON("policy/"+name, &role)
+	if err != nil {
+		return nil, err
+	}
+	// Roles are still migrated in memory where the storage is read-only
+	if err := s.Put(ctx, entry); err != nil && !errors.Is(err, logical.ErrReadOnly) {
+		return nil, fmt.Errorf("failed to store migrated role %q: %w", name, err)
+	}
+	return &role, nil
+}
+
+// leaseTTL returns the lease TTL of the tokens of the role and where it comes
+// from: the ttl of the role, the default_lease_ttl of config/access, capped at
+// the max_ttl of the role, or zero for the default of the mount
+func (r *roleConfig) leaseTTL(defaultTTL time.Duration) (time.Duration, string) {
+	switch {
+	case r.TTL > 0:
+		return r.TTL, ttlSourceRole
+	case defaultTTL > 0:
+		if r.MaxTTL > 0 && defaultTTL > r.MaxTTL {
+			return r.MaxTTL, ttlSourceConfig
+		}
+		return defaultTTL, ttlSourceConfig
+	default:
+		return 0, ttlSourceSystem
+	}
+}
+
+// renewStrategy returns how the leases of the role are renewed. Roles
+// written before renew_strategy extend their leases.
+func (r *roleConfig) renewStrategy() string {
+	if r.RenewStrategy == "" {
+		return renewStrategyExtend
+	}
+	return r.RenewStrategy
 }
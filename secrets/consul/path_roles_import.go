@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// roleNameRegex matches the names roles can be written under
+var roleNameRegex = regexp.MustCompile("^" + framework.GenericNameRegex("name") + "$")
+
+func pathRoleImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "import/roles",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixConsul,
+			OperationVerb:   "import",
+			OperationSuffix: "roles",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"roles": {
+				Type: framework.TypeMap,
+				Description: `Map of role names to role definitions, with the same
+fields as roles/<name>.`,
+				Required: true,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathRoleImportWrite,
+			},
+		},
+
+		HelpSynopsis:    pathRoleImportHelpSyn,
+		HelpDescription: pathRoleImportHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	definitions := d.Get("roles").(map[string]any)
+	if len(definitions) == 0 {
+		return logical.ErrorResponse("roles must contain at least one role"), nil
+	}
+
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Every role is validated as by roles/<name> before any is written, so
+	// that an invalid role does not leave the import half done
+	schema := pathRoles(b).Fields
+	entries := make([]*logical.StorageEntry, 0, len(names))
+	var invalid, warnings []string
+	for _, name := range names {
+		role, roleWarnings, err := importedRole(schema, name, definitions[name])
+		if err == nil {
+			var intErr error
+			err, intErr = validateRoleCluster(ctx, req.Storage, role)
+			if intErr != nil {
+				return nil, intErr
+			}
+		}
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%q: %s", name, err))
+			continue
+		}
+		warnings = append(warnings, roleWarnings...)
+
+		entry, err := logical.StorageEntryJSON("policy/"+name, role)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if len(invalid) > 0 {
+		return logical.ErrorResponse("no roles were imported, %d of %d roles are invalid: %s",
+			len(invalid), len(names), strings.Join(invalid, "; ")), nil
+	}
+
+	// The roles are written in a single transaction when the storage
+	// supports it
+	rollback, err := logical.StartTxStorage(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback()
+
+	for i, entry := range entries {
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, fmt.Errorf("failed to import role %q, roles written before it: %q: %w", names[i], names[:i], err)
+		}
+	}
+
+	if err := logical.EndTxStorage(ctx, req); err != nil {
+		return nil, fmt.Errorf("failed to import roles: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]any{
+			"imported": names,
+		},
+		Warnings: warnings,
+	}, nil
+}
+
+// importedRole validates the definition of an imported role against the
+// fields of roles/<name>. Unknown fields are ignored with a warning, like
+// they are on roles/<name>.
+func importedRole(schema map[string]*framework.FieldSchema, name string, definition any) (*roleConfig, []string, error) {
+	if !roleNameRegex.MatchString(name) {
+		return nil, nil, errors.New("invalid role name")
+	}
+	raw, ok := definition.(map[string]any)
+	if !ok {
+		return nil, nil, errors.New("role definition must be an object")
+	}
+
+	var warnings []string
+	for field := range raw {
+		if _, ok := schema[field]; !ok || field == "name" {
+			warnings = append(warnings, fmt.Sprintf("role %q: ignored unrecognized field %q", name, field))
+		}
+	}
+	sort.Strings(warnings)
+
+	fieldData := &framework.FieldData{
+		Raw:    raw,
+		Schema: schema,
+	}
+	if err := fieldData.Validate(); err != nil {
+		return nil, nil, err
+	}
+	role, roleWarnings, err := roleFromFieldData(fieldData)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, warning := range roleWarnings {
+		warnings = append(warnings, fmt.Sprintf("role %q: %s", name, warning))
+	}
+	return role, warnings, nil
+}
+
+const pathRoleImportHelpSyn = `
+Create or update several roles at once
+`
+
+const pathRoleImportHelpDesc = `
+This path creates or updates the roles of a map of role names to role
+definitions, which take the same fields as roles/<name>. All roles are
+validated first, and none is written if any is invalid, in which case the
+error lists every invalid role. The roles are written in a single transaction
+when the storage supports transactions.
+`
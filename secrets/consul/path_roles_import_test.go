@@ -0,0 +1,112 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+func TestRole_Import(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importRoles := func(roles map[string]any) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      "import/roles",
+			Data: map[string]any{
+				"roles": roles,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	listRoles := func() []string {
+		t.Helper()
+		keys, err := config.StorageView.List(context.Background(), "policy/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+
+	// An invalid role fails the whole import and every invalid role is
+	// reported
+	resp := importRoles(map[string]any{
+		"web": map[string]any{"consul_policies": "web"},
+		"api": map[string]any{"consul_policies": "api", "ttl": "2h", "max_ttl": "1h"},
+		"db":  map[string]any{"consul_policy_ids": "db"},
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+	for _, expected := range []string{"2 of 3 roles are invalid", `"api": ttl cannot be greater than max_ttl`, `"db": invalid policy ID`} {
+		if !strings.Contains(resp.Error().Error(), expected) {
+			t.Fatalf("expected %q in error: %s", expected, resp.Error())
+		}
+	}
+	if keys := listRoles(); len(keys) != 0 {
+		t.Fatalf("expected no roles to be written: %v", keys)
+	}
+
+	resp = importRoles(map[string]any{
+		"web": map[string]any{"consul_policies": "web", "ttl": "1h"},
+		"api": map[string]any{"consul_roles": []any{"api"}, "polices": "api"},
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to import roles: %#v", resp)
+	}
+	if !reflect.DeepEqual(resp.Data["imported"], []string{"api", "web"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], `"polices"`) {
+		t.Fatalf("expected a warning for the unrecognized field: %#v", resp.Warnings)
+	}
+
+	// The roles are the same as if written with roles/<name>
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "roles/web",
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("failed to read role: resp:%#v err:%s", resp, err)
+	}
+	if !reflect.DeepEqual(resp.Data["consul_policies"], []string{"web"}) || resp.Data["ttl"] != int64(time.Hour.Seconds()) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if keys := listRoles(); !reflect.DeepEqual(keys, []string{"api", "web"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// A role named import is managed like any other role
+	resp = importRoles(map[string]any{
+		"import": map[string]any{"consul_policies": "import"},
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to import roles: %#v", resp)
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "roles/import",
+	})
+	if err != nil || resp == nil || !reflect.DeepEqual(resp.Data["consul_policies"], []string{"import"}) {
+		t.Fatalf("failed to read role: resp:%#v err:%s", resp, err)
+	}
+}
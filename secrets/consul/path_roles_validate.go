@@ -0,0 +1,189 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+func pathRoleValidate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("name") + "/validate",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixConsul,
+			OperationVerb:   "validate",
+			OperationSuffix: "role",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathRoleValidateRead,
+			},
+		},
+
+		HelpSynopsis:    pathRoleValidateHelpSyn,
+		HelpDescription: pathRoleValidateHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleValidateRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role := d.Get("name").(string)
+	roleConfigData, err := readRole(ctx, req.Storage, role)
+	if err != nil {
+		return nil, err
+	}
+	if roleConfigData == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", role)), nil
+	}
+
+	// The entities are looked up with the token tokens are generated with,
+	// which has to be able to read them to attach them
+	c, conf, userErr, intErr := b.issuanceClient(ctx, req.Storage, roleConfigData.Cluster)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+
+	scope := aclScope{Namespace: roleConfigData.ConsulNamespace, Partition: roleConfigData.Partition}
+	if scope.Namespace == "" {
+		scope.Namespace = conf.DefaultNamespace
+	}
+	if scope.Partition == "" {
+		scope.Partition = conf.DefaultPartition
+	}
+
+	// Problems are reported in the response, as finding them is the purpose
+	// of the validation
+	missing := map[string][]string{}
+	inaccessible := map[string]map[string]string{}
+	unregistered := map[string][]string{}
+	var warnings []string
+
+	queryOpts := (&api.QueryOptions{
+		Namespace: scope.Namespace,
+		Partition: scope.Partition,
+	}).WithContext(ctx)
+
+	for _, name := range roleConfigData.Policies {
+		policy, _, err := c.ACL().PolicyReadByName(name, queryOpts)
+		recordLookup(missing, inaccessible, "consul_policies", name, policy != nil, err)
+	}
+	for _, id := range roleConfigData.PolicyIDs {
+		policy, _, err := c.ACL().PolicyRead(id, queryOpts)
+		// Unlike lookups by name, lookups by ID fail for missing policies
+		var statusErr api.StatusError
+		if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+			err = nil
+		}
+		recordLookup(missing, inaccessible, "consul_policy_ids", id, policy != nil, err)
+	}
+	for _, name := range roleConfigData.ConsulRoles {
+		consulRole, _, err := c.ACL().RoleReadByName(name, queryOpts)
+		recordLookup(missing, inaccessible, "consul_roles", name, consulRole != nil, err)
+	}
+
+	for _, policy := range roleConfigData.TemplatedPolicies {
+		template, _, err := c.ACL().TemplatedPolicyReadByName(policy.TemplateName, queryOpts)
+		recordLookup(missing, inaccessible, "templated_policies", policy.TemplateName, template != nil, err)
+	}
+
+	// Identities do not require the service or node to exist, they are only
+	// reported when they are not registered
+	for _, identity := range parseServiceIdentities(roleConfigData.ServiceIdentities) {
+		datacenters := identity.Datacenters
+		if len(datacenters) == 0 {
+			datacenters = []string{""}
+		}
+		for _, datacenter := range datacenters {
+			opts := *queryOpts
+			opts.Datacenter = datacenter
+			services, _, err := c.Catalog().Service(identity.ServiceName, "", &opts)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("failed to look up service %q: %s", identity.ServiceName, err))
+				continue
+			}
+			if len(services) == 0 {
+				unregistered["service_identities"] = append(unregistered["service_identities"], identityName(identity.ServiceName, datacenter))
+			}
+		}
+	}
+	for _, identity := range parseNodeIdentities(roleConfigData.NodeIdentities) {
+		// Nodes are not namespaced
+		opts := &api.QueryOptions{
+			Partition:  scope.Partition,
+			Datacenter: identity.Datacenter,
+		}
+		node, _, err := c.Catalog().Node(identity.NodeName, opts.WithContext(ctx))
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to look up node %q: %s", identity.NodeName, err))
+			continue
+		}
+		if node == nil {
+			unregistered["node_identities"] = append(unregistered["node_identities"], identityName(identity.NodeName, identity.Datacenter))
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]any{
+			"valid":            len(missing) == 0 && len(inaccessible) == 0,
+			"consul_namespace": scope.Namespace,
+			"partition":        scope.Partition,
+			"missing":          missing,
+			"inaccessible":     inaccessible,
+			"unregistered":     unregistered,
+		},
+		Warnings: warnings,
+	}, nil
+}
+
+// recordLookup records an ACL policy or role of the kind as missing when it
+// was not found, or as inaccessible when it could not be read
+func recordLookup(missing map[string][]string, inaccessible map[string]map[string]string, kind, name string, found bool, err error) {
+	switch {
+	case err != nil:
+		if inaccessible[kind] == nil {
+			inaccessible[kind] = map[string]string{}
+		}
+		inaccessible[kind][name] = err.Error()
+	case !found:
+		missing[kind] = append(missing[kind], name)
+	}
+}
+
+// identityName formats an identity as configured on roles, with the
+// datacenter it is looked up in if any
+func identityName(name, datacenter string) string {
+	return strings.TrimSuffix(name+":"+datacenter, ":")
+}
+
+const pathRoleValidateHelpSyn = `
+Check that the entities referenced by a role exist in Consul
+`
+
+const pathRoleValidateHelpDesc = `
+This path looks up the consul_policies, consul_policy_ids and consul_roles of
+the role in its namespace and partition with the token used to generate
+tokens, without generating one. Policies and roles that do not exist are
+reported as missing, and those that cannot be read as inaccessible. Service
+and node identities do not require the service or node to exist, but those
+that are not registered are reported as unregistered.
+`
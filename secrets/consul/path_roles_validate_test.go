@@ -0,0 +1,148 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// testConsulCatalogServer answers the lookups of roles/<name>/validate. The
+// "write" policy, the "ops" role, the "web" service and the "node1" node
+// exist, as well as the policy with ID 5f4b3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d.
+// Reading the "secret" policy is denied and nothing else exists.
+func testConsulCatalogServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Nodes are not namespaced
+		if r.URL.Query().Get("ns") != "ns1" && !strings.HasPrefix(r.URL.Path, "/v1/catalog/node/") {
+			t.Errorf("expected lookup in namespace ns1: %s", r.URL)
+		}
+
+		switch r.URL.Path {
+		case "/v1/acl/policy/name/write":
+			_, _ = w.Write([]byte(`{"ID": "policy-id", "Name": "write"}`))
+		case "/v1/acl/policy/name/secret":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("Permission denied"))
+		case "/v1/acl/policy/5f4b3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d":
+			_, _ = w.Write([]byte(`{"ID": "5f4b3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d", "Name": "read"}`))
+		case "/v1/acl/role/name/ops":
+			_, _ = w.Write([]byte(`{"ID": "role-id", "Name": "ops"}`))
+		case "/v1/catalog/service/web":
+			_, _ = w.Write([]byte(`[{"ServiceName": "web"}]`))
+		case "/v1/catalog/node/node1":
+			_, _ = w.Write([]byte(`{"Node": {"Node": "node1"}}`))
+		default:
+			switch {
+			case strings.HasPrefix(r.URL.Path, "/v1/acl/"):
+				w.WriteHeader(http.StatusNotFound)
+			case strings.HasPrefix(r.URL.Path, "/v1/catalog/service/"):
+				_, _ = w.Write([]byte(`[]`))
+			default:
+				_, _ = w.Write([]byte(`null`))
+			}
+		}
+	}))
+}
+
+func TestRole_Validate(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := testConsulCatalogServer(t)
+	defer ts.Close()
+
+	for _, req := range []struct {
+		path string
+		data map[string]any
+	}{
+		{"config/access", map[string]any{
+			"address":           strings.TrimPrefix(ts.URL, "http://"),
+			"token":             "management",
+			"default_namespace": "ns1",
+		}},
+		{"roles/test", map[string]any{
+			"consul_policies":    []string{"write", "wrtie", "secret"},
+			"consul_policy_ids":  []string{"5f4b3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d", "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"},
+			"consul_roles":       []string{"ops", "opps"},
+			"service_identities": []string{"web", "api:dc1"},
+			"node_identities":    []string{"node1:dc1", "node2:dc1"},
+		}},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      req.path,
+			Data:      req.data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to write %s: resp:%#v err:%s", req.path, resp, err)
+		}
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "roles/test/validate",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to validate role: resp:%#v err:%s", resp, err)
+	}
+
+	if resp.Data["valid"] != false || resp.Data["consul_namespace"] != "ns1" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	expectedMissing := map[string][]string{
+		"consul_policies":   {"wrtie"},
+		"consul_policy_ids": {"0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"},
+		"consul_roles":      {"opps"},
+	}
+	if !reflect.DeepEqual(resp.Data["missing"], expectedMissing) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expectedMissing, resp.Data["missing"])
+	}
+	inaccessible := resp.Data["inaccessible"].(map[string]map[string]string)
+	if len(inaccessible) != 1 || !strings.Contains(inaccessible["consul_policies"]["secret"], "403") {
+		t.Fatalf("bad: %#v", inaccessible)
+	}
+	expectedUnregistered := map[string][]string{
+		"service_identities": {"api:dc1"},
+		"node_identities":    {"node2:dc1"},
+	}
+	if !reflect.DeepEqual(resp.Data["unregistered"], expectedUnregistered) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expectedUnregistered, resp.Data["unregistered"])
+	}
+
+	// Unknown roles are reported as errors
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "roles/unknown/validate",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for an unknown role: resp:%#v err:%s", resp, err)
+	}
+
+	// Policy IDs must be UUIDs
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test",
+		Data: map[string]any{
+			"consul_policy_ids": []string{"read"},
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for a malformed policy ID: resp:%#v err:%s", resp, err)
+	}
+}
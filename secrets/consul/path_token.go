@@ -5,15 +5,32 @@ package consul
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-uuid"
 	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/helper/identitytpl"
+	"github.com/openbao/openbao/sdk/v2/helper/template"
 	"github.com/openbao/openbao/sdk/v2/logical"
 )
 
+// maxPolicyNameLength is the longest policy name Consul accepts
+const maxPolicyNameLength = 128
+
+// consulExpiryGrace is how much longer a token expires in Consul than its
+// lease may last, so that it is still revoked by OpenBao first
+const consulExpiryGrace = time.Minute
+
+var invalidPolicyNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
 func pathToken(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "creds/" + framework.GenericNameRegex("role"),
@@ -39,21 +56,16 @@ func pathToken(b *backend) *framework.Path {
 
 func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	role := d.Get("role").(string)
-	entry, err := req.Storage.Get(ctx, "policy/"+role)
+	roleConfigData, err := readRole(ctx, req.Storage, role)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving role: %w", err)
+		return nil, err
 	}
-	if entry == nil {
+	if roleConfigData == nil {
 		return logical.ErrorResponse(fmt.Sprintf("role %q not found", role)), nil
 	}
 
-	var roleConfigData roleConfig
-	if err := entry.DecodeJSON(&roleConfigData); err != nil {
-		return nil, err
-	}
-
 	// Get the consul client
-	c, userErr, intErr := b.client(ctx, req.Storage)
+	c, conf, userErr, intErr := b.issuanceClient(ctx, req.Storage, roleConfigData.Cluster)
 	if intErr != nil {
 		return nil, intErr
 	}
@@ -61,8 +73,33 @@ func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *fr
 		return logical.ErrorResponse(userErr.Error()), nil
 	}
 
+	return b.createToken(ctx, req, c, conf, role, roleConfigData)
+}
+
+// createToken generates a Consul token for the role and returns it as a
+// secret. Failures caused by the role are returned as error responses.
+func (b *backend) createToken(ctx context.Context, req *logical.Request, c *api.Client, conf *accessConfig, role string, roleConfigData *roleConfig) (*logical.Response, error) {
+	var err error
+
+	// Roles without their own namespace and partition use the defaults of
+	// the mount
+	namespace := roleConfigData.ConsulNamespace
+	if namespace == "" {
+		namespace = conf.DefaultNamespace
+	}
+	partition := roleConfigData.Partition
+	if partition == "" {
+		partition = conf.DefaultPartition
+	}
+
 	// Generate a name for the token
-	tokenName := fmt.Sprintf("Vault %s %s %d", role, req.DisplayName, time.Now().UnixNano())
+	tokenName := tokenDescription(conf, req, role)
+	if roleConfigData.DescriptionTemplate != "" {
+		tokenName, err = b.renderDescriptionTemplate(roleConfigData.DescriptionTemplate, req, role)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
 
 	writeOpts := &api.WriteOptions{}
 	writeOpts = writeOpts.WithContext(ctx)
@@ -74,6 +111,11 @@ func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *fr
 			Name: policyName,
 		})
 	}
+	for _, policyID := range roleConfigData.PolicyIDs {
+		policyLinks = append(policyLinks, &api.ACLTokenPolicyLink{
+			ID: policyID,
+		})
+	}
 
 	roleLinks := []*api.ACLTokenRoleLink{}
 	for _, roleName := range roleConfigData.ConsulRoles {
@@ -82,40 +124,421 @@ func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *fr
 		})
 	}
 
+	// Create the ephemeral policy of the role, which is deleted along with
+	// the token
+	rules := roleConfigData.PolicyDocument
+	if roleConfigData.PolicyTemplate != "" {
+		rules, err = b.renderPolicyTemplate(roleConfigData.PolicyTemplate, req.EntityID)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	queryOpts := (&api.QueryOptions{
+		Namespace: namespace,
+		Partition: partition,
+	}).WithContext(ctx)
+
+	// Creating policies and tokens is not idempotent, so when a call whose
+	// response was lost is retried, the object is read back by the name or
+	// accessor it was created with before creating it again
+	var policyID string
+	if rules != "" {
+		var policy *api.ACLPolicy
+		policyName := ephemeralPolicyName(role)
+		attempted := false
+		err := b.retry(ctx, conf.MaxRetries, "creating policy", func() error {
+			if attempted {
+				existing, _, err := c.ACL().PolicyReadByName(policyName, queryOpts)
+				if err != nil {
+					return err
+				}
+				if existing != nil {
+					policy = existing
+					return nil
+				}
+			}
+			attempted = true
+
+			var err error
+			policy, _, err = c.ACL().PolicyCreate(&api.ACLPolicy{
+				Name:        policyName,
+				Description: tokenName,
+				Rules:       rules,
+				Namespace:   namespace,
+				Partition:   partition,
+			}, writeOpts)
+			return err
+		})
+		if err != nil {
+			return logical.ErrorResponse("failed to create policy of token: %s", err), nil
+		}
+		policyID = policy.ID
+		policyLinks = append(policyLinks, &api.ACLTokenPolicyLink{
+			ID: policyID,
+		})
+	}
+
+	var expirationTTL time.Duration
+	if roleConfigData.UseConsulExpiry {
+		expirationTTL = consulExpirationTTL(b.System(), *roleConfigData)
+	}
+	// Without a lease, the token is only expired by Consul once its TTL
+	// has passed, as it is never renewed
+	if roleConfigData.NoStore {
+		expirationTTL, _ = roleConfigData.leaseTTL(conf.DefaultLeaseTTL)
+		if expirationTTL == 0 {
+			expirationTTL = b.System().DefaultLeaseTTL()
+		}
+	}
+
+	// Identities have no partition or namespace of their own, they are
+	// created in those of the token
+	if err := validateNodeIdentitiesNamespace(roleConfigData.NodeIdentities, namespace); err != nil {
+		return logical.ErrorResponse("invalid role %q: %s", role, err), nil
+	}
 	aclServiceIdentities := parseServiceIdentities(roleConfigData.ServiceIdentities)
 	aclNodeIdentities := parseNodeIdentities(roleConfigData.NodeIdentities)
 
-	token, _, err := c.ACL().TokenCreate(&api.ACLToken{
-		Description:       tokenName,
-		Policies:          policyLinks,
-		Roles:             roleLinks,
-		ServiceIdentities: aclServiceIdentities,
-		NodeIdentities:    aclNodeIdentities,
-		Local:             roleConfigData.Local,
-		Namespace:         roleConfigData.ConsulNamespace,
-		Partition:         roleConfigData.Partition,
-	}, writeOpts)
+	var token *api.ACLToken
+	var warnings []string
+	createToken := func() error {
+		accessorID, err := uuid.GenerateUUID()
+		if err != nil {
+			return err
+		}
+		secretID, err := uuid.GenerateUUID()
+		if err != nil {
+			return err
+		}
+
+		attempted := false
+		return b.retry(ctx, conf.MaxRetries, "creating token", func() error {
+			if attempted {
+				existing, _, err := c.ACL().TokenRead(accessorID, queryOpts)
+				if err == nil {
+					token = existing
+					return nil
+				}
+				if !isACLNotFound(err) {
+					return err
+				}
+			}
+			attempted = true
+
+			var err error
+			token, _, err = c.ACL().TokenCreate(&api.ACLToken{
+				AccessorID:        accessorID,
+				SecretID:          secretID,
+				Description:       tokenName,
+				Policies:          policyLinks,
+				Roles:             roleLinks,
+				ServiceIdentities: aclServiceIdentities,
+				NodeIdentities:    aclNodeIdentities,
+				TemplatedPolicies: aclTemplatedPolicies(roleConfigData.TemplatedPolicies),
+				Local:             roleConfigData.Local,
+				Namespace:         namespace,
+				Partition:         partition,
+				ExpirationTTL:     expirationTTL,
+			}, writeOpts)
+			return err
+		})
+	}
+	err = createToken()
+
+	// Consul rejects tokens linking policies that do not exist, so the
+	// policies of the role are looked up to tell which are missing
+	var missing []string
+	if err != nil && len(roleConfigData.Policies) > 0 {
+		missing = missingPolicies(ctx, c, roleConfigData.Policies, namespace, partition)
+	}
+	if len(missing) > 0 && roleConfigData.IgnoreMissingPolicies {
+		policyLinks = slices.DeleteFunc(policyLinks, func(link *api.ACLTokenPolicyLink) bool {
+			return link.Name != "" && slices.Contains(missing, link.Name)
+		})
+		warnings = append(warnings, fmt.Sprintf("consul_policies of role %q that do not exist in Consul were left out of the token: %s", role, strings.Join(missing, ", ")))
+		err = createToken()
+	}
 	if err != nil {
+		if policyID != "" {
+			delErr := b.retry(ctx, conf.MaxRetries, "deleting policy", func() error {
+				_, err := c.ACL().PolicyDelete(policyID, writeOpts)
+				return err
+			})
+			if delErr != nil {
+				b.Logger().Warn("failed to delete policy of token that could not be created", "policy_id", policyID, "error", delErr)
+			}
+		}
+		if len(missing) > 0 && !roleConfigData.IgnoreMissingPolicies {
+			resp := logical.ErrorResponse("consul_policies of role %q do not exist in Consul: %s", role, strings.Join(missing, ", "))
+			resp.AddWarning(fmt.Sprintf("Consul rejected the token: %s. Set ignore_missing_policies on the role to generate tokens without the missing policies.", err))
+			return resp, nil
+		}
 		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	// Use the helper to create the secret
-	s := b.Secret(SecretTokenType).Response(map[string]any{
+	data := map[string]any{
 		"token":            token.SecretID,
 		"accessor":         token.AccessorID,
+		"description":      token.Description,
+		"role":             role,
+		"creation_time":    creationTime(token).Format(time.RFC3339),
 		"local":            token.Local,
 		"consul_namespace": token.Namespace,
 		"partition":        token.Partition,
-	}, map[string]any{
-		"token": token.AccessorID,
-		"role":  role,
+	}
+
+	// Tokens without a lease are neither recorded nor returned as a secret
+	if roleConfigData.NoStore {
+		deleteOpts := &api.WriteOptions{
+			Namespace: token.Namespace,
+			Partition: token.Partition,
+		}
+		// A token that Consul does not expire would never be revoked
+		if token.ExpirationTime == nil {
+			if delErr := b.deleteToken(ctx, c, conf.MaxRetries, token.AccessorID, "", deleteOpts.WithContext(ctx)); delErr != nil {
+				b.Logger().Warn("failed to delete token that does not expire", "accessor", token.AccessorID, "error", delErr)
+			}
+			return logical.ErrorResponse("Consul does not support token expiration, which no_store requires"), nil
+		}
+		data["expiration_time"] = token.ExpirationTime.UTC().Format(time.RFC3339)
+		return &logical.Response{Data: data, Warnings: warnings}, nil
+	}
+
+	// Record the token so the tokens of the role can be listed and revoked
+	err = recordIssuedToken(ctx, req.Storage, role, &issuedToken{
+		Accessor:    token.AccessorID,
+		Namespace:   token.Namespace,
+		Partition:   token.Partition,
+		PolicyID:    policyID,
+		Cluster:     roleConfigData.Cluster,
+		DisplayName: req.DisplayName,
+		IssueTime:   time.Now().UTC(),
 	})
-	s.Secret.TTL = roleConfigData.TTL
+	if err != nil {
+		deleteOpts := &api.WriteOptions{
+			Namespace: token.Namespace,
+			Partition: token.Partition,
+		}
+		if delErr := b.deleteToken(ctx, c, conf.MaxRetries, token.AccessorID, policyID, deleteOpts.WithContext(ctx)); delErr != nil {
+			b.Logger().Warn("failed to delete token that could not be recorded", "accessor", token.AccessorID, "error", delErr)
+		}
+		return nil, err
+	}
+
+	// Use the helper to create the secret
+	internalData := map[string]any{
+		"token":            token.AccessorID,
+		"role":             role,
+		"policy_id":        policyID,
+		"consul_namespace": token.Namespace,
+		"partition":        token.Partition,
+
+		// Renewals carry no display name, request ID or entity, so tokens
+		// reissued for the lease are described with those it was created by
+		"display_name": req.DisplayName,
+		"request_id":   req.ID,
+		"entity_id":    req.EntityID,
+	}
+	// Leases are revoked in the cluster the token was generated in, even if
+	// the role is changed to another one
+	if roleConfigData.Cluster != "" {
+		internalData["cluster"] = roleConfigData.Cluster
+	}
+	s := b.Secret(SecretTokenType).Response(data, internalData)
+	s.Secret.TTL, _ = roleConfigData.leaseTTL(conf.DefaultLeaseTTL)
 	s.Secret.MaxTTL = roleConfigData.MaxTTL
+	for _, warning := range warnings {
+		s.AddWarning(warning)
+	}
+
+	// Consul versions without support for token expiration ignore it
+	if expirationTTL > 0 && token.ExpirationTime == nil {
+		s.AddWarning("Consul does not support token expiration, the token only expires when its lease is revoked")
+	}
 
 	return s, nil
 }
 
+// isACLNotFound reports whether reading a token failed because it does not
+// exist, which older versions of Consul answer with a 403
+func isACLNotFound(err error) bool {
+	var statusErr api.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.Code == http.StatusNotFound ||
+		(statusErr.Code == http.StatusForbidden && strings.Contains(statusErr.Body, "ACL not found"))
+}
+
+// missingPolicies returns the names of the policies that do not exist in the
+// namespace and partition. Policies that cannot be read are assumed to exist.
+func missingPolicies(ctx context.Context, c *api.Client, names []string, namespace, partition string) []string {
+	queryOpts := (&api.QueryOptions{
+		Namespace: namespace,
+		Partition: partition,
+	}).WithContext(ctx)
+
+	var missing []string
+	for _, name := range names {
+		policy, _, err := c.ACL().PolicyReadByName(name, queryOpts)
+		if err == nil && policy == nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// tokenDescription returns the description of a token generated for the
+// role. With descriptive_tokens, it names the mount, the role and the request,
+// whose ID is logged along with the lease in the audit log, so that tokens
+// listed in Consul can be traced back to their lease.
+func tokenDescription(conf *accessConfig, req *logical.Request, role string) string {
+	if !conf.DescriptiveTokens {
+		return fmt.Sprintf("Vault %s %s %d", role, req.DisplayName, time.Now().UnixNano())
+	}
+	return fmt.Sprintf("OpenBao %screds/%s request %s for %s", req.MountPoint, role, req.ID, req.DisplayName)
+}
+
+// descriptionTemplateData are the fields available to the
+// token_description_template of roles
+type descriptionTemplateData struct {
+	RoleName    string
+	MountPath   string
+	DisplayName string
+	EntityID    string
+	EntityName  string
+	RequestID   string
+}
+
+// validateDescriptionTemplate checks that the token_description_template of
+// a role parses and renders, so that references to unknown fields are found
+// when the role is written rather than when tokens are generated
+func validateDescriptionTemplate(tpl string) error {
+	_, err := executeDescriptionTemplate(tpl, descriptionTemplateData{
+		RoleName:    "role",
+		MountPath:   "consul/",
+		DisplayName: "token",
+		EntityID:    "00000000-0000-0000-0000-000000000000",
+		EntityName:  "entity",
+		RequestID:   "00000000-0000-0000-0000-000000000000",
+	})
+	return err
+}
+
+// renderDescriptionTemplate renders the token_description_template of a role
+// for the request, with the name of the identity entity of the requester
+func (b *backend) renderDescriptionTemplate(tpl string, req *logical.Request, role string) (string, error) {
+	data := descriptionTemplateData{
+		RoleName:    role,
+		MountPath:   req.MountPoint,
+		DisplayName: req.DisplayName,
+		EntityID:    req.EntityID,
+		RequestID:   req.ID,
+	}
+	if req.EntityID != "" {
+		entity, err := b.System().EntityInfo(req.EntityID)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up identity entity: %w", err)
+		}
+		if entity != nil {
+			data.EntityName = entity.Name
+		}
+	}
+
+	description, err := executeDescriptionTemplate(tpl, data)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(description) == "" {
+		return "", fmt.Errorf("token_description_template rendered an empty description")
+	}
+	return description, nil
+}
+
+func executeDescriptionTemplate(tpl string, data descriptionTemplateData) (string, error) {
+	t, err := template.NewTemplate(template.Template(tpl))
+	if err != nil {
+		return "", fmt.Errorf("invalid token_description_template: %w", err)
+	}
+	description, err := t.Generate(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render token_description_template: %w", err)
+	}
+	return description, nil
+}
+
+// creationTime returns when Consul created the token, or the current time
+// for Consul versions that do not report it
+func creationTime(token *api.ACLToken) time.Time {
+	if token.CreateTime.IsZero() {
+		return time.Now().UTC()
+	}
+	return token.CreateTime.UTC()
+}
+
+// consulExpirationTTL returns the expiration of a token of the role in
+// Consul. Consul tokens cannot be extended, so the token expires once its
+// lease reaches the max TTL, plus consulExpiryGrace.
+func consulExpirationTTL(sys logical.SystemView, role roleConfig) time.Duration {
+	maxTTL := sys.MaxLeaseTTL()
+	if role.MaxTTL > 0 && role.MaxTTL < maxTTL {
+		maxTTL = role.MaxTTL
+	}
+	return maxTTL + consulExpiryGrace
+}
+
+// renderPolicyTemplate renders the policy_template of a role with the identity
+// entity of the requester and its groups
+func (b *backend) renderPolicyTemplate(tpl string, entityID string) (string, error) {
+	var entity *logical.Entity
+	var groups []*logical.Group
+	if entityID != "" {
+		var err error
+		entity, err = b.System().EntityInfo(entityID)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up identity entity: %w", err)
+		}
+		groups, err = b.System().GroupsForEntity(entityID)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up identity groups: %w", err)
+		}
+	}
+
+	// Values are quoted so they cannot change the structure of the policy,
+	// but missing values are rendered as empty strings in JSON mode, which
+	// would match every resource for prefix rules. They are detected by
+	// rendering in ACL mode first, which rejects them.
+	var rules string
+	for _, mode := range []int{identitytpl.ACLTemplating, identitytpl.JSONTemplating} {
+		_, out, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+			String: tpl,
+			Entity: entity,
+			Groups: groups,
+			Mode:   mode,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to render policy_template: %w", err)
+		}
+		rules = out
+	}
+	if strings.TrimSpace(rules) == "" {
+		return "", fmt.Errorf("policy_template rendered an empty policy")
+	}
+	return rules, nil
+}
+
+// ephemeralPolicyName returns a unique name for the policy created for a
+// token of the role. Consul policy names only allow alphanumerics, dashes and
+// underscores.
+func ephemeralPolicyName(role string) string {
+	name := fmt.Sprintf("vault-%s-%d", invalidPolicyNameChars.ReplaceAllString(role, "-"), time.Now().UnixNano())
+	if len(name) > maxPolicyNameLength {
+		name = name[len(name)-maxPolicyNameLength:]
+	}
+	return name
+}
+
 func parseServiceIdentities(data []string) []*api.ACLServiceIdentity {
 	aclServiceIdentities := []*api.ACLServiceIdentity{}
 
@@ -132,6 +555,27 @@ func parseServiceIdentities(data []string) []*api.ACLServiceIdentity {
 	return aclServiceIdentities
 }
 
+// validateServiceIdentities checks that the service identities are either a
+// service name, or a service name followed by a colon and a comma separated
+// list of datacenters, such as "web:dc1,dc2"
+func validateServiceIdentities(data []string) error {
+	for _, serviceIdentity := range data {
+		serviceName, datacenters, scoped := strings.Cut(serviceIdentity, ":")
+		if serviceName == "" {
+			return fmt.Errorf("service identity %q is missing a service name", serviceIdentity)
+		}
+		if !scoped {
+			continue
+		}
+		for _, datacenter := range strings.Split(datacenters, ",") {
+			if datacenter == "" || strings.Contains(datacenter, ":") {
+				return fmt.Errorf("service identity %q must be formatted as <service>:<datacenter>[,<datacenter>...]", serviceIdentity)
+			}
+		}
+	}
+	return nil
+}
+
 func parseNodeIdentities(data []string) []*api.ACLNodeIdentity {
 	aclNodeIdentities := []*api.ACLNodeIdentity{}
 
@@ -147,3 +591,87 @@ func parseNodeIdentities(data []string) []*api.ACLNodeIdentity {
 
 	return aclNodeIdentities
 }
+
+// validateNodeIdentitiesNamespace checks that node identities are only
+// attached to tokens of the default namespace, the only namespace of a
+// partition Consul allows them in
+func validateNodeIdentitiesNamespace(nodeIdentities []string, namespace string) error {
+	if len(nodeIdentities) > 0 && namespace != "" && namespace != "default" {
+		return fmt.Errorf("node_identities can only be attached to tokens in the default namespace, not %q", namespace)
+	}
+	return nil
+}
+
+// templatedPolicy is a Consul templated policy attached to the tokens of a
+// role, such as builtin/service for a service name
+type templatedPolicy struct {
+	TemplateName      string                    `json:"template_name"`
+	TemplateVariables *templatedPolicyVariables `json:"template_variables,omitempty"`
+	Datacenters       []string                  `json:"datacenters,omitempty"`
+}
+
+type templatedPolicyVariables struct {
+	Name string `json:"name"`
+}
+
+// templatedPolicyRequiresName lists the builtin templated policies of Consul,
+// and whether they require the name variable
+var templatedPolicyRequiresName = map[string]bool{
+	api.ACLTemplatedPolicyServiceName:     true,
+	api.ACLTemplatedPolicyNodeName:        true,
+	api.ACLTemplatedPolicyAPIGatewayName:  true,
+	api.ACLTemplatedPolicyDNSName:         false,
+	api.ACLTemplatedPolicyNomadServerName: false,
+	api.ACLTemplatedPolicyNomadClientName: false,
+}
+
+// parseTemplatedPolicies decodes the templated policies of a role, given
+// either as objects or as JSON strings, and checks that their templates are
+// known and given the variables they require
+func parseTemplatedPolicies(data []any) ([]*templatedPolicy, error) {
+	var policies []*templatedPolicy
+	for _, raw := range data {
+		encoded, ok := raw.(string)
+		if !ok {
+			b, err := json.Marshal(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid templated policy: %w", err)
+			}
+			encoded = string(b)
+		}
+
+		dec := json.NewDecoder(strings.NewReader(encoded))
+		dec.DisallowUnknownFields()
+		policy := &templatedPolicy{}
+		if err := dec.Decode(policy); err != nil {
+			return nil, fmt.Errorf("invalid templated policy %s: %w", encoded, err)
+		}
+
+		requiresName, known := templatedPolicyRequiresName[policy.TemplateName]
+		switch {
+		case policy.TemplateName == "":
+			return nil, fmt.Errorf("templated policy %s is missing a template_name", encoded)
+		case !known:
+			return nil, fmt.Errorf("unknown templated policy %q", policy.TemplateName)
+		case requiresName && (policy.TemplateVariables == nil || policy.TemplateVariables.Name == ""):
+			return nil, fmt.Errorf("templated policy %q requires the name variable", policy.TemplateName)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func aclTemplatedPolicies(policies []*templatedPolicy) []*api.ACLTemplatedPolicy {
+	var aclPolicies []*api.ACLTemplatedPolicy
+	for _, policy := range policies {
+		entry := &api.ACLTemplatedPolicy{
+			TemplateName: policy.TemplateName,
+			Datacenters:  policy.Datacenters,
+		}
+		if policy.TemplateVariables != nil {
+			entry.TemplateVariables = &api.ACLTemplatedPolicyVariables{Name: policy.TemplateVariables.Name}
+		}
+		aclPolicies = append(aclPolicies, entry)
+	}
+	return aclPolicies
+}
@@ -4,10 +4,21 @@
 package consul
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/openbao/openbao/sdk/v2/logical"
 )
 
 func TestToken_parseServiceIdentities(t *testing.T) {
@@ -61,6 +72,30 @@ func TestToken_parseServiceIdentities(t *testing.T) {
 	}
 }
 
+func TestToken_validateServiceIdentities(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "No datacenters", args: []string{"myservice-1"}},
+		{name: "Multiple datacenters", args: []string{"myservice-1:dc1,dc2"}},
+		{name: "Missing service name", args: []string{":dc1"}, wantErr: true},
+		{name: "Empty", args: []string{""}, wantErr: true},
+		{name: "Missing datacenter", args: []string{"myservice-1:"}, wantErr: true},
+		{name: "Empty datacenter", args: []string{"myservice-1:dc1,,dc2"}, wantErr: true},
+		{name: "Multiple colons", args: []string{"myservice-1:dc1:dc2"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateServiceIdentities(tt.args); (err != nil) != tt.wantErr {
+				t.Errorf("validateServiceIdentities() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestToken_parseNodeIdentities(t *testing.T) {
 	tests := []struct {
 		name string
@@ -105,3 +140,994 @@ func TestToken_parseNodeIdentities(t *testing.T) {
 		})
 	}
 }
+
+func TestToken_ephemeralPolicyName(t *testing.T) {
+	valid := regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+	for _, role := range []string{"test", "my.role", strings.Repeat("r", 200)} {
+		name := ephemeralPolicyName(role)
+		if !valid.MatchString(name) {
+			t.Errorf("ephemeralPolicyName(%q) = %q, which is not a valid Consul policy name", role, name)
+		}
+	}
+}
+
+func TestToken_tokenDescription(t *testing.T) {
+	req := &logical.Request{
+		ID:          "c1b8c0c4-5b0e-4c39-9d4b-0d2a5e6f7a8b",
+		MountPoint:  "consul/",
+		DisplayName: "token-ci",
+	}
+
+	legacy := tokenDescription(&accessConfig{}, req, "web")
+	if !strings.HasPrefix(legacy, "Vault web token-ci ") {
+		t.Errorf("unexpected description without descriptive_tokens: %q", legacy)
+	}
+
+	descriptive := tokenDescription(&accessConfig{DescriptiveTokens: true}, req, "web")
+	if want := "OpenBao consul/creds/web request c1b8c0c4-5b0e-4c39-9d4b-0d2a5e6f7a8b for token-ci"; descriptive != want {
+		t.Errorf("unexpected description with descriptive_tokens: got %q, want %q", descriptive, want)
+	}
+}
+
+func TestToken_consulExpirationTTL(t *testing.T) {
+	sys := &logical.StaticSystemView{
+		MaxLeaseTTLVal: 24 * time.Hour,
+	}
+
+	tests := []struct {
+		name   string
+		maxTTL time.Duration
+		want   time.Duration
+	}{
+		{
+			name: "Mount max TTL",
+			want: 24*time.Hour + consulExpiryGrace,
+		},
+		{
+			name:   "Role max TTL",
+			maxTTL: time.Hour,
+			want:   time.Hour + consulExpiryGrace,
+		},
+		{
+			name:   "Role max TTL above mount max TTL",
+			maxTTL: 48 * time.Hour,
+			want:   24*time.Hour + consulExpiryGrace,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := consulExpirationTTL(sys, roleConfig{MaxTTL: tt.maxTTL}); got != tt.want {
+				t.Errorf("consulExpirationTTL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToken_renderPolicyTemplate(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.System = &logical.StaticSystemView{
+		EntityVal: &logical.Entity{
+			ID:       "entity-id",
+			Name:     "alice",
+			Metadata: map[string]string{"team": "payments"},
+		},
+	}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := b.(*backend)
+
+	tests := []struct {
+		name     string
+		tpl      string
+		entityID string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Entity name and metadata",
+			tpl:      `key_prefix {{identity.entity.name}} { policy = "write" } service {{identity.entity.metadata.team}} { policy = "read" }`,
+			entityID: "entity-id",
+			want:     `key_prefix "alice" { policy = "write" } service "payments" { policy = "read" }`,
+		},
+		{
+			name:     "Missing metadata",
+			tpl:      `key_prefix {{identity.entity.metadata.missing}} { policy = "write" }`,
+			entityID: "entity-id",
+			wantErr:  true,
+		},
+		{
+			name:    "No entity",
+			tpl:     `key_prefix {{identity.entity.name}} { policy = "write" }`,
+			wantErr: true,
+		},
+		{
+			name:     "Empty policy",
+			tpl:      " ",
+			entityID: "entity-id",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := backend.renderPolicyTemplate(tt.tpl, tt.entityID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderPolicyTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderPolicyTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToken_renderDescriptionTemplate(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = &logical.StaticSystemView{
+		EntityVal: &logical.Entity{
+			ID:   "entity-id",
+			Name: "alice",
+		},
+	}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := b.(*backend)
+
+	tests := []struct {
+		name     string
+		tpl      string
+		entityID string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Role, mount and entity",
+			tpl:      "{{.MountPath}}{{.RoleName}} for {{.EntityName}} ({{.DisplayName}}, request {{.RequestID}})",
+			entityID: "entity-id",
+			want:     "consul/web for alice (token-ci, request c1b8c0c4)",
+		},
+		{
+			name: "No entity",
+			tpl:  "{{.RoleName}} for {{.EntityName}}",
+			want: "web for ",
+		},
+		{
+			name:    "Empty description",
+			tpl:     "{{.EntityName}}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &logical.Request{
+				ID:          "c1b8c0c4",
+				MountPoint:  "consul/",
+				DisplayName: "token-ci",
+				EntityID:    tt.entityID,
+			}
+			got, err := backend.renderDescriptionTemplate(tt.tpl, req, "web")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderDescriptionTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderDescriptionTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Templates are validated when the role is written
+	for tpl, wantErr := range map[string]bool{
+		"{{.RoleName}} for {{.EntityName}}": false,
+		"{{.Unknown}}":                      true,
+		"{{.RoleName":                       true,
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      "roles/test",
+			Data: map[string]any{
+				"consul_policies":            []string{"test"},
+				"token_description_template": tpl,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (resp != nil && resp.IsError()) != wantErr {
+			t.Errorf("writing token_description_template %q: resp:%#v, wantErr %v", tpl, resp, wantErr)
+		}
+	}
+}
+
+func TestToken_issuedTokenIndex(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issueTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, accessor := range []string{"accessor-1", "accessor-2"} {
+		err := recordIssuedToken(context.Background(), config.StorageView, "test", &issuedToken{
+			Accessor:    accessor,
+			DisplayName: "token",
+			IssueTime:   issueTime,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ListOperation,
+		Path:      "tokens/test",
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to list tokens: resp:%#v err:%s", resp, err)
+	}
+	if keys := resp.Data["keys"]; !reflect.DeepEqual(keys, []string{"accessor-1", "accessor-2"}) {
+		t.Fatalf("bad: keys: %#v", keys)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Path = "tokens/test/accessor-1"
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to read token: resp:%#v err:%s", resp, err)
+	}
+	if resp.Data["accessor"] != "accessor-1" || resp.Data["issue_time"] != "2024-01-02T03:04:05Z" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Revoked tokens are removed from the index
+	if err := deleteIssuedToken(context.Background(), config.StorageView, "test", "accessor-1"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil {
+		t.Fatalf("expected the token to be removed, got %#v", resp)
+	}
+}
+
+func TestToken_renewReissue(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Consul creates tokens with increasing accessors and records their
+	// descriptions and deletions
+	var descriptions []string
+	var deleted []string
+	live := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessor := strings.TrimPrefix(r.URL.Path, "/v1/acl/token/")
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/token":
+			var token api.ACLToken
+			if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+				t.Error(err)
+			}
+			descriptions = append(descriptions, token.Description)
+			created := len(descriptions)
+			live[fmt.Sprintf("accessor-%d", created)] = true
+			fmt.Fprintf(w, `{"AccessorID": "accessor-%d", "SecretID": "secret-%d"}`, created, created)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+			if !live[accessor] {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, "ACL not found")
+				return
+			}
+			fmt.Fprintf(w, `{"AccessorID": %q}`, accessor)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+			if !live[accessor] {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, "Cannot find token to delete")
+				return
+			}
+			delete(live, accessor)
+			deleted = append(deleted, accessor)
+			_, _ = w.Write([]byte("true"))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	for _, req := range []struct {
+		path string
+		data map[string]any
+	}{
+		{"config/access", map[string]any{
+			"address": strings.TrimPrefix(ts.URL, "http://"),
+			"token":   "management",
+		}},
+		{"roles/test", map[string]any{
+			"consul_policies": []string{"test"},
+			"ttl":             "1h",
+			"renew_strategy":  "reissue",
+		}},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      req.path,
+			Data:      req.data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to write %s: resp:%#v err:%s", req.path, resp, err)
+		}
+	}
+
+	generate := func() *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:     config.StorageView,
+			Operation:   logical.ReadOperation,
+			Path:        "creds/test",
+			DisplayName: "token-user",
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("failed to generate token: resp:%#v err:%s", resp, err)
+		}
+		return resp
+	}
+	resp := generate()
+	if resp.Data["token"] != "secret-1" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The renewal returns a new token and the lease refers to it. It is
+	// described with the display name of the request that created the lease.
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.RenewOperation,
+		Secret:    secret,
+		Data:      resp.Data,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to renew token: resp:%#v err:%s", resp, err)
+	}
+	if resp.Data["token"] != "secret-2" || resp.Secret.InternalData["token"] != "accessor-2" {
+		t.Fatalf("bad: data:%#v internal data:%#v", resp.Data, resp.Secret.InternalData)
+	}
+	if !reflect.DeepEqual(deleted, []string{"accessor-1"}) {
+		t.Fatalf("expected the replaced token to be deleted: %v", deleted)
+	}
+	if !strings.Contains(descriptions[1], "token-user") {
+		t.Fatalf("bad: descriptions: %v", descriptions)
+	}
+	keys, err := config.StorageView.List(context.Background(), tokenIndexPrefix+"test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"accessor-2"}) {
+		t.Fatalf("bad: index: %v", keys)
+	}
+
+	// Revocation deletes the new token
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.RevokeOperation,
+		Secret:    resp.Secret,
+		Data:      resp.Data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"accessor-1", "accessor-2"}) {
+		t.Fatalf("expected the new token to be revoked: %v", deleted)
+	}
+
+	// Leases whose token was revoked at tokens/<role> are not reissued
+	lease := generate()
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.DeleteOperation,
+		Path:      "tokens/test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to revoke tokens: resp:%#v err:%s", resp, err)
+	}
+	lease.Secret.IssueTime = time.Now()
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.RenewOperation,
+		Secret:    lease.Secret,
+		Data:      lease.Data,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: resp:%#v err:%s", resp, err)
+	}
+	if len(descriptions) != 3 {
+		t.Fatalf("expected no token to be generated: %v", descriptions)
+	}
+
+	// Templated policies would be rendered for whoever renews the lease
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "roles/templated",
+		Data: map[string]any{
+			"policy_template": `key_prefix "{{identity.entity.name}}" { policy = "read" }`,
+			"renew_strategy":  "reissue",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: resp:%#v err:%s", resp, err)
+	}
+}
+
+func TestToken_noStore(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Consul only expires tokens when expires is set, as versions before 1.5
+	expires := true
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/token":
+			if expires {
+				fmt.Fprint(w, `{"AccessorID": "accessor", "SecretID": "secret", "ExpirationTime": "2030-01-01T00:00:00Z"}`)
+			} else {
+				fmt.Fprint(w, `{"AccessorID": "accessor", "SecretID": "secret"}`)
+			}
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v1/acl/token/"))
+			_, _ = w.Write([]byte("true"))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]any{
+			"address": strings.TrimPrefix(ts.URL, "http://"),
+			"token":   "management",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write configuration: resp:%#v err:%s", resp, err)
+	}
+
+	// Roles without a lease must expire in Consul and own no policy
+	for _, data := range []map[string]any{
+		{"consul_policies": []string{"test"}, "no_store": true},
+		{"consul_policy_document": `key_prefix "" { policy = "read" }`, "use_consul_expiry": true, "no_store": true},
+		{"policy_template": `key_prefix "" { policy = "read" }`, "use_consul_expiry": true, "no_store": true},
+		{"consul_policies": []string{"test"}, "use_consul_expiry": true, "no_store": true, "renew_strategy": "reissue"},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      "roles/invalid",
+			Data:      data,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error for %v: resp:%#v err:%s", data, resp, err)
+		}
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test",
+		Data: map[string]any{
+			"consul_policies":   []string{"test"},
+			"ttl":               "1h",
+			"use_consul_expiry": true,
+			"no_store":          true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+	}
+
+	// The token is returned without a lease and is not recorded
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token: resp:%#v err:%s", resp, err)
+	}
+	if resp.Secret != nil {
+		t.Fatalf("expected no lease: %#v", resp.Secret)
+	}
+	if resp.Data["token"] != "secret" || resp.Data["expiration_time"] != "2030-01-01T00:00:00Z" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	keys, err := config.StorageView.List(context.Background(), tokenIndexPrefix+"test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected no recorded token: %v", keys)
+	}
+
+	// Tokens that Consul would never expire are deleted
+	expires = false
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: resp:%#v err:%s", resp, err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"accessor"}) {
+		t.Fatalf("expected the token to be deleted: %v", deleted)
+	}
+}
+
+func TestToken_missingPolicies(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Consul rejects tokens linking the missing policy
+	var created [][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/token":
+			var token api.ACLToken
+			if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+				t.Error(err)
+			}
+			var policies []string
+			for _, link := range token.Policies {
+				policies = append(policies, link.Name)
+			}
+			if slices.Contains(policies, "missing") {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `No such ACL policy with name "missing"`)
+				return
+			}
+			created = append(created, policies)
+			fmt.Fprint(w, `{"AccessorID": "accessor", "SecretID": "secret"}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/acl/policy/name/test":
+			fmt.Fprint(w, `{"ID": "policy", "Name": "test"}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/acl/policy/name/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	writeRole := func(ignoreMissing bool) {
+		t.Helper()
+		for _, req := range []struct {
+			path string
+			data map[string]any
+		}{
+			{"config/access", map[string]any{
+				"address": strings.TrimPrefix(ts.URL, "http://"),
+				"token":   "management",
+			}},
+			{"roles/test", map[string]any{
+				"consul_policies":         []string{"test", "missing"},
+				"ignore_missing_policies": ignoreMissing,
+			}},
+		} {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Storage:   config.StorageView,
+				Operation: logical.UpdateOperation,
+				Path:      req.path,
+				Data:      req.data,
+			})
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("failed to write %s: resp:%#v err:%s", req.path, resp, err)
+			}
+		}
+	}
+
+	// The error names the missing policy and the role
+	writeRole(false)
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: resp:%#v err:%s", resp, err)
+	}
+	if resp.Data["error"] != `consul_policies of role "test" do not exist in Consul: missing` || len(resp.Warnings) != 1 {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The missing policy is left out of the token with a warning
+	writeRole(true)
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token: resp:%#v err:%s", resp, err)
+	}
+	if !reflect.DeepEqual(created, [][]string{{"test"}}) {
+		t.Fatalf("expected a token with the existing policy: %v", created)
+	}
+	expected := []string{`consul_policies of role "test" that do not exist in Consul were left out of the token: missing`}
+	if !reflect.DeepEqual(resp.Warnings, expected) {
+		t.Fatalf("bad: warnings: %v", resp.Warnings)
+	}
+}
+
+func TestToken_retriedCreate(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = 250 * time.Millisecond }()
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Consul creates the policy and the token, but the responses are lost
+	policies := map[string]api.ACLPolicy{}
+	tokens := map[string]api.ACLToken{}
+	var creates int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/policy":
+			creates++
+			var policy api.ACLPolicy
+			if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+				t.Error(err)
+			}
+			if _, ok := policies[policy.Name]; ok {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, "Invalid Policy: A Policy with Name already exists")
+				return
+			}
+			policy.ID = "policy"
+			policies[policy.Name] = policy
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/acl/policy/name/"):
+			policy, ok := policies[strings.TrimPrefix(r.URL.Path, "/v1/acl/policy/name/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(policy)
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/token":
+			creates++
+			var token api.ACLToken
+			if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+				t.Error(err)
+			}
+			if token.AccessorID == "" || token.SecretID == "" {
+				t.Errorf("expected the token IDs to be generated beforehand: %#v", token)
+			}
+			if _, ok := tokens[token.AccessorID]; ok {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, "Invalid Token: AccessorID is already in use")
+				return
+			}
+			tokens[token.AccessorID] = token
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+			token, ok := tokens[strings.TrimPrefix(r.URL.Path, "/v1/acl/token/")]
+			if !ok {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, "ACL not found")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(token)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	for _, req := range []struct {
+		path string
+		data map[string]any
+	}{
+		{"config/access", map[string]any{
+			"address": strings.TrimPrefix(ts.URL, "http://"),
+			"token":   "management",
+		}},
+		{"roles/test", map[string]any{
+			"consul_policy_document": `key_prefix "" { policy = "read" }`,
+		}},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.UpdateOperation,
+			Path:      req.path,
+			Data:      req.data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to write %s: resp:%#v err:%s", req.path, resp, err)
+		}
+	}
+
+	// The retries read the policy and token back instead of creating them
+	// again
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token: resp:%#v err:%s", resp, err)
+	}
+	if creates != 2 || len(policies) != 1 || len(tokens) != 1 {
+		t.Fatalf("expected a single policy and token to be created: creates:%d policies:%v tokens:%v", creates, policies, tokens)
+	}
+	token, ok := tokens[resp.Data["accessor"].(string)]
+	if !ok || resp.Data["token"] != token.SecretID {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Secret.InternalData["policy_id"] != "policy" {
+		t.Fatalf("bad: %#v", resp.Secret.InternalData)
+	}
+}
+
+func TestToken_identityPartition(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created api.ACLToken
+	var deletedPartition string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/token":
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Error(err)
+			}
+			fmt.Fprintf(w, `{"AccessorID": "accessor", "SecretID": "secret", "Partition": %q}`, created.Partition)
+		case r.Method == http.MethodDelete && r.URL.Path == "/v1/acl/token/accessor":
+			deletedPartition = r.URL.Query().Get("partition")
+			_, _ = w.Write([]byte("true"))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]any{
+			"address":           strings.TrimPrefix(ts.URL, "http://"),
+			"token":             "management",
+			"default_partition": "default-part",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write configuration: resp:%#v err:%s", resp, err)
+	}
+
+	// Node identities are only allowed in the default namespace
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "roles/invalid",
+		Data: map[string]any{
+			"node_identities":  []string{"node-1:dc1"},
+			"consul_namespace": "ns1",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: resp:%#v err:%s", resp, err)
+	}
+
+	// The service identity is created in the partition of the role rather
+	// than the default partition of the mount
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test",
+		Data: map[string]any{
+			"service_identities": []string{"web:dc1"},
+			"partition":          "part1",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate token: resp:%#v err:%s", resp, err)
+	}
+	if created.Partition != "part1" {
+		t.Fatalf("bad: token created in partition %q", created.Partition)
+	}
+	if len(created.ServiceIdentities) != 1 || created.ServiceIdentities[0].ServiceName != "web" {
+		t.Fatalf("bad: service identities: %#v", created.ServiceIdentities)
+	}
+	if resp.Data["partition"] != "part1" {
+		t.Fatalf("bad: partition: %v", resp.Data["partition"])
+	}
+
+	secret := resp.Secret
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.RevokeOperation,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to revoke token: resp:%#v err:%s", resp, err)
+	}
+	if deletedPartition != "part1" {
+		t.Fatalf("bad: token deleted in partition %q", deletedPartition)
+	}
+}
+
+func TestToken_maxConcurrentRevocations(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deletions block until unblocked, counting those in flight
+	var lock sync.Mutex
+	var inFlight, maxInFlight, created int
+	unblock := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/acl/token":
+			lock.Lock()
+			created++
+			fmt.Fprintf(w, `{"AccessorID": "accessor-%d", "SecretID": "secret"}`, created)
+			lock.Unlock()
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+			lock.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			lock.Unlock()
+			<-unblock
+			lock.Lock()
+			inFlight--
+			lock.Unlock()
+			_, _ = w.Write([]byte("true"))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]any{
+			"address":                    strings.TrimPrefix(ts.URL, "http://"),
+			"token":                      "management",
+			"max_concurrent_revocations": -1,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: resp:%#v err:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]any{
+			"address":                    strings.TrimPrefix(ts.URL, "http://"),
+			"token":                      "management",
+			"max_concurrent_revocations": 2,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write configuration: resp:%#v err:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.ReadOperation,
+		Path:      "config/access",
+	})
+	if err != nil || resp == nil || resp.Data["max_concurrent_revocations"] != 2 {
+		t.Fatalf("bad: resp:%#v err:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test",
+		Data: map[string]any{
+			"consul_policies": []string{"test"},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+	}
+
+	var secrets []*logical.Secret
+	for i := 0; i < 5; i++ {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   config.StorageView,
+			Operation: logical.ReadOperation,
+			Path:      "creds/test",
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("failed to generate token: resp:%#v err:%s", resp, err)
+		}
+		secrets = append(secrets, resp.Secret)
+	}
+
+	var wg sync.WaitGroup
+	for _, secret := range secrets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Storage:   config.StorageView,
+				Operation: logical.RevokeOperation,
+				Secret:    secret,
+			})
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Errorf("failed to revoke token: resp:%#v err:%s", resp, err)
+			}
+		}()
+	}
+
+	// Let the revocations pile up before unblocking them one at a time
+	time.Sleep(100 * time.Millisecond)
+	for range secrets {
+		unblock <- struct{}{}
+	}
+	wg.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if maxInFlight != 2 {
+		t.Fatalf("bad: %d revocations in flight, want 2", maxInFlight)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-multierror"
+	"github.com/openbao/openbao/sdk/v2/framework"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+// tokenIndexPrefix is where the tokens generated for each role are recorded
+// until they are revoked
+const tokenIndexPrefix = "tokens/"
+
+// issuedToken records a token generated for a role
+type issuedToken struct {
+	Accessor    string    `json:"accessor"`
+	Namespace   string    `json:"consul_namespace"`
+	Partition   string    `json:"partition"`
+	PolicyID    string    `json:"policy_id"`
+	Cluster     string    `json:"cluster,omitempty"`
+	DisplayName string    `json:"display_name"`
+	IssueTime   time.Time `json:"issue_time"`
+}
+
+func pathListTokens(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tokens/" + framework.GenericNameRegex("role") + "/?$",
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixConsul,
+			OperationSuffix: "tokens",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation:   b.pathTokensList,
+			logical.DeleteOperation: b.pathTokensRevoke,
+		},
+
+		HelpSynopsis:    pathTokensHelpSyn,
+		HelpDescription: pathTokensHelpDesc,
+	}
+}
+
+func pathTokens(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tokens/" + framework.GenericNameRegex("role") + "/" + framework.GenericNameRegex("accessor"),
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixConsul,
+			OperationSuffix: "token",
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"accessor": {
+				Type:        framework.TypeString,
+				Description: "Accessor of the token.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTokenIndexRead,
+		},
+
+		HelpSynopsis:    pathTokensHelpSyn,
+		HelpDescription: pathTokensHelpDesc,
+	}
+}
+
+func (b *backend) pathTokensList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role := d.Get("role").(string)
+
+	entries, err := req.Storage.List(ctx, tokenIndexPrefix+role+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathTokenIndexRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role := d.Get("role").(string)
+	accessor := d.Get("accessor").(string)
+
+	token, err := readIssuedToken(ctx, req.Storage, role, accessor)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]any{
+			"accessor":         token.Accessor,
+			"consul_namespace": token.Namespace,
+			"partition":        token.Partition,
+			"display_name":     token.DisplayName,
+			"issue_time":       token.IssueTime.Format(time.RFC3339),
+		},
+	}
+	if token.Cluster != "" {
+		resp.Data["cluster"] = token.Cluster
+	}
+	return resp, nil
+}
+
+// pathTokensRevoke deletes every token generated for the role from Consul.
+// Their leases are left to expire, their revocation ignores tokens that no
+// longer exist. Each token is deleted in the cluster it was generated in,
+// with the settings of that cluster, so config/access is only required for
+// tokens generated in the cluster it configures.
+func (b *backend) pathTokensRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role := d.Get("role").(string)
+
+	accessors, err := req.Storage.List(ctx, tokenIndexPrefix+role+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	type clusterClient struct {
+		client *api.Client
+		conf   *accessConfig
+	}
+	clients := map[string]clusterClient{}
+	revoked := []string{}
+	var errs *multierror.Error
+	for _, accessor := range accessors {
+		token, err := readIssuedToken(ctx, req.Storage, role, accessor)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		if token == nil {
+			continue
+		}
+
+		cc, ok := clients[token.Cluster]
+		if !ok {
+			c, conf, userErr, intErr := b.client(ctx, req.Storage, token.Cluster)
+			if intErr != nil {
+				return nil, intErr
+			}
+			if userErr != nil {
+				errs = multierror.Append(errs, fmt.Errorf("failed to revoke token %s: %w", accessor, userErr))
+				continue
+			}
+			cc = clusterClient{client: c, conf: conf}
+			clients[token.Cluster] = cc
+		}
+
+		release, err := b.acquireRevocation(ctx, cc.conf.MaxConcurrentRevocations)
+		if err != nil {
+			return nil, err
+		}
+		writeOpts := &api.WriteOptions{
+			Namespace: token.Namespace,
+			Partition: token.Partition,
+		}
+		err = b.deleteToken(ctx, cc.client, cc.conf.MaxRetries, token.Accessor, token.PolicyID, writeOpts.WithContext(ctx))
+		release()
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to revoke token %s: %w", accessor, err))
+			continue
+		}
+		if err := deleteIssuedToken(ctx, req.Storage, role, accessor); err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		revoked = append(revoked, accessor)
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]any{
+			"revoked": revoked,
+		},
+	}, nil
+}
+
+// recordIssuedToken adds a generated token to the index of its role
+func recordIssuedToken(ctx context.Context, s logical.Storage, role string, token *issuedToken) error {
+	entry, err := logical.StorageEntryJSON(tokenIndexPrefix+role+"/"+token.Accessor, token)
+	if err != nil {
+		return fmt.Errorf("error generating token index JSON: %w", err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return fmt.Errorf("error recording token: %w", err)
+	}
+	return nil
+}
+
+func readIssuedToken(ctx context.Context, s logical.Storage, role, accessor string) (*issuedToken, error) {
+	entry, err := s.Get(ctx, tokenIndexPrefix+role+"/"+accessor)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving token: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var token issuedToken
+	if err := entry.DecodeJSON(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// deleteIssuedToken removes a revoked token from the index of its role
+func deleteIssuedToken(ctx context.Context, s logical.Storage, role, accessor string) error {
+	if err := s.Delete(ctx, tokenIndexPrefix+role+"/"+accessor); err != nil {
+		return fmt.Errorf("error removing token %s from index: %w", accessor, err)
+	}
+	return nil
+}
+
+const pathTokensHelpSyn = `
+List, read or revoke the tokens generated for a role
+`
+
+const pathTokensHelpDesc = `
+This path lists the accessors of the tokens generated for a role that have
+not been revoked yet, and reads when and for whom each was generated.
+
+Deleting tokens/<role> deletes every token generated for the role from Consul
+at once. Their leases remain until they expire or are revoked, which then
+succeeds without a token to delete.
+`
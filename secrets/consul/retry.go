@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// defaultMaxRetries is how often failing Consul API calls are retried
+	// unless max_retries is configured
+	defaultMaxRetries = 3
+
+	// maxRetryDelay caps the backoff between retries
+	maxRetryDelay = 5 * time.Second
+)
+
+// retryBaseDelay is the backoff before the first retry, which doubles with
+// every following retry
+var retryBaseDelay = 250 * time.Millisecond
+
+// retry calls f until it succeeds, fails with an error that is not worth
+// retrying, or maxRetries retries are exhausted. The backoff is jittered, so
+// that the many calls failing at once when Consul is briefly unavailable,
+// such as revocations of a whole mount, do not all retry at once.
+func (b *backend) retry(ctx context.Context, maxRetries int, op string, f func() error) error {
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if !isRetryableError(err) {
+			return err
+		}
+		if attempt >= maxRetries {
+			if attempt == 0 {
+				return err
+			}
+			return fmt.Errorf("%s failed after %d attempts: %w", op, attempt+1, err)
+		}
+
+		backoff := jitter(delay)
+		b.Logger().Warn("Consul API call failed, retrying", "operation", op, "attempt", attempt+1, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s failed: %w", op, err)
+		case <-time.After(backoff):
+		}
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// jitter returns a random backoff between half of delay and delay
+func jitter(delay time.Duration) time.Duration {
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// isRetryableError reports whether a failed Consul API call may succeed when
+// retried. Server errors and failing connections are transient, while Consul
+// rejecting the request, such as for a missing ACL permission, an untrusted
+// server certificate or a response that cannot be decoded are final.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500
+	}
+
+	// Failed certificate verifications surface as url.Errors, which are
+	// net.Errors, so they are ruled out first
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &verificationErr) || errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/openbao/openbao/sdk/v2/logical"
+)
+
+func TestRetry(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = 250 * time.Millisecond }()
+
+	b, err := Factory(context.Background(), logical.TestBackendConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := b.(*backend)
+
+	unavailable := api.StatusError{Code: 500, Body: "No cluster leader"}
+	forbidden := api.StatusError{Code: 403, Body: "Permission denied"}
+	refused := &url.Error{Op: "Put", URL: "http://127.0.0.1:8500/v1/acl/token", Err: syscall.ECONNREFUSED}
+	untrusted := &url.Error{Op: "Put", URL: "https://127.0.0.1:8500/v1/acl/token", Err: x509.UnknownAuthorityError{}}
+	undecodable := &json.SyntaxError{Offset: 1}
+
+	tests := []struct {
+		name       string
+		errs       []error
+		maxRetries int
+		wantCalls  int
+		wantErr    error
+	}{
+		{
+			name:       "Success",
+			errs:       []error{nil},
+			maxRetries: 3,
+			wantCalls:  1,
+		},
+		{
+			name:       "Transient error",
+			errs:       []error{unavailable, refused, nil},
+			maxRetries: 3,
+			wantCalls:  3,
+		},
+		{
+			name:       "Client error",
+			errs:       []error{forbidden},
+			maxRetries: 3,
+			wantCalls:  1,
+			wantErr:    forbidden,
+		},
+		{
+			name:       "Untrusted certificate",
+			errs:       []error{untrusted},
+			maxRetries: 3,
+			wantCalls:  1,
+			wantErr:    untrusted,
+		},
+		{
+			name:       "Undecodable response",
+			errs:       []error{undecodable},
+			maxRetries: 3,
+			wantCalls:  1,
+			wantErr:    undecodable,
+		},
+		{
+			name:       "Retries exhausted",
+			errs:       []error{unavailable, unavailable, unavailable},
+			maxRetries: 2,
+			wantCalls:  3,
+			wantErr:    unavailable,
+		},
+		{
+			name:       "Retries disabled",
+			errs:       []error{unavailable},
+			maxRetries: 0,
+			wantCalls:  1,
+			wantErr:    unavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := backend.retry(context.Background(), tt.maxRetries, "test", func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("retry() called f %d times, want %d", calls, tt.wantCalls)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("retry() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantCalls > 1 && tt.wantErr != nil && !strings.Contains(err.Error(), "failed after 3 attempts") {
+				t.Errorf("retry() = %v, want the number of attempts", err)
+			}
+		})
+	}
+}
+
+func TestRetry_jitter(t *testing.T) {
+	delay := 100 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		if backoff := jitter(delay); backoff < delay/2 || backoff > delay {
+			t.Fatalf("jitter(%s) = %s, want between %s and %s", delay, backoff, delay/2, delay)
+		}
+	}
+}
@@ -44,25 +44,151 @@ func (b *backend) secretTokenRenew(ctx context.Context, req *logical.Request, d
 		return resp, nil
 	}
 
-	entry, err := req.Storage.Get(ctx, "policy/"+role)
+	result, err := readRole(ctx, req.Storage, role)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving role: %w", err)
+		return nil, err
 	}
-	if entry == nil {
+	if result == nil {
 		return logical.ErrorResponse(fmt.Sprintf("issuing role %q not found", role)), nil
 	}
 
-	var result roleConfig
-	if err := entry.DecodeJSON(&result); err != nil {
+	defaultTTL, err := b.defaultLeaseTTL(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	roleTTL, _ := result.leaseTTL(defaultTTL)
+
+	// Cap the renewal at the max_ttl of the role and the mount, counted from
+	// when the token was issued
+	ttl, warnings, err := framework.CalculateTTL(b.System(), req.Secret.Increment, roleTTL, 0, result.MaxTTL, 0, req.Secret.IssueTime)
+	if err != nil {
 		return nil, err
 	}
-	resp.Secret.TTL = result.TTL
+	resp.Secret.TTL = ttl
 	resp.Secret.MaxTTL = result.MaxTTL
+	resp.Warnings = append(resp.Warnings, warnings...)
+
+	// The lease keeps its TTLs, but refers to the new token from now on
+	if result.renewStrategy() == renewStrategyReissue {
+		reissued, err := b.reissueToken(ctx, req, role, result)
+		if err != nil || reissued.IsError() {
+			return reissued, err
+		}
+		resp.Data = reissued.Data
+		resp.Secret.InternalData = reissued.Secret.InternalData
+		resp.Warnings = append(resp.Warnings, reissued.Warnings...)
+	}
+	return resp, nil
+}
+
+// reissueToken generates a new token for the role of the lease and deletes
+// the token of the lease. Leases whose token no longer exists, such as after
+// the tokens of the role were revoked at tokens/<role>, are not handed a new
+// one. If the old token cannot be deleted the new one is deleted instead, so
+// that the lease keeps referring to the only token.
+func (b *backend) reissueToken(ctx context.Context, req *logical.Request, role string, roleConfigData *roleConfig) (*logical.Response, error) {
+	// Tokens are looked up and deleted with the same client as on revocation
+	leaseClient, leaseConf, userErr, intErr := b.client(ctx, req.Storage, leaseCluster(req.Secret.InternalData))
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+
+	replaced, replacedPolicyID, replacedOpts := leaseToken(req.Secret.InternalData, req.Data)
+	replacedOpts = replacedOpts.WithContext(ctx)
+	if replaced != "" {
+		exists, err := b.tokenExists(ctx, leaseClient, leaseConf.MaxRetries, replaced, replacedOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token replaced on renewal: %w", err)
+		}
+		if !exists {
+			return logical.ErrorResponse("token %q of the lease no longer exists in Consul", replaced), nil
+		}
+	}
+
+	c, conf, userErr, intErr := b.issuanceClient(ctx, req.Storage, roleConfigData.Cluster)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+
+	resp, err := b.createToken(ctx, leaseRequest(req), c, conf, role, roleConfigData)
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+	if replaced == "" {
+		return resp, nil
+	}
+
+	// The replaced token may have been revoked since it was looked up, in
+	// which case the new one must not outlive it either
+	if err := b.deleteReplacedToken(ctx, leaseClient, leaseConf.MaxRetries, replaced, replacedPolicyID, replacedOpts); err != nil {
+		accessor, policyID, deleteOpts := leaseToken(resp.Secret.InternalData, resp.Data)
+		if delErr := b.deleteToken(ctx, c, conf.MaxRetries, accessor, policyID, deleteOpts.WithContext(ctx)); delErr != nil {
+			b.Logger().Warn("failed to delete reissued token", "accessor", accessor, "error", delErr)
+		} else if delErr := deleteIssuedToken(ctx, req.Storage, role, accessor); delErr != nil {
+			b.Logger().Warn("failed to remove reissued token from index", "accessor", accessor, "error", delErr)
+		}
+		return nil, fmt.Errorf("failed to delete token replaced on renewal: %w", err)
+	}
+
+	// The replaced token is already deleted, so failing to prune it only
+	// leaves a stale entry in the index
+	if err := deleteIssuedToken(ctx, req.Storage, role, replaced); err != nil {
+		b.Logger().Warn("failed to remove replaced token from index", "accessor", replaced, "error", err)
+	}
+
 	return resp, nil
 }
 
+// leaseRequest returns a copy of a renewal request with the display name, ID
+// and entity of the request that created the lease, which renewals lack, so
+// that reissued tokens are described like the token they replace
+func leaseRequest(req *logical.Request) *logical.Request {
+	issueReq := *req
+	issueReq.DisplayName, _ = req.Secret.InternalData["display_name"].(string)
+	issueReq.ID, _ = req.Secret.InternalData["request_id"].(string)
+	issueReq.EntityID, _ = req.Secret.InternalData["entity_id"].(string)
+	return &issueReq
+}
+
+// tokenExists reports whether the token with the given accessor exists in
+// Consul
+func (b *backend) tokenExists(ctx context.Context, c *api.Client, maxRetries int, accessor string, opts *api.WriteOptions) (bool, error) {
+	queryOpts := (&api.QueryOptions{
+		Namespace: opts.Namespace,
+		Partition: opts.Partition,
+	}).WithContext(ctx)
+
+	err := b.retry(ctx, maxRetries, "reading token", func() error {
+		_, _, err := c.ACL().TokenRead(accessor, queryOpts)
+		return err
+	})
+	if isACLNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// deleteReplacedToken deletes the token of a lease being renewed, along with
+// its policy. Unlike on revocation, a token that no longer exists is an error.
+func (b *backend) deleteReplacedToken(ctx context.Context, c *api.Client, maxRetries int, accessor, policyID string, writeOpts *api.WriteOptions) error {
+	err := b.retry(ctx, maxRetries, "deleting token", func() error {
+		_, err := c.ACL().TokenDelete(accessor, writeOpts)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return b.deleteTokenPolicy(ctx, c, maxRetries, accessor, policyID, writeOpts)
+}
+
 func (b *backend) secretTokenRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	c, userErr, intErr := b.client(ctx, req.Storage)
+	c, conf, userErr, intErr := b.client(ctx, req.Storage, leaseCluster(req.Secret.InternalData))
 	if intErr != nil {
 		return nil, intErr
 	}
@@ -71,8 +197,8 @@ func (b *backend) secretTokenRevoke(ctx context.Context, req *logical.Request, d
 		return nil, userErr
 	}
 
-	tokenRaw, ok := req.Secret.InternalData["token"]
-	if !ok {
+	accessor, policyID, revokeWriteOptions := leaseToken(req.Secret.InternalData, req.Data)
+	if accessor == "" {
 		// We return nil here because this is a pre-0.5.3 problem and there is
 		// nothing we can do about it. We already can't revoke the lease
 		// properly if it has been renewed and this is documented pre-0.5.3
@@ -80,38 +206,127 @@ func (b *backend) secretTokenRevoke(ctx context.Context, req *logical.Request, d
 		return nil, nil //nolint:nilnil
 	}
 
-	// Extract Consul Namespace and Partition info from secret
-	var revokeWriteOptions *api.WriteOptions
-	var namespace, partition string
+	release, err := b.acquireRevocation(ctx, conf.MaxConcurrentRevocations)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	namespaceRaw, ok := req.Data["consul_namespace"]
-	if ok {
-		namespace = namespaceRaw.(string)
+	if err := b.deleteToken(ctx, c, conf.MaxRetries, accessor, policyID, revokeWriteOptions); err != nil {
+		return nil, err
 	}
-	partitionRaw, ok := req.Data["partition"]
-	if ok {
-		partition = partitionRaw.(string)
+
+	// Prune the revoked token from the index of its role
+	if role, ok := req.Secret.InternalData["role"].(string); ok {
+		if err := deleteIssuedToken(ctx, req.Storage, role, accessor); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil //nolint:nilnil
+}
+
+// leaseToken returns the accessor of the token of a lease, the ID of the
+// policy created for it if any, and the options to delete it with in its
+// namespace and partition. Leases created before the namespace and partition
+// were stored in the internal data have them in their data.
+func leaseToken(internalData, data map[string]any) (string, string, *api.WriteOptions) {
+	accessor, _ := internalData["token"].(string)
+	policyID, _ := internalData["policy_id"].(string)
+
+	namespace, ok := internalData["consul_namespace"].(string)
+	if !ok {
+		namespace, _ = data["consul_namespace"].(string)
+	}
+	partition, ok := internalData["partition"].(string)
+	if !ok {
+		partition, _ = data["partition"].(string)
 	}
 
-	revokeWriteOptions = &api.WriteOptions{
+	return accessor, policyID, &api.WriteOptions{
 		Namespace: namespace,
 		Partition: partition,
 	}
+}
+
+// leaseCluster returns the cluster the token of a lease was generated in, or
+// an empty string for the cluster of config/access
+func leaseCluster(internalData map[string]any) string {
+	cluster, _ := internalData["cluster"].(string)
+	return cluster
+}
 
-	_, err := c.ACL().TokenDelete(tokenRaw.(string), revokeWriteOptions)
+// acquireRevocation waits until fewer than limit tokens are being revoked,
+// and returns the function to call once the token is revoked. A limit of zero
+// does not wait. Revocations already waiting when the limit is changed keep
+// waiting for the previous limit.
+func (b *backend) acquireRevocation(ctx context.Context, limit int) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	b.revocationsMutex.Lock()
+	if b.revocations == nil || b.revocationsLimit != limit {
+		b.revocations = make(chan struct{}, limit)
+		b.revocationsLimit = limit
+	}
+	revocations := b.revocations
+	b.revocationsMutex.Unlock()
+
+	select {
+	case revocations <- struct{}{}:
+		return func() { <-revocations }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting to revoke token: %w", ctx.Err())
+	}
+}
+
+// deleteToken deletes the token with the given accessor from Consul, along
+// with the policy created for it, if any. Tokens and policies that no longer
+// exist are ignored with a warning, so that revocation is idempotent.
+func (b *backend) deleteToken(ctx context.Context, c *api.Client, maxRetries int, accessor, policyID string, writeOpts *api.WriteOptions) error {
+	// A failed revocation leaks the token, so transient errors are retried
+	err := b.retry(ctx, maxRetries, "deleting token", func() error {
+		_, err := c.ACL().TokenDelete(accessor, writeOpts)
+		return err
+	})
 	if err != nil {
 		statusError := api.StatusError{}
 
-		if errors.As(err, &statusError) &&
-			statusError.Code == 404 &&
-			// Don't just rely on the status code, a 404 could have many causes (e.g. load balancer has briefly no backend)
-			// So we additionally match the exact response body.
-			// This might break in future versions of Consul, but at least it's safe.
-			statusError.Body == "Cannot find token to delete" {
-			return nil, nil //nolint:nilnil
+		// Don't just rely on the status code, a 404 could have many causes (e.g. load balancer has briefly no backend)
+		// So we additionally match the exact response body.
+		// This might break in future versions of Consul, but at least it's safe.
+		if !errors.As(err, &statusError) ||
+			statusError.Code != 404 ||
+			statusError.Body != "Cannot find token to delete" {
+			return err
 		}
-		return nil, err
+		b.Logger().Warn("token to revoke no longer exists", "accessor", accessor)
 	}
 
-	return nil, nil //nolint:nilnil
+	return b.deleteTokenPolicy(ctx, c, maxRetries, accessor, policyID, writeOpts)
+}
+
+// deleteTokenPolicy deletes the policy created from the
+// consul_policy_document of the role for a token, if any
+func (b *backend) deleteTokenPolicy(ctx context.Context, c *api.Client, maxRetries int, accessor, policyID string, writeOpts *api.WriteOptions) error {
+	if policyID == "" {
+		return nil
+	}
+
+	err := b.retry(ctx, maxRetries, "deleting policy", func() error {
+		_, err := c.ACL().PolicyDelete(policyID, writeOpts)
+		return err
+	})
+	if err != nil {
+		statusError := api.StatusError{}
+		if !errors.As(err, &statusError) || statusError.Code != 404 {
+			return fmt.Errorf("failed to delete policy of token: %w", err)
+		}
+		// The policy was deleted out-of-band, which must not leave the
+		// lease unrevocable
+		b.Logger().Warn("policy of revoked token no longer exists", "accessor", accessor, "policy_id", policyID)
+	}
+
+	return nil
 }
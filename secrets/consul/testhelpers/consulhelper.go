@@ -24,6 +24,10 @@ type Config struct {
 	docker.ServiceHostPort
 	Token             string
 	ContainerHTTPAddr string
+
+	// TLSAddress is the address of the HTTPS listener, which is only
+	// enabled by PrepareTLSTestContainer
+	TLSAddress string
 }
 
 func (c *Config) APIConfig() *consulapi.Config {
@@ -58,6 +62,13 @@ func PrepareTestContainer(t *testing.T, version string, isEnterprise bool, doBoo
 // is used by `PrepareTestContainer` which is used typically in tests that rely
 // on Consul but run tested code within the test process.
 func RunContainer(ctx context.Context, namePrefix, version string, isEnterprise bool, doBootstrapSetup bool) (func(), *Config, error) {
+	return runContainer(ctx, namePrefix, version, isEnterprise, doBootstrapSetup, "")
+}
+
+// runContainer runs Consul as described by RunContainer. If tlsDir is set,
+// it must contain the files written by writeTLSFiles and Consul additionally
+// serves HTTPS on port 8501, requiring client certificates.
+func runContainer(ctx context.Context, namePrefix, version string, isEnterprise bool, doBootstrapSetup bool, tlsDir string) (func(), *Config, error) {
 	if retAddress := os.Getenv("CONSUL_HTTP_ADDR"); retAddress != "" {
 		shp, err := docker.NewServiceHostPortParse(retAddress)
 		if err != nil {
@@ -67,6 +78,13 @@ func RunContainer(ctx context.Context, namePrefix, version string, isEnterprise
 	}
 
 	config := `acl { enabled = true default_policy = "deny" }`
+	ports := []string{"8500/tcp"}
+	copyFromTo := map[string]string{}
+	if tlsDir != "" {
+		config += tlsAgentConfig
+		ports = append(ports, "8501/tcp")
+		copyFromTo[tlsDir] = tlsContainerDir
+	}
 	if preset, ok := versionPresets[version]; ok {
 		version = preset
 	}
@@ -106,7 +124,8 @@ func RunContainer(ctx context.Context, namePrefix, version string, isEnterprise
 		ImageTag:      version,
 		Env:           envVars,
 		Cmd:           []string{"agent", "-dev", "-client", "0.0.0.0", "-hcl", config},
-		Ports:         []string{"8500/tcp"},
+		Ports:         ports,
+		CopyFromTo:    copyFromTo,
 		AuthUsername:  os.Getenv("CONSUL_DOCKER_USERNAME"),
 		AuthPassword:  os.Getenv("CONSUL_DOCKER_PASSWORD"),
 	}
@@ -266,6 +285,9 @@ func RunContainer(ctx context.Context, namePrefix, version string, isEnterprise
 		return nil, nil, fmt.Errorf("failed to find any network settings for container")
 	}
 	cfg := svc.Config.(*Config)
+	if tlsDir != "" {
+		cfg.TLSAddress = svc.StartResult.Addrs[1]
+	}
 	for _, eps := range svc.Container.NetworkSettings.Networks {
 		// Just pick the first network, we assume only one for now.
 		// Pull out the real container IP and set that up
@@ -0,0 +1,158 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package consul
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TLSServerName is the name the certificate of the Consul HTTPS listener is
+// issued for
+const TLSServerName = "consul.test"
+
+const tlsContainerDir = "/consul/tls"
+
+// tlsAgentConfig enables the HTTPS listener using the files written by
+// writeTLSFiles
+const tlsAgentConfig = `
+ports { https = 8501 }
+tls {
+	https {
+		ca_file = "` + tlsContainerDir + `/ca.pem"
+		cert_file = "` + tlsContainerDir + `/server.pem"
+		key_file = "` + tlsContainerDir + `/server-key.pem"
+		verify_incoming = true
+	}
+}
+`
+
+// TLSFiles holds the PEM encoded CA certificate that issued the certificate
+// of the Consul HTTPS listener, and a client certificate issued by it
+type TLSFiles struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+}
+
+// PrepareTLSTestContainer is like PrepareTestContainer, but Consul also
+// serves HTTPS at Config.TLSAddress using a certificate issued for
+// TLSServerName. Requests over HTTPS must present the returned client
+// certificate. The TLS configuration requires Consul 1.12 or newer.
+func PrepareTLSTestContainer(t *testing.T, version string) (func(), *Config, *TLSFiles) {
+	t.Helper()
+
+	dir := t.TempDir()
+	files, err := writeTLSFiles(dir)
+	if err != nil {
+		t.Fatalf("failed generating TLS files: %s", err)
+	}
+
+	cleanup, config, err := runContainer(context.Background(), "", version, false, true, dir)
+	if err != nil {
+		t.Fatalf("failed starting consul: %s", err)
+	}
+	if config.TLSAddress == "" {
+		cleanup()
+		t.Skip("CONSUL_HTTP_ADDR is set, skipping test that requires Consul with TLS")
+	}
+	return cleanup, config, files
+}
+
+// writeTLSFiles generates a CA with a server and a client certificate. The
+// CA and server certificate are written to dir for Consul.
+func writeTLSFiles(dir string) (*TLSFiles, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Consul Test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	issue := func(serial int64, template *x509.Certificate) ([]byte, []byte, error) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		template.SerialNumber = big.NewInt(serial)
+		template.NotBefore = caTemplate.NotBefore
+		template.NotAfter = caTemplate.NotAfter
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+	}
+
+	serverCert, serverKey, err := issue(2, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: TLSServerName},
+		DNSNames:    []string{TLSServerName, "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+	clientCert, clientKey, err := issue(3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "openbao"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	// The files must be readable by the consul user of the container
+	if err := os.Chmod(dir, 0o755); err != nil {
+		return nil, err
+	}
+	for name, contents := range map[string][]byte{
+		"ca.pem":         caPEM,
+		"server.pem":     serverCert,
+		"server-key.pem": serverKey,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), contents, 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	return &TLSFiles{
+		CACert:     string(caPEM),
+		ClientCert: string(clientCert),
+		ClientKey:  string(clientKey),
+	}, nil
+}